@@ -23,7 +23,8 @@ import (
 	"image/jpeg"
 	"image/png"
 	"io"
-	"log"
+	"log/slog"
+	"maps"
 	"math"
 	"math/rand"
 	"net"
@@ -32,20 +33,37 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"unicode/utf8"
 
-	"github.com/catsimple/firescrew/pkg/firescrewServe"
 	"github.com/8ff/tuna"
+	"github.com/catsimple/firescrew/pkg/cameraStatus"
+	"github.com/catsimple/firescrew/pkg/configSchema"
+	"github.com/catsimple/firescrew/pkg/eventBus"
+	"github.com/catsimple/firescrew/pkg/eventLifecycle"
+	"github.com/catsimple/firescrew/pkg/faceGallery"
+	"github.com/catsimple/firescrew/pkg/firescrewServe"
+	"github.com/catsimple/firescrew/pkg/inferenceScheduler"
+	"github.com/catsimple/firescrew/pkg/logging"
+	"github.com/catsimple/firescrew/pkg/metrics"
+	"github.com/catsimple/firescrew/pkg/motionDetect"
+	"github.com/catsimple/firescrew/pkg/motionEvents"
+	"github.com/catsimple/firescrew/pkg/sceneHealth"
+	"github.com/catsimple/firescrew/pkg/sharedDetector"
+	"github.com/catsimple/firescrew/pkg/streamWatchdog"
+	"github.com/catsimple/firescrew/pkg/supervisor"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/goki/freetype"
 	"github.com/goki/freetype/truetype"
 
-	ob "github.com/catsimple/firescrew/pkg/objectPredict"
 	"github.com/8ff/prettyTimer"
+	ob "github.com/catsimple/firescrew/pkg/objectPredict"
 	"github.com/hybridgroup/mjpeg"
 )
 
@@ -57,7 +75,39 @@ var gifSlice []image.RGBA
 //go:embed assets/*
 var assetsFs embed.FS
 
-var everyNthFrame = 1         // Process every Nth frame, 1 = every frame
+// Metrics served on /metrics, every series is labelled with the camera name
+var (
+	metricsRegistry   = metrics.NewRegistry()
+	framesReceived    = metricsRegistry.Counter("firescrew_frames_received_total", "Frames decoded from the lo feed", "camera")
+	framesDropped     = metricsRegistry.Counter("firescrew_frames_dropped_total", "Decoded frames replaced by a newer one before the main loop took them", "camera")
+	framesProcessed   = metricsRegistry.Counter("firescrew_frames_processed_total", "Frames the main loop checked for motion", "camera")
+	frameDecodeErrors = metricsRegistry.Counter("firescrew_frame_decode_errors_total", "Frames of the lo feed that could not be decoded", "camera")
+	motionRatio       = metricsRegistry.Gauge("firescrew_motion_ratio", "Fraction of the last frame covered by motion blobs", "camera")
+	inferenceSeconds  = metricsRegistry.Histogram("firescrew_inference_seconds", "Object detection latency", nil, "camera", "backend")
+	eventsStarted     = metricsRegistry.Counter("firescrew_events_started_total", "Motion event clips started, by the class of the first object", "camera", "class")
+	eventsEnded       = metricsRegistry.Counter("firescrew_events_ended_total", "Motion event clips ended, by the class of the first object", "camera", "class")
+	recordingBytes    = metricsRegistry.Counter("firescrew_recording_bytes_written_total", "Bytes written to clips", "camera")
+	recodeSeconds     = metricsRegistry.Histogram("firescrew_recode_seconds", "Duration of successful mp4 recodes", []float64{1, 2.5, 5, 10, 30, 60, 120, 300}, "camera")
+	recodeFailures    = metricsRegistry.Counter("firescrew_recode_failures_total", "Failed mp4 recodes", "camera")
+	eventDeliveries   = metricsRegistry.Counter("firescrew_event_deliveries_total", "Events delivered to the webhook, script, slack and mqtt handlers", "camera", "sink", "result")
+	processRestarts   = metricsRegistry.Counter("firescrew_process_restarts_total", "Restarts of the ffmpeg feeds and the embedded detector", "camera", "process")
+	diskFree          = metricsRegistry.Gauge("firescrew_disk_free_bytes", "Free bytes on the file system of hiResPath", "camera", "path")
+)
+
+// Live state of the camera for the status file, see writeStatus
+var (
+	statusMutex    sync.Mutex
+	status         = cameraStatus.Snapshot{Started: time.Now(), Sinks: map[string]cameraStatus.Sink{}}
+	statusRestarts = map[string]func() int64{} // Restart counters of the lo, hi and detector supervisors
+	statusUsedAt   time.Time                   // Last walk of hiResPath, it is slow on big archives
+)
+
+// statusInterval is how often the status file is written, the web server marks it stale after a few missed writes
+const statusInterval = 5 * time.Second
+
+// daemonBus publishes the events on the bus of the daemon that started this camera, nil when run on its own
+var daemonBus *eventBus.Client
+
 var interenceAvgInterval = 10 // Frames to average inference time over
 
 var stream *mjpeg.Stream
@@ -75,6 +125,7 @@ type Prediction struct {
 }
 
 type Config struct {
+	Version                       int               `json:"version"` // Of the config schema, see configVersion
 	CameraName                    string            `json:"cameraName"`
 	PrintDebug                    bool              `json:"printDebug"`
 	DeviceUrl                     string            `json:"deviceUrl"`
@@ -82,25 +133,59 @@ type Config struct {
 	HiResDeviceUrl                string            `json:"hiResDeviceUrl"`
 	HiStreamParamBypass           StreamParams      `json:"hiStreamParamBypass"`
 	PixelMotionAreaThreshold      float64           `json:"pixelMotionAreaThreshold"`
+	PixelMotion                   PixelMotion       `json:"pixelMotion"`
+	SceneHealth                   SceneHealth       `json:"sceneHealth"`
 	ObjectCenterMovementThreshold float64           `json:"objectCenterMovementThreshold"`
 	ObjectAreaThreshold           float64           `json:"objectAreaThreshold"`
 	StreamDrawIgnoredAreas        bool              `json:"streamDrawIgnoredAreas"`
 	IgnoreAreasClasses            []IgnoreAreaClass `json:"ignoreAreasClasses"`
 	EnableOutputStream            bool              `json:"enableOutputStream"`
 	OutputStreamAddr              string            `json:"outputStreamAddr"`
+	MetricsAddr                   string            `json:"metricsAddr"`            // Serves /metrics on its own, it is also on outputStreamAddr
+	ShutdownTimeoutSeconds        int               `json:"shutdownTimeoutSeconds"` // Time to finish the open event and flush queues on SIGINT/SIGTERM, defaults to 10
+	CoordinateSpace               string            `json:"coordinateSpace"`        // "pixels" (default) or "normalized" 0-1 fractions of the frame
+	RestartBackoff                RestartBackoff    `json:"restartBackoff"`         // Delay before ffmpeg feeds and the detector are restarted
+	StreamWatchdog                StreamWatchdog    `json:"streamWatchdog"`         // Restarts feeds that stalled without ffmpeg exiting
+	Logging                       LoggingConfig     `json:"logging"`                // Log format, levels and file
 	Motion                        struct {
-		OnnxModel                 string   `json:"onnxModel"`
-		OnnxEnableCoreMl          bool     `json:"onnxEnableCoreMl"`
-		EmbeddedObjectScript      string   `json:"EmbeddedObjectScript"`
-		ConfidenceMinThreshold    float64  `json:"confidenceMinThreshold"`
-		LookForClasses            []string `json:"lookForClasses"`
-		NetworkObjectDetectServer string   `json:"networkObjectDetectServer"`
-		EventGap                  int      `json:"eventGap"`
-		PrebufferSeconds          int      `json:"prebufferSeconds"`
-		GenerateGIF               bool     `json:"generateGIF"`     // 控制是否生成GIF
-		EveryNthFrame             int      `json:"everyNthFrame"`   // 控制跳帧检测频率
-		OnnxModelWidth            int      `json:"onnxModelWidth"`  // 新增：模型宽度
-		OnnxModelHeight           int      `json:"onnxModelHeight"` // 新增：模型高度
+		OnnxModel                 string                       `json:"onnxModel"`
+		OnnxEnableCoreMl          bool                         `json:"onnxEnableCoreMl"`
+		EmbeddedObjectScript      string                       `json:"embeddedObjectScript"`
+		ConfidenceMinThreshold    float64                      `json:"confidenceMinThreshold"`
+		LookForClasses            []string                     `json:"lookForClasses"`
+		NetworkObjectDetectServer string                       `json:"networkObjectDetectServer"`
+		EventGap                  int                          `json:"eventGap"`
+		PrebufferSeconds          int                          `json:"prebufferSeconds"`
+		MinObjectSeconds          float64                      `json:"minObjectSeconds"`     // A track has to be seen this long before it starts or extends an event
+		PostRollSeconds           int                          `json:"postRollSeconds"`      // Video kept after the last object, defaults to eventGap
+		MaxEventSeconds           int                          `json:"maxEventSeconds"`      // Longer events are split into several clips, 0 never splits
+		ClassCooldownSeconds      map[string]int               `json:"classCooldownSeconds"` // Per class, "*" for all others. Time after an event before the class starts a new one
+		GenerateGIF               bool                         `json:"generateGIF"`          // 控制是否生成GIF
+		EveryNthFrame             int                          `json:"everyNthFrame"`        // 控制跳帧检测频率, deprecated: converted to detectFps
+		DetectFps                 float64                      `json:"detectFps"`            // Detection rate while something moves or is tracked, also the rate frames are decoded at. Defaults to 5
+		IdleDetectFps             float64                      `json:"idleDetectFps"`        // Detection rate while nothing moves, 0 only detects on pixel motion
+		OnnxModelWidth            int                          `json:"onnxModelWidth"`       // 新增：模型宽度
+		OnnxModelHeight           int                          `json:"onnxModelHeight"`      // 新增：模型高度
+		OnnxSessionPool           int                          `json:"onnxSessionPool"`      // Number of onnx sessions that can infer concurrently
+		OnnxMaxBatch              int                          `json:"onnxMaxBatch"`         // Max images per session run, model must have a dynamic batch axis
+		OnnxEnableCuda            bool                         `json:"onnxEnableCuda"`
+		OnnxCudaDeviceID          int                          `json:"onnxCudaDeviceID"`
+		OnnxProviders             []string                     `json:"onnxProviders"`       // Execution providers tried in order, cpu is always the last resort
+		OnnxProviderOptions       map[string]map[string]string `json:"onnxProviderOptions"` // Per provider onnxruntime settings
+		OnnxLibraryPath           string                       `json:"onnxLibraryPath"`     // Use this onnxruntime library instead of the embedded one
+		OnnxIntraOpThreads        int                          `json:"onnxIntraOpThreads"`
+		OnnxInterOpThreads        int                          `json:"onnxInterOpThreads"`
+		OnnxModelCacheDir         string                       `json:"onnxModelCacheDir"`    // Where models are cached and verified, defaults to the user cache dir
+		DetectionRegion           string                       `json:"detectionRegion"`      // What part of the frame is fed to the model: full, roi, tiled or motion
+		RegionsOfInterest         []RegionOfInterest           `json:"regionsOfInterest"`    // Crops used with detectionRegion roi
+		TileSize                  int                          `json:"tileSize"`             // Tile size in frame pixels for detectionRegion tiled, defaults to the model size
+		TileOverlap               float64                      `json:"tileOverlap"`          // Fraction of a tile overlapping its neighbour
+		TileIncludeFullFrame      bool                         `json:"tileIncludeFullFrame"` // Also run the full frame next to the tiles
+		MotionCropMargin          float64                      `json:"motionCropMargin"`     // Margin added around the changed pixels for detectionRegion motion
+		SecondaryClassifiers      []SecondaryClassifier        `json:"secondaryClassifiers"` // Second stage models run on crops of new objects
+		PlateRecognition          PlateRecognition             `json:"plateRecognition"`
+		FaceRecognition           FaceRecognition              `json:"faceRecognition"`
+		AppearanceEmbedding       AppearanceEmbedding          `json:"appearanceEmbedding"`
 	} `json:"motion"`
 	Video struct {
 		HiResPath     string `json:"hiResPath"`
@@ -112,26 +197,27 @@ type Config struct {
 			Host  string `json:"host"`
 			Port  int    `json:"port"`
 			User  string `json:"user"`
-			Pass  string `json:"pass"`
+			Pass  string `json:"password"`
 			Topic string `json:"topic"`
-		}
+		} `json:"mqtt"`
 		Slack struct {
 			Url string `json:"url"`
-		}
+		} `json:"slack"`
 		ScriptPath string `json:"scriptPath"`
 		Webhook    string `json:"webhookUrl"`
 	} `json:"events"`
 	Notifications struct {
-		EnablePushoverAlerts bool   `json:"enablePushoverAlerts"`
-		PushoverAppToken     string `json:"pushoverAppToken"`
-		PushoverUserKey      string `json:"pushoverUserKey"`
+		EnablePushoverAlerts bool     `json:"enablePushoverAlerts"`
+		PushoverAppToken     string   `json:"pushoverAppToken"`
+		PushoverUserKey      string   `json:"pushoverUserKey"`
+		Attributes           []string `json:"attributes"` // Only notify for events with one of these attributes, e.g. unknown_person. Empty notifies for every event
 	} `json:"notifications"`
 }
 
 type StreamParams struct {
-	Width  int
-	Height int
-	FPS    float64
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	FPS    float64 `json:"fps"`
 }
 
 type InferenceStats struct {
@@ -140,15 +226,13 @@ type InferenceStats struct {
 	Max float64
 }
 
-// TODO ADD MUTEX LOCK
+// RuntimeConfig is set up before the frame loop starts. The motion events are owned by Events and are
+// only reached through it.
 type RuntimeConfig struct {
-	MotionTriggeredLast time.Time `json:"motionTriggredLast"`
-	MotionTriggered     bool      `json:"motionTriggered"`
-	// MotionTriggeredChan chan bool `json:"motionTriggeredChan"`
 	// MotionHiRecOn bool `json:"motionHiRecOn"`
 	HiResControlChannel   chan RecordMsg
-	MotionVideo           VideoMetadata
-	MotionMutex           *sync.Mutex
+	Children              context.Context // Cancelled when shutdown gives up, for ffmpeg runs that may outlive ingest like recodes
+	Events                *motionEvents.Manager[TrackedObject]
 	TextFont              *truetype.Font
 	LoResStreamParams     StreamParams
 	HiResStreamParams     StreamParams
@@ -156,16 +240,217 @@ type RuntimeConfig struct {
 	InferenceTimingBuffer []InferenceStats
 	modelReady            bool
 	ObjectPredictClient   *ob.Client
+	Detector              sharedDetector.Camera // This camera on the shared detector, of this process or of the daemon
+	MotionDetector        *motionDetect.Detector
+	SceneMonitor          *sceneHealth.Monitor
 	CodecName             string
+	FrameGeometry         FrameGeometry
 }
 
 type IgnoreAreaClass struct {
-	Class       []string `json:"class"`
-	Coordinates string   `json:"coordinates"`
-	Top         int      `json:"top"`
-	Bottom      int      `json:"bottom"`
-	Left        int      `json:"left"`
-	Right       int      `json:"right"`
+	Class       []string        `json:"class"`
+	Coordinates string          `json:"coordinates"`
+	Top         float64         `json:"top"`
+	Bottom      float64         `json:"bottom"`
+	Left        float64         `json:"left"`
+	Right       float64         `json:"right"`
+	Rect        image.Rectangle `json:"-"` // Area in frame pixels, resolved from the coordinates once the frame size is known
+}
+
+// PixelMotion tunes the background model that decides when a frame is worth running inference on, see pkg/motionDetect
+type PixelMotion struct {
+	Downscale       int                `json:"downscale"`       // Frame pixels per side of a background cell, defaults to 4
+	BlurRadius      int                `json:"blurRadius"`      // In cells, defaults to 1, -1 disables
+	Threshold       float64            `json:"threshold"`       // Minimum gray level difference to the background, defaults to 25
+	VarianceFactor  float64            `json:"varianceFactor"`  // Standard deviations a cell must also differ by, defaults to 2.5, -1 disables
+	LearningRate    float64            `json:"learningRate"`    // Background adaptation per frame, defaults to 0.02
+	MinBlobArea     float64            `json:"minBlobArea"`     // Smaller blobs are ignored, pixels or a fraction of the frame area with coordinateSpace normalized
+	MaxChangedRatio float64            `json:"maxChangedRatio"` // Larger changes (IR switchover) reset the background, defaults to 0.6
+	Masks           []RegionOfInterest `json:"masks"`           // Areas that never trigger motion, coordinates like ignore areas
+}
+
+// LoggingConfig sets the log output, see logging.Config
+type LoggingConfig struct {
+	Format     string            `json:"format"`     // console (default), text or json
+	Level      string            `json:"level"`      // Defaults to info, or debug with printDebug
+	Levels     map[string]string `json:"levels"`     // Per component: firescrew, objectPredict, serve
+	File       string            `json:"file"`       // Also log to this file, rotated by size
+	MaxSizeMB  int               `json:"maxSizeMB"`  // Defaults to 10
+	MaxBackups int               `json:"maxBackups"` // Defaults to 3
+}
+
+// RestartBackoff is the delay before a failed ffmpeg feed or detector is restarted, it doubles per failure in a row
+type RestartBackoff struct {
+	MinSeconds float64 `json:"minSeconds"` // Defaults to 1
+	MaxSeconds float64 `json:"maxSeconds"` // Defaults to 60
+}
+
+// StreamWatchdog timeouts, 0 uses the default and a negative value disables the check
+type StreamWatchdog struct {
+	NoDataSeconds  float64 `json:"noDataSeconds"`  // No bytes from ffmpeg, lo and hi feed, defaults to 15
+	NoFrameSeconds float64 `json:"noFrameSeconds"` // No decoded frame, lo feed only, defaults to 30
+	FrozenSeconds  float64 `json:"frozenSeconds"`  // Identical frames, lo feed only, defaults to 120
+}
+
+// SceneHealth watches for lighting changes, day/night switchovers and camera tampering, see pkg/sceneHealth
+type SceneHealth struct {
+	Enabled          bool    `json:"enabled"`
+	BrightnessJump   float64 `json:"brightnessJump"`   // Mean gray level change between frames treated as a lighting change, defaults to 40
+	SuppressSeconds  float64 `json:"suppressSeconds"`  // Motion is ignored this long after a lighting change, defaults to 2
+	UniformStdDev    float64 `json:"uniformStdDev"`    // Frames more uniform than this are a covered lens, defaults to 6
+	MovedCorrelation float64 `json:"movedCorrelation"` // Similarity to the learned scene below which the camera was moved, defaults to 0.5
+	DefocusRatio     float64 `json:"defocusRatio"`     // Fraction of the learned sharpness below which the camera is defocused, defaults to 0.4
+	TamperSeconds    float64 `json:"tamperSeconds"`    // How long a tamper condition has to hold before it is reported, defaults to 5
+	RelearnMinutes   float64 `json:"relearnMinutes"`   // A moved camera becomes the new reference after this long, defaults to 5
+	NightChroma      float64 `json:"nightChroma"`      // Mean color saturation below which the picture is IR night mode, defaults to 4
+	ModeSeconds      float64 `json:"modeSeconds"`      // How long a day/night mode has to hold before it is reported, defaults to 10
+}
+
+type RegionOfInterest struct {
+	Coordinates string          `json:"coordinates"` // Top,Bottom,Left,Right like ignore areas
+	Top         float64         `json:"-"`
+	Bottom      float64         `json:"-"`
+	Left        float64         `json:"-"`
+	Right       float64         `json:"-"`
+	Rect        image.Rectangle `json:"-"`
+}
+
+// SecondaryClassifier runs an onnx classification model on the crop of every new object of ParentClasses.
+// The top label is attached to the TrackedObject when it reaches ConfidenceMinThreshold.
+type SecondaryClassifier struct {
+	Name                   string         `json:"name"`
+	ParentClasses          []string       `json:"parentClasses"`
+	Model                  string         `json:"model"`
+	ModelWidth             int            `json:"modelWidth"`
+	ModelHeight            int            `json:"modelHeight"`
+	InputName              string         `json:"inputName"`
+	OutputName             string         `json:"outputName"`
+	Labels                 []string       `json:"labels"`
+	Softmax                bool           `json:"softmax"`
+	Mean                   [3]float32     `json:"mean"`
+	Std                    [3]float32     `json:"std"`
+	ConfidenceMinThreshold float64        `json:"confidenceMinThreshold"`
+	CropMargin             float64        `json:"cropMargin"` // Fraction of the box added on every side before cropping
+	Classifier             *ob.Classifier `json:"-"`
+}
+
+// PlateRecognition reads licence plates of vehicles with a plate detector and an OCR model.
+// Reads of the same track are voted on across frames before the plate is attached to the object.
+type PlateRecognition struct {
+	Enabled            bool            `json:"enabled"`
+	ParentClasses      []string        `json:"parentClasses"` // Defaults to car and truck
+	DetectorModel      string          `json:"detectorModel"`
+	DetectorWidth      int             `json:"detectorWidth"`
+	DetectorHeight     int             `json:"detectorHeight"`
+	DetectorConfidence float64         `json:"detectorConfidence"`
+	OcrModel           string          `json:"ocrModel"`
+	OcrWidth           int             `json:"ocrWidth"`
+	OcrHeight          int             `json:"ocrHeight"`
+	OcrInputName       string          `json:"ocrInputName"`
+	OcrOutputName      string          `json:"ocrOutputName"`
+	Alphabet           string          `json:"alphabet"`
+	Length             int             `json:"length"`
+	Ctc                bool            `json:"ctc"`
+	PadChar            string          `json:"padChar"`
+	Softmax            bool            `json:"softmax"`
+	MinConfidence      float64         `json:"minConfidence"`    // Reads below this dont vote
+	MinVotes           int             `json:"minVotes"`         // Votes the winning text needs before the plate is accepted, defaults to 3
+	MaxReadsPerTrack   int             `json:"maxReadsPerTrack"` // OCR runs per tracked vehicle, defaults to 10
+	AllowList          []string        `json:"allowList"`
+	DenyList           []string        `json:"denyList"`
+	MaxListDistance    int             `json:"maxListDistance"` // Characters that may differ from a list entry, e.g. 1 to tolerate a single misread
+	Reader             *ob.PlateReader `json:"-"`
+}
+
+// FaceRecognition detects faces on person crops and matches their embeddings against the enrolled gallery.
+// The gallery is managed through the web server and shared on disk, see pkg/faceGallery.
+type FaceRecognition struct {
+	Enabled            bool                 `json:"enabled"`
+	DetectorModel      string               `json:"detectorModel"`
+	DetectorWidth      int                  `json:"detectorWidth"`
+	DetectorHeight     int                  `json:"detectorHeight"`
+	DetectorConfidence float64              `json:"detectorConfidence"`
+	DetectorRows       int                  `json:"detectorRows"` // 5 for box+score outputs, 20 for models with 5 keypoints
+	EmbedderModel      string               `json:"embedderModel"`
+	EmbedderWidth      int                  `json:"embedderWidth"`
+	EmbedderHeight     int                  `json:"embedderHeight"`
+	EmbedderInputName  string               `json:"embedderInputName"`
+	EmbedderOutputName string               `json:"embedderOutputName"`
+	EmbeddingSize      int                  `json:"embeddingSize"`
+	Mean               [3]float32           `json:"mean"`
+	Std                [3]float32           `json:"std"`
+	MatchThreshold     float64              `json:"matchThreshold"`  // Minimum cosine similarity to a gallery photo, defaults to 0.45
+	MaxRunsPerTrack    int                  `json:"maxRunsPerTrack"` // Face runs per tracked person until one matches, defaults to 5
+	GalleryPath        string               `json:"galleryPath"`     // Defaults to <hiResPath>/faces, the web server started with this config manages it
+	Recognizer         *ob.FaceRecognizer   `json:"-"`
+	Gallery            *faceGallery.Gallery `json:"-"`
+}
+
+// AppearanceEmbedding computes a re-identification embedding per track. The embeddings are stored with the
+// event metadata, the web server uses them to find other events where the same object appeared.
+type AppearanceEmbedding struct {
+	Enabled         bool          `json:"enabled"`
+	Model           string        `json:"model"`
+	ModelWidth      int           `json:"modelWidth"`
+	ModelHeight     int           `json:"modelHeight"`
+	InputName       string        `json:"inputName"`
+	OutputName      string        `json:"outputName"`
+	EmbeddingSize   int           `json:"embeddingSize"`
+	Mean            [3]float32    `json:"mean"`
+	Std             [3]float32    `json:"std"`
+	Classes         []string      `json:"classes"`         // Detector classes to embed, empty embeds every class
+	SamplesPerTrack int           `json:"samplesPerTrack"` // Crops averaged per track, defaults to 3
+	CropMargin      float64       `json:"cropMargin"`      // Fraction of the box added on every side before cropping
+	Embedder        *ob.CropModel `json:"-"`
+}
+
+// appearanceTrack accumulates the embeddings of one track
+type appearanceTrack struct {
+	Sum        []float32
+	Samples    int
+	LastSample time.Time
+	LastSeen   time.Time
+}
+
+var appearanceTracks = map[string]*appearanceTrack{}
+
+// faceTrack holds the face results of one tracked person
+type faceTrack struct {
+	Runs       int
+	LastSeen   time.Time
+	Person     string // Name of the matched person
+	Similarity float32
+	FaceSeen   bool
+	Identity   string // Identity last reported to the event
+}
+
+var faceTracks = map[string]*faceTrack{}
+
+var faceEntries []faceGallery.Entry // Enrolled embeddings, swapped by watchFaceGallery
+var faceEntriesMutex sync.RWMutex
+
+// plateTrack holds the votes of one tracked vehicle
+type plateTrack struct {
+	Votes    *ob.PlateVotes
+	LastSeen time.Time
+	Plate    string // Accepted plate, set once MinVotes is reached
+}
+
+var plateTracks = map[string]*plateTrack{}
+
+// ObjectLabel is the result of a secondary classifier attached to a TrackedObject
+type ObjectLabel struct {
+	Classifier string
+	Label      string
+	Confidence float32
+}
+
+// FrameGeometry holds the config values that depend on the frame size, resolved to frame pixels.
+// Detections, ignore areas, tracking and snapshots all work in the pixel space of the detection frame.
+type FrameGeometry struct {
+	Size                          image.Point
+	ObjectCenterMovementThreshold float64
+	ObjectAreaThreshold           float64
 }
 
 type ControlCommand struct {
@@ -180,17 +465,28 @@ type TrackedObject struct {
 	LastMoved  time.Time
 	Class      string
 	Confidence float32
+	Labels     []ObjectLabel `json:",omitempty"`
+	ID         string        `json:",omitempty"` // Track id, kept while the object is matched across frames
+	Plate      string        `json:",omitempty"`
+	PlateConf  float32       `json:",omitempty"`
+	Identity   string        `json:",omitempty"` // known_person or unknown_person once a face was seen
+	Person     string        `json:",omitempty"` // Name of the enrolled person the face matched
+	FaceMatch  float32       `json:",omitempty"` // Cosine similarity of the match
+	Embedding  []float32     `json:",omitempty"` // L2 normalized appearance embedding of the track
 }
 
 type VideoMetadata struct {
-	ID           string
-	MotionStart  time.Time
-	MotionEnd    time.Time
-	Objects      []TrackedObject
-	RecodedToMp4 bool
-	Snapshots    []string
-	VideoFile    string
-	CameraName   string
+	Attributes    []string `json:",omitempty"` // Event wide attributes like known_person/unknown_person
+	notified      bool     // Pushover motion notification sent for this event
+	ID            string
+	MotionStart   time.Time
+	MotionEnd     time.Time
+	Objects       []TrackedObject
+	RecodedToMp4  bool
+	Snapshots     []string
+	VideoFile     string
+	CameraName    string
+	ContinuedFrom string `json:",omitempty"` // Previous clip of the same event, split at maxEventSeconds
 }
 
 type Event struct {
@@ -213,7 +509,7 @@ var lastPositions = []TrackedObject{}
 var globalConfig Config
 var runtimeConfig RuntimeConfig
 
-var predictFrameCounter int
+var inferenceStatsMutex sync.Mutex
 
 type Frame struct {
 	Data [][]byte
@@ -222,9 +518,6 @@ type Frame struct {
 
 type FrameMsg struct {
 	Frame image.Image
-	Error string
-	// Exited   bool
-	ExitCode int
 }
 
 type StreamInfo struct {
@@ -240,93 +533,516 @@ type StreamInfo struct {
 // RecordMsg struct to control recording
 type RecordMsg struct {
 	Record   bool
-	Filename string
+	Filename string    // A different file while recording continues the recording in the new file
+	Until    time.Time // Stream after this is not written, a later message can extend it. Zero records until stopped
 }
 
-func readConfig(path string) Config {
-	// Read the configuration file.
-	configFile, err := os.ReadFile(path)
+// configVersion is the version of the config schema this build reads, configs without a version are version 1.
+// Raise it when a change to the config needs old configs to be migrated.
+const configVersion = 1
+
+// renamedConfigFields are keys of version 1 configs that were renamed, decodeConfig moves them to their new name
+// with a deprecation warning
+var renamedConfigFields = configSchema.Renamed{"events.mqtt.pass": "password"}
+
+// configEnvPrefix prefixes the environment variables that override fields of the camera config, e.g.
+// FIRESCREW_MOTION_ONNX_MODEL. The variables of the daemon share the prefix and are skipped.
+const configEnvPrefix = "FIRESCREW_"
+
+// decodeConfig parses a camera config read from name. YAML and TOML are told apart from JSON by the extension, renamed
+// keys are migrated, then secret files and FIRESCREW_* variables are applied and the result is parsed with
+// parseConfig. The secrets of the config are redacted from the log from then on, even when it has errors. The
+// warnings are for the caller to show, they do not stop the config from being used.
+func decodeConfig(name string, data []byte) (Config, []string, configSchema.Errors) {
+	data, err := configSchema.ToJSON(name, data)
 	if err != nil {
-		Log("error", fmt.Sprintf("Error reading config file: %v", err))
-		os.Exit(1)
+		return Config{}, nil, configSchema.Errors{{Message: err.Error()}}
+	}
+	data, warnings, migrateErrs := configSchema.Migrate(data, renamedConfigFields)
+
+	var environ []string
+	for _, entry := range os.Environ() {
+		if !strings.HasPrefix(entry, "FIRESCREW_DAEMON_") {
+			environ = append(environ, entry)
+		}
+	}
+	data, secrets, errs := configSchema.Resolve(data, &Config{}, configEnvPrefix, environ)
+	logging.Redact(secrets...)
+
+	config, parseErrs := parseConfig(data)
+	logging.Redact(configSecrets(config)...)
+	return config, warnings, append(append(migrateErrs, errs...), parseErrs...)
+}
+
+// configSecrets returns the values of config that must not show up in the log or the status
+func configSecrets(config Config) []string {
+	secrets := []string{
+		config.Notifications.PushoverAppToken,
+		config.Notifications.PushoverUserKey,
+		config.Events.Mqtt.Pass,
+		config.Events.Slack.Url, // The path of a Slack webhook is its credential
+	}
+	for _, raw := range []string{config.DeviceUrl, config.HiResDeviceUrl, config.Events.Webhook} {
+		secrets = append(secrets, cameraStatus.URLSecrets(raw)...)
+	}
+	return secrets
+}
+
+// redactedConfig returns config with its secrets replaced, for printing it
+func redactedConfig(config Config) Config {
+	for _, secret := range []*string{&config.Notifications.PushoverAppToken, &config.Notifications.PushoverUserKey, &config.Events.Mqtt.Pass, &config.Events.Slack.Url} {
+		if *secret != "" {
+			*secret = logging.Redacted
+		}
 	}
+	config.DeviceUrl = cameraStatus.RedactURL(config.DeviceUrl)
+	config.HiResDeviceUrl = cameraStatus.RedactURL(config.HiResDeviceUrl)
+	config.Events.Webhook = cameraStatus.RedactURL(config.Events.Webhook)
+	return config
+}
 
-	// Parse the configuration file into a Config struct.
+// parseConfig decodes a camera config, checks it and applies the defaults. It returns every problem it finds, each
+// with the JSON path of the offending value, instead of stopping at the first.
+func parseConfig(data []byte) (Config, configSchema.Errors) {
 	var config Config
-	err = json.Unmarshal(configFile, &config)
-	if err != nil {
-		Log("error", fmt.Sprintf("Error parsing config file: %v", err))
-		os.Exit(1)
+	errs := configSchema.Check(data, &config, renamedConfigFields)
+	for _, err := range errs {
+		if err.Path == "" {
+			return config, errs // Not a JSON object, there is nothing to check further
+		}
+	}
+	// Values of the wrong type were reported and are left empty, the checks below still find the other problems
+	if err := json.Unmarshal(data, &config); err != nil && len(errs) == 0 {
+		errs.Add("", "%v", err)
+	}
+
+	reported := map[string]bool{}
+	for _, err := range errs {
+		reported[err.Path] = true
+	}
+	for _, err := range normalizeConfig(&config) {
+		if !reported[err.Path] {
+			errs = append(errs, err)
+		}
+	}
+	return config, errs
+}
+
+// normalizeConfig checks the values of config that the schema cannot express and fills in the defaults
+func normalizeConfig(config *Config) configSchema.Errors {
+	var errs configSchema.Errors
+
+	switch {
+	case config.Version == 0:
+		config.Version = configVersion
+	case config.Version < 0 || config.Version > configVersion:
+		errs.Add("version", "unsupported version %d, this firescrew reads configs up to version %d", config.Version, configVersion)
+	}
+
+	if config.ShutdownTimeoutSeconds < 0 {
+		errs.Add("shutdownTimeoutSeconds", "must not be negative")
+	}
+	if config.ShutdownTimeoutSeconds == 0 {
+		config.ShutdownTimeoutSeconds = 10
+	}
+
+	if config.Logging.Level == "" && config.PrintDebug {
+		config.Logging.Level = "debug"
+	}
+	switch config.Logging.Format {
+	case "", "console", "text", "json":
+	default:
+		errs.Add("logging.format", "must be one of console, text or json")
+	}
+	if _, err := logging.ParseLevel(config.Logging.Level, slog.LevelInfo); err != nil {
+		errs.Add("logging.level", "%v", err)
+	}
+	for component, level := range config.Logging.Levels {
+		if _, err := logging.ParseLevel(level, slog.LevelInfo); err != nil {
+			errs.Add(configSchema.Field("logging.levels", component), "%v", err)
+		}
+	}
+
+	if config.Logging.MaxSizeMB <= 0 {
+		config.Logging.MaxSizeMB = 10
+	}
+	if config.Logging.MaxBackups <= 0 {
+		config.Logging.MaxBackups = 3
+	}
+
+	if config.RestartBackoff.MinSeconds < 0 || config.RestartBackoff.MaxSeconds < 0 {
+		errs.Add("restartBackoff", "seconds must not be negative")
 	}
+	if config.RestartBackoff.MinSeconds == 0 {
+		config.RestartBackoff.MinSeconds = 1
+	}
+	if config.RestartBackoff.MaxSeconds == 0 {
+		config.RestartBackoff.MaxSeconds = max(60, config.RestartBackoff.MinSeconds)
+	}
+	if config.RestartBackoff.MaxSeconds < config.RestartBackoff.MinSeconds {
+		errs.Add("restartBackoff.maxSeconds", "must not be less than minSeconds")
+	}
+
+	// Negative values disable a watchdog check
+	if config.StreamWatchdog.NoDataSeconds == 0 {
+		config.StreamWatchdog.NoDataSeconds = 15
+	}
+	if config.StreamWatchdog.NoFrameSeconds == 0 {
+		config.StreamWatchdog.NoFrameSeconds = 30
+	}
+	if config.StreamWatchdog.FrozenSeconds == 0 {
+		config.StreamWatchdog.FrozenSeconds = 120
+	}
+
+	// The same defaults as motionDetect.New and sceneHealth.New, so the normalized config shows what is used
+	pixelMotion := &config.PixelMotion
+	if pixelMotion.Downscale <= 0 {
+		pixelMotion.Downscale = 4
+	}
+	if pixelMotion.BlurRadius == 0 {
+		pixelMotion.BlurRadius = 1
+	}
+	if pixelMotion.Threshold == 0 {
+		pixelMotion.Threshold = 25
+	}
+	if pixelMotion.VarianceFactor == 0 {
+		pixelMotion.VarianceFactor = 2.5
+	}
+	if pixelMotion.LearningRate == 0 {
+		pixelMotion.LearningRate = 0.02
+	}
+	if pixelMotion.MaxChangedRatio == 0 {
+		pixelMotion.MaxChangedRatio = 0.6
+	}
+	scene := &config.SceneHealth
+	if scene.BrightnessJump == 0 {
+		scene.BrightnessJump = 40
+	}
+	if scene.SuppressSeconds == 0 {
+		scene.SuppressSeconds = 2
+	}
+	if scene.UniformStdDev == 0 {
+		scene.UniformStdDev = 6
+	}
+	if scene.MovedCorrelation == 0 {
+		scene.MovedCorrelation = 0.5
+	}
+	if scene.DefocusRatio == 0 {
+		scene.DefocusRatio = 0.4
+	}
+	if scene.TamperSeconds == 0 {
+		scene.TamperSeconds = 5
+	}
+	if scene.RelearnMinutes == 0 {
+		scene.RelearnMinutes = 5
+	}
+	if scene.NightChroma == 0 {
+		scene.NightChroma = 4
+	}
+	if scene.ModeSeconds == 0 {
+		scene.ModeSeconds = 10
+	}
+
+	switch config.CoordinateSpace {
+	case "":
+		config.CoordinateSpace = "pixels"
+	case "pixels", "normalized":
+	default:
+		errs.Add("coordinateSpace", "must be either pixels or normalized")
+	}
+	normalized := config.CoordinateSpace == "normalized"
 
-	// Split the coordinates string into separate integers.
+	// Split the coordinates string into separate numbers.
 	for i, ignoreAreaClass := range config.IgnoreAreasClasses {
-		coords := strings.Split(ignoreAreaClass.Coordinates, ",")
-		if len(coords) == 4 {
-			config.IgnoreAreasClasses[i].Top, err = strconv.Atoi(coords[0])
-			if err != nil {
-				Log("error", fmt.Sprintf("Error parsing config file: %v", err))
-				os.Exit(1)
-			}
-			config.IgnoreAreasClasses[i].Bottom, err = strconv.Atoi(coords[1])
-			if err != nil {
-				Log("error", fmt.Sprintf("Error parsing config file: %v", err))
-				os.Exit(1)
-			}
-			config.IgnoreAreasClasses[i].Left, err = strconv.Atoi(coords[2])
-			if err != nil {
-				Log("error", fmt.Sprintf("Error parsing config file: %v", err))
-				os.Exit(1)
-			}
-			config.IgnoreAreasClasses[i].Right, err = strconv.Atoi(coords[3])
-			if err != nil {
-				Log("error", fmt.Sprintf("Error parsing config file: %v", err))
-				os.Exit(1)
-			}
-		} else {
-			Log("error", fmt.Sprintf("Error parsing config file: %v", errors.New("coordinates string must contain 4 comma separated integers")))
-			os.Exit(1)
+		values, err := parseCoordinates(ignoreAreaClass.Coordinates, normalized)
+		if err != nil {
+			errs.Add(configSchema.Index("ignoreAreasClasses", i)+".coordinates", "%v", err)
+			continue
+		}
+		config.IgnoreAreasClasses[i].Top = values[0]
+		config.IgnoreAreasClasses[i].Bottom = values[1]
+		config.IgnoreAreasClasses[i].Left = values[2]
+		config.IgnoreAreasClasses[i].Right = values[3]
+	}
+
+	motion := &config.Motion
+	switch motion.DetectionRegion {
+	case "":
+		motion.DetectionRegion = "full"
+	case "full", "roi", "tiled", "motion":
+	default:
+		errs.Add("motion.detectionRegion", "must be one of full, roi, tiled or motion")
+	}
+
+	for i, provider := range motion.OnnxProviders {
+		switch provider {
+		case ob.ProviderTensorRT, ob.ProviderCUDA, ob.ProviderOpenVINO, ob.ProviderCoreML, ob.ProviderCPU:
+		default:
+			errs.Add(configSchema.Index("motion.onnxProviders", i), "must be one of tensorrt, cuda, openvino, coreml or cpu")
+		}
+	}
+
+	if motion.DetectionRegion != "full" && motion.OnnxModel == "" {
+		errs.Add("motion.detectionRegion", "other than full requires onnxModel to be set")
+	}
+
+	if motion.DetectionRegion == "roi" && len(motion.RegionsOfInterest) == 0 {
+		errs.Add("motion.regionsOfInterest", "detectionRegion roi requires at least one entry")
+	}
+
+	for i, roi := range motion.RegionsOfInterest {
+		values, err := parseCoordinates(roi.Coordinates, normalized)
+		if err != nil {
+			errs.Add(configSchema.Index("motion.regionsOfInterest", i)+".coordinates", "%v", err)
+			continue
+		}
+		motion.RegionsOfInterest[i].Top = values[0]
+		motion.RegionsOfInterest[i].Bottom = values[1]
+		motion.RegionsOfInterest[i].Left = values[2]
+		motion.RegionsOfInterest[i].Right = values[3]
+	}
+
+	if motion.TileOverlap == 0 {
+		motion.TileOverlap = 0.2
+	}
+
+	for i, mask := range config.PixelMotion.Masks {
+		values, err := parseCoordinates(mask.Coordinates, normalized)
+		if err != nil {
+			errs.Add(configSchema.Index("pixelMotion.masks", i)+".coordinates", "%v", err)
+			continue
+		}
+		config.PixelMotion.Masks[i].Top = values[0]
+		config.PixelMotion.Masks[i].Bottom = values[1]
+		config.PixelMotion.Masks[i].Left = values[2]
+		config.PixelMotion.Masks[i].Right = values[3]
+	}
+
+	if motion.MotionCropMargin == 0 {
+		motion.MotionCropMargin = 0.1
+	}
+
+	if len(motion.SecondaryClassifiers) > 0 && motion.OnnxModel == "" {
+		errs.Add("motion.secondaryClassifiers", "require onnxModel to be set")
+	}
+	for i, classifier := range motion.SecondaryClassifiers {
+		if classifier.Name == "" || classifier.Model == "" || len(classifier.ParentClasses) == 0 || len(classifier.Labels) == 0 {
+			errs.Add(configSchema.Index("motion.secondaryClassifiers", i), "requires name, model, parentClasses and labels")
+		}
+	}
+
+	if motion.PlateRecognition.Enabled {
+		plates := &motion.PlateRecognition
+		if motion.OnnxModel == "" {
+			errs.Add("motion.plateRecognition", "requires onnxModel to be set")
+		}
+		if plates.DetectorModel == "" || plates.OcrModel == "" || plates.Alphabet == "" || plates.Length <= 0 {
+			errs.Add("motion.plateRecognition", "requires detectorModel, ocrModel, alphabet and length")
+		}
+		if len(plates.ParentClasses) == 0 {
+			plates.ParentClasses = []string{"car", "truck"}
+		}
+		if plates.MinVotes <= 0 {
+			plates.MinVotes = 3
+		}
+		if plates.MaxReadsPerTrack <= 0 {
+			plates.MaxReadsPerTrack = 10
+		}
+	}
+
+	if motion.FaceRecognition.Enabled {
+		faces := &motion.FaceRecognition
+		if motion.OnnxModel == "" {
+			errs.Add("motion.faceRecognition", "requires onnxModel to be set")
+		}
+		if faces.DetectorModel == "" || faces.EmbedderModel == "" || faces.EmbeddingSize <= 0 {
+			errs.Add("motion.faceRecognition", "requires detectorModel, embedderModel and embeddingSize")
+		}
+		if faces.MatchThreshold == 0 {
+			faces.MatchThreshold = 0.45
+		}
+		if faces.MaxRunsPerTrack <= 0 {
+			faces.MaxRunsPerTrack = 5
+		}
+		if faces.GalleryPath == "" {
+			faces.GalleryPath = filepath.Join(config.Video.HiResPath, "faces")
+		}
+	}
+
+	if motion.AppearanceEmbedding.Enabled {
+		appearance := &motion.AppearanceEmbedding
+		if motion.OnnxModel == "" {
+			errs.Add("motion.appearanceEmbedding", "requires onnxModel to be set")
+		}
+		if appearance.Model == "" || appearance.EmbeddingSize <= 0 {
+			errs.Add("motion.appearanceEmbedding", "requires model and embeddingSize")
+		}
+		if appearance.SamplesPerTrack <= 0 {
+			appearance.SamplesPerTrack = 3
+		}
+	}
+
+	switch motion.EmbeddedObjectScript {
+	case "objectDetectServerYolo.py", "objectDetectServerCoral.py", "objectDetectServerCoreML.py":
+	case "":
+		// Only the python detector runs it, an onnx model or a network detector does without
+		if motion.OnnxModel == "" && motion.NetworkObjectDetectServer == "" {
+			errs.Add("motion.embeddedObjectScript", "must be set without onnxModel or networkObjectDetectServer")
+		}
+	default:
+		errs.Add("motion.embeddedObjectScript", "must be one of objectDetectServerYolo.py, objectDetectServerCoral.py or objectDetectServerCoreML.py")
+	}
+
+	if motion.DetectFps < 0 {
+		errs.Add("motion.detectFps", "must not be negative")
+	}
+	if motion.IdleDetectFps < 0 {
+		errs.Add("motion.idleDetectFps", "must not be negative")
+	}
+	if motion.IdleDetectFps > motion.DetectFps && motion.DetectFps > 0 {
+		errs.Add("motion.idleDetectFps", "must not be higher than detectFps")
+	}
+
+	if motion.MinObjectSeconds < 0 {
+		errs.Add("motion.minObjectSeconds", "must not be negative")
+	}
+	if motion.PostRollSeconds < 0 {
+		errs.Add("motion.postRollSeconds", "must not be negative")
+	}
+	if motion.MaxEventSeconds < 0 {
+		errs.Add("motion.maxEventSeconds", "must not be negative")
+	}
+	if motion.MaxEventSeconds > 0 && motion.MaxEventSeconds <= max(motion.EventGap, motion.PostRollSeconds) {
+		errs.Add("motion.maxEventSeconds", "must be longer than eventGap and postRollSeconds")
+	}
+	var negative []string
+	for class, seconds := range motion.ClassCooldownSeconds {
+		if seconds < 0 {
+			negative = append(negative, class)
+		}
+	}
+	slices.Sort(negative)
+	for _, class := range negative {
+		errs.Add(configSchema.Field("motion.classCooldownSeconds", class), "must not be negative")
+	}
+
+	// Check if pushover tokens are provided if enabled
+	if config.Notifications.EnablePushoverAlerts {
+		if config.Notifications.PushoverAppToken == "" {
+			errs.Add("notifications.pushoverAppToken", "must be set with enablePushoverAlerts")
+		}
+		if config.Notifications.PushoverUserKey == "" {
+			errs.Add("notifications.pushoverUserKey", "must be set with enablePushoverAlerts")
 		}
 	}
 
-	if config.Motion.EmbeddedObjectScript == "" {
-		Log("error", fmt.Sprintf("Error parsing config file: %v", errors.New("embeddedObjectScript must be set")))
+	return errs
+}
+
+func readConfig(path string) Config {
+	// Read the configuration file.
+	configFile, err := os.ReadFile(path)
+	if err != nil {
+		Log("error", fmt.Sprintf("Error reading config file: %v", err))
 		os.Exit(1)
 	}
 
-	if config.Motion.EmbeddedObjectScript != "objectDetectServerYolo.py" && config.Motion.EmbeddedObjectScript != "objectDetectServerCoral.py" && config.Motion.EmbeddedObjectScript != "objectDetectServerCoreML.py" {
-		Log("error", fmt.Sprintf("Error parsing config file: %v", errors.New("embeddedObjectScript must be either objectDetectServerYolo.py or objectDetectServerCoral.py")))
+	// Parse the configuration file into a Config struct, reporting every problem before giving up.
+	config, warnings, errs := decodeConfig(path, configFile)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			Log("error", fmt.Sprintf("Error parsing config file: %v", err))
+		}
 		os.Exit(1)
 	}
 
-	if config.Motion.EveryNthFrame > 0 {
-		everyNthFrame = config.Motion.EveryNthFrame
-	} else {
-		// 默认值，防止配置文件未设置或设置为0
-		everyNthFrame = 1
+	err = logging.Setup(logging.Config{
+		Format:     config.Logging.Format,
+		Level:      config.Logging.Level,
+		Levels:     config.Logging.Levels,
+		File:       config.Logging.File,
+		MaxSizeMB:  config.Logging.MaxSizeMB,
+		MaxBackups: config.Logging.MaxBackups,
+	})
+	if err != nil {
+		Log("error", fmt.Sprintf("Error parsing config file: logging: %v", err))
+		os.Exit(1)
+	}
+	logger = logging.For("firescrew").With("camera", config.CameraName)
+	slog.SetDefault(logger)
+	for _, warning := range warnings {
+		Log("warning", fmt.Sprintf("Config file: %s", warning))
 	}
 
 	// Print the configuration properties.
 	Log("info", "******************** CONFIG ********************")
+	Log("info", fmt.Sprintf("Config Version: %d", config.Version))
 	Log("info", fmt.Sprintf("Print Debug: %t", config.PrintDebug))
-	Log("info", fmt.Sprintf("Device URL: %s", config.DeviceUrl))
+	Log("info", fmt.Sprintf("Logging: format %q level %q file %q", config.Logging.Format, config.Logging.Level, config.Logging.File))
+	Log("info", fmt.Sprintf("Device URL: %s", cameraStatus.RedactURL(config.DeviceUrl)))
 	Log("info", fmt.Sprintf("Lo-Res Param Bypass: Res: %dx%d FPS: %.2f", config.LoStreamParamBypass.Width, config.LoStreamParamBypass.Height, config.LoStreamParamBypass.FPS))
 	Log("info", fmt.Sprintf("Hi-Res Param Bypass: Res: %dx%d FPS: %.2f", config.HiStreamParamBypass.Width, config.HiStreamParamBypass.Height, config.HiStreamParamBypass.FPS))
-	Log("info", fmt.Sprintf("Hi-Res Device URL: %s", config.HiResDeviceUrl))
+	Log("info", fmt.Sprintf("Hi-Res Device URL: %s", cameraStatus.RedactURL(config.HiResDeviceUrl)))
 	Log("info", fmt.Sprintf("Video HiResPath: %s", config.Video.HiResPath))
 	Log("info", fmt.Sprintf("Video RecodeTsToMp4: %t", config.Video.RecodeTsToMp4))
 	Log("info", fmt.Sprintf("Video OnlyRemuxMp4: %t", config.Video.OnlyRemuxMp4))
+	Log("info", fmt.Sprintf("Notifications Attributes: %v", config.Notifications.Attributes))
 	Log("info", fmt.Sprintf("Motion OnnxModel: %s", config.Motion.OnnxModel))
 	Log("info", fmt.Sprintf("Motion OnnxEnableCoreMl: %t", config.Motion.OnnxEnableCoreMl))
+	Log("info", fmt.Sprintf("Motion OnnxSessionPool: %d", config.Motion.OnnxSessionPool))
+	Log("info", fmt.Sprintf("Motion OnnxMaxBatch: %d", config.Motion.OnnxMaxBatch))
+	Log("info", fmt.Sprintf("Motion OnnxEnableCuda: %t", config.Motion.OnnxEnableCuda))
+	Log("info", fmt.Sprintf("Motion OnnxCudaDeviceID: %d", config.Motion.OnnxCudaDeviceID))
+	Log("info", fmt.Sprintf("Motion OnnxProviders: %v", config.Motion.OnnxProviders))
+	for provider, options := range config.Motion.OnnxProviderOptions {
+		Log("info", fmt.Sprintf("  Provider Options %s: %v", provider, options))
+	}
+	Log("info", fmt.Sprintf("Motion OnnxLibraryPath: %s", config.Motion.OnnxLibraryPath))
+	Log("info", fmt.Sprintf("Motion OnnxModelCacheDir: %s", config.Motion.OnnxModelCacheDir))
+	Log("info", fmt.Sprintf("Motion OnnxThreads: Intra: %d Inter: %d", config.Motion.OnnxIntraOpThreads, config.Motion.OnnxInterOpThreads))
+	for _, classifier := range config.Motion.SecondaryClassifiers {
+		Log("info", fmt.Sprintf("Motion SecondaryClassifier: %s Model: %s Parents: %v Labels: %v Threshold: %.2f", classifier.Name, classifier.Model, classifier.ParentClasses, classifier.Labels, classifier.ConfidenceMinThreshold))
+	}
+	if config.Motion.PlateRecognition.Enabled {
+		plates := config.Motion.PlateRecognition
+		Log("info", fmt.Sprintf("Motion PlateRecognition: Detector: %s OCR: %s Parents: %v MinVotes: %d MaxReads: %d", plates.DetectorModel, plates.OcrModel, plates.ParentClasses, plates.MinVotes, plates.MaxReadsPerTrack))
+		Log("info", fmt.Sprintf("  Allow List: %v Deny List: %v Max Distance: %d", plates.AllowList, plates.DenyList, plates.MaxListDistance))
+	}
+	if config.Motion.FaceRecognition.Enabled {
+		faces := config.Motion.FaceRecognition
+		Log("info", fmt.Sprintf("Motion FaceRecognition: Detector: %s Embedder: %s Threshold: %.2f MaxRuns: %d Gallery: %s", faces.DetectorModel, faces.EmbedderModel, faces.MatchThreshold, faces.MaxRunsPerTrack, faces.GalleryPath))
+	}
+	if config.Motion.AppearanceEmbedding.Enabled {
+		appearance := config.Motion.AppearanceEmbedding
+		Log("info", fmt.Sprintf("Motion AppearanceEmbedding: Model: %s Size: %d Classes: %v Samples: %d", appearance.Model, appearance.EmbeddingSize, appearance.Classes, appearance.SamplesPerTrack))
+	}
+	Log("info", fmt.Sprintf("Motion DetectionRegion: %s", config.Motion.DetectionRegion))
+	switch config.Motion.DetectionRegion {
+	case "roi":
+		for _, roi := range config.Motion.RegionsOfInterest {
+			Log("info", fmt.Sprintf("  Region Of Interest: %s", roi.Coordinates))
+		}
+	case "tiled":
+		Log("info", fmt.Sprintf("  Tile Size: %d Overlap: %.2f Include Full Frame: %t", config.Motion.TileSize, config.Motion.TileOverlap, config.Motion.TileIncludeFullFrame))
+	case "motion":
+		Log("info", fmt.Sprintf("  Motion Crop Margin: %.2f", config.Motion.MotionCropMargin))
+	}
 	Log("info", fmt.Sprintf("Motion Embedded Object Script: %s", config.Motion.EmbeddedObjectScript))
 	Log("info", fmt.Sprintf("Motion Object Min Threshold: %f", config.Motion.ConfidenceMinThreshold))
 	Log("info", fmt.Sprintf("Motion LookForClasses: %v", config.Motion.LookForClasses))
 	Log("info", fmt.Sprintf("Motion Network Object Detect Server: %s", config.Motion.NetworkObjectDetectServer))
 	Log("info", fmt.Sprintf("Motion PrebufferSeconds: %d", config.Motion.PrebufferSeconds))
 	Log("info", fmt.Sprintf("Motion EventGap: %d", config.Motion.EventGap))
-	Log("info", fmt.Sprintf("Motion EveryNthFrame: %d", everyNthFrame))
+	Log("info", fmt.Sprintf("Motion MinObjectSeconds: %.2f PostRollSeconds: %d MaxEventSeconds: %d", config.Motion.MinObjectSeconds, config.Motion.PostRollSeconds, config.Motion.MaxEventSeconds))
+	Log("info", fmt.Sprintf("Motion ClassCooldownSeconds: %v", config.Motion.ClassCooldownSeconds))
+	Log("info", fmt.Sprintf("Motion DetectFps: %.2f IdleDetectFps: %.2f", config.Motion.DetectFps, config.Motion.IdleDetectFps))
 	Log("info", fmt.Sprintf("Motion GenerateGIF: %t", config.Motion.GenerateGIF))
+	Log("info", fmt.Sprintf("Coordinate Space: %s", config.CoordinateSpace))
 	Log("info", fmt.Sprintf("Pixel Motion Area Threshold: %f", config.PixelMotionAreaThreshold))
+	Log("info", fmt.Sprintf("Pixel Motion: Downscale: %d Blur: %d Threshold: %.1f Variance Factor: %.1f Learning Rate: %.3f Min Blob Area: %.2f Max Changed Ratio: %.2f", config.PixelMotion.Downscale, config.PixelMotion.BlurRadius, config.PixelMotion.Threshold, config.PixelMotion.VarianceFactor, config.PixelMotion.LearningRate, config.PixelMotion.MinBlobArea, config.PixelMotion.MaxChangedRatio))
+	for _, mask := range config.PixelMotion.Masks {
+		Log("info", fmt.Sprintf("  Motion Mask: %s", mask.Coordinates))
+	}
 	Log("info", fmt.Sprintf("Object Center Movement Threshold: %f", config.ObjectCenterMovementThreshold))
 	Log("info", fmt.Sprintf("Object Area Threshold: %f", config.ObjectAreaThreshold))
 	Log("info", "Ignore Areas Classes:")
@@ -334,15 +1050,20 @@ func readConfig(path string) Config {
 		Log("info", fmt.Sprintf("  Class: %v, Coordinates: %s", ignoreAreaClass.Class, ignoreAreaClass.Coordinates))
 	}
 	Log("info", fmt.Sprintf("Draw Ignored Areas: %t", config.StreamDrawIgnoredAreas))
+	Log("info", fmt.Sprintf("Scene Health: %t", config.SceneHealth.Enabled))
 	Log("info", fmt.Sprintf("Enable Output Stream: %t", config.EnableOutputStream))
 	Log("info", fmt.Sprintf("Output Stream Address: %s", config.OutputStreamAddr))
+	Log("info", fmt.Sprintf("Metrics Address: %s", config.MetricsAddr))
+	Log("info", fmt.Sprintf("Shutdown Timeout Seconds: %d", config.ShutdownTimeoutSeconds))
+	Log("info", fmt.Sprintf("Restart Backoff Seconds: %g-%g", config.RestartBackoff.MinSeconds, config.RestartBackoff.MaxSeconds))
+	Log("info", fmt.Sprintf("Stream Watchdog Seconds: no data %g, no frames %g, frozen %g", config.StreamWatchdog.NoDataSeconds, config.StreamWatchdog.NoFrameSeconds, config.StreamWatchdog.FrozenSeconds))
 	Log("info", "************* EVENTS CONFIG *************")
 	Log("info", fmt.Sprintf("Events MQTT Host: %s", config.Events.Mqtt.Host))
 	Log("info", fmt.Sprintf("Events MQTT Port: %d", config.Events.Mqtt.Port))
 	Log("info", fmt.Sprintf("Events MQTT Topic: %s", config.Events.Mqtt.Topic))
-	Log("info", fmt.Sprintf("Events Slack URL: %s", config.Events.Slack.Url))
+	Log("info", fmt.Sprintf("Events Slack URL: %s", redactedConfig(config).Events.Slack.Url))
 	Log("info", fmt.Sprintf("Events Script Path: %s", config.Events.ScriptPath))
-	Log("info", fmt.Sprintf("Events Webhook URL: %s", config.Events.Webhook))
+	Log("info", fmt.Sprintf("Events Webhook URL: %s", cameraStatus.RedactURL(config.Events.Webhook)))
 	Log("info", "************************************************")
 
 	// Load font into runtime
@@ -360,19 +1081,6 @@ func readConfig(path string) Config {
 
 	runtimeConfig.TextFont = font
 
-	// Check if pushover tokens are provided if enabled
-	if config.Notifications.EnablePushoverAlerts {
-		if config.Notifications.PushoverAppToken == "" {
-			Log("error", fmt.Sprintf("Error parsing config file: %v", errors.New("pushoverAppToken must be set")))
-			os.Exit(1)
-		}
-
-		if config.Notifications.PushoverUserKey == "" {
-			Log("error", fmt.Sprintf("Error parsing config file: %v", errors.New("pushoverUserKey must be set")))
-			os.Exit(1)
-		}
-	}
-
 	return config
 }
 
@@ -380,6 +1088,11 @@ func eventHandler(eventType string, payload []byte) {
 	// Log the event type
 	// Log("event", fmt.Sprintf("Event: %s", eventType))
 
+	// Started by the daemon, the web server gets the events over its bus
+	if daemonBus != nil {
+		daemonBus.Publish(eventBus.Event{Type: eventType, Camera: globalConfig.CameraName, Payload: payload})
+	}
+
 	// Webhook URL
 	if globalConfig.Events.Webhook != "" {
 		resp, err := http.Post(globalConfig.Events.Webhook, "application/json", bytes.NewReader(payload))
@@ -387,7 +1100,11 @@ func eventHandler(eventType string, payload []byte) {
 			Log("error", fmt.Sprintf("Failed to post to webhook: %s", err))
 		} else {
 			defer resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("status %s", resp.Status)
+			}
 		}
+		countDelivery("webhook", err)
 	}
 
 	// Script Path
@@ -396,6 +1113,7 @@ func eventHandler(eventType string, payload []byte) {
 		stdin, err := cmd.StdinPipe()
 		if err != nil {
 			Log("error", fmt.Sprintf("Failed to get stdin pipe: %s", err))
+			countDelivery("script", err)
 			return
 		}
 
@@ -407,9 +1125,11 @@ func eventHandler(eventType string, payload []byte) {
 			}
 		}()
 
-		if err := cmd.Start(); err != nil {
+		err = cmd.Start()
+		if err != nil {
 			Log("error", fmt.Sprintf("Failed to start script: %s", err))
 		}
+		countDelivery("script", err)
 	}
 
 	// Send to Slack
@@ -423,7 +1143,11 @@ func eventHandler(eventType string, payload []byte) {
 			Log("error", fmt.Sprintf("Failed to post to Slack: %s", err))
 		} else {
 			defer resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("status %s", resp.Status)
+			}
 		}
+		countDelivery("slack", err)
 	}
 
 	// Send to MQTT
@@ -432,28 +1156,40 @@ func eventHandler(eventType string, payload []byte) {
 		if err != nil {
 			Log("error", fmt.Sprintf("Failed to send to MQTT: %s", err))
 		}
+		countDelivery("mqtt", err)
 	}
 }
 
-func Log(level, msg string) {
-	switch level {
-	case "info":
-		fmt.Printf("\x1b[32m%s [INFO] %s\x1b[0m\n", time.Now().Format("15:04:05"), msg)
-	case "notice":
-		fmt.Printf("\x1b[35m%s [NOTICE] %s\x1b[0m\n", time.Now().Format("15:04:05"), msg)
-	case "event":
-		fmt.Printf("\x1b[34m%s [EVENT] %s\x1b[0m\n", time.Now().Format("15:04:05"), msg)
-	case "error":
-		fmt.Printf("\x1b[31m%s [ERROR] %s\x1b[0m\n", time.Now().Format("15:04:05"), msg)
-	case "warning":
-		fmt.Printf("\x1b[33m%s [WARNING] %s\x1b[0m\n", time.Now().Format("15:04:05"), msg)
-	case "debug":
-		if globalConfig.PrintDebug {
-			fmt.Printf("\x1b[36m%s [DEBUG] %s\x1b[0m\n", time.Now().Format("15:04:05"), msg)
+// countDelivery counts the outcome of an event delivery to sink
+func countDelivery(sink string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	eventDeliveries.With(globalConfig.CameraName, sink, result).Inc()
+
+	updateStatus(func(s *cameraStatus.Snapshot) {
+		delivery := s.Sinks[sink]
+		if err != nil {
+			delivery.Failure++
+			delivery.LastError, delivery.LastFail = logging.RedactString(err.Error()), time.Now()
+		} else {
+			delivery.Success++
 		}
-	default:
-		fmt.Printf("%s [UNKNOWN] %s\n", time.Now().Format("15:04:05"), msg)
+		s.Sinks[sink] = delivery
+	})
+}
+
+// logger is the logger of the main app, it gets the camera name as a field once the config was read
+var logger = logging.For("firescrew")
+
+// Log logs msg at level: debug, info, event, notice, warning or error
+func Log(level, msg string, fields ...any) {
+	slogLevel, err := logging.ParseLevel(level, slog.LevelInfo)
+	if err != nil {
+		fields = append(fields, "level_name", level)
 	}
+	logger.Log(context.Background(), slogLevel, msg, fields...)
 }
 
 func getStreamInfo(rtspURL string) (StreamInfo, error) {
@@ -536,15 +1272,21 @@ func CheckFFmpegAndFFprobe() (bool, error) {
 }
 
 // 优化：修改了ffmpeg参数以降低CPU占用
-func processRTSPFeed(rtspURL string, msgChannel chan<- FrameMsg) {
-	cmd := exec.Command(
+// Frames are decoded at decodeFps and put into frames, a frame the main loop did not take in time is dropped.
+// The feed is up once the first frame was decoded. ffmpeg is killed when ctx is cancelled or the watchdog finds the
+// stream stalled.
+func processRTSPFeed(ctx context.Context, sup *supervisor.Supervisor, rtspURL string, decodeFps float64, frames *inferenceScheduler.Latest[FrameMsg]) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := sup.Command(ctx,
 		"ffmpeg",
 		"-rtsp_transport", "tcp",
 		"-re",
 		"-i", rtspURL,
 		"-analyzeduration", "1000000",
 		"-probesize", "1000000",
-		"-vf", `select=not(mod(n\,5))`,
+		"-vf", fmt.Sprintf("fps=%g", decodeFps),
 		"-fps_mode", "vfr",
 		"-c:v", "png",
 		"-pred", "0", // 优化：不使用预测，加快速度
@@ -552,37 +1294,53 @@ func processRTSPFeed(rtspURL string, msgChannel chan<- FrameMsg) {
 		"-f", "image2pipe",
 		"-",
 	)
-	stderrBuffer := &bytes.Buffer{}
-	cmd.Stderr = stderrBuffer
 
 	pipe, err := cmd.StdoutPipe()
 	if err != nil {
-		msgChannel <- FrameMsg{Error: err.Error()}
-		return
+		return err
 	}
 	defer pipe.Close()
 
 	err = cmd.Start()
 	if err != nil {
-		msgChannel <- FrameMsg{Error: err.Error()}
-		return
+		return err
 	}
 
 	frameCount := 0
 	frameData := bytes.NewBuffer(nil)
 	isFrameStarted := false
 
-	buffer := make([]byte, 8192) // Buffer size
+	chunks, readErr := readPipe(ctx, pipe, 8192)
+	watchdog := streamWatchdog.New(streamWatchdogConfig(), time.Now())
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+feed:
 	for {
-		n, err := pipe.Read(buffer)
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			msgChannel <- FrameMsg{Error: err.Error()}
-			return
+		var chunk []byte
+		select {
+		case data, ok := <-chunks:
+			if !ok {
+				if err := <-readErr; err != io.EOF {
+					cancel()
+					cmd.Wait()
+					return err
+				}
+				break feed
+			}
+			chunk = data
+		case now := <-ticker.C:
+			if err := watchdog.Check(now); err != nil {
+				streamStalled("lo", err)
+				cancel()
+				cmd.Wait()
+				return err
+			}
+			continue
 		}
+		watchdog.Data(time.Now())
 
-		frameData.Write(buffer[:n])
+		frameData.Write(chunk)
 
 		if bytes.HasPrefix(frameData.Bytes(), []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}) {
 			isFrameStarted = true
@@ -591,9 +1349,13 @@ func processRTSPFeed(rtspURL string, msgChannel chan<- FrameMsg) {
 		if isFrameStarted && bytes.HasSuffix(frameData.Bytes(), []byte{0x49, 0x45, 0x4E, 0x44, 0xAE, 0x42, 0x60, 0x82}) {
 			img, err := png.Decode(bytes.NewReader(frameData.Bytes()))
 			if err != nil {
-				msgChannel <- FrameMsg{Error: "Failed to decode PNG: " + err.Error()}
+				Log("error", "Failed to decode PNG: "+err.Error())
+				frameDecodeErrors.With(globalConfig.CameraName).Inc()
 			} else {
-				msgChannel <- FrameMsg{Frame: img}
+				framesReceived.With(globalConfig.CameraName).Inc()
+				frames.Put(FrameMsg{Frame: img})
+				watchdog.Frame(img, time.Now())
+				sup.Healthy()
 			}
 
 			frameCount++
@@ -613,43 +1375,38 @@ func processRTSPFeed(rtspURL string, msgChannel chan<- FrameMsg) {
 		}
 	}
 
-	err = cmd.Wait()
-	exitCode := 0
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
-				exitCode = status.ExitStatus()
-			}
-		}
-		msgChannel <- FrameMsg{Error: "FFmpeg exited with error: " + err.Error(), ExitCode: exitCode}
-	}
-
-	if stderrBuffer.Len() > 0 {
-		msgChannel <- FrameMsg{Error: "FFmpeg STDERR: " + stderrBuffer.String()}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("ffmpeg exited: %w", err)
 	}
+	return errors.New("ffmpeg ended the stream")
 }
 
-func recordRTSPStream(rtspURL string, controlChannel <-chan RecordMsg, prebufferDuration time.Duration) {
+// recordRTSPStream keeps a prebuffer of the hi res stream and writes clips as told by controlChannel. The feed is up
+// once the first data arrived. When ctx is cancelled ffmpeg is killed and the open clip is closed.
+func recordRTSPStream(ctx context.Context, sup *supervisor.Supervisor, rtspURL string, controlChannel <-chan RecordMsg, prebufferDuration time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var file *os.File
 	recording := false
 
-	cmd := exec.Command("ffmpeg", "-rtsp_transport", "tcp", "-i", rtspURL, "-c", "copy", "-f", "mpegts", "pipe:1")
+	cmd := sup.Command(ctx, "ffmpeg", "-rtsp_transport", "tcp", "-i", rtspURL, "-c", "copy", "-f", "mpegts", "pipe:1")
 	pipe, err := cmd.StdoutPipe()
 	if err != nil {
-		Log("error", fmt.Sprintf("Error creating pipe: %v", err))
-		return
+		return fmt.Errorf("error creating pipe: %w", err)
 	}
 
 	err = cmd.Start()
 	if err != nil {
-		Log("error", fmt.Sprintf("Error starting ffmpeg: %v", err))
-		return
+		return fmt.Errorf("error starting ffmpeg: %w", err)
 	}
 
 	defer func() {
 		if recording && file != nil {
 			file.Close()
+			clipClosed(file.Name())
 		}
+		cancel() // A stalled ffmpeg does not exit by itself
 		cmd.Wait()
 	}()
 
@@ -660,50 +1417,84 @@ func recordRTSPStream(rtspURL string, controlChannel <-chan RecordMsg, prebuffer
 
 	bufferSize := 4096
 	prebuffer := make([]chunkInfo, 0)
-	buffer := make([]byte, bufferSize)
+	// Reads run in the background, control messages are handled while the stream is stalled
+	chunks, readErr := readPipe(ctx, pipe, bufferSize)
+	watchdog := streamWatchdog.New(streamWatchdogConfig(), time.Now())
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var until, lastWritten time.Time // Post-roll end and time of the last chunk written
+
+	// write writes a chunk unless it is past the post-roll, chunks are written in order and only once
+	write := func(chunk chunkInfo) error {
+		if !chunk.Time.After(lastWritten) || (!until.IsZero() && chunk.Time.After(until)) {
+			return nil
+		}
+		if _, err := file.Write(chunk.Data); err != nil {
+			return fmt.Errorf("error writing clip: %w", err)
+		}
+		recordingBytes.With(globalConfig.CameraName).Add(float64(len(chunk.Data)))
+		lastWritten = chunk.Time
+		return nil
+	}
 
 	for {
 		select {
 		case msg := <-controlChannel:
-			if msg.Record && !recording {
-				// 确保文件夹存在 (处理路径中包含的子目录)
-				dir := filepath.Dir(msg.Filename)
-				if _, err := os.Stat(dir); os.IsNotExist(err) {
-					os.MkdirAll(dir, 0755)
+			if msg.Record {
+				if recording && msg.Filename != file.Name() {
+					// Next clip of the same event, it continues where the previous one stopped
+					file.Close()
+					clipClosed(file.Name())
+					recording = false
 				}
+				if !recording {
+					// 确保文件夹存在 (处理路径中包含的子目录)
+					dir := filepath.Dir(msg.Filename)
+					if _, err := os.Stat(dir); os.IsNotExist(err) {
+						os.MkdirAll(dir, 0755)
+					}
 
-				file, err = os.Create(msg.Filename)
-				if err != nil {
-					log.Fatal(err)
-					return
-				}
-				for _, chunk := range prebuffer { // Write prebuffered data
-					_, err := file.Write(chunk.Data)
+					file, err = os.Create(msg.Filename)
 					if err != nil {
-						log.Fatal(err)
-						return
+						return fmt.Errorf("error creating clip: %w", err)
+					}
+					recording = true
+				}
+				// Write prebuffered data, after a pause in the post-roll this catches up on what was missed
+				until = msg.Until
+				for _, chunk := range prebuffer {
+					if err := write(chunk); err != nil {
+						return err
 					}
 				}
-				recording = true
 			} else if !msg.Record && recording {
 				file.Close()
+				clipClosed(file.Name())
 				recording = false
 			}
 
-		default:
-			n, err := pipe.Read(buffer)
-			if err != nil {
+		case now := <-ticker.C:
+			if err := watchdog.Check(now); err != nil {
+				streamStalled("hi", err)
+				return err
+			}
+
+		case chunk, ok := <-chunks:
+			if !ok {
+				err := <-readErr
+				if ctx.Err() != nil {
+					return nil // Stopped on shutdown or by the supervisor
+				}
 				if err == io.EOF {
-					return
+					return errors.New("ffmpeg ended the stream")
 				}
-				log.Fatal(err)
-				return
+				return fmt.Errorf("error reading from ffmpeg: %w", err)
 			}
+			sup.Healthy()
 
 			// Prebuffer handling
-			chunk := make([]byte, n)
-			copy(chunk, buffer[:n])
 			timestamp := time.Now()
+			watchdog.Data(timestamp)
 			prebuffer = append(prebuffer, chunkInfo{Data: chunk, Time: timestamp})
 			// Remove chunks that are older than prebufferDuration
 			for len(prebuffer) > 1 && timestamp.Sub(prebuffer[0].Time) > prebufferDuration {
@@ -711,17 +1502,52 @@ func recordRTSPStream(rtspURL string, controlChannel <-chan RecordMsg, prebuffer
 			}
 
 			if recording && file != nil {
-				_, err := file.Write(buffer[:n])
-				if err != nil {
-					log.Fatal(err)
+				if err := write(prebuffer[len(prebuffer)-1]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// readPipe reads r in the background, so a stalled stream never blocks the caller. The chunks channel is closed
+// after a read error, which is then available on the error channel. Reading stops when ctx is cancelled.
+func readPipe(ctx context.Context, r io.Reader, size int) (<-chan []byte, <-chan error) {
+	chunks := make(chan []byte, 64)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(chunks)
+		for {
+			buffer := make([]byte, size)
+			n, err := r.Read(buffer)
+			if n > 0 {
+				select {
+				case chunks <- buffer[:n]:
+				case <-ctx.Done():
+					readErr <- ctx.Err()
 					return
 				}
 			}
+			if err != nil {
+				readErr <- err
+				return
+			}
 		}
+	}()
+	return chunks, readErr
+}
+
+func streamWatchdogConfig() streamWatchdog.Config {
+	seconds := func(s float64) time.Duration { return time.Duration(s * float64(time.Second)) }
+	return streamWatchdog.Config{
+		NoData:   seconds(globalConfig.StreamWatchdog.NoDataSeconds),
+		NoFrames: seconds(globalConfig.StreamWatchdog.NoFrameSeconds),
+		Frozen:   seconds(globalConfig.StreamWatchdog.FrozenSeconds),
 	}
 }
 
-func recodeToMP4(inputFile string) (string, error) {
+// recodeToMP4 recodes inputFile next to it, ffmpeg is killed when ctx is cancelled
+func recodeToMP4(ctx context.Context, inputFile string) (string, error) {
 	// Check if the input file has a .ts extension
 	if !strings.HasSuffix(inputFile, ".ts") {
 		return "", fmt.Errorf("input file must have a .ts extension. Got: %s", inputFile)
@@ -731,10 +1557,10 @@ func recodeToMP4(inputFile string) (string, error) {
 	outputFile := strings.TrimSuffix(inputFile, ".ts") + ".mp4"
 
 	var cmd *exec.Cmd
-	// Create the FFmpeg command
+	// Create the FFmpeg command, in its own process group like the supervised children
 	if globalConfig.Video.OnlyRemuxMp4 {
 		if runtimeConfig.CodecName == "hevc" {
-			cmd = exec.Command("ffmpeg", "-i", inputFile,
+			cmd = supervisor.Command(ctx, "ffmpeg", "-i", inputFile,
 				"-c:v", "copy",
 				"-c:a", "aac",
 				"-tag:v", "hvc1",
@@ -742,10 +1568,10 @@ func recodeToMP4(inputFile string) (string, error) {
 				"-hls_segment_type", "fmp4",
 				outputFile)
 		} else {
-			cmd = exec.Command("ffmpeg", "-i", inputFile, "-c", "copy", outputFile)
+			cmd = supervisor.Command(ctx, "ffmpeg", "-i", inputFile, "-c", "copy", outputFile)
 		}
 	} else {
-		cmd = exec.Command("ffmpeg", "-i", inputFile, "-c:v", "libx264", "-c:a", "aac", outputFile)
+		cmd = supervisor.Command(ctx, "ffmpeg", "-i", inputFile, "-c:v", "libx264", "-c:a", "aac", outputFile)
 	}
 
 	// Capture the standard output and standard error
@@ -757,211 +1583,997 @@ func recodeToMP4(inputFile string) (string, error) {
 	return outputFile, nil
 }
 
-func main() {
-	ptime := prettyTimer.NewTimingStats()
-	// Check if there is a config file argument, if there isnt give error and exit
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Not enough arguments provided\n")
-		fmt.Println("Usage: firescrew [configfile]")
-		fmt.Println("  -t, --template, t\tPrints the template config to stdout")
-		fmt.Println("  -h, --help, h\t\tPrints this help message")
-		fmt.Println("  -s, --serve, s\tStarts the web server, requires: [path] [addr]")
-		return
+// modelsCommand implements "firescrew models [--cache dir] list|add|verify" and returns the exit code
+func modelsCommand(args []string) int {
+	usage := func() int {
+		fmt.Fprintf(os.Stderr, "Usage: firescrew models [--cache dir] list|add|verify\n")
+		fmt.Fprintf(os.Stderr, "  list\t\t\t\tLists cached and embedded models\n")
+		fmt.Fprintf(os.Stderr, "  add [name] [url|path] [sha256]\tDownloads or copies a model into the cache, sha256 is optional\n")
+		fmt.Fprintf(os.Stderr, "  verify [name]\t\t\tVerifies the sha256 of one or all cached models\n")
+		return 1
 	}
 
-	switch os.Args[1] {
-	case "-t", "--template", "t":
-		// Dump template config to stdout
-		printTemplateFile()
-		return
-	case "-h", "--help", "h":
-		// Print help
-		fmt.Println("Usage: firescrew [configfile]")
-		fmt.Println("  -t, --template, t\tPrints the template config to stdout")
-		fmt.Println("  -h, --help, h\t\tPrints this help message")
-		fmt.Println("  -s, --serve, s\tStarts the web server, requires: [path] [addr]")
-		fmt.Println("  -v, --version, v\tPrints the version")
-		fmt.Println("  -update, --update, update\tUpdates firescrew to the latest version")
-		return
-	case "-s", "--serve", "s":
-		// This requires 2 more params, a path to files and an addr in form :8080
-		// Check if those params are provided if not give help message
-		if len(os.Args) < 4 {
-			fmt.Fprintf(os.Stderr, "Not enough arguments provided\n")
-			fmt.Fprintf(os.Stderr, ("Usage: firescrew -s [path] [addr]\n"))
-			return
-		}
-		err := firescrewServe.Serve(os.Args[2], os.Args[3])
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error starting server: %v\n", err)
-			return
-		}
-		os.Exit(1)
-	case "-v", "--version", "v":
-		// Print version
-		fmt.Println(Version)
-		os.Exit(0)
-	case "-update", "--update", "update":
-		// Determine OS and ARCH
-		osRelease := runtime.GOOS
-		arch := runtime.GOARCH
-
-		// Build URL
-		e := tuna.SelfUpdate(fmt.Sprintf("https://github.com/catsimple/firescrew/releases/download/latest/firescrew.%s.%s", osRelease, arch))
-		if e != nil {
-			fmt.Println(e)
-			os.Exit(1)
-		}
-
-		fmt.Println("Updated!")
-		os.Exit(0)
+	cacheDir := ""
+	if len(args) >= 2 && args[0] == "--cache" {
+		cacheDir = args[1]
+		args = args[2:]
+	}
+	if len(args) < 1 {
+		return usage()
 	}
 
-	// Read the config file
-	globalConfig = readConfig(os.Args[1])
-
-	// Check if ffmpeg/ffprobe binaries are available
-	_, err := CheckFFmpegAndFFprobe()
+	manager, err := ob.NewModelManager(cacheDir)
 	if err != nil {
-		Log("error", fmt.Sprintf("Unable to find ffmpeg/ffprobe binaries. Please install them: %s", err))
-		os.Exit(2)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
 	}
 
-	if globalConfig.LoStreamParamBypass.Width == 0 || globalConfig.LoStreamParamBypass.Height == 0 || globalConfig.LoStreamParamBypass.FPS == 0 {
-		// Print HI/LO stream details
-		hiResStreamInfo, err := getStreamInfo(globalConfig.HiResDeviceUrl)
+	switch args[0] {
+	case "list":
+		list, err := manager.List()
 		if err != nil {
-			Log("error", fmt.Sprintf("Error getting stream info: ffprobe: %v", err))
-			os.Exit(3)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
 		}
-
-		if len(hiResStreamInfo.Streams) == 0 {
-			Log("error", fmt.Sprintf("No HI res streams found at %s", globalConfig.HiResDeviceUrl))
-			os.Exit(3)
+		fmt.Printf("Cache: %s\n", manager.CacheDir)
+		for _, model := range list {
+			if model.SHA256 == "" {
+				fmt.Printf("%-16s %-10s %s\n", model.Name, "-", "embedded, not extracted yet")
+				continue
+			}
+			fmt.Printf("%-16s %-10d %s %s\n", model.Name, model.Size, model.SHA256, model.Source)
 		}
-
-		// Find stream with codec_type: video
-		streamIndex := -1
-		for index, stream := range hiResStreamInfo.Streams {
-			if stream.CodecType == "video" {
-				streamIndex = index
-				runtimeConfig.CodecName = stream.CodecName
-				if globalConfig.Video.OnlyRemuxMp4 {
-					if stream.CodecName != "h264" {
-						Log("warning", fmt.Sprintf("OnlyRemuxMp4 is enabled but the stream codec is not h264 or h265. Your videos may not play in WebUI. Codec: %s", stream.CodecName))
-					}
+	case "add":
+		if len(args) < 3 {
+			return usage()
+		}
+		expected := ""
+		if len(args) > 3 {
+			expected = args[3]
+		}
+		info, err := manager.Add(args[1], args[2], expected)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Added %s (%d bytes) sha256: %s\n", info.Name, info.Size, info.SHA256)
+	case "verify":
+		var names []string
+		if len(args) > 1 {
+			names = args[1:]
+		} else {
+			list, err := manager.List()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			for _, model := range list {
+				if model.SHA256 != "" {
+					names = append(names, model.Name)
 				}
-				break
 			}
 		}
 
-		if streamIndex == -1 {
-			Log("error", fmt.Sprintf("No video stream found at %s", globalConfig.HiResDeviceUrl))
-			os.Exit(3)
+		failed := 0
+		for _, name := range names {
+			if err := manager.Verify(name); err != nil {
+				fmt.Printf("FAIL %v\n", err)
+				failed++
+				continue
+			}
+			fmt.Printf("OK   %s\n", name)
 		}
-
-		runtimeConfig.HiResStreamParams = StreamParams{
-			Width:  hiResStreamInfo.Streams[streamIndex].Width,
-			Height: hiResStreamInfo.Streams[streamIndex].Height,
-			FPS:    hiResStreamInfo.Streams[streamIndex].RFrameRate,
+		if failed > 0 {
+			return 1
 		}
-	} else {
-		runtimeConfig.HiResStreamParams = globalConfig.HiStreamParamBypass
+	default:
+		return usage()
 	}
+	return 0
+}
 
-	if globalConfig.LoStreamParamBypass.Width == 0 || globalConfig.LoStreamParamBypass.Height == 0 || globalConfig.LoStreamParamBypass.FPS == 0 {
-		loResStreamInfo, err := getStreamInfo(globalConfig.DeviceUrl)
-		if err != nil {
-			Log("error", fmt.Sprintf("Error getting stream info: %v", err))
-			os.Exit(3)
+// validateCommand implements "firescrew validate [config]" and returns the exit code. It lists every problem of the
+// camera config, or prints the config as firescrew reads it: with the current version and the defaults filled in.
+func validateCommand(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: firescrew validate [configfile]\n")
+		return 1
+	}
+	configFile, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config file: %v\n", err)
+		return 1
+	}
+	config, warnings, errs := decodeConfig(args[0], configFile)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", args[0], warning)
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], logging.RedactString(err.Error()))
 		}
+		return 1
+	}
+	normalized, err := json.MarshalIndent(redactedConfig(config), "", "    ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error printing config: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(normalized))
+	return 0
+}
 
-		if len(loResStreamInfo.Streams) == 0 {
-			Log("error", fmt.Sprintf("No LO res streams found at %s", globalConfig.DeviceUrl))
-			os.Exit(3)
-		}
+// DaemonConfig is the config of "firescrew daemon", it runs every camera and the web server from one file
+type DaemonConfig struct {
+	Serve struct {
+		Addr string `json:"addr"` // Defaults to :8080
+		Path string `json:"path"` // Defaults to the hiResPath of the first camera
+	} `json:"serve"`
+	RestartBackoff RestartBackoff    `json:"restartBackoff"` // Delay before a camera process that exited is restarted
+	Logging        LoggingConfig     `json:"logging"`        // Log of the daemon, every camera logs with its own config
+	Cameras        []json.RawMessage `json:"cameras"`        // Camera configs, inline or the path of a config file
+}
 
-		// Find stream with codec_type: video
-		streamIndex := -1
-		for index, stream := range loResStreamInfo.Streams {
-			if stream.CodecType == "video" {
-				streamIndex = index
-				break
-			}
-		}
+// daemonCamera is a camera of the daemon config
+type daemonCamera struct {
+	ConfigPath             string
+	CameraName             string
+	ShutdownTimeoutSeconds int
+	Video                  struct {
+		HiResPath string
+	}
+	GalleryPath string     // Of face recognition, empty when it is off
+	Detector    *ob.Config // Onnx settings of the object detector, nil for the python detector
+}
 
-		if streamIndex == -1 {
-			Log("error", fmt.Sprintf("No video stream found at %s", globalConfig.DeviceUrl))
-			os.Exit(3)
-		}
+// Environment of the camera processes started by the daemon, their events are published on its bus and onnx
+// cameras detect on its shared detector
+const (
+	daemonBusEnv      = "FIRESCREW_DAEMON_BUS"
+	daemonTokenEnv    = "FIRESCREW_DAEMON_TOKEN"
+	daemonDetectorEnv = "FIRESCREW_DAEMON_DETECTOR"
+)
 
-		runtimeConfig.LoResStreamParams = StreamParams{
-			Width:  loResStreamInfo.Streams[streamIndex].Width,
-			Height: loResStreamInfo.Streams[streamIndex].Height,
-			FPS:    loResStreamInfo.Streams[streamIndex].RFrameRate,
+// daemonCommand implements "firescrew daemon [config]" and returns the exit code. Every camera runs in a process
+// of its own, supervised and restarted like the ffmpeg feeds, and the web server runs in the daemon. The cameras
+// publish their events on the in-memory bus of the daemon, which the web server reads, and cameras with the same
+// onnx settings share one detector loaded by the daemon.
+func daemonCommand(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: firescrew daemon [configfile]\n")
+		return 1
+	}
+	configFile, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading daemon config: %v\n", err)
+		return 1
+	}
+	if configFile, err = configSchema.ToJSON(args[0], configFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing daemon config: %v\n", err)
+		return 1
+	}
+	var config DaemonConfig
+	if errs := configSchema.Check(configFile, &config, nil); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "Error parsing daemon config: %v\n", err)
 		}
-	} else {
-		runtimeConfig.LoResStreamParams = globalConfig.LoStreamParamBypass
+		return 1
+	}
+	if err := json.Unmarshal(configFile, &config); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing daemon config: %v\n", err)
+		return 1
 	}
+	if err := logging.Setup(logging.Config{
+		Format:     config.Logging.Format,
+		Level:      config.Logging.Level,
+		Levels:     config.Logging.Levels,
+		File:       config.Logging.File,
+		MaxSizeMB:  config.Logging.MaxSizeMB,
+		MaxBackups: config.Logging.MaxBackups,
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing daemon config: logging: %v\n", err)
+		return 1
+	}
+	defer logging.Close()
+	logger = logging.For("daemon")
+	slog.SetDefault(logger)
 
-	// Print stream info from runtimeConfig
-	Log("info", "******************** STREAM INFO ********************")
-	Log("info", fmt.Sprintf("Lo-Res Stream Resolution: %dx%d FPS: %.2f", runtimeConfig.LoResStreamParams.Width, runtimeConfig.LoResStreamParams.Height, runtimeConfig.LoResStreamParams.FPS))
-	Log("info", fmt.Sprintf("Hi-Res Stream Resolution: %dx%d FPS: %.2f", runtimeConfig.HiResStreamParams.Width, runtimeConfig.HiResStreamParams.Height, runtimeConfig.HiResStreamParams.FPS))
-	Log("info", "*****************************************************")
+	cameras, cleanup, err := daemonCameras(filepath.Dir(args[0]), config.Cameras)
+	defer cleanup()
+	if err != nil {
+		Log("error", fmt.Sprintf("Error parsing daemon config: %v", err))
+		return 1
+	}
+	if config.Serve.Addr == "" {
+		config.Serve.Addr = ":8080"
+	}
+	if config.Serve.Path == "" {
+		config.Serve.Path = cameras[0].Video.HiResPath
+	}
+	servePath, _ := filepath.Abs(config.Serve.Path)
+	for _, camera := range cameras {
+		if hiResPath, _ := filepath.Abs(camera.Video.HiResPath); hiResPath != servePath {
+			Log("warning", fmt.Sprintf("Camera %s records to %s, the web server only shows %s", camera.CameraName, camera.Video.HiResPath, config.Serve.Path))
+		}
+	}
+	// The web server manages the gallery of the first camera with face recognition
+	for _, camera := range cameras {
+		if camera.GalleryPath == "" {
+			continue
+		}
+		galleryPath, _ := filepath.Abs(camera.GalleryPath)
+		if firescrewServe.GalleryPath == "" {
+			firescrewServe.GalleryPath = galleryPath
+		} else if galleryPath != firescrewServe.GalleryPath {
+			Log("warning", fmt.Sprintf("Camera %s reads the face gallery %s, the web server only manages %s", camera.CameraName, camera.GalleryPath, firescrewServe.GalleryPath))
+		}
+	}
 
-	// Define motion mutex
-	runtimeConfig.MotionMutex = &sync.Mutex{}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Copy assets to local filesystem
-	path := copyAssetsToTemp()
-	// Start the object detector
+	bus := eventBus.New(500)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		Log("error", fmt.Sprintf("Cannot start the event bus: %v", err))
+		return 1
+	}
+	token := eventBus.NewToken()
+	go bus.Listen(ctx, listener, token)
 
-	if globalConfig.Motion.OnnxModel != "" {
-		var err error
-		Log("info", fmt.Sprintf("Loading ONNX Model: %s", globalConfig.Motion.OnnxModel))
+	firescrewServe.Bus = bus
+	go func() {
+		if err := firescrewServe.Serve(config.Serve.Path, config.Serve.Addr); err != nil {
+			Log("error", fmt.Sprintf("Error starting server: %v", err))
+			stop()
+		}
+	}()
 
-		// === 新增：处理分辨率配置 ===
-		// 获取配置中的宽高
-		mWidth := globalConfig.Motion.OnnxModelWidth
-		mHeight := globalConfig.Motion.OnnxModelHeight
+	executable, err := os.Executable()
+	if err != nil {
+		Log("error", fmt.Sprintf("Cannot find the firescrew executable: %v", err))
+		return 1
+	}
+	env := append(os.Environ(), daemonBusEnv+"="+listener.Addr().String(), daemonTokenEnv+"="+token)
 
-		// 如果配置文件没写(为0)，则设置默认值
-		// 建议默认 640 (标准YOLO)，但如果你导出的模型是 320，请在 config.json 里明确写 320
-		if mWidth == 0 {
-			mWidth = 640
+	detectors, err := startDaemonDetectors(ctx, cameras, token)
+	defer func() {
+		for _, detector := range detectors {
+			if detector.Client != nil {
+				detector.Client.Close() // After the cameras stopped
+			}
 		}
-		if mHeight == 0 {
-			mHeight = 640
+	}()
+	if err != nil {
+		Log("error", fmt.Sprintf("Cannot load the shared detector: %v", err))
+		return 1
+	}
+	go watchDaemonModelReload(args[0], detectors)
+
+	var running sync.WaitGroup
+	for _, camera := range cameras {
+		cameraEnv := env
+		for _, detector := range detectors {
+			if slices.Contains(detector.Cameras, camera.CameraName) {
+				cameraEnv = append(env[:len(env):len(env)], daemonDetectorEnv+"="+detector.Addr)
+			}
 		}
+		running.Add(1)
+		go func(camera daemonCamera, env []string) {
+			defer running.Done()
+			runDaemonCamera(ctx, camera, executable, env, config.RestartBackoff, bus)
+		}(camera, cameraEnv)
+	}
+	Log("notice", fmt.Sprintf("Daemon started %d cameras, web server on %s", len(cameras), config.Serve.Addr))
 
-		Log("info", fmt.Sprintf("Model Resolution set to: %dx%d", mWidth, mHeight))
-
-		// 初始化客户端，传入宽和高
-		runtimeConfig.ObjectPredictClient, err = ob.Init(ob.Config{
-			Model:        globalConfig.Motion.OnnxModel,
-			EnableCoreMl: globalConfig.Motion.OnnxEnableCoreMl,
-			ModelWidth:   mWidth,  // 传入宽度
-			ModelHeight:  mHeight, // 传入高度
-		})
+	<-ctx.Done()
+	Log("notice", "Shutting down, waiting for the cameras")
+	running.Wait()
+	return 0
+}
 
-		if err != nil {
-			fmt.Println("Cannot init model:", err)
-			return
+// daemonCameras reads the cameras of the daemon config. Paths are relative to dir, inline configs are written to
+// temporary files for the camera processes, cleanup removes them.
+func daemonCameras(dir string, raw []json.RawMessage) ([]daemonCamera, func(), error) {
+	var temporary []string
+	cleanup := func() {
+		for _, path := range temporary {
+			os.Remove(path)
 		}
+	}
+	if len(raw) == 0 {
+		return nil, cleanup, errors.New("cameras must list at least one camera")
+	}
 
-		defer runtimeConfig.ObjectPredictClient.Close() // Cleanup files
-
-	} else {
+	cameras := make([]daemonCamera, 0, len(raw))
+	names := map[string]bool{}
+	for i, entry := range raw {
+		var path string
+		if json.Unmarshal(entry, &path) == nil {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, cleanup, fmt.Errorf("cameras[%d]: %w", i, err)
+			}
+			entry = data
+		} else {
+			file, err := os.CreateTemp("", "firescrew-camera-*.json")
+			if err != nil {
+				return nil, cleanup, err
+			}
+			temporary = append(temporary, file.Name())
+			_, err = file.Write(entry)
+			file.Close()
+			if err != nil {
+				return nil, cleanup, err
+			}
+			path = file.Name()
+		}
+		// Report a broken camera config before its process is started over and over. The camera process inherits the
+		// environment, so it reads the same config.
+		config, _, errs := decodeConfig(path, entry) // The camera process logs the warnings
+		if len(errs) > 0 {
+			return nil, cleanup, fmt.Errorf("cameras[%d]: %w", i, errs)
+		}
+		camera := daemonCamera{ConfigPath: path, CameraName: config.CameraName, ShutdownTimeoutSeconds: config.ShutdownTimeoutSeconds}
+		camera.Video.HiResPath = config.Video.HiResPath
+		if config.Motion.FaceRecognition.Enabled {
+			camera.GalleryPath = config.Motion.FaceRecognition.GalleryPath
+		}
+		if config.Motion.OnnxModel != "" {
+			width, height := config.Motion.OnnxModelWidth, config.Motion.OnnxModelHeight
+			if width == 0 {
+				width = 640
+			}
+			if height == 0 {
+				height = 640
+			}
+			detector := objectPredictConfig(config, width, height)
+			camera.Detector = &detector
+		}
+
+		switch {
+		case camera.CameraName == "":
+			return nil, cleanup, fmt.Errorf("cameras[%d]: cameraName must be set", i)
+		case names[camera.CameraName]:
+			return nil, cleanup, fmt.Errorf("cameras[%d]: cameraName %s is used twice", i, camera.CameraName)
+		case camera.Video.HiResPath == "":
+			return nil, cleanup, fmt.Errorf("cameras[%d]: video.hiResPath must be set", i)
+		}
+		names[camera.CameraName] = true
+		cameras = append(cameras, camera)
+	}
+	return cameras, cleanup, nil
+}
+
+// daemonDetector is a detector loaded by the daemon, shared by the cameras with the same onnx settings
+type daemonDetector struct {
+	Config  ob.Config
+	Client  *ob.Client
+	Addr    string // Of the Listen of its sharedDetector.Server
+	Cameras []string
+}
+
+// startDaemonDetectors loads a detector for every distinct onnx setting of the cameras and serves it to their
+// processes on a local port until ctx is done. The detectors are returned even on error, for closing.
+func startDaemonDetectors(ctx context.Context, cameras []daemonCamera, token string) ([]*daemonDetector, error) {
+	var detectors []*daemonDetector
+	byConfig := map[string]*daemonDetector{}
+	for _, camera := range cameras {
+		if camera.Detector == nil {
+			continue
+		}
+		key, err := json.Marshal(camera.Detector)
+		if err != nil {
+			return detectors, err
+		}
+		detector := byConfig[string(key)]
+		if detector == nil {
+			detector = &daemonDetector{Config: *camera.Detector}
+			byConfig[string(key)] = detector
+			detectors = append(detectors, detector)
+		}
+		detector.Cameras = append(detector.Cameras, camera.CameraName)
+	}
+
+	for _, detector := range detectors {
+		Log("info", fmt.Sprintf("Loading ONNX Model %s (%dx%d) for %s", detector.Config.Model, detector.Config.ModelWidth, detector.Config.ModelHeight, strings.Join(detector.Cameras, ", ")))
+		client, err := ob.Init(detector.Config)
+		if err != nil {
+			return detectors, fmt.Errorf("cameras %s: %w", strings.Join(detector.Cameras, ", "), err)
+		}
+		detector.Client = client
+		Log("info", fmt.Sprintf("ONNX execution provider: %s", client.Provider))
+
+		server := sharedDetector.NewServer(sharedDetector.Client(client), detector.Config.SessionPoolSize)
+		server.Provider = client.Provider
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return detectors, err
+		}
+		detector.Addr = l.Addr().String()
+		go server.Listen(ctx, l, token)
+	}
+	return detectors, nil
+}
+
+// watchDaemonModelReload swaps the models of the shared detectors on SIGHUP, like watchModelReload does for a
+// single camera. The cameras of a detector keep sharing it, so they have to agree on the new model.
+func watchDaemonModelReload(configPath string, detectors []*daemonDetector) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	for range c {
+		configFile, err := os.ReadFile(configPath)
+		if err == nil {
+			configFile, err = configSchema.ToJSON(configPath, configFile)
+		}
+		var config DaemonConfig
+		if err == nil {
+			err = json.Unmarshal(configFile, &config)
+		}
+		if err != nil {
+			Log("error", fmt.Sprintf("Error reading daemon config for model reload: %v", err))
+			continue
+		}
+		cameras, cleanup, err := daemonCameras(filepath.Dir(configPath), config.Cameras)
+		cleanup()
+		if err != nil {
+			Log("error", fmt.Sprintf("Error parsing daemon config for model reload: %v", err))
+			continue
+		}
+
+		for _, detector := range detectors {
+			var models []ob.Config
+			for _, camera := range cameras {
+				if slices.Contains(detector.Cameras, camera.CameraName) && camera.Detector != nil {
+					models = append(models, *camera.Detector)
+				}
+			}
+			names := strings.Join(detector.Cameras, ", ")
+			if len(models) == 0 {
+				Log("warning", fmt.Sprintf("Model reload: cameras %s no longer use onnx, this requires a restart", names))
+				continue
+			}
+			model := models[0]
+			if slices.ContainsFunc(models, func(m ob.Config) bool {
+				return m.Model != model.Model || m.ModelWidth != model.ModelWidth || m.ModelHeight != model.ModelHeight
+			}) {
+				Log("warning", fmt.Sprintf("Model reload: cameras %s share a detector, splitting them onto different models requires a restart", names))
+				continue
+			}
+			if model.Model == detector.Config.Model && model.ModelWidth == detector.Config.ModelWidth && model.ModelHeight == detector.Config.ModelHeight {
+				Log("info", fmt.Sprintf("Model reload: onnx model of %s unchanged", names))
+				continue
+			}
+
+			Log("info", fmt.Sprintf("Swapping ONNX model of %s %s -> %s (%dx%d)", names, detector.Config.Model, model.Model, model.ModelWidth, model.ModelHeight))
+			if err := detector.Client.SwapModel(model.Model, model.ModelWidth, model.ModelHeight); err != nil {
+				Log("error", fmt.Sprintf("Error swapping ONNX model: %v", err))
+				continue
+			}
+			detector.Config.Model, detector.Config.ModelWidth, detector.Config.ModelHeight = model.Model, model.ModelWidth, model.ModelHeight
+			Log("info", fmt.Sprintf("ONNX model of %s swapped to %s", names, model.Model))
+		}
+	}
+}
+
+// runDaemonCamera runs the process of camera until ctx is done. It is restarted when it exits or stops writing its
+// status file, on shutdown it is asked to stop and gets its shutdownTimeoutSeconds to finish the open event.
+func runDaemonCamera(ctx context.Context, camera daemonCamera, executable string, env []string, backoff RestartBackoff, bus *eventBus.Bus) {
+	statusPath := cameraStatus.Path(camera.Video.HiResPath, camera.CameraName)
+	var pid atomic.Int64
+
+	sup := supervisor.New(supervisor.Config{
+		MinBackoff: time.Duration(backoff.MinSeconds * float64(time.Second)),
+		MaxBackoff: time.Duration(backoff.MaxSeconds * float64(time.Second)),
+		Probe: func(ctx context.Context) error {
+			status, err := cameraStatus.Read(statusPath)
+			if err != nil {
+				return err
+			}
+			if int64(status.PID) != pid.Load() {
+				return errors.New("no status written yet")
+			}
+			if age := time.Since(status.Updated); age > 30*time.Second {
+				return fmt.Errorf("status not written for %s", age.Round(time.Second))
+			}
+			return nil
+		},
+		ProbeInterval: 10 * time.Second,
+		StartGrace:    2 * time.Minute, // Probing the streams and loading the model take a while
+		Up:            func() { daemonEvent(bus, "camera_up", camera.CameraName, supervisor.Exit{}) },
+		Down:          func(exit supervisor.Exit) { daemonEvent(bus, "camera_down", camera.CameraName, exit) },
+	})
+
+	sup.Run(ctx, func(ctx context.Context) error {
+		cmd := sup.Command(ctx, executable, camera.ConfigPath)
+		cmd.Env = env
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = io.MultiWriter(os.Stderr, cmd.Stderr)
+		cmd.Cancel = func() error { return supervisor.Terminate(cmd) }
+		cmd.WaitDelay = time.Duration(camera.ShutdownTimeoutSeconds+5) * time.Second
+
+		Log("info", fmt.Sprintf("Starting camera %s", camera.CameraName))
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		pid.Store(int64(cmd.Process.Pid))
+		if err := cmd.Wait(); err != nil {
+			return fmt.Errorf("camera process failed: %w", err)
+		}
+		return errors.New("camera process exited")
+	})
+}
+
+// daemonEvent logs a camera process going up or down and publishes it on the bus
+func daemonEvent(bus *eventBus.Bus, eventType, cameraName string, exit supervisor.Exit) {
+	type Event struct {
+		Type             string    `json:"type"`
+		Timestamp        time.Time `json:"timestamp"`
+		CameraName       string    `json:"camera_name"`
+		Error            string    `json:"error,omitempty"`
+		Stderr           []string  `json:"stderr,omitempty"`
+		RestartInSeconds float64   `json:"restart_in_seconds,omitempty"`
+	}
+
+	event := Event{
+		Type:             eventType,
+		Timestamp:        time.Now(),
+		CameraName:       cameraName,
+		Stderr:           redactLines(exit.Stderr),
+		RestartInSeconds: exit.Restart.Seconds(),
+	}
+	if exit.Err != nil {
+		event.Error = logging.RedactString(exit.Err.Error())
+	}
+	if eventType == "camera_up" {
+		Log("notice", fmt.Sprintf("Camera %s is up", cameraName))
+	} else {
+		Log("error", fmt.Sprintf("Camera %s is down, restarting in %s: %s", cameraName, exit.Restart.Round(time.Second), event.Error))
+	}
+
+	eventJson, err := json.Marshal(event)
+	if err != nil {
+		Log("error", fmt.Sprintf("Error marshalling %s event: %v", eventType, err))
+		return
+	}
+	bus.Publish(eventBus.Event{Type: eventType, Camera: cameraName, Time: event.Timestamp, Payload: eventJson})
+}
+
+// watchModelReload swaps the onnx model on SIGHUP when onnxModel, onnxModelWidth or onnxModelHeight changed
+// in the config file. Ingest keeps running, the old sessions finish their frames before they are destroyed.
+func watchModelReload(configPath string) {
+	current := globalConfig.Motion
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	for range c {
+		configFile, err := os.ReadFile(configPath)
+		if err != nil {
+			Log("error", fmt.Sprintf("Error reading config file for model reload: %v", err))
+			continue
+		}
+		config, _, errs := decodeConfig(configPath, configFile)
+		if len(errs) > 0 {
+			Log("error", fmt.Sprintf("Error parsing config file for model reload: %v", errs))
+			continue
+		}
+
+		motion := config.Motion
+		if motion.OnnxModel == "" {
+			Log("warning", "Model reload: onnxModel is empty, switching to the network detector requires a restart")
+			continue
+		}
+		if motion.OnnxModel == current.OnnxModel && motion.OnnxModelWidth == current.OnnxModelWidth && motion.OnnxModelHeight == current.OnnxModelHeight {
+			Log("info", "Model reload: onnx model unchanged")
+			continue
+		}
+
+		Log("info", fmt.Sprintf("Swapping ONNX model %s -> %s (%dx%d)", current.OnnxModel, motion.OnnxModel, motion.OnnxModelWidth, motion.OnnxModelHeight))
+		err = runtimeConfig.ObjectPredictClient.SwapModel(motion.OnnxModel, motion.OnnxModelWidth, motion.OnnxModelHeight)
+		if err != nil {
+			Log("error", fmt.Sprintf("Error swapping ONNX model: %v", err))
+			continue
+		}
+		current = motion
+		updateStatus(func(s *cameraStatus.Snapshot) { s.Detector.Model = motion.OnnxModel })
+		Log("info", fmt.Sprintf("ONNX model swapped to %s", motion.OnnxModel))
+	}
+}
+
+func main() {
+	// Standard log output, like the errors of http.Server, goes through the logging package as well
+	slog.SetDefault(logger)
+	ptime := prettyTimer.NewTimingStats()
+	// Check if there is a config file argument, if there isnt give error and exit
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, "Not enough arguments provided\n")
+		fmt.Println("Usage: firescrew [configfile]")
+		fmt.Println("  -t, --template, t\tPrints the template config to stdout")
+		fmt.Println("  -h, --help, h\t\tPrints this help message")
+		fmt.Println("  -s, --serve, s\tStarts the web server, requires: [path] [addr], optional: [configfile] to search by example image")
+		return
+	}
+
+	switch os.Args[1] {
+	case "-t", "--template", "t":
+		// Dump template config to stdout
+		printTemplateFile()
+		return
+	case "-h", "--help", "h":
+		// Print help
+		fmt.Println("Usage: firescrew [configfile]")
+		fmt.Println("  -t, --template, t\tPrints the template config to stdout")
+		fmt.Println("  -h, --help, h\t\tPrints this help message")
+		fmt.Println("  -s, --serve, s\tStarts the web server, requires: [path] [addr], optional: [configfile] to search by example image")
+		fmt.Println("  models\t\tManages the onnx model cache: list|add|verify")
+		fmt.Println("  daemon\t\tRuns every camera and the web server from one config, requires: [configfile]")
+		fmt.Println("  validate\t\tChecks a config and prints it with the defaults applied, requires: [configfile]")
+		fmt.Println("  -v, --version, v\tPrints the version")
+		fmt.Println("  -update, --update, update\tUpdates firescrew to the latest version")
+		return
+	case "-s", "--serve", "s":
+		// This requires 2 more params, a path to files and an addr in form :8080
+		// Check if those params are provided if not give help message
+		if len(os.Args) < 4 {
+			fmt.Fprintf(os.Stderr, "Not enough arguments provided\n")
+			fmt.Fprintf(os.Stderr, ("Usage: firescrew -s [path] [addr] [configfile]\n"))
+			return
+		}
+		// With a config that enables appearanceEmbedding uploaded images can be searched by example as well, and the
+		// face gallery is the one the camera reads
+		if len(os.Args) > 4 {
+			globalConfig = readConfig(os.Args[4])
+			if globalConfig.Motion.FaceRecognition.Enabled {
+				firescrewServe.GalleryPath = globalConfig.Motion.FaceRecognition.GalleryPath
+			}
+			if globalConfig.Motion.AppearanceEmbedding.Enabled {
+				embedder, err := serveAppearanceEmbedder()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error loading appearance embedding: %v\n", err)
+					return
+				}
+				firescrewServe.ImageEmbedder = embedder.Run
+			}
+		}
+		err := firescrewServe.Serve(os.Args[2], os.Args[3])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting server: %v\n", err)
+			return
+		}
+		os.Exit(1)
+	case "models":
+		os.Exit(modelsCommand(os.Args[2:]))
+	case "daemon":
+		os.Exit(daemonCommand(os.Args[2:]))
+	case "validate":
+		os.Exit(validateCommand(os.Args[2:]))
+	case "-v", "--version", "v":
+		// Print version
+		fmt.Println(Version)
+		os.Exit(0)
+	case "-update", "--update", "update":
+		// Determine OS and ARCH
+		osRelease := runtime.GOOS
+		arch := runtime.GOARCH
+
+		// Build URL
+		e := tuna.SelfUpdate(fmt.Sprintf("https://github.com/catsimple/firescrew/releases/download/latest/firescrew.%s.%s", osRelease, arch))
+		if e != nil {
+			fmt.Println(e)
+			os.Exit(1)
+		}
+
+		fmt.Println("Updated!")
+		os.Exit(0)
+	}
+
+	// Read the config file
+	globalConfig = readConfig(os.Args[1])
+	defer logging.Close()
+	if addr := os.Getenv(daemonBusEnv); addr != "" {
+		daemonBus = eventBus.Dial(addr, os.Getenv(daemonTokenEnv))
+		defer daemonBus.Close(2 * time.Second)
+	}
+
+	// SIGINT/SIGTERM cancel ctx, ingest stops and the rest of the pipeline is drained by shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	children, killChildren := context.WithCancel(context.Background())
+	defer killChildren()
+	runtimeConfig.Children = children
+
+	// Check if ffmpeg/ffprobe binaries are available
+	_, err := CheckFFmpegAndFFprobe()
+	if err != nil {
+		Log("error", fmt.Sprintf("Unable to find ffmpeg/ffprobe binaries. Please install them: %s", err))
+		os.Exit(2)
+	}
+
+	if globalConfig.LoStreamParamBypass.Width == 0 || globalConfig.LoStreamParamBypass.Height == 0 || globalConfig.LoStreamParamBypass.FPS == 0 {
+		// Print HI/LO stream details
+		hiResStreamInfo, err := getStreamInfo(globalConfig.HiResDeviceUrl)
+		if err != nil {
+			Log("error", fmt.Sprintf("Error getting stream info: ffprobe: %v", err))
+			os.Exit(3)
+		}
+
+		if len(hiResStreamInfo.Streams) == 0 {
+			Log("error", fmt.Sprintf("No HI res streams found at %s", cameraStatus.RedactURL(globalConfig.HiResDeviceUrl)))
+			os.Exit(3)
+		}
+
+		// Find stream with codec_type: video
+		streamIndex := -1
+		for index, stream := range hiResStreamInfo.Streams {
+			if stream.CodecType == "video" {
+				streamIndex = index
+				runtimeConfig.CodecName = stream.CodecName
+				if globalConfig.Video.OnlyRemuxMp4 {
+					if stream.CodecName != "h264" {
+						Log("warning", fmt.Sprintf("OnlyRemuxMp4 is enabled but the stream codec is not h264 or h265. Your videos may not play in WebUI. Codec: %s", stream.CodecName))
+					}
+				}
+				break
+			}
+		}
+
+		if streamIndex == -1 {
+			Log("error", fmt.Sprintf("No video stream found at %s", cameraStatus.RedactURL(globalConfig.HiResDeviceUrl)))
+			os.Exit(3)
+		}
+
+		runtimeConfig.HiResStreamParams = StreamParams{
+			Width:  hiResStreamInfo.Streams[streamIndex].Width,
+			Height: hiResStreamInfo.Streams[streamIndex].Height,
+			FPS:    hiResStreamInfo.Streams[streamIndex].RFrameRate,
+		}
+	} else {
+		runtimeConfig.HiResStreamParams = globalConfig.HiStreamParamBypass
+	}
+
+	if globalConfig.LoStreamParamBypass.Width == 0 || globalConfig.LoStreamParamBypass.Height == 0 || globalConfig.LoStreamParamBypass.FPS == 0 {
+		loResStreamInfo, err := getStreamInfo(globalConfig.DeviceUrl)
+		if err != nil {
+			Log("error", fmt.Sprintf("Error getting stream info: %v", err))
+			os.Exit(3)
+		}
+
+		if len(loResStreamInfo.Streams) == 0 {
+			Log("error", fmt.Sprintf("No LO res streams found at %s", cameraStatus.RedactURL(globalConfig.DeviceUrl)))
+			os.Exit(3)
+		}
+
+		// Find stream with codec_type: video
+		streamIndex := -1
+		for index, stream := range loResStreamInfo.Streams {
+			if stream.CodecType == "video" {
+				streamIndex = index
+				break
+			}
+		}
+
+		if streamIndex == -1 {
+			Log("error", fmt.Sprintf("No video stream found at %s", cameraStatus.RedactURL(globalConfig.DeviceUrl)))
+			os.Exit(3)
+		}
+
+		runtimeConfig.LoResStreamParams = StreamParams{
+			Width:  loResStreamInfo.Streams[streamIndex].Width,
+			Height: loResStreamInfo.Streams[streamIndex].Height,
+			FPS:    loResStreamInfo.Streams[streamIndex].RFrameRate,
+		}
+	} else {
+		runtimeConfig.LoResStreamParams = globalConfig.LoStreamParamBypass
+	}
+
+	// Print stream info from runtimeConfig
+	Log("info", "******************** STREAM INFO ********************")
+	Log("info", fmt.Sprintf("Lo-Res Stream Resolution: %dx%d FPS: %.2f", runtimeConfig.LoResStreamParams.Width, runtimeConfig.LoResStreamParams.Height, runtimeConfig.LoResStreamParams.FPS))
+	Log("info", fmt.Sprintf("Hi-Res Stream Resolution: %dx%d FPS: %.2f", runtimeConfig.HiResStreamParams.Width, runtimeConfig.HiResStreamParams.Height, runtimeConfig.HiResStreamParams.FPS))
+	Log("info", "*****************************************************")
+
+	// everyNthFrame counted frames of the old fixed 1 in 5 ffmpeg select, keep the effective rate for old configs
+	if globalConfig.Motion.DetectFps == 0 {
+		globalConfig.Motion.DetectFps = 5
+		if globalConfig.Motion.EveryNthFrame > 0 && runtimeConfig.LoResStreamParams.FPS > 0 {
+			globalConfig.Motion.DetectFps = runtimeConfig.LoResStreamParams.FPS / float64(5*globalConfig.Motion.EveryNthFrame)
+			Log("warning", fmt.Sprintf("motion.everyNthFrame is deprecated, use motion.detectFps: %.2f", globalConfig.Motion.DetectFps))
+		}
+	}
+	globalConfig.Motion.IdleDetectFps = min(globalConfig.Motion.IdleDetectFps, globalConfig.Motion.DetectFps)
+	Log("info", fmt.Sprintf("Detection rate: %.2f fps, idle: %.2f fps", globalConfig.Motion.DetectFps, globalConfig.Motion.IdleDetectFps))
+
+	// The recorder reads its control channel between stream reads, the buffer keeps the event manager from waiting on it
+	runtimeConfig.HiResControlChannel = make(chan RecordMsg, 64)
+	runtimeConfig.Events = newMotionEvents()
+	go runEventSink()
+	updateStatus(func(s *cameraStatus.Snapshot) {
+		s.Detector.Backend, s.Detector.Model = "onnx", globalConfig.Motion.OnnxModel
+		if globalConfig.Motion.OnnxModel == "" {
+			s.Detector.Backend, s.Detector.Model = "network", globalConfig.Motion.NetworkObjectDetectServer
+			if globalConfig.Motion.NetworkObjectDetectServer == "" { // The embedded python server is started below
+				s.Detector.Model = globalConfig.Motion.EmbeddedObjectScript
+			}
+		}
+	})
+	statusDone := make(chan struct{})
+	go func() {
+		defer close(statusDone)
+		runStatusWriter(ctx)
+	}()
+
+	// Copy assets to local filesystem
+	path := copyAssetsToTemp()
+	defer os.RemoveAll(path)
+	// Start the object detector
+
+	if globalConfig.Motion.OnnxModel != "" {
+		var err error
+		Log("info", fmt.Sprintf("Loading ONNX Model: %s", globalConfig.Motion.OnnxModel))
+
+		// === 新增：处理分辨率配置 ===
+		// 获取配置中的宽高
+		mWidth := globalConfig.Motion.OnnxModelWidth
+		mHeight := globalConfig.Motion.OnnxModelHeight
+
+		// 如果配置文件没写(为0)，则设置默认值
+		// 建议默认 640 (标准YOLO)，但如果你导出的模型是 320，请在 config.json 里明确写 320
+		if mWidth == 0 {
+			mWidth = 640
+		}
+		if mHeight == 0 {
+			mHeight = 640
+		}
+
+		Log("info", fmt.Sprintf("Model Resolution set to: %dx%d", mWidth, mHeight))
+
+		// 初始化客户端，传入宽和高
+		cfg := objectPredictConfig(globalConfig, mWidth, mHeight)
+		if addr := os.Getenv(daemonDetectorEnv); addr != "" {
+			// The daemon loaded the model for every camera with these onnx settings, only the crop models are loaded here
+			remote, err := sharedDetector.Dial(addr, os.Getenv(daemonTokenEnv), globalConfig.CameraName)
+			if err != nil {
+				Log("error", fmt.Sprintf("Cannot connect to the shared detector of the daemon: %v", err))
+				return
+			}
+			defer remote.Close()
+			Log("info", fmt.Sprintf("Using the shared detector of the daemon at %s", addr))
+			runtimeConfig.Detector = remote
+			cfg.CropModelsOnly, cfg.Providers = true, []string{remote.Provider}
+		}
+		runtimeConfig.ObjectPredictClient, err = ob.Init(cfg)
+
+		if err != nil {
+			Log("error", fmt.Sprintf("Cannot init model: %v", err))
+			return
+		}
+
+		Log("info", fmt.Sprintf("ONNX execution provider: %s", runtimeConfig.ObjectPredictClient.Provider))
+		setProcessUp("detector", true)
+		defer runtimeConfig.ObjectPredictClient.Close() // Cleanup files
+		if runtimeConfig.Detector == nil {
+			runtimeConfig.Detector = sharedDetector.NewServer(sharedDetector.Client(runtimeConfig.ObjectPredictClient), globalConfig.Motion.OnnxSessionPool).Camera(globalConfig.CameraName)
+			go watchModelReload(os.Args[1])
+		} else {
+			signal.Ignore(syscall.SIGHUP) // The daemon swaps the model of its shared detector on its own SIGHUP
+		}
+
+		// Load the second stage classifiers on the same environment
+		for i, classifier := range globalConfig.Motion.SecondaryClassifiers {
+			globalConfig.Motion.SecondaryClassifiers[i].Classifier, err = runtimeConfig.ObjectPredictClient.NewClassifier(ob.CropModelConfig{
+				Model:       classifier.Model,
+				ModelWidth:  classifier.ModelWidth,
+				ModelHeight: classifier.ModelHeight,
+				InputName:   classifier.InputName,
+				OutputName:  classifier.OutputName,
+				Mean:        classifier.Mean,
+				Std:         classifier.Std,
+			}, classifier.Labels, classifier.Softmax)
+			if err != nil {
+				Log("error", fmt.Sprintf("Cannot init secondary classifier %s: %v", classifier.Name, err))
+				return
+			}
+			defer globalConfig.Motion.SecondaryClassifiers[i].Classifier.Close()
+		}
+
+		if globalConfig.Motion.PlateRecognition.Enabled {
+			plates := &globalConfig.Motion.PlateRecognition
+			padChar, _ := utf8.DecodeRuneInString(plates.PadChar)
+			plates.Reader, err = runtimeConfig.ObjectPredictClient.NewPlateReader(ob.PlateReaderConfig{
+				Detector: ob.CropModelConfig{
+					Model:       plates.DetectorModel,
+					ModelWidth:  plates.DetectorWidth,
+					ModelHeight: plates.DetectorHeight,
+				},
+				DetectorConfidence: float32(plates.DetectorConfidence),
+				OCR: ob.CropModelConfig{
+					Model:       plates.OcrModel,
+					ModelWidth:  plates.OcrWidth,
+					ModelHeight: plates.OcrHeight,
+					InputName:   plates.OcrInputName,
+					OutputName:  plates.OcrOutputName,
+				},
+				Alphabet: plates.Alphabet,
+				Length:   plates.Length,
+				CTC:      plates.Ctc,
+				PadChar:  padChar,
+				Softmax:  plates.Softmax,
+			})
+			if err != nil {
+				Log("error", fmt.Sprintf("Cannot init plate recognition: %v", err))
+				return
+			}
+			defer plates.Reader.Close()
+		}
+
+		if globalConfig.Motion.FaceRecognition.Enabled {
+			faces := &globalConfig.Motion.FaceRecognition
+			faces.Recognizer, err = runtimeConfig.ObjectPredictClient.NewFaceRecognizer(ob.FaceRecognizerConfig{
+				Detector: ob.CropModelConfig{
+					Model:       faces.DetectorModel,
+					ModelWidth:  faces.DetectorWidth,
+					ModelHeight: faces.DetectorHeight,
+				},
+				DetectorConfidence: float32(faces.DetectorConfidence),
+				DetectorRows:       faces.DetectorRows,
+				Embedder: ob.CropModelConfig{
+					Model:       faces.EmbedderModel,
+					ModelWidth:  faces.EmbedderWidth,
+					ModelHeight: faces.EmbedderHeight,
+					InputName:   faces.EmbedderInputName,
+					OutputName:  faces.EmbedderOutputName,
+					OutputSize:  faces.EmbeddingSize,
+					Mean:        faces.Mean,
+					Std:         faces.Std,
+				},
+			})
+			if err != nil {
+				Log("error", fmt.Sprintf("Cannot init face recognition: %v", err))
+				return
+			}
+			defer faces.Recognizer.Close()
+
+			faces.Gallery, err = faceGallery.Open(faces.GalleryPath)
+			if err != nil {
+				Log("error", fmt.Sprintf("Cannot open face gallery: %v", err))
+				return
+			}
+			// The watcher embeds photos with the recognizer, it has to stop before the deferred Close above
+			galleryCtx, stopGallery := context.WithCancel(ctx)
+			galleryDone := make(chan struct{})
+			go func() {
+				defer close(galleryDone)
+				watchFaceGallery(galleryCtx)
+			}()
+			defer func() {
+				stopGallery()
+				<-galleryDone
+			}()
+		}
+
+		if globalConfig.Motion.AppearanceEmbedding.Enabled {
+			globalConfig.Motion.AppearanceEmbedding.Embedder, err = newAppearanceEmbedder(runtimeConfig.ObjectPredictClient)
+			if err != nil {
+				Log("error", fmt.Sprintf("Cannot init appearance embedding: %v", err))
+				return
+			}
+			defer globalConfig.Motion.AppearanceEmbedding.Embedder.Close()
+		}
+
+	} else {
 		if globalConfig.Motion.NetworkObjectDetectServer == "" {
 			globalConfig.Motion.NetworkObjectDetectServer = "127.0.0.1:8555"
-			go startObjectDetector(path + "/" + globalConfig.Motion.EmbeddedObjectScript)
+			go startObjectDetector(ctx, path+"/"+globalConfig.Motion.EmbeddedObjectScript, globalConfig.Motion.NetworkObjectDetectServer)
 			// Set networkObjectDetectServer path to 127.0.0.1:8555
 			// time.Sleep(10 * time.Second) // Give time to kill old instance if still running
 			// Wait until tcp connection is works to globalConfig.Motion.NetworkObjectDetectServer
 			Log("info", "Waiting for object detector to come up")
 			if !runtimeConfig.modelReady {
-				for {
+				for ctx.Err() == nil {
 					conn, err := net.DialTimeout("tcp", globalConfig.Motion.NetworkObjectDetectServer, 1*time.Second)
 					if err != nil {
 						Log("warning", fmt.Sprintf("Waiting for object detector to start: %v", err))
@@ -974,7 +2586,7 @@ func main() {
 			}
 		} else {
 			Log("info", fmt.Sprintf("Checking connection to: %s", globalConfig.Motion.NetworkObjectDetectServer))
-			for {
+			for ctx.Err() == nil {
 				conn, err := net.DialTimeout("tcp", globalConfig.Motion.NetworkObjectDetectServer, 1*time.Second)
 				if err != nil {
 					Log("warning", fmt.Sprintf("Waiting for %s to respond: %v", globalConfig.Motion.NetworkObjectDetectServer, err))
@@ -985,46 +2597,74 @@ func main() {
 				}
 			}
 		}
+		runtimeConfig.Detector = sharedDetector.NewServer(networkDetector{}, globalConfig.Motion.OnnxSessionPool).Camera(globalConfig.CameraName)
+	}
+
+	if globalConfig.SceneHealth.Enabled {
+		scene := globalConfig.SceneHealth
+		runtimeConfig.SceneMonitor = sceneHealth.New(sceneHealth.Config{
+			BrightnessJump:   scene.BrightnessJump,
+			SuppressFor:      time.Duration(scene.SuppressSeconds * float64(time.Second)),
+			UniformStdDev:    scene.UniformStdDev,
+			MovedCorrelation: scene.MovedCorrelation,
+			DefocusRatio:     scene.DefocusRatio,
+			TamperAfter:      time.Duration(scene.TamperSeconds * float64(time.Second)),
+			RelearnAfter:     time.Duration(scene.RelearnMinutes * float64(time.Minute)),
+			NightChroma:      scene.NightChroma,
+			ModeAfter:        time.Duration(scene.ModeSeconds * float64(time.Second)),
+		})
 	}
 
 	stream = mjpeg.NewStream()
 	if globalConfig.EnableOutputStream {
 		go startWebcamStream(stream)
 	}
+	if globalConfig.MetricsAddr != "" {
+		go startMetricsServer()
+	}
 
-	// Define the last image
-	imgLast := image.NewRGBA(image.Rect(0, 0, runtimeConfig.HiResStreamParams.Width, runtimeConfig.HiResStreamParams.Height))
-
-	// Start HI Res prebuffering
-	runtimeConfig.HiResControlChannel = make(chan RecordMsg)
+	// Start HI Res prebuffering. The recorder has its own context, it is only stopped once the last event was closed
+	recorderCtx, stopRecorder := context.WithCancel(context.Background())
+	recorderDone := make(chan struct{})
 	go func() {
-		for {
-			recordRTSPStream(globalConfig.HiResDeviceUrl, runtimeConfig.HiResControlChannel, time.Duration(globalConfig.Motion.PrebufferSeconds)*time.Second)
-			// defer close(runtimeConfig.HiResControlChannel)
-			time.Sleep(5 * time.Second)
-			Log("warning", "Restarting HI RTSP feed")
-		}
+		defer close(recorderDone)
+		sup := newSupervisor("hi", supervisor.Config{})
+		trackRestarts("hi", sup)
+		sup.Run(recorderCtx, func(ctx context.Context) error {
+			err := recordRTSPStream(ctx, sup, globalConfig.HiResDeviceUrl, runtimeConfig.HiResControlChannel, time.Duration(globalConfig.Motion.PrebufferSeconds)*time.Second)
+			if recorderCtx.Err() == nil {
+				Log("warning", fmt.Sprintf("HI RTSP feed stopped: %v", err))
+			}
+			return err
+		})
 	}()
 
-	frameChannel := make(chan FrameMsg)
-	go func(frameChannel chan FrameMsg) {
-		for {
-			processRTSPFeed(globalConfig.DeviceUrl, frameChannel)
-			// Log("warning", "EXITED")
-			//*********** EXITS BELOW ***********//
-			time.Sleep(5 * time.Second)
-			Log("warning", "Restarting LO RTSP feed")
+	// Only the newest decoded frame waits for the main loop, a slow detector never works on stale frames
+	frames := inferenceScheduler.NewLatest[FrameMsg]()
+	framesDropped.Func(func() float64 { return float64(frames.Dropped()) }, globalConfig.CameraName)
+	diskFree.Func(func() float64 {
+		free, _, err := metrics.DiskSpace(globalConfig.Video.HiResPath)
+		if err != nil {
+			return math.NaN()
 		}
-	}(frameChannel)
+		return float64(free)
+	}, globalConfig.CameraName, globalConfig.Video.HiResPath)
+	go func() {
+		defer frames.Close() // Ends the frame loop below
+		sup := newSupervisor("lo", supervisor.Config{})
+		trackRestarts("lo", sup)
+		sup.Run(ctx, func(runCtx context.Context) error {
+			err := processRTSPFeed(runCtx, sup, globalConfig.DeviceUrl, globalConfig.Motion.DetectFps, frames)
+			if ctx.Err() == nil {
+				Log("warning", fmt.Sprintf("LO RTSP feed stopped: %v", err))
+			}
+			return err
+		})
+	}()
 	// go dumpRtspFrames(globalConfig.DeviceUrl, "/Volumes/RAMDisk/", 4) // 1 means mod every nTh frame
 	// go readFramesFromRam(frameChannel, "/Volumes/RAMDisk/")
 
-	for msg := range frameChannel {
-		if msg.Error != "" {
-			Log("error", msg.Error)
-			continue
-		}
-
+	for msg := range frames.C() {
 		if msg.Frame != nil {
 			ptime.Start() // DEBUG TIMER
 
@@ -1035,109 +2675,424 @@ func main() {
 				draw.Draw(rgba, rgba.Bounds(), msg.Frame, msg.Frame.Bounds().Min, draw.Src)
 			}
 
-			// Handle all motion stuff here
-			if runtimeConfig.MotionTriggered || (!runtimeConfig.MotionTriggered && CountChangedPixels(rgba, imgLast, uint8(30)) > int(globalConfig.PixelMotionAreaThreshold)) { // Use short-circuit to bypass pixel count if event is already triggered, otherwise we may not be able to identify all objects if motion is triggered
-				// If its been more than globalConfig.Motion.EventGap seconds since the last motion event, untrigger
-				if runtimeConfig.MotionTriggered && time.Since(runtimeConfig.MotionTriggeredLast) > time.Duration(globalConfig.Motion.EventGap)*time.Second {
-					go endMotionEvent() // End the motion event
+			// Resolve config coordinates against the frame size, only changes if the stream resolution changes
+			if rgba.Bounds().Size() != runtimeConfig.FrameGeometry.Size {
+				resolveFrameGeometry(rgba.Bounds().Size())
+			}
+
+			// The background model sees every frame so it keeps adapting during events.
+			// The pixel threshold is bypassed while an event is triggered, otherwise we may not be able to identify all objects
+			// Lighting changes and a covered lens are not motion, restart the background instead
+			if runtimeConfig.SceneMonitor != nil {
+				scene := runtimeConfig.SceneMonitor.Update(rgba, time.Now())
+				for _, event := range scene.Events {
+					sceneEvent(event)
+				}
+				if scene.Suppress {
+					runtimeConfig.MotionDetector.Reset()
 				}
+			}
+			motion := runtimeConfig.MotionDetector.Detect(rgba)
+			if motion.Reset {
+				Log("debug", "Motion background reset")
+			}
+			ratio := float64(motion.ChangedPixels) / float64(rgba.Bounds().Dx()*rgba.Bounds().Dy())
+			framesProcessed.With(globalConfig.CameraName).Inc()
+			motionRatio.With(globalConfig.CameraName).Set(ratio)
 
-				// Only run this on every Nth frame
-				if predictFrameCounter%everyNthFrame == 0 {
-					if predictFrameCounter > 10000 {
-						predictFrameCounter = 0
-					}
-					if msg.Frame != nil {
-
-						var predict []Prediction
-						var err error
-						// If globalConfig.Motion.OnnxModel is blank run this
-						// Send data to objectPredict
-						if globalConfig.Motion.OnnxModel == "" {
-							predict, err = objectPredict(msg.Frame)
-							if err != nil {
-								Log("error", fmt.Sprintf("Error running objectPredict: %v", err))
-								return
-							}
-							performDetectionOnObject(nil, rgba, predict)
-						} else {
-							timer := time.Now()
-							objects, resizedImage, err := runtimeConfig.ObjectPredictClient.Predict(msg.Frame)
-							if err != nil {
-								fmt.Println("Cannot predict:", err)
-								return
-							}
-
-							// Detect took
-							took := time.Since(timer).Milliseconds()
-
-							for _, object := range objects {
-								pred := Prediction{
-									Object:     object.ClassID,
-									ClassName:  object.ClassName,
-									Box:        []float32{object.X1, object.Y1, object.X2, object.Y2},
-									Top:        int(object.Y1),
-									Bottom:     int(object.Y2),
-									Left:       int(object.X1),
-									Right:      int(object.X2),
-									Confidence: object.Confidence,
-									Took:       float64(took),
-								}
-								predict = append(predict, pred)
-							}
-							performDetectionOnObject(rgba, resizedImage, predict)
-						}
-						calcInferenceStats(predict) // Calculate inference stats
-
-						// FIX THIS Its taking way too long to process
-						// if len(predict) > 0 {
-						// 	// Notify in realtime about detected objects
-						// 	type Event struct {
-						// 		Type             string       `json:"type"`
-						// 		Timestamp        time.Time    `json:"timestamp"`
-						// 		PredictedObjects []Prediction `json:"predicted_objects"`
-						// 	}
-
-						// 	eventRaw := Event{
-						// 		Type:             "objects_predicted",
-						// 		Timestamp:        time.Now(),
-						// 		PredictedObjects: predict,
-						// 	}
-						// 	eventJson, err := json.Marshal(eventRaw)
-						// 	if err != nil {
-						// 		Log("error", fmt.Sprintf("Error marshalling object_predicted event: %v", err))
-						// 		return
-						// 	}
-						// 	go eventHandler("objects_detected", eventJson)
-						// }
-
-						// if len(predict) > 0 {
-						// 	fname := fmt.Sprintf("%d.jpg", predictFrameCounter)
-						// 	saveJPEG(filepath.Join(globalConfig.Video.HiResPath, fname), rgba, 100)
-						// }
+			// Handle all motion stuff here
+			// Events are closed on a timer by runtimeConfig.Events, not here
+			moving := len(motion.Blobs) > 0 && motion.ChangedPixels > int(globalConfig.PixelMotionAreaThreshold)
+			updateStatus(func(s *cameraStatus.Snapshot) {
+				s.LastFrame, s.Motion, s.MotionRatio = time.Now(), moving, ratio
+			})
 
-					}
+			// Fast while something moves or is tracked, slow (or not at all) while idle, within the fair share of the detector.
+			// The pixel threshold is bypassed while an event is triggered, otherwise we may not be able to identify all objects
+			detectFps := globalConfig.Motion.IdleDetectFps
+			if runtimeConfig.Events.Active() || moving {
+				detectFps = globalConfig.Motion.DetectFps
+			}
+			if runtimeConfig.Detector.Due(time.Now(), detectFps) {
+				var predict []Prediction
+				objects, detectTook, err := detectObjects(rgba, motion.Blobs) // Boxes are already in rgba coordinates
+				if err != nil {
+					Log("error", fmt.Sprintf("Cannot predict: %v", err))
+					stop() // Shut down like on a signal, so the open event is still finished
+					continue
+				}
 
-					predictFrameCounter++
+				// Detect took
+				took := float64(detectTook.Milliseconds())
+
+				for _, object := range objects {
+					pred := Prediction{
+						Object:     object.ClassID,
+						ClassName:  object.ClassName,
+						Box:        []float32{object.X1, object.Y1, object.X2, object.Y2},
+						Top:        int(object.Y1),
+						Bottom:     int(object.Y2),
+						Left:       int(object.X1),
+						Right:      int(object.X2),
+						Confidence: object.Confidence,
+						Took:       took,
+					}
+					predict = append(predict, pred)
+				}
+				performDetectionOnObject(rgba, predict)
+				calcInferenceStats(took) // Calculate inference stats
+				backend := "onnx"
+				if globalConfig.Motion.OnnxModel == "" {
+					backend = "network" // The embedded python server or networkObjectDetectServer
 				}
+				inferenceSeconds.With(globalConfig.CameraName, backend).Observe(took / 1000)
+
+				// FIX THIS Its taking way too long to process
+				// if len(predict) > 0 {
+				// 	// Notify in realtime about detected objects
+				// 	type Event struct {
+				// 		Type             string       `json:"type"`
+				// 		Timestamp        time.Time    `json:"timestamp"`
+				// 		PredictedObjects []Prediction `json:"predicted_objects"`
+				// 	}
+
+				// 	eventRaw := Event{
+				// 		Type:             "objects_predicted",
+				// 		Timestamp:        time.Now(),
+				// 		PredictedObjects: predict,
+				// 	}
+				// 	eventJson, err := json.Marshal(eventRaw)
+				// 	if err != nil {
+				// 		Log("error", fmt.Sprintf("Error marshalling object_predicted event: %v", err))
+				// 		return
+				// 	}
+				// 	go eventHandler("objects_detected", eventJson)
+				// }
+
 			}
 
 			// if globalConfig.EnableOutputStream {
 			// 	streamImage(rgba, stream) // Stream the image to the web
 			// }
 
-			imgLast = rgba // Set the last image to the current image
-
 			ptime.Finish() // DEBUG TIMER
 			// ptime.PrintStats() // DEBUG TIMER
 
 		}
 	}
 
+	if !shutdown(stopRecorder, recorderDone) {
+		killChildren()
+	}
+	<-statusDone // The last write has to be the stopped one
+	writeStatus(false)
+}
+
+// shutdown drains the pipeline once ingest stopped: the open event is finished, the recorder closes its clip,
+// queued event handlers, notifications and metadata are flushed and running recodes complete. It gives up after
+// shutdownTimeoutSeconds and returns false, the deferred cleanup in main runs either way.
+func shutdown(stopRecorder context.CancelFunc, recorderDone <-chan struct{}) bool {
+	timeout := time.Duration(globalConfig.ShutdownTimeoutSeconds) * time.Second
+	Log("notice", fmt.Sprintf("Shutting down, waiting up to %s", timeout))
+
+	done := make(chan struct{})
+	go func() {
+		runtimeConfig.Events.Close(time.Now())
+		stopRecorder()
+		<-recorderDone
+		close(eventSink)
+		<-eventSinkDone
+		recodes.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		Log("info", "Shutdown complete")
+		return true
+	case <-time.After(timeout):
+		Log("warning", fmt.Sprintf("Shutdown timed out after %s, stopping remaining ffmpeg processes", timeout))
+		return false
+	}
+}
+
+// sceneEvent logs a scene health change and sends it as a camera_tamper or camera_day_night event
+func sceneEvent(scene sceneHealth.Event) {
+	type Event struct {
+		Type       string    `json:"type"`
+		Timestamp  time.Time `json:"timestamp"`
+		CameraName string    `json:"camera_name"`
+		Reason     string    `json:"reason,omitempty"` // covered, moved or defocused
+		Active     bool      `json:"active"`           // Tampering started or cleared
+		Mode       string    `json:"mode,omitempty"`   // day or night
+	}
+
+	switch {
+	case scene.Type == "camera_day_night":
+		Log("notice", fmt.Sprintf("Camera switched to %s mode", scene.Mode))
+	case scene.Active:
+		Log("warning", fmt.Sprintf("Camera tamper detected: %s", scene.Reason))
+	default:
+		Log("notice", fmt.Sprintf("Camera tamper cleared: %s", scene.Reason))
+	}
+
+	eventJson, err := json.Marshal(Event{
+		Type:       scene.Type,
+		Timestamp:  time.Now(),
+		CameraName: globalConfig.CameraName,
+		Reason:     scene.Reason,
+		Active:     scene.Active,
+		Mode:       scene.Mode,
+	})
+	if err != nil {
+		Log("error", fmt.Sprintf("Error marshalling %s event: %v", scene.Type, err))
+		return
+	}
+	eventHandler(scene.Type, eventJson)
+}
+
+// newSupervisor returns the supervisor of the lo or hi feed, or of another child when cfg sets its own hooks. Feeds
+// report stream_up once data arrives and stream_down when ffmpeg stopped.
+func newSupervisor(name string, cfg supervisor.Config) *supervisor.Supervisor {
+	cfg.MinBackoff = time.Duration(globalConfig.RestartBackoff.MinSeconds * float64(time.Second))
+	cfg.MaxBackoff = time.Duration(globalConfig.RestartBackoff.MaxSeconds * float64(time.Second))
+	if cfg.Up == nil {
+		cfg.Up = func() { childEvent("stream_up", name, supervisor.Exit{}) }
+	}
+	if cfg.Down == nil {
+		cfg.Down = func(exit supervisor.Exit) { childEvent("stream_down", name, exit) }
+	}
+	return supervisor.New(cfg)
+}
+
+// redactLines replaces the secrets of the config in the stderr of a child, ffmpeg prints the stream URL it failed on
+func redactLines(lines []string) []string {
+	redacted := make([]string, len(lines))
+	for i, line := range lines {
+		redacted[i] = logging.RedactString(line)
+	}
+	return redacted
+}
+
+// childEvent logs a child process going up or down and sends it as an event. Handlers run in the background so a
+// slow webhook does not delay the restart.
+func childEvent(eventType, process string, exit supervisor.Exit) {
+	type Event struct {
+		Type             string    `json:"type"`
+		Timestamp        time.Time `json:"timestamp"`
+		CameraName       string    `json:"camera_name"`
+		Process          string    `json:"process"` // lo, hi or detector
+		Error            string    `json:"error,omitempty"`
+		Stderr           []string  `json:"stderr,omitempty"` // Last lines of stderr of the failed run
+		RestartInSeconds float64   `json:"restart_in_seconds,omitempty"`
+	}
+
+	event := Event{
+		Type:             eventType,
+		Timestamp:        time.Now(),
+		CameraName:       globalConfig.CameraName,
+		Process:          process,
+		Stderr:           redactLines(exit.Stderr),
+		RestartInSeconds: exit.Restart.Seconds(),
+	}
+	if exit.Err != nil {
+		event.Error = logging.RedactString(exit.Err.Error())
+	}
+
+	setProcessUp(process, eventType == "stream_up")
+	if eventType == "stream_up" {
+		Log("notice", fmt.Sprintf("%s stream is up", strings.ToUpper(process)))
+	} else {
+		Log("error", fmt.Sprintf("%s is down, restarting in %s: %s", process, exit.Restart.Round(time.Second), event.Error))
+		for _, line := range exit.Stderr {
+			Log("debug", fmt.Sprintf("%s STDERR: %s", process, line))
+		}
+	}
+
+	eventJson, err := json.Marshal(event)
+	if err != nil {
+		Log("error", fmt.Sprintf("Error marshalling %s event: %v", eventType, err))
+		return
+	}
+	go eventHandler(eventType, eventJson)
+}
+
+// streamStalled logs a stalled lo or hi feed and sends it as a stream_stalled event, the feed is restarted after this.
+// The event goes through eventSink in order with the motion events, both feeds stop before the sink is closed.
+func streamStalled(process string, err error) {
+	type Event struct {
+		Type       string    `json:"type"`
+		Timestamp  time.Time `json:"timestamp"`
+		CameraName string    `json:"camera_name"`
+		Process    string    `json:"process"`
+		Reason     string    `json:"reason"` // no_data, no_frames or frozen
+		Seconds    float64   `json:"seconds"`
+	}
+
+	var stall *streamWatchdog.Stall
+	if !errors.As(err, &stall) {
+		return
+	}
+	Log("warning", fmt.Sprintf("%s stream stalled: %v, restarting it", strings.ToUpper(process), err))
+
+	eventJson, err := json.Marshal(Event{
+		Type:       "stream_stalled",
+		Timestamp:  time.Now(),
+		CameraName: globalConfig.CameraName,
+		Process:    process,
+		Reason:     stall.Reason,
+		Seconds:    stall.For.Seconds(),
+	})
+	if err != nil {
+		Log("error", fmt.Sprintf("Error marshalling stream_stalled event: %v", err))
+		return
+	}
+	eventSink <- func() { eventHandler("stream_stalled", eventJson) }
+}
+
+// resolveFrameGeometry converts the configured ignore areas and tracking thresholds to pixels of a frame of size.
+// With coordinateSpace "normalized" they are fractions: coordinates of the frame width/height,
+// the center movement threshold of the frame diagonal and the area threshold of the frame area.
+func resolveFrameGeometry(size image.Point) {
+	geometry := FrameGeometry{
+		Size:                          size,
+		ObjectCenterMovementThreshold: globalConfig.ObjectCenterMovementThreshold,
+		ObjectAreaThreshold:           globalConfig.ObjectAreaThreshold,
+	}
+
+	scaleX, scaleY := 1.0, 1.0
+	if globalConfig.CoordinateSpace == "normalized" {
+		scaleX, scaleY = float64(size.X), float64(size.Y)
+		geometry.ObjectCenterMovementThreshold *= math.Hypot(scaleX, scaleY)
+		geometry.ObjectAreaThreshold *= scaleX * scaleY
+	}
+
+	for i, area := range globalConfig.IgnoreAreasClasses {
+		globalConfig.IgnoreAreasClasses[i].Rect = coordinatesToRect(area.Top, area.Bottom, area.Left, area.Right, scaleX, scaleY)
+	}
+
+	for i, roi := range globalConfig.Motion.RegionsOfInterest {
+		globalConfig.Motion.RegionsOfInterest[i].Rect = coordinatesToRect(roi.Top, roi.Bottom, roi.Left, roi.Right, scaleX, scaleY)
+	}
+
+	var masks []image.Rectangle
+	for i, mask := range globalConfig.PixelMotion.Masks {
+		globalConfig.PixelMotion.Masks[i].Rect = coordinatesToRect(mask.Top, mask.Bottom, mask.Left, mask.Right, scaleX, scaleY)
+		masks = append(masks, globalConfig.PixelMotion.Masks[i].Rect)
+	}
+
+	// A new background model for the new frame size
+	pixelMotion := globalConfig.PixelMotion
+	runtimeConfig.MotionDetector = motionDetect.New(motionDetect.Config{
+		Downscale:       pixelMotion.Downscale,
+		BlurRadius:      pixelMotion.BlurRadius,
+		Threshold:       float32(pixelMotion.Threshold),
+		VarianceFactor:  float32(pixelMotion.VarianceFactor),
+		LearningRate:    float32(pixelMotion.LearningRate),
+		MinBlobArea:     int(pixelMotion.MinBlobArea * scaleX * scaleY),
+		MaxChangedRatio: pixelMotion.MaxChangedRatio,
+		Masks:           masks,
+	})
+
+	runtimeConfig.FrameGeometry = geometry
+	Log("debug", fmt.Sprintf("Frame geometry resolved for %dx%d: center threshold %.1fpx, area threshold %.1fpx", size.X, size.Y, geometry.ObjectCenterMovementThreshold, geometry.ObjectAreaThreshold))
+}
+
+// parseCoordinates splits a "Top,Bottom,Left,Right" string, normalized values must be within 0-1
+func parseCoordinates(coordinates string, normalized bool) ([4]float64, error) {
+	var values [4]float64
+	coords := strings.Split(coordinates, ",")
+	if len(coords) != 4 {
+		return values, errors.New("coordinates string must contain 4 comma separated numbers")
+	}
+
+	for i, coord := range coords {
+		var err error
+		values[i], err = strconv.ParseFloat(strings.TrimSpace(coord), 64)
+		if err != nil {
+			return values, err
+		}
+		if normalized && (values[i] < 0 || values[i] > 1) {
+			return values, fmt.Errorf("normalized coordinates must be between 0 and 1: %s", coordinates)
+		}
+	}
+	return values, nil
+}
+
+func coordinatesToRect(top, bottom, left, right, scaleX, scaleY float64) image.Rectangle {
+	return image.Rect(
+		int(math.Round(left*scaleX)), int(math.Round(top*scaleY)),
+		int(math.Round(right*scaleX)), int(math.Round(bottom*scaleY)),
+	)
+}
+
+// detectObjects runs the detector on the part of frame selected by detectionRegion.
+// motionBlobs are the boxes of the moving blobs, used by the motion region mode.
+func detectObjects(frame *image.RGBA, motionBlobs []image.Rectangle) ([]ob.Object, time.Duration, error) {
+	detector := runtimeConfig.Detector
+	request := sharedDetector.Request{Frame: frame} // Full frame, also the fallback for motion mode when there is no motion box
+
+	switch globalConfig.Motion.DetectionRegion {
+	case "roi":
+		request.Regions = make([]image.Rectangle, len(globalConfig.Motion.RegionsOfInterest))
+		for i, roi := range globalConfig.Motion.RegionsOfInterest {
+			request.Regions[i] = roi.Rect
+		}
+	case "tiled":
+		request.Tiles = &ob.TileOptions{
+			TileWidth:        globalConfig.Motion.TileSize,
+			TileHeight:       globalConfig.Motion.TileSize,
+			Overlap:          globalConfig.Motion.TileOverlap,
+			IncludeFullFrame: globalConfig.Motion.TileIncludeFullFrame,
+		}
+	case "motion":
+		if len(motionBlobs) > 0 {
+			// Never crop below the model size, small crops would just be upscaled. Blobs that end up overlapping share a crop
+			modelWidth, modelHeight := detector.ModelSize()
+			regions := make([]image.Rectangle, len(motionBlobs))
+			for i, blob := range motionBlobs {
+				regions[i] = ob.ExpandRegion(blob, frame.Bounds(), modelWidth, modelHeight, globalConfig.Motion.MotionCropMargin)
+			}
+			request.Regions = motionDetect.MergeOverlapping(regions)
+		}
+	}
+	return detector.Detect(request)
+}
+
+// networkDetector runs the embedded python server or networkObjectDetectServer on the whole frame, it has no
+// regions or tiles
+type networkDetector struct{}
+
+func (networkDetector) Detect(r sharedDetector.Request) ([]ob.Object, time.Duration, error) {
+	start := time.Now()
+	predict, err := objectPredict(r.Frame)
+	if err != nil {
+		return nil, 0, fmt.Errorf("objectPredict: %w", err)
+	}
+	objects := make([]ob.Object, len(predict))
+	for i, p := range predict {
+		objects[i] = ob.Object{
+			ClassID:    p.Object,
+			ClassName:  p.ClassName,
+			Confidence: p.Confidence,
+			X1:         float32(p.Left),
+			Y1:         float32(p.Top),
+			X2:         float32(p.Right),
+			Y2:         float32(p.Bottom),
+		}
+	}
+	return objects, time.Since(start), nil
+}
+
+func (networkDetector) ModelSize() (int, int) {
+	return 0, 0 // Unknown, motion crops are never used
 }
 
-func performDetectionOnObject(originalFrame *image.RGBA, frame *image.RGBA, prediction []Prediction) {
+// performDetectionOnObject tracks the predictions of a frame, all boxes are in frame pixels.
+// Boxes are drawn on a copy so the frame itself stays clean for motion detection.
+func performDetectionOnObject(frame *image.RGBA, prediction []Prediction) {
 	now := time.Now()
+	var annotated *image.RGBA // Copy of frame with boxes drawn, created on the first new object
 	for _, predict := range prediction {
 		// If class is not within LookForClasses, skip it
 		if len(globalConfig.Motion.LookForClasses) > 0 {
@@ -1167,204 +3122,526 @@ func performDetectionOnObject(originalFrame *image.RGBA, frame *image.RGBA, pred
 			Confidence: predict.Confidence,
 		}
 
-		exists := findObjectPosition(object)
-		if !exists {
+		exists := findObjectPosition(&object)
+		if exists {
+			recognizePlate(frame, &object)
+			recognizeFace(frame, &object)
+			embedAppearance(frame, &object)
+		}
+		// A track counts once, after it persisted and unless its class cools down
+		if runtimeConfig.Events.Admit(object, now) {
+			// Check if this object is within the areas of interest
+			for _, ignoreAreaClass := range globalConfig.IgnoreAreasClasses {
+				for _, class := range ignoreAreaClass.Class {
+					if class == object.Class {
+						if object.Center.X > ignoreAreaClass.Rect.Min.X && object.Center.X < ignoreAreaClass.Rect.Max.X && object.Center.Y > ignoreAreaClass.Rect.Min.Y && object.Center.Y < ignoreAreaClass.Rect.Max.Y {
+							// This object is within an ignore area, skip it
+							// fmt.Printf("Ignoring object %s @ %d|%f\n", object, object.Center)
+							// Log("warning", fmt.Sprintf("IGNORING OBJECT @ %d|%f [%s|%f]", object.Center, object.Area, object.Class, object.Confidence))
+							return
+						}
+					}
+				}
+			}
+
+			object.Labels = classifyObject(frame, object)
+			if !exists {
+				recognizePlate(frame, &object)
+				recognizeFace(frame, &object)
+				embedAppearance(frame, &object)
+			}
+
+			if annotated == nil {
+				annotated = cloneRGBA(frame)
+			}
+
+			Log("info", fmt.Sprintf("TRIGGERED NEW OBJECT @ COORD: %d AREA: %f [%s|%f]", object.Center, object.Area, object.Class, object.Confidence))
+			trigger := runtimeConfig.Events.Trigger(object, now)
+
+			ob.DrawRectangle(annotated, rect, color.RGBA{255, 165, 0, 255}, 2) // Draw orange rectangle
+
+			pt := image.Pt(predict.Left, predict.Top-5)
+			if predict.Top-5 < 0 {
+				pt = image.Pt(predict.Left, predict.Top+20) // if the box is too close to the top of the image, put the label inside the box
+			}
+			ob.AddLabelWithTTF(annotated, objectCaption(object), pt, color.RGBA{255, 165, 0, 255}, 12.0) // Orange size 12 font
+
+			// Send pushover notification (Motion Detected - Snapshot)
+			if trigger.Notify {
+				err := sendPushoverNotification(globalConfig.Notifications.PushoverUserKey, globalConfig.Notifications.PushoverAppToken, "Motion detected!", annotated)
+				if err != nil {
+					Log("error", fmt.Sprintf("Error sending pushover notification: %v", err))
+				}
+			}
+
+			// Add frames for gif
+			if globalConfig.Motion.GenerateGIF {
+				gifSliceMutex.Lock()
+				// 额外建议：加一个硬上限防止内存溢出，即使开启了GIF
+				if len(gifSlice) < 200 {
+					gifSlice = append(gifSlice, *cloneRGBA(annotated))
+				}
+				gifSliceMutex.Unlock()
+			}
+
+			// Store snapshot of the object, the file name is part of the event already
+			// 确保目录存在
+			fullSnapshotPath := filepath.Join(globalConfig.Video.HiResPath, trigger.Snapshot)
+			snapDir := filepath.Dir(fullSnapshotPath)
+			if _, err := os.Stat(snapDir); os.IsNotExist(err) {
+				os.MkdirAll(snapDir, 0755)
+			}
+			saveJPEG(fullSnapshotPath, annotated, 80) // 优化：稍微降低质量到80
+		}
+	}
+}
+
+// recognizePlate reads the plate of a vehicle and votes on the text per track. Once a text has MinVotes
+// it is attached to object and its entry in the current event, and a plate_recognized event is sent.
+func recognizePlate(frame *image.RGBA, object *TrackedObject) {
+	plates := globalConfig.Motion.PlateRecognition
+	if plates.Reader == nil || !slices.Contains(plates.ParentClasses, object.Class) {
+		return
+	}
+
+	now := time.Now()
+	for id, track := range plateTracks {
+		if now.Sub(track.LastSeen) > 30*time.Second { // Same expiry as lastPositions
+			delete(plateTracks, id)
+		}
+	}
+
+	track, ok := plateTracks[object.ID]
+	if !ok {
+		track = &plateTrack{Votes: ob.NewPlateVotes()}
+		plateTracks[object.ID] = track
+	}
+	track.LastSeen = now
+
+	// Plate already accepted or out of reads, carry the result over to the updated object
+	if track.Plate != "" || track.Votes.Reads >= plates.MaxReadsPerTrack {
+		if track.Plate != "" {
+			object.Plate, object.PlateConf, _ = track.Votes.Best()
+		}
+		return
+	}
+
+	reads, err := plates.Reader.Read(frame.SubImage(object.BBox))
+	if err != nil {
+		Log("error", fmt.Sprintf("Error reading plate: %v", err))
+		return
+	}
+	for _, read := range reads {
+		if read.Confidence >= float32(plates.MinConfidence) {
+			Log("debug", fmt.Sprintf("PLATE READ %s [%f] TRACK %s", read.Text, read.Confidence, object.ID))
+			track.Votes.Add(read.Text, read.Confidence)
+		}
+	}
+
+	plate, confidence, votes := track.Votes.Best()
+	if votes < plates.MinVotes {
+		return
+	}
+	track.Plate = plate
+	object.Plate, object.PlateConf = plate, confidence
+
+	list := matchPlateList(plate)
+	Log("info", fmt.Sprintf("PLATE RECOGNIZED %s [%f] VOTES: %d/%d LIST: %s", plate, confidence, votes, track.Votes.Reads, list))
+
+	eventID := updateEventObject(frame, *object, func(tracked *TrackedObject) {
+		tracked.Plate, tracked.PlateConf = plate, confidence
+	})
+
+	type Event struct {
+		Type       string        `json:"type"`
+		Timestamp  time.Time     `json:"timestamp"`
+		ID         string        `json:"id"`
+		CameraName string        `json:"camera_name"`
+		Plate      string        `json:"plate"`
+		Confidence float32       `json:"confidence"`
+		Votes      int           `json:"votes"`
+		List       string        `json:"list"` // allow, deny or unknown
+		Object     TrackedObject `json:"object"`
+	}
+
+	eventJson, err := json.Marshal(Event{
+		Type:       "plate_recognized",
+		Timestamp:  now,
+		ID:         eventID,
+		CameraName: globalConfig.CameraName,
+		Plate:      plate,
+		Confidence: confidence,
+		Votes:      votes,
+		List:       list,
+		Object:     *object,
+	})
+	if err != nil {
+		Log("error", fmt.Sprintf("Error marshalling plate_recognized event: %v", err))
+		return
+	}
+	eventHandler("plate_recognized", eventJson)
+}
+
+// updateEventObject applies update to the objects of the current event with track id and returns the event id.
+// A motion notification held back by the attributes filter is sent once the update allows it, on frame.
+func updateEventObject(frame *image.RGBA, object TrackedObject, update func(tracked *TrackedObject)) string {
+	eventID, notify := runtimeConfig.Events.UpdateObject(object.ID, update)
+	if notify {
+		msg := "Motion detected!"
+		if object.Identity != "" {
+			msg = fmt.Sprintf("Motion detected! (%s)", object.Identity)
+		}
+		snapshot := cloneRGBA(frame)
+		ob.DrawRectangle(snapshot, object.BBox, color.RGBA{255, 165, 0, 255}, 2)
+		ob.AddLabelWithTTF(snapshot, objectCaption(object), image.Pt(object.BBox.Min.X, max(object.BBox.Min.Y-5, 20)), color.RGBA{255, 165, 0, 255}, 12.0)
+		err := sendPushoverNotification(globalConfig.Notifications.PushoverUserKey, globalConfig.Notifications.PushoverAppToken, msg, snapshot)
+		if err != nil {
+			Log("error", fmt.Sprintf("Error sending pushover notification: %v", err))
+		}
+	}
+	return eventID
+}
+
+// eventAttributes collects the event wide attributes of objects, e.g. known_person if any face matched the gallery
+func eventAttributes(objects []TrackedObject) []string {
+	var attributes []string
+	for _, object := range objects {
+		if object.Identity != "" && !slices.Contains(attributes, object.Identity) {
+			attributes = append(attributes, object.Identity)
+		}
+	}
+	return attributes
+}
+
+// notificationAllowed reports whether an event with attributes passes the notifications attributes filter
+func notificationAllowed(attributes []string) bool {
+	if len(globalConfig.Notifications.Attributes) == 0 {
+		return true
+	}
+	for _, attribute := range attributes {
+		if slices.Contains(globalConfig.Notifications.Attributes, attribute) {
+			return true
+		}
+	}
+	return false
+}
+
+// recognizeFace looks for a face on a person and matches it against the enrolled gallery. A person is
+// known_person once a face matched, unknown_person if faces were seen but none matched within MaxRunsPerTrack.
+func recognizeFace(frame *image.RGBA, object *TrackedObject) {
+	faces := globalConfig.Motion.FaceRecognition
+	if faces.Recognizer == nil || object.Class != "person" {
+		return
+	}
+
+	now := time.Now()
+	for id, track := range faceTracks {
+		if now.Sub(track.LastSeen) > 30*time.Second { // Same expiry as lastPositions
+			delete(faceTracks, id)
+		}
+	}
+
+	track, ok := faceTracks[object.ID]
+	if !ok {
+		track = &faceTrack{}
+		faceTracks[object.ID] = track
+	}
+	track.LastSeen = now
+
+	if track.Person == "" && track.Runs < faces.MaxRunsPerTrack {
+		track.Runs++
+		detected, err := faces.Recognizer.Detect(frame.SubImage(object.BBox))
+		if err != nil {
+			Log("error", fmt.Sprintf("Error detecting faces: %v", err))
+			return
+		}
+
+		if len(detected) > 0 {
+			track.FaceSeen = true
+			faceEntriesMutex.RLock()
+			match, ok := faceGallery.BestMatch(faceEntries, detected[0].Embedding, float32(faces.MatchThreshold))
+			faceEntriesMutex.RUnlock()
+			Log("debug", fmt.Sprintf("FACE ON TRACK %s BEST MATCH %s [%f]", object.ID, match.Name, match.Similarity))
+			if ok {
+				track.Person, track.Similarity = match.Name, match.Similarity
+			}
+		}
+	}
+
+	identity := ""
+	switch {
+	case track.Person != "":
+		identity = "known_person"
+	case track.FaceSeen && track.Runs >= faces.MaxRunsPerTrack:
+		identity = "unknown_person"
+	}
+	if identity == "" {
+		return
+	}
+
+	object.Identity, object.Person, object.FaceMatch = identity, track.Person, track.Similarity
+	if track.Identity == identity {
+		return // Already reported for this track
+	}
+	track.Identity = identity
 
-			// Check if this object is within the areas of interest
-			for _, ignoreAreaClass := range globalConfig.IgnoreAreasClasses {
-				for _, class := range ignoreAreaClass.Class {
-					if class == object.Class {
-						if object.Center.X > ignoreAreaClass.Left && object.Center.X < ignoreAreaClass.Right && object.Center.Y > ignoreAreaClass.Top && object.Center.Y < ignoreAreaClass.Bottom {
-							// This object is within an ignore area, skip it
-							// fmt.Printf("Ignoring object %s @ %d|%f\n", object, object.Center)
-							// Log("warning", fmt.Sprintf("IGNORING OBJECT @ %d|%f [%s|%f]", object.Center, object.Area, object.Class, object.Confidence))
-							return
-						}
-					}
-				}
-			}
+	Log("info", fmt.Sprintf("FACE %s ON TRACK %s %s", identity, object.ID, track.Person))
+	// The motion notification may have been held back by the attributes filter until now
+	updateEventObject(frame, *object, func(tracked *TrackedObject) {
+		tracked.Identity, tracked.Person, tracked.FaceMatch = object.Identity, object.Person, object.FaceMatch
+	})
+}
 
-			Log("info", fmt.Sprintf("TRIGGERED NEW OBJECT @ COORD: %d AREA: %f [%s|%f]", object.Center, object.Area, object.Class, object.Confidence))
-			if !runtimeConfig.MotionTriggered {
-				// Lock mutex
-				runtimeConfig.MotionMutex.Lock()
-				runtimeConfig.MotionTriggered = true
-				runtimeConfig.MotionTriggeredLast = now
-				runtimeConfig.MotionVideo.CameraName = globalConfig.CameraName
-				runtimeConfig.MotionVideo.MotionStart = now
-
-				// 优化：使用时间戳作为ID，并增加随机码防止冲突
-				runtimeConfig.MotionVideo.ID = now.Format("20060102_150405") + "_" + generateRandomString(4)
-
-				// 优化：确定日期文件夹
-				dateFolder := now.Format("2006-01-02")
-				// 确保文件夹存在
-				basePath := filepath.Join(globalConfig.Video.HiResPath, dateFolder)
-				if _, err := os.Stat(basePath); os.IsNotExist(err) {
-					os.MkdirAll(basePath, 0755)
-				}
+// objectPredictConfig is the objectPredict client config built from the motion onnx settings
+func objectPredictConfig(config Config, mWidth, mHeight int) ob.Config {
+	return ob.Config{
+		Model:           config.Motion.OnnxModel,
+		EnableCoreMl:    config.Motion.OnnxEnableCoreMl,
+		EnableCuda:      config.Motion.OnnxEnableCuda,
+		CudaDeviceID:    config.Motion.OnnxCudaDeviceID,
+		ModelWidth:      mWidth,  // 传入宽度
+		ModelHeight:     mHeight, // 传入高度
+		SessionPoolSize: config.Motion.OnnxSessionPool,
+		MaxBatchSize:    config.Motion.OnnxMaxBatch,
+		Providers:       config.Motion.OnnxProviders,
+		ProviderOptions: config.Motion.OnnxProviderOptions,
+		LibraryPath:     config.Motion.OnnxLibraryPath,
+		IntraOpThreads:  config.Motion.OnnxIntraOpThreads,
+		InterOpThreads:  config.Motion.OnnxInterOpThreads,
+		ModelCacheDir:   config.Motion.OnnxModelCacheDir,
+	}
+}
 
-				runtimeConfig.MotionVideo.Objects = append(runtimeConfig.MotionVideo.Objects, object)
+// serveAppearanceEmbedder loads the appearance embedding model for the web server, on a client without a detector
+func serveAppearanceEmbedder() (*ob.CropModel, error) {
+	cfg := objectPredictConfig(globalConfig, globalConfig.Motion.OnnxModelWidth, globalConfig.Motion.OnnxModelHeight)
+	cfg.CropModelsOnly = true
+	client, err := ob.Init(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newAppearanceEmbedder(client)
+}
 
-				// 优化：视频文件名包含相对路径
-				videoFilename := fmt.Sprintf("clip_%s.ts", runtimeConfig.MotionVideo.ID)
-				// VideoFile 存储相对路径，方便后续处理
-				runtimeConfig.MotionVideo.VideoFile = filepath.Join(dateFolder, videoFilename)
+// newAppearanceEmbedder loads the appearance embedding model, used by the detector and by the web server for search by example
+func newAppearanceEmbedder(client *ob.Client) (*ob.CropModel, error) {
+	appearance := globalConfig.Motion.AppearanceEmbedding
+	return client.NewCropModel(ob.CropModelConfig{
+		Model:       appearance.Model,
+		ModelWidth:  appearance.ModelWidth,
+		ModelHeight: appearance.ModelHeight,
+		InputName:   appearance.InputName,
+		OutputName:  appearance.OutputName,
+		OutputSize:  appearance.EmbeddingSize,
+		Mean:        appearance.Mean,
+		Std:         appearance.Std,
+	})
+}
 
-				// 发送录制指令，使用绝对路径
-				runtimeConfig.HiResControlChannel <- RecordMsg{
-					Record:   true,
-					Filename: filepath.Join(globalConfig.Video.HiResPath, runtimeConfig.MotionVideo.VideoFile),
-				}
+// embedAppearance averages the appearance embeddings of a few crops of the track, spaced a second apart so
+// the samples see the object from different angles, and stores the result on object and its event entry.
+func embedAppearance(frame *image.RGBA, object *TrackedObject) {
+	appearance := globalConfig.Motion.AppearanceEmbedding
+	if appearance.Embedder == nil || (len(appearance.Classes) > 0 && !slices.Contains(appearance.Classes, object.Class)) {
+		return
+	}
 
-				// Notify in realtime about detected objects
-				type Event struct {
-					Type                string    `json:"type"`
-					Timestamp           time.Time `json:"timestamp"`
-					MotionTriggeredLast time.Time `json:"motion_triggered_last"`
-					ID                  string    `json:"id"`
-					MotionStart         time.Time `json:"motion_start"`
-					Objects             []TrackedObject
-					CameraName          string `json:"camera_name"`
-				}
+	now := time.Now()
+	for id, track := range appearanceTracks {
+		if now.Sub(track.LastSeen) > 30*time.Second { // Same expiry as lastPositions
+			delete(appearanceTracks, id)
+		}
+	}
 
-				eventRaw := Event{
-					Type:                "motion_started",
-					Timestamp:           time.Now(),
-					MotionTriggeredLast: time.Now(),
-					ID:                  runtimeConfig.MotionVideo.ID,
-					MotionStart:         runtimeConfig.MotionVideo.MotionStart,
-					Objects:             runtimeConfig.MotionVideo.Objects,
-					CameraName:          runtimeConfig.MotionVideo.CameraName,
-				}
-				eventJson, err := json.Marshal(eventRaw)
-				if err != nil {
-					Log("error", fmt.Sprintf("Error marshalling motion_started event: %v", err))
-					return
-				}
-				eventHandler("motion_start", eventJson)
+	track, ok := appearanceTracks[object.ID]
+	if !ok {
+		track = &appearanceTrack{}
+		appearanceTracks[object.ID] = track
+	}
+	track.LastSeen = now
 
-				// Send pushover notification (Motion Detected - Snapshot)
-				if globalConfig.Notifications.EnablePushoverAlerts {
-					frameCopy := *frame
+	if track.Samples < appearance.SamplesPerTrack && now.Sub(track.LastSample) >= time.Second {
+		crop := frame.SubImage(ob.ExpandRegion(object.BBox, frame.Bounds(), 0, 0, appearance.CropMargin))
+		embedding, err := appearance.Embedder.Run(crop)
+		if err != nil {
+			Log("error", fmt.Sprintf("Error computing appearance embedding: %v", err))
+			return
+		}
 
-					ob.DrawRectangle(&frameCopy, rect, color.RGBA{255, 165, 0, 255}, 2) // Draw orange rectangle
+		if track.Sum == nil {
+			track.Sum = make([]float32, len(embedding))
+		}
+		for i, v := range faceGallery.Normalize(embedding) {
+			track.Sum[i] += v
+		}
+		track.Samples++
+		track.LastSample = now
 
-					pt := image.Pt(predict.Left, predict.Top-5)
-					if predict.Top-5 < 0 {
-						pt = image.Pt(predict.Left, predict.Top+20) // if the box is too close to the top of the image, put the label inside the box
-					}
-					ob.AddLabelWithTTF(&frameCopy, fmt.Sprintf("%s %.2f", predict.ClassName, predict.Confidence), pt, color.RGBA{255, 165, 0, 255}, 12.0) // Orange size 12 font
+		mean := faceGallery.Normalize(track.Sum)
+		updateEventObject(frame, *object, func(tracked *TrackedObject) {
+			tracked.Embedding = mean
+		})
+	}
 
-					// Send pushover notification
-					err := sendPushoverNotification(globalConfig.Notifications.PushoverUserKey, globalConfig.Notifications.PushoverAppToken, "Motion detected!", &frameCopy)
-					if err != nil {
-						Log("error", fmt.Sprintf("Error sending pushover notification: %v", err))
-					}
-				}
+	if track.Samples > 0 {
+		object.Embedding = faceGallery.Normalize(track.Sum)
+	}
+}
 
-				// Unlock mutex
-				runtimeConfig.MotionMutex.Unlock()
+// watchFaceGallery reloads the enrolled embeddings whenever the gallery changes, until ctx is done
+func watchFaceGallery(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	var loaded time.Time
+	for {
+		if modified := globalConfig.Motion.FaceRecognition.Gallery.Modified(); !modified.Equal(loaded) {
+			if err := loadFaceGallery(); err != nil {
+				Log("error", fmt.Sprintf("Error loading face gallery: %v", err))
 			} else {
-				// Lock mutex
-				runtimeConfig.MotionMutex.Lock()
-				runtimeConfig.MotionTriggeredLast = now
-				runtimeConfig.MotionVideo.Objects = append(runtimeConfig.MotionVideo.Objects, object)
-
-				// Notify in realtime about detected objects
-				type Event struct {
-					Type                string    `json:"type"`
-					Timestamp           time.Time `json:"timestamp"`
-					MotionTriggeredLast time.Time `json:"motion_triggered_last"`
-					ID                  string    `json:"id"`
-					MotionStart         time.Time `json:"motion_start"`
-					Objects             []TrackedObject
-					CameraName          string `json:"camera_name"`
-				}
+				loaded = modified
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
 
-				eventRaw := Event{
-					Type:                "motion_update",
-					Timestamp:           time.Now(),
-					MotionTriggeredLast: time.Now(),
-					ID:                  runtimeConfig.MotionVideo.ID,
-					MotionStart:         runtimeConfig.MotionVideo.MotionStart,
-					Objects:             runtimeConfig.MotionVideo.Objects,
-					CameraName:          runtimeConfig.MotionVideo.CameraName,
-				}
-				eventJson, err := json.Marshal(eventRaw)
+// loadFaceGallery computes the embeddings of new gallery photos, caches them in the gallery and swaps faceEntries
+func loadFaceGallery() error {
+	faces := globalConfig.Motion.FaceRecognition
+	people, err := faces.Gallery.People()
+	if err != nil {
+		return err
+	}
+	cached, err := faces.Gallery.Embeddings()
+	if err != nil {
+		return err
+	}
+
+	embeddings := map[string][]float32{} // Only photos still enrolled are kept in the cache
+	var entries []faceGallery.Entry
+	for _, person := range people {
+		for _, photo := range person.Photos {
+			key := person.ID + "/" + photo
+			embedding, ok := cached[key]
+			if !ok {
+				embedding, err = embedGalleryPhoto(filepath.Join(faces.Gallery.Dir, person.ID, photo))
 				if err != nil {
-					Log("error", fmt.Sprintf("Error marshalling motion_update event: %v", err))
-					return
+					Log("warning", fmt.Sprintf("Skipping face gallery photo %s of %s: %v", photo, person.Name, err))
+					continue
 				}
-				eventHandler("motion_update", eventJson)
-
-				// Unlock mutex
-				runtimeConfig.MotionMutex.Unlock()
 			}
+			embeddings[key] = embedding
+			entries = append(entries, faceGallery.Entry{PersonID: person.ID, Name: person.Name, Embedding: faceGallery.Normalize(embedding)})
+		}
+	}
 
-			// Log("error", fmt.Sprintf("STORED %d OBJECTS", len(runtimeConfig.MotionVideo.Objects)))
+	if err := faces.Gallery.SaveEmbeddings(embeddings); err != nil {
+		return err
+	}
 
-			ob.DrawRectangle(frame, rect, color.RGBA{255, 165, 0, 255}, 2) // Draw orange rectangle
+	faceEntriesMutex.Lock()
+	faceEntries = entries
+	faceEntriesMutex.Unlock()
+	Log("info", fmt.Sprintf("Face gallery loaded: %d people, %d photos", len(people), len(entries)))
+	return nil
+}
 
-			pt := image.Pt(predict.Left, predict.Top-5)
-			if predict.Top-5 < 0 {
-				pt = image.Pt(predict.Left, predict.Top+20) // if the box is too close to the top of the image, put the label inside the box
+// embedGalleryPhoto embeds the largest face of a photo, photos without a detectable face are assumed to be a face crop
+func embedGalleryPhoto(path string) ([]float32, error) {
+	img, err := ob.LoadImage(path)
+	if err != nil {
+		return nil, err
+	}
+
+	recognizer := globalConfig.Motion.FaceRecognition.Recognizer
+	detected, err := recognizer.Detect(img)
+	if err != nil {
+		return nil, err
+	}
+	if len(detected) > 0 {
+		return detected[0].Embedding, nil
+	}
+	return recognizer.Embed(img)
+}
+
+// matchPlateList returns deny or allow if plate is within MaxListDistance of an entry of those lists, deny wins
+func matchPlateList(plate string) string {
+	plates := globalConfig.Motion.PlateRecognition
+	matches := func(list []string) bool {
+		for _, entry := range list {
+			if ob.PlateDistance(plate, ob.NormalizePlate(entry)) <= plates.MaxListDistance {
+				return true
 			}
-			ob.AddLabelWithTTF(frame, fmt.Sprintf("%s %.2f", predict.ClassName, predict.Confidence), pt, color.RGBA{255, 165, 0, 255}, 12.0) // Orange size 12 font
+		}
+		return false
+	}
 
-			// Store snapshot of the object
-			if runtimeConfig.MotionVideo.ID != "" {
-				// 优化：快照放入日期文件夹
-				dateFolder := now.Format("2006-01-02")
-				snapshotFilename := filepath.Join(dateFolder, fmt.Sprintf("snap_%s_%s.jpg", runtimeConfig.MotionVideo.ID, generateRandomString(4)))
-				runtimeConfig.MotionVideo.Snapshots = append(runtimeConfig.MotionVideo.Snapshots, snapshotFilename)
+	switch {
+	case matches(plates.DenyList):
+		return "deny"
+	case matches(plates.AllowList):
+		return "allow"
+	default:
+		return "unknown"
+	}
+}
 
-				if originalFrame != nil {
-					origWidth, origHeight := ob.GetImageDimensions(originalFrame)
-					// Resize the image to the original dimensions
-					frame = ob.RemovePadding(frame, origWidth, origHeight)
-				}
+// objectCaption is the text drawn next to the box of object, class and confidence followed by the secondary labels
+func objectCaption(object TrackedObject) string {
+	caption := fmt.Sprintf("%s %.2f", object.Class, object.Confidence)
+	for _, label := range object.Labels {
+		caption += " " + label.Label
+	}
+	if object.Plate != "" {
+		caption += " " + object.Plate
+	}
+	return caption
+}
 
-				// Add frames for gif
-				// Add frames for gif
-				copyFrame := *frame
-				if globalConfig.Motion.GenerateGIF {
-					gifSliceMutex.Lock()
-					// 额外建议：加一个硬上限防止内存溢出，即使开启了GIF
-					if len(gifSlice) < 200 {
-						gifSlice = append(gifSlice, copyFrame)
-					}
-					gifSliceMutex.Unlock()
-				}
+// classifyObject runs the secondary classifiers configured for the class of object on its crop of frame
+func classifyObject(frame *image.RGBA, object TrackedObject) []ObjectLabel {
+	var labels []ObjectLabel
+	for _, classifier := range globalConfig.Motion.SecondaryClassifiers {
+		if classifier.Classifier == nil || !slices.Contains(classifier.ParentClasses, object.Class) {
+			continue
+		}
 
-				// 确保目录存在
-				fullSnapshotPath := filepath.Join(globalConfig.Video.HiResPath, snapshotFilename)
-				snapDir := filepath.Dir(fullSnapshotPath)
-				if _, err := os.Stat(snapDir); os.IsNotExist(err) {
-					os.MkdirAll(snapDir, 0755)
-				}
-				saveJPEG(fullSnapshotPath, frame, 80) // 优化：稍微降低质量到80
-			} else {
-				Log("warning", "runtimeConfig.MotionVideo.ID is empty, not writing snapshot. This shouldnt happen.")
-			}
+		crop := frame.SubImage(ob.ExpandRegion(object.BBox, frame.Bounds(), 0, 0, classifier.CropMargin))
+		label, err := classifier.Classifier.Classify(crop)
+		if err != nil {
+			Log("error", fmt.Sprintf("Error running secondary classifier %s: %v", classifier.Name, err))
+			continue
+		}
+		if label.Confidence < float32(classifier.ConfidenceMinThreshold) {
+			continue
 		}
+
+		Log("debug", fmt.Sprintf("CLASSIFIED %s AS %s:%s [%f]", object.Class, classifier.Name, label.Name, label.Confidence))
+		labels = append(labels, ObjectLabel{Classifier: classifier.Name, Label: label.Name, Confidence: label.Confidence})
 	}
+	return labels
 }
 
-// Function that goes over lastPositions and checks if any of them are within of a threshold of the current center
-func findObjectPosition(object TrackedObject) bool {
+// Function that goes over lastPositions and checks if any of them are within of a threshold of the current center.
+// A matched object takes over the track id of the previous position, a new object gets a new id.
+func findObjectPosition(object *TrackedObject) bool {
 	// Check if this object has been seen before
 	for i := 0; i < len(lastPositions); i++ {
 		distance := math.Sqrt(float64((object.Center.X-lastPositions[i].Center.X)*(object.Center.X-lastPositions[i].Center.X) + (object.Center.Y-lastPositions[i].Center.Y)*(object.Center.Y-lastPositions[i].Center.Y)))
 		// fmt.Printf("Distance: %v\n", distance)
-		if distance < globalConfig.ObjectCenterMovementThreshold {
+		if distance < runtimeConfig.FrameGeometry.ObjectCenterMovementThreshold {
 			// Compare area as well to see if its +- within the threshold
 			areaDiff := math.Abs(object.Area - lastPositions[i].Area)
 			// fmt.Printf("Area diff: %v\n", areaDiff)
-			if areaDiff < globalConfig.ObjectAreaThreshold {
+			if areaDiff < runtimeConfig.FrameGeometry.ObjectAreaThreshold {
 				// This means a match, overwrite old object with updated one
 				// Log("warning", fmt.Sprintf("UPDATING OBJECT @ %d|%f TO %d|%f DISTANCE: %d ADIFF: %d", lastPositions[i].Center, lastPositions[i].Area, object.Center, object.Area, int(distance), int(areaDiff)))
-				lastPositions[i] = object
+				object.ID = lastPositions[i].ID
+				lastPositions[i] = *object
 				return true
 			}
 		}
@@ -1381,7 +3658,8 @@ func findObjectPosition(object TrackedObject) bool {
 	}
 
 	// This is a new object, add it
-	lastPositions = append(lastPositions, object)
+	object.ID = generateRandomString(8)
+	lastPositions = append(lastPositions, *object)
 	return false
 }
 
@@ -1390,8 +3668,7 @@ func streamImage(img *image.RGBA, stream *mjpeg.Stream) {
 	if globalConfig.StreamDrawIgnoredAreas {
 		for _, ignoreAreaClass := range globalConfig.IgnoreAreasClasses {
 			// Draw the ignore area
-			rect := image.Rect(ignoreAreaClass.Left, ignoreAreaClass.Top, ignoreAreaClass.Right, ignoreAreaClass.Bottom)
-			ob.DrawRectangle(img, rect, color.RGBA{255, 0, 0, 0}, 2)
+			ob.DrawRectangle(img, ignoreAreaClass.Rect, color.RGBA{255, 0, 0, 0}, 2)
 		}
 	}
 
@@ -1409,6 +3686,7 @@ func streamImage(img *image.RGBA, stream *mjpeg.Stream) {
 func startWebcamStream(stream *mjpeg.Stream) {
 	// start http server
 	http.Handle("/", stream)
+	http.Handle("/metrics", metricsRegistry.Handler())
 
 	server := &http.Server{
 		Addr:         globalConfig.OutputStreamAddr,
@@ -1416,7 +3694,136 @@ func startWebcamStream(stream *mjpeg.Stream) {
 		WriteTimeout: 60 * time.Second,
 	}
 
-	log.Fatal(server.ListenAndServe())
+	if err := server.ListenAndServe(); err != nil {
+		Log("error", fmt.Sprintf("Output stream server failed: %v", err))
+	}
+}
+
+// startMetricsServer serves /metrics on metricsAddr, for setups without the output stream
+func startMetricsServer() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metricsRegistry.Handler())
+	server := &http.Server{
+		Addr:         globalConfig.MetricsAddr,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		Log("error", fmt.Sprintf("Metrics server failed: %v", err))
+	}
+}
+
+// trackRestarts exports the restarts of the lo, hi or detector supervisor to /metrics and the status file
+func trackRestarts(process string, sup *supervisor.Supervisor) {
+	processRestarts.Func(func() float64 { return float64(sup.Restarts()) }, globalConfig.CameraName, process)
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	statusRestarts[process] = sup.Restarts
+}
+
+// updateStatus changes the live state of the camera, the next writeStatus picks it up
+func updateStatus(update func(s *cameraStatus.Snapshot)) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	update(&status)
+}
+
+// setProcessUp records a lo, hi or detector process going up or down
+func setProcessUp(process string, up bool) {
+	updateStatus(func(s *cameraStatus.Snapshot) {
+		switch process {
+		case "lo":
+			s.Lo.Up = up
+		case "hi":
+			s.Hi.Up = up
+		case "detector":
+			s.Detector.Up = up
+		}
+	})
+}
+
+// runStatusWriter writes the status file every statusInterval until ctx is done
+func runStatusWriter(ctx context.Context) {
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		writeStatus(true)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeStatus writes the state of the camera to <hiResPath>/status/<cameraName>.json for the status page of the
+// web server, running is false for the last write on shutdown
+func writeStatus(running bool) {
+	snapshot := cameraStatus.Snapshot{
+		Camera:  globalConfig.CameraName,
+		Version: Version,
+		PID:     os.Getpid(),
+		Updated: time.Now(),
+		Running: running,
+	}
+
+	if event, ok := runtimeConfig.Events.Current(); ok {
+		snapshot.ActiveEvent, snapshot.EventStart = event.ID, event.Start
+	}
+
+	hiResPath := globalConfig.Video.HiResPath
+	storage := cameraStatus.Storage{Path: hiResPath}
+	storage.FreeBytes, storage.TotalBytes, _ = metrics.DiskSpace(hiResPath)
+	statusMutex.Lock()
+	measure := time.Since(statusUsedAt) > 10*time.Minute
+	statusMutex.Unlock()
+	if measure {
+		used := cameraStatus.DirSize(hiResPath)
+		updateStatus(func(s *cameraStatus.Snapshot) {
+			s.Storage.UsedBytes, s.Storage.Measured = used, time.Now()
+			statusUsedAt = s.Storage.Measured
+		})
+	}
+
+	statusMutex.Lock()
+	snapshot.Started = status.Started
+	snapshot.LastFrame, snapshot.Motion, snapshot.MotionRatio = status.LastFrame, status.Motion, status.MotionRatio
+	snapshot.Lo = cameraStatus.Stream{
+		URL:    cameraStatus.RedactURL(globalConfig.DeviceUrl),
+		Width:  runtimeConfig.LoResStreamParams.Width,
+		Height: runtimeConfig.LoResStreamParams.Height,
+		FPS:    runtimeConfig.LoResStreamParams.FPS,
+		Up:     status.Lo.Up,
+	}
+	snapshot.Hi = cameraStatus.Stream{
+		URL:    cameraStatus.RedactURL(globalConfig.HiResDeviceUrl),
+		Width:  runtimeConfig.HiResStreamParams.Width,
+		Height: runtimeConfig.HiResStreamParams.Height,
+		FPS:    runtimeConfig.HiResStreamParams.FPS,
+		Codec:  runtimeConfig.CodecName,
+		Up:     status.Hi.Up,
+	}
+	snapshot.Detector = status.Detector
+	snapshot.Sinks = maps.Clone(status.Sinks)
+	storage.UsedBytes, storage.Measured = status.Storage.UsedBytes, status.Storage.Measured
+	snapshot.Storage = storage
+	restarts := maps.Clone(statusRestarts)
+	statusMutex.Unlock()
+
+	if restarts["lo"] != nil {
+		snapshot.Lo.Restarts = restarts["lo"]()
+	}
+	if restarts["hi"] != nil {
+		snapshot.Hi.Restarts = restarts["hi"]()
+	}
+	if restarts["detector"] != nil {
+		snapshot.Detector.Restarts = restarts["detector"]()
+	}
+
+	if err := cameraStatus.Write(cameraStatus.Path(hiResPath, globalConfig.CameraName), snapshot); err != nil {
+		Log("warning", fmt.Sprintf("Cannot write status file: %v", err))
+	}
 }
 
 func establishConnection() error {
@@ -1522,11 +3929,10 @@ func objectPredict(imgRaw image.Image) ([]Prediction, error) {
 	}
 }
 
-func startObjectDetector(scriptPath string) {
+// startObjectDetector runs the embedded python object server under a supervisor until ctx is cancelled. It is
+// restarted when it exits or stops accepting connections on addr, with a growing delay while it keeps failing.
+func startObjectDetector(ctx context.Context, scriptPath, addr string) {
 	basePath := filepath.Dir(scriptPath)
-	restartCount := 0
-	pidFileName := filepath.Base(scriptPath) + ".pid"
-	pidFilePath := filepath.Join("/tmp", pidFileName)
 
 	// Read the first line of the script to get the shebang
 	file, err := os.Open(scriptPath)
@@ -1549,80 +3955,48 @@ func startObjectDetector(scriptPath string) {
 		interpreterArgs = []string{"python3"} // Default interpreter if shebang is not found or incorrect
 	}
 
-	// Try to read existing PID file
-	pidData, err := os.ReadFile(pidFilePath)
-	if err == nil {
-		pid, err := strconv.Atoi(string(pidData))
-		if err == nil {
-			process, err := os.FindProcess(pid)
-			if err == nil {
-				process.Kill() // Try to kill the existing process
+	sup := newSupervisor("detector", supervisor.Config{
+		PidFile: filepath.Join("/tmp", filepath.Base(scriptPath)+".pid"), // Kills a server left behind by a crash
+		Probe: func(ctx context.Context) error {
+			conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return err
 			}
-		}
+			return conn.Close()
+		},
+		StartGrace: 2 * time.Minute, // Loading the model takes a while
+	})
+	sup.Config.Up = func() {
+		setProcessUp("detector", true)
+		Log("info", "Embedded python object server is up")
 	}
+	sup.Config.Down = func(exit supervisor.Exit) { childEvent("detector_down", "detector", exit) }
+	trackRestarts("detector", sup)
 
-	for {
-		if restartCount > 3 {
-			Log("error", "Embedded python script failed 3 times, giving up")
-			os.Exit(1)
-		}
-
-		cmd := exec.Command(interpreterArgs[0], append(interpreterArgs[1:], "-u", scriptPath)...)
+	sup.Run(ctx, func(ctx context.Context) error {
+		cmd := sup.Command(ctx, interpreterArgs[0], append(interpreterArgs[1:], "-u", scriptPath)...)
 		cmd.Dir = basePath
 
 		stdout, err := cmd.StdoutPipe()
 		if err != nil {
-			Log("error", fmt.Sprintf("Error creating StdoutPipe for Cmd: %v", err))
-			continue
+			return fmt.Errorf("error creating StdoutPipe for Cmd: %w", err)
 		}
 
-		var stderr bytes.Buffer
-		cmd.Stderr = &stderr
-
 		Log("info", "Starting embedded python object server")
-		err = cmd.Start()
-
-		if err != nil {
-			Log("error", fmt.Sprintf("Error starting Cmd: %v", err))
-			continue
-		}
-
-		// Write PID to file
-		err = os.WriteFile(pidFilePath, []byte(strconv.Itoa(cmd.Process.Pid)), 0644)
-		if err != nil {
-			Log("error", fmt.Sprintf("Error writing PID to file: %v", err))
-			cmd.Process.Kill()
-			continue
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("error starting Cmd: %w", err)
 		}
+		sup.Started(cmd)
 
 		go readOutput(stdout)
 
-		// Create a channel to catch signals to the process
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-		go func() {
-			<-c
-			if cmd.Process != nil {
-				cmd.Process.Kill()
-			}
-			os.Remove(pidFilePath) // Remove PID file
-			os.Exit(1)
-		}()
-
 		runtimeConfig.modelReady = true // Allow objectPredict to start sending images
 
-		err = cmd.Wait()
-		if err != nil {
-			Log("error", fmt.Sprintf("Embedded python script failed: %s", stderr.String()))
-		} else {
-			Log("info", "Embedded python script exited, restarting...")
+		if err := cmd.Wait(); err != nil { // Killed by ctx on shutdown
+			return fmt.Errorf("embedded python script failed: %w", err)
 		}
-
-		os.Remove(pidFilePath) // Remove PID file
-
-		time.Sleep(2 * time.Second)
-		restartCount++
-	}
+		return errors.New("embedded python script exited")
+	})
 }
 
 // Helped function for startObjectDetector
@@ -1641,21 +4015,12 @@ func readOutput(r io.ReadCloser) {
 	}
 }
 
-// Function that copies assetsFs to /tmp in a random folder and returns path
+// Function that copies assetsFs to /tmp in a random folder and returns path, the caller removes it
 func copyAssetsToTemp() string {
 	// Create a random folder in /tmp
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	tempDir := fmt.Sprintf("/tmp/%d", r.Intn(1000)+1)
-	os.Mkdir(tempDir, 0755)
-
-	// Delete the temporary directory when the application exits
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-c
-		os.RemoveAll(tempDir)
-		os.Exit(0)
-	}()
+	os.Mkdir(tempDir, 0755) // Removed by main on shutdown
 
 	// Copy assets to temp dir
 	assets, err := assetsFs.ReadDir("assets") // Read the "assets" directory instead of "."
@@ -1694,7 +4059,8 @@ func copyAssetsToTemp() string {
 func printTemplateFile() {
 	fileBytes, err := assetsFs.ReadFile("assets/template.json")
 	if err != nil {
-		log.Fatalf("Failed to read template file: %v", err)
+		Log("error", fmt.Sprintf("Failed to read template file: %v", err))
+		return
 	}
 
 	fmt.Println(string(fileBytes))
@@ -1710,35 +4076,11 @@ func generateRandomString(length int) string {
 	return string(b)
 }
 
-// 优化：增加了步长 (stride)，减少了 CPU 计算量
-func CountChangedPixels(img1, img2 *image.RGBA, threshold uint8) int {
-	if img1.Bounds() != img2.Bounds() {
-		return -1
-	}
-
-	count := 0
-	step := 2 // 优化：每隔2个像素检查一次，减少75%计算量
-	bounds := img1.Bounds()
-	width, height := bounds.Dx(), bounds.Dy()
-
-	for y := 0; y < height; y += step {
-		for x := 0; x < width; x += step {
-			offset := y*img1.Stride + x*4
-			r1, g1, b1 := int(img1.Pix[offset]), int(img1.Pix[offset+1]), int(img1.Pix[offset+2])
-			r2, g2, b2 := int(img2.Pix[offset]), int(img2.Pix[offset+1]), int(img2.Pix[offset+2])
-			gray1 := (299*r1 + 587*g1 + 114*b1) / 1000
-			gray2 := (299*r2 + 587*g2 + 114*b2) / 1000
-			diff := gray1 - gray2
-			if diff < 0 {
-				diff = -diff
-			}
-			if uint8(diff) > threshold {
-				count++
-			}
-		}
-	}
-
-	return count
+// cloneRGBA returns a deep copy of img
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Src)
+	return dst
 }
 
 func saveJPEG(filename string, img *image.RGBA, quality int) {
@@ -1785,35 +4127,28 @@ func sendToMQTT(topic string, message string, host string, port int, user string
 	return nil // Return nil if there were no errors
 }
 
-func calcInferenceStats(predict []Prediction) {
-	// Calculate avg of all predict times for this run
-	stats := InferenceStats{}
-	stats.Min = math.MaxFloat64
-	count := 0
-
-	if len(predict) == 0 {
-		return
-	}
-
-	for _, prediction := range predict {
-		if prediction.Took > float64(1000/everyNthFrame) {
-			Log("warning", fmt.Sprintf("Inference took %fms, max ceiling should be: %dms", prediction.Took, 1000/everyNthFrame))
+// calcInferenceStats records the latency of one inference call (in ms), it is safe to call from
+// multiple goroutines so concurrent or batched predictions all feed the same averages
+func calcInferenceStats(took float64) {
+	inferenceStatsMutex.Lock()
+	defer inferenceStatsMutex.Unlock()
+
+	updateStatus(func(s *cameraStatus.Snapshot) {
+		s.Detector.Up = true // Down again once the embedded server fails
+		s.Detector.Inferences++
+		s.Detector.LastRun = time.Now()
+		if s.Detector.Inferences == 1 { // Until the first window is averaged
+			s.Detector.AvgMs, s.Detector.MinMs, s.Detector.MaxMs = took, took, took
 		}
+	})
 
-		if prediction.Took > stats.Max {
-			stats.Max = prediction.Took
-		}
-
-		if prediction.Took < stats.Min {
-			stats.Min = prediction.Took
-		}
-
-		stats.Avg += prediction.Took
-		count++
+	// Slower inference than the detection rate just lowers the rate the scheduler hands out
+	ceiling := int(1000 / globalConfig.Motion.DetectFps)
+	if took > float64(ceiling) {
+		Log("warning", fmt.Sprintf("Inference took %fms, max ceiling should be: %dms", took, ceiling))
 	}
 
-	stats.Avg = stats.Avg / float64(count)
-
+	stats := InferenceStats{Avg: took, Min: took, Max: took}
 	runtimeConfig.InferenceTimingBuffer = append(runtimeConfig.InferenceTimingBuffer, stats)
 
 	if len(runtimeConfig.InferenceTimingBuffer) >= interenceAvgInterval {
@@ -1833,6 +4168,9 @@ func calcInferenceStats(predict []Prediction) {
 		}
 
 		statsFinal.Avg = statsFinal.Avg / float64(len(runtimeConfig.InferenceTimingBuffer))
+		updateStatus(func(s *cameraStatus.Snapshot) {
+			s.Detector.AvgMs, s.Detector.MinMs, s.Detector.MaxMs = statsFinal.Avg, statsFinal.Min, statsFinal.Max
+		})
 
 		// Log avg inference time
 		type Event struct {
@@ -1850,7 +4188,7 @@ func calcInferenceStats(predict []Prediction) {
 			InferenceAvg: statsFinal.Avg,
 			InferenceMin: statsFinal.Min,
 			InferenceMax: statsFinal.Max,
-			Ceiling:      1000 / everyNthFrame,
+			Ceiling:      ceiling,
 		}
 		eventJson, err := json.Marshal(eventRaw)
 		if err != nil {
@@ -1865,43 +4203,162 @@ func calcInferenceStats(predict []Prediction) {
 	}
 }
 
-func endMotionEvent() {
-	// Log("info", fmt.Sprintf("SINCE_LAST_EVENT: %d GAP: %d", time.Since(runtimeConfig.MotionTriggeredLast), time.Duration(globalConfig.Motion.EventGap)*time.Second))
-	Log("info", "MOTION_ENDED")
-	runtimeConfig.MotionTriggered = false
-	runtimeConfig.MotionMutex.Lock()
+// hiResRecorder controls recordRTSPStream for the event manager, clip files are relative to the hi res path
+type hiResRecorder struct{}
+
+func (hiResRecorder) Record(videoFile string, until time.Time) {
+	runtimeConfig.HiResControlChannel <- RecordMsg{Record: true, Filename: filepath.Join(globalConfig.Video.HiResPath, videoFile), Until: until}
+}
+
+func (hiResRecorder) Stop() {
+	runtimeConfig.HiResControlChannel <- RecordMsg{Record: false}
+}
+
+// newMotionEvents creates the event manager from the motion config
+func newMotionEvents() *motionEvents.Manager[TrackedObject] {
+	cooldown := make(map[string]time.Duration, len(globalConfig.Motion.ClassCooldownSeconds))
+	for class, seconds := range globalConfig.Motion.ClassCooldownSeconds {
+		cooldown[class] = time.Duration(seconds) * time.Second
+	}
+
+	return motionEvents.New(motionEvents.Config[TrackedObject]{
+		CameraName: globalConfig.CameraName,
+		Lifecycle: eventLifecycle.Config{
+			MinPersistence: time.Duration(globalConfig.Motion.MinObjectSeconds * float64(time.Second)),
+			Gap:            time.Duration(globalConfig.Motion.EventGap) * time.Second,
+			PostRoll:       time.Duration(globalConfig.Motion.PostRollSeconds) * time.Second,
+			MaxDuration:    time.Duration(globalConfig.Motion.MaxEventSeconds) * time.Second,
+			Cooldown:       cooldown,
+		},
+		Recorder:   hiResRecorder{},
+		TrackID:    func(object TrackedObject) string { return object.ID },
+		Class:      func(object TrackedObject) string { return object.Class },
+		Attributes: eventAttributes,
+		Notify: func(attributes []string) bool {
+			return globalConfig.Notifications.EnablePushoverAlerts && notificationAllowed(attributes)
+		},
+		// 优化：使用时间戳作为ID，并增加随机码防止冲突
+		NewID: func(now time.Time) string {
+			return now.Format("20060102_150405") + "_" + generateRandomString(4)
+		},
+		// 优化：视频文件名包含相对路径，放入日期文件夹
+		VideoFile: func(id string, start time.Time) string {
+			return filepath.Join(start.Format("2006-01-02"), fmt.Sprintf("clip_%s.ts", id))
+		},
+		SnapshotFile: func(id string, now time.Time) string {
+			return filepath.Join(now.Format("2006-01-02"), fmt.Sprintf("snap_%s_%s.jpg", id, generateRandomString(4)))
+		},
+		Started: func(event motionEvents.Event[TrackedObject]) {
+			eventsStarted.With(globalConfig.CameraName, event.Objects[0].Class).Inc()
+			if event.ContinuedFrom != "" {
+				Log("info", "MOTION_SPLIT", "event_id", event.ID, "continued_from", event.ContinuedFrom)
+			}
+			eventSink <- func() { sendMotionEvent("motion_started", "motion_start", event) }
+		},
+		Updated: func(event motionEvents.Event[TrackedObject]) {
+			eventSink <- func() { sendMotionEvent("motion_update", "motion_update", event) }
+		},
+		Ended: endMotionEvent,
+	})
+}
+
+// sendMotionEvent sends event as eventType
+func sendMotionEvent(eventType string, handlerType string, event motionEvents.Event[TrackedObject]) {
+	type Event struct {
+		Type                string    `json:"type"`
+		Timestamp           time.Time `json:"timestamp"`
+		MotionTriggeredLast time.Time `json:"motion_triggered_last"`
+		ID                  string    `json:"id"`
+		MotionStart         time.Time `json:"motion_start"`
+		Objects             []TrackedObject
+		MotionEnd           *time.Time `json:"motion_end,omitempty"`
+		CameraName          string     `json:"camera_name"`
+		Attributes          []string   `json:"attributes"`
+		ContinuedFrom       string     `json:"continued_from,omitempty"`
+		Snapshots           []string   `json:"snapshots"`  // Relative to hiResPath, like in the metadata
+		VideoFile           string     `json:"video_file"` // Relative to hiResPath, the .ts clip before it was recoded
+	}
+
+	eventRaw := Event{
+		Type:                eventType,
+		Timestamp:           time.Now(),
+		MotionTriggeredLast: event.LastTriggered,
+		ID:                  event.ID,
+		MotionStart:         event.Start,
+		Objects:             event.Objects,
+		CameraName:          event.CameraName,
+		Attributes:          event.Attributes,
+		ContinuedFrom:       event.ContinuedFrom,
+		Snapshots:           event.Snapshots,
+		VideoFile:           event.VideoFile,
+	}
+	if !event.End.IsZero() {
+		eventRaw.MotionEnd = &event.End
+	}
+	eventJson, err := json.Marshal(eventRaw)
+	if err != nil {
+		Log("error", fmt.Sprintf("Error marshalling %s event: %v", eventType, err))
+		return
+	}
+	eventHandler(handlerType, eventJson)
+}
+
+// eventSink runs the side effects of motion events (event handlers, notifications, metadata) one after the
+// other, so the event manager never waits on the network or the disk and the order of events is kept
+var eventSink = make(chan func(), 256)
+var eventSinkDone = make(chan struct{})
+
+// runEventSink runs the side effects until eventSink is closed
+func runEventSink() {
+	defer close(eventSinkDone)
+	for sideEffect := range eventSink {
+		sideEffect()
+	}
+}
+
+// endMotionEvent is called by the event manager when a clip ended, the recorder was already told to stop
+// or to continue in the next clip
+func endMotionEvent(event motionEvents.Event[TrackedObject]) {
+	Log("info", "MOTION_ENDED", "event_id", event.ID)
+	eventsEnded.With(globalConfig.CameraName, event.Objects[0].Class).Inc()
+
+	// Take the gif frames of this event now, the next one may start collecting before the sink gets to it
+	gifSliceMutex.Lock()
+	frames := gifSlice
+	gifSlice = make([]image.RGBA, 0) // 必须清理内存，否则内存泄漏
+	gifSliceMutex.Unlock()
+
+	eventSink <- func() { finishMotionEvent(event, frames) }
+}
 
+// finishMotionEvent sends the motion ended notification with the gif frames of the event and writes its metadata
+func finishMotionEvent(event motionEvents.Event[TrackedObject], frames []image.RGBA) {
 	// 优化：日期文件夹处理
-	dateFolder := runtimeConfig.MotionVideo.MotionStart.Format("2006-01-02")
+	dateFolder := event.Start.Format("2006-01-02")
 	basePath := filepath.Join(globalConfig.Video.HiResPath, dateFolder)
 	if _, err := os.Stat(basePath); os.IsNotExist(err) {
 		os.MkdirAll(basePath, 0755)
 	}
 
-	// 拼接完整路径
-	fullVideoPath := filepath.Join(globalConfig.Video.HiResPath, runtimeConfig.MotionVideo.VideoFile)
-
-	if globalConfig.Notifications.EnablePushoverAlerts {
+	if globalConfig.Notifications.EnablePushoverAlerts && notificationAllowed(event.Attributes) {
 		// 计算本次运动持续时间，用于通知文案
-		duration := runtimeConfig.MotionVideo.MotionEnd.Sub(runtimeConfig.MotionVideo.MotionStart).Round(time.Second)
+		duration := event.End.Sub(event.Start).Round(time.Second)
 
 		if globalConfig.Motion.GenerateGIF {
 			// === 情况 A: 开启了 Pushover 且 开启了 GIF ===
-			gifSliceMutex.Lock()
-
-			if len(gifSlice) > 0 {
-				gifPath := filepath.Join(basePath, fmt.Sprintf("%s.gif", runtimeConfig.MotionVideo.ID))
+			if len(frames) > 0 {
+				gifPath := filepath.Join(basePath, fmt.Sprintf("%s.gif", event.ID))
 
 				// 1. 创建 GIF
-				err := CreateGIF(gifSlice, gifPath, 100)
+				err := CreateGIF(frames, gifPath, 100)
 				if err != nil {
 					Log("error", fmt.Sprintf("Error creating GIF: %v", err))
 					// 如果生成 GIF 失败，降级发送纯文本
-					txtMsg := fmt.Sprintf("Motion ended (GIF Failed). Camera: %s. Duration: %s", runtimeConfig.MotionVideo.CameraName, duration)
+					txtMsg := fmt.Sprintf("Motion ended (GIF Failed). Camera: %s. Duration: %s", event.CameraName, duration)
 					sendPushoverNotificationText(globalConfig.Notifications.PushoverUserKey, globalConfig.Notifications.PushoverAppToken, txtMsg)
 				} else {
 					// 2. 发送 GIF 通知
-					msg := fmt.Sprintf("Motion ended. Camera: %s. Duration: %s", runtimeConfig.MotionVideo.CameraName, duration)
+					msg := fmt.Sprintf("Motion ended. Camera: %s. Duration: %s", event.CameraName, duration)
 					err = sendPushoverNotificationGif(globalConfig.Notifications.PushoverUserKey, globalConfig.Notifications.PushoverAppToken, msg, gifPath)
 					if err != nil {
 						Log("error", fmt.Sprintf("Error sending pushover notification: %v", err))
@@ -1911,113 +4368,74 @@ func endMotionEvent() {
 				}
 			} else {
 				// 有 GIF 配置但没有帧数据（极短事件），发送纯文本
-				txtMsg := fmt.Sprintf("Motion ended (No Frames). Camera: %s. Duration: %s", runtimeConfig.MotionVideo.CameraName, duration)
+				txtMsg := fmt.Sprintf("Motion ended (No Frames). Camera: %s. Duration: %s", event.CameraName, duration)
 				sendPushoverNotificationText(globalConfig.Notifications.PushoverUserKey, globalConfig.Notifications.PushoverAppToken, txtMsg)
 			}
-
-			// 必须清理内存
-			gifSlice = make([]image.RGBA, 0)
-			gifSliceMutex.Unlock()
-
 		} else {
 			// === 情况 B: 开启了 Pushover 但 禁用了 GIF ===
 			// 发送纯文本通知
-			txtMsg := fmt.Sprintf("Motion ended. Camera: %s. Duration: %s", runtimeConfig.MotionVideo.CameraName, duration)
+			txtMsg := fmt.Sprintf("Motion ended. Camera: %s. Duration: %s", event.CameraName, duration)
 
 			err := sendPushoverNotificationText(globalConfig.Notifications.PushoverUserKey, globalConfig.Notifications.PushoverAppToken, txtMsg)
 			if err != nil {
 				Log("error", fmt.Sprintf("Error sending pushover text: %v", err))
 			}
-
-			// 清理内存（以防万一有残留数据）
-			gifSliceMutex.Lock()
-			if len(gifSlice) > 0 {
-				gifSlice = make([]image.RGBA, 0)
-			}
-			gifSliceMutex.Unlock()
-		}
-	} else {
-		// === 情况 C: 禁用了 Pushover 通知 ===
-		// 必须清理内存，否则内存泄漏
-		gifSliceMutex.Lock()
-		if len(gifSlice) > 0 {
-			gifSlice = make([]image.RGBA, 0)
 		}
-		gifSliceMutex.Unlock()
 	}
 
-	// Stop Hi res recording and dump json file as well as clear struct
-	runtimeConfig.MotionVideo.MotionEnd = time.Now()
-	runtimeConfig.HiResControlChannel <- RecordMsg{Record: false}
-
-	if globalConfig.Video.RecodeTsToMp4 { // Store this for future reference
-		runtimeConfig.MotionVideo.RecodedToMp4 = true
-		go func(videoFile string) {
-			// Recode the ts file to mp4
-			_, err := recodeToMP4(videoFile)
-			if err != nil {
-				Log("error", fmt.Sprintf("Error recoding ts file to mp4: %v", err))
-			} else {
-				// Remove the ts file
-				err = os.Remove(videoFile)
-				if err != nil {
-					Log("error", fmt.Sprintf("Error removing ts file: %v", err))
-				}
-			}
-		}(fullVideoPath)
+	// Dump json file, the recorder recodes the clip once it closed the file
+	metadata := VideoMetadata{
+		Attributes:    event.Attributes,
+		ID:            event.ID,
+		MotionStart:   event.Start,
+		MotionEnd:     event.End,
+		Objects:       event.Objects,
+		RecodedToMp4:  globalConfig.Video.RecodeTsToMp4, // Store this for future reference
+		Snapshots:     event.Snapshots,
+		VideoFile:     event.VideoFile,
+		CameraName:    event.CameraName,
+		ContinuedFrom: event.ContinuedFrom,
 	}
-
-	jsonData, err := json.Marshal(runtimeConfig.MotionVideo)
+	jsonData, err := json.Marshal(metadata)
 	if err != nil {
-		Log("error", fmt.Sprintf("Error marshalling metadata: %v", err))
+		Log("error", fmt.Sprintf("Error marshalling metadata: %v", err), "event_id", event.ID)
 	}
 
-	err = os.WriteFile(filepath.Join(basePath, fmt.Sprintf("meta_%s.json", runtimeConfig.MotionVideo.ID)), jsonData, 0644)
+	err = os.WriteFile(filepath.Join(basePath, fmt.Sprintf("meta_%s.json", event.ID)), jsonData, 0644)
 	if err != nil {
-		Log("error", fmt.Sprintf("Error writing metadata file: %v", err))
-	}
-
-	// Notify in realtime about detected objects
-	// type Event struct {
-	// 	Type                string          `json:"type"`
-	// 	Timestamp           time.Time       `json:"timestamp"`
-	// 	MotionTriggeredLast time.Time       `json:"motion_triggered_last"`
-	// 	ID                  string          `json:"id"`
-	// 	MotionStart         time.Time       `json:"motion_start"`
-	// 	MotionEnd           time.Time       `json:"motion_end"`
-	// 	Objects             []TrackedObject `json:"objects"`
-	// 	RecodedToMp4        bool            `json:"recoded_to_mp4"`
-	// 	Snapshots           []string        `json:"snapshots"`
-	// 	VideoFile           string          `json:"video_file"`
-	// 	CameraName          string          `json:"camera_name"`
-	// 	MetadataPath        string          `json:"metadata_path"`
-	// }
-
-	// eventRaw := Event{
-	// 	Type:                "motion_ended",
-	// 	Timestamp:           time.Now(),
-	// 	MotionTriggeredLast: runtimeConfig.MotionTriggeredLast,
-	// 	ID:                  runtimeConfig.MotionVideo.ID,
-	// 	MotionStart:         runtimeConfig.MotionVideo.MotionStart,
-	// 	MotionEnd:           runtimeConfig.MotionVideo.MotionEnd,
-	// 	Objects:             runtimeConfig.MotionVideo.Objects,
-	// 	RecodedToMp4:        runtimeConfig.MotionVideo.RecodedToMp4,
-	// 	Snapshots:           runtimeConfig.MotionVideo.Snapshots,
-	// 	VideoFile:           runtimeConfig.MotionVideo.VideoFile,
-	// 	CameraName:          runtimeConfig.MotionVideo.CameraName,
-	// 	MetadataPath:        filepath.Join(globalConfig.Video.HiResPath, fmt.Sprintf("meta_%s.json", runtimeConfig.MotionVideo.ID)),
-	// }
-	// eventJson, err := json.Marshal(eventRaw)
-	// if err != nil {
-	// 	Log("error", fmt.Sprintf("Error marshalling motion_ended event: %v", err))
-	// 	return
-	// }
-	// eventHandler("motion_end", eventJson)
-
-	// 	// Clear the whole runtimeConfig.MotionVideo struct
-	runtimeConfig.MotionVideo = VideoMetadata{}
-
-	runtimeConfig.MotionMutex.Unlock()
+		Log("error", fmt.Sprintf("Error writing metadata file: %v", err), "event_id", event.ID)
+	}
+
+	// Sent once the metadata is written, so the web server already finds the event
+	sendMotionEvent("motion_ended", "motion_end", event)
+}
+
+// recodes are the running recodes, shutdown waits for them
+var recodes sync.WaitGroup
+
+// clipClosed is called by the recorder once it closed a clip file
+func clipClosed(videoFile string) {
+	if !globalConfig.Video.RecodeTsToMp4 {
+		return
+	}
+	recodes.Add(1)
+	go func() {
+		defer recodes.Done()
+		// Recode the ts file to mp4
+		start := time.Now()
+		_, err := recodeToMP4(runtimeConfig.Children, videoFile)
+		if err != nil {
+			Log("error", fmt.Sprintf("Error recoding ts file to mp4: %v", err))
+			recodeFailures.With(globalConfig.CameraName).Inc()
+		} else {
+			recodeSeconds.With(globalConfig.CameraName).Observe(time.Since(start).Seconds())
+			// Remove the ts file
+			err = os.Remove(videoFile)
+			if err != nil {
+				Log("error", fmt.Sprintf("Error removing ts file: %v", err))
+			}
+		}
+	}()
 }
 
 func sendPushoverNotification(userKey string, appToken string, msg string, img *image.RGBA) error {
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDecodeConfigMigratesMqttPass(t *testing.T) {
+	config, warnings, errs := decodeConfig("config.json", []byte(`{"cameraName": "front", "events": {"mqtt": {"pass": "s3cret"}}, "motion": {"onnxModel": "yolov8n"}}`))
+	if len(errs) != 0 || config.Events.Mqtt.Pass != "s3cret" {
+		t.Errorf("expected pass to be read as password, got %q %v", config.Events.Mqtt.Pass, errs)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "events.mqtt.pass is deprecated") {
+		t.Errorf("expected a deprecation warning, got %v", warnings)
+	}
+
+	_, _, errs = decodeConfig("config.yaml", []byte("events: {mqtt: {pass: a, password: b}}\nmotion: {onnxModel: yolov8n}\n"))
+	if len(errs) != 1 || errs[0].Error() != "events.mqtt.pass: set together with password" {
+		t.Errorf("expected pass and password together to be an error, got %v", errs)
+	}
+}
+
+func TestDecodeConfigEmbeddedObjectScript(t *testing.T) {
+	for doc, expected := range map[string]string{
+		`{"motion": {"onnxModel": "yolov8n"}}`:                              "",
+		`{"motion": {"networkObjectDetectServer": "10.0.0.2:8555"}}`:        "",
+		`{"motion": {"embeddedObjectScript": "objectDetectServerYolo.py"}}`: "",
+		`{"motion": {}}`: "motion.embeddedObjectScript: must be set without onnxModel or networkObjectDetectServer",
+		`{"motion": {"onnxModel": "yolov8n", "embeddedObjectScript": "yolo.py"}}`: "motion.embeddedObjectScript: must be one of objectDetectServerYolo.py, objectDetectServerCoral.py or objectDetectServerCoreML.py",
+	} {
+		_, _, errs := decodeConfig("config.json", []byte(doc))
+		if got := errs.Error(); got != expected {
+			t.Errorf("%s: expected %q, got %q", doc, expected, got)
+		}
+	}
+}
+
+func TestDecodeConfigOnnxProviders(t *testing.T) {
+	_, _, errs := decodeConfig("config.json", []byte(`{"motion": {"onnxModel": "yolov8n", "onnxProviders": ["openvino", "cpu"], "onnxProviderOptions": {"openvino": {"device_type": "GPU_FP16"}}}}`))
+	if len(errs) != 0 {
+		t.Errorf("expected openvino to be accepted, got %v", errs)
+	}
+	_, _, errs = decodeConfig("config.json", []byte(`{"motion": {"onnxModel": "yolov8n", "onnxProviders": ["vulkan"]}}`))
+	if len(errs) != 1 || errs[0].Path != "motion.onnxProviders[0]" {
+		t.Errorf("expected an unknown provider to be an error, got %v", errs)
+	}
+}
+
+func TestDaemonCamerasDetector(t *testing.T) {
+	cameras, cleanup, err := daemonCameras(t.TempDir(), []json.RawMessage{
+		[]byte(`{"cameraName": "front", "video": {"hiResPath": "media"}, "motion": {"onnxModel": "yolov8n"}}`),
+		[]byte(`{"cameraName": "back", "video": {"hiResPath": "media"}, "motion": {"onnxModel": "yolov8n", "onnxModelWidth": 640, "onnxModelHeight": 640}}`),
+		[]byte(`{"cameraName": "garage", "video": {"hiResPath": "media"}, "motion": {"onnxModel": "yolov8s", "onnxModelWidth": 320, "onnxModelHeight": 320}}`),
+		[]byte(`{"cameraName": "yard", "video": {"hiResPath": "media"}, "motion": {"embeddedObjectScript": "objectDetectServerYolo.py"}}`),
+	})
+	defer cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := func(camera daemonCamera) string {
+		data, _ := json.Marshal(camera.Detector)
+		return string(data)
+	}
+	if key(cameras[0]) != key(cameras[1]) {
+		t.Errorf("expected the default model size to share the detector of the explicit one, got %s and %s", key(cameras[0]), key(cameras[1]))
+	}
+	if key(cameras[0]) == key(cameras[2]) || cameras[2].Detector.ModelWidth != 320 {
+		t.Errorf("expected another model to get its own detector, got %s", key(cameras[2]))
+	}
+	if cameras[3].Detector != nil {
+		t.Errorf("expected no shared detector for the python detector, got %s", key(cameras[3]))
+	}
+}
@@ -6,6 +6,7 @@ require (
 	github.com/8ff/onnxruntime_go v0.0.0-20230830191505-2b14a218432e
 	github.com/8ff/prettyTimer v0.0.0-20230830184900-c96793faf613
 	github.com/8ff/tuna v0.0.0-20230811173825-52af88c52674
+	github.com/BurntSushi/toml v1.4.0
 	github.com/asticode/go-astits v1.13.0
 	github.com/bluenviron/gortsplib/v3 v3.10.0
 	github.com/bluenviron/mediacommon v1.0.0
@@ -15,6 +16,7 @@ require (
 	github.com/pion/rtp v1.8.1
 	github.com/tj/go-naturaldate v1.3.0
 	golang.org/x/image v0.11.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -28,3 +30,5 @@ require (
 	golang.org/x/sync v0.1.0 // indirect
 	golang.org/x/sys v0.11.0 // indirect
 )
+
+replace github.com/8ff/onnxruntime_go => ./third_party/onnxruntime_go
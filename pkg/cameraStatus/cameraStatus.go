@@ -0,0 +1,234 @@
+// Package cameraStatus shares the live state of a camera process with the web server. The camera process writes a
+// Snapshot to a small JSON file below its hiResPath every few seconds and firescrewServe reads all of them, so the two
+// keep running as separate processes. A snapshot that was not refreshed for a while belongs to a camera process that
+// died and is marked stale.
+package cameraStatus
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Dir is the folder below hiResPath that holds one snapshot per camera
+const Dir = "status"
+
+// Snapshot is the state of one camera process
+type Snapshot struct {
+	Camera      string          `json:"camera"`
+	Version     string          `json:"version"`
+	PID         int             `json:"pid"`
+	Started     time.Time       `json:"started"`
+	Updated     time.Time       `json:"updated"`
+	Running     bool            `json:"running"` // False once the process shut down
+	Stale       bool            `json:"stale"`   // Set by ReadAll, the process stopped updating without shutting down
+	Lo          Stream          `json:"lo"`
+	Hi          Stream          `json:"hi"`
+	LastFrame   time.Time       `json:"lastFrame"` // Last frame of the lo feed checked for motion
+	Motion      bool            `json:"motion"`
+	MotionRatio float64         `json:"motionRatio"` // Fraction of the last frame covered by motion blobs
+	ActiveEvent string          `json:"activeEvent,omitempty"`
+	EventStart  time.Time       `json:"eventStart,omitempty"`
+	Detector    Detector        `json:"detector"`
+	Sinks       map[string]Sink `json:"sinks"` // Event handlers by name: webhook, script, slack and mqtt
+	Storage     Storage         `json:"storage"`
+}
+
+// Stream is one ffmpeg feed of the camera
+type Stream struct {
+	URL      string  `json:"url"` // Credentials are redacted
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	FPS      float64 `json:"fps"`
+	Codec    string  `json:"codec,omitempty"`
+	Up       bool    `json:"up"`
+	Restarts int64   `json:"restarts"`
+}
+
+// Detector is the object detection backend and its latency over the last inference window
+type Detector struct {
+	Backend    string    `json:"backend"` // onnx or network
+	Model      string    `json:"model"`
+	Up         bool      `json:"up"`
+	Restarts   int64     `json:"restarts,omitempty"` // Of the embedded python server
+	Inferences int64     `json:"inferences"`
+	AvgMs      float64   `json:"avgMs"`
+	MinMs      float64   `json:"minMs"`
+	MaxMs      float64   `json:"maxMs"`
+	LastRun    time.Time `json:"lastRun,omitempty"`
+}
+
+// Sink counts the deliveries to one event handler
+type Sink struct {
+	Success   int64     `json:"success"`
+	Failure   int64     `json:"failure"`
+	LastError string    `json:"lastError,omitempty"`
+	LastFail  time.Time `json:"lastFail,omitempty"`
+}
+
+// Storage is the usage of hiResPath
+type Storage struct {
+	Path       string    `json:"path"`
+	FreeBytes  uint64    `json:"freeBytes"`
+	TotalBytes uint64    `json:"totalBytes"`
+	UsedBytes  int64     `json:"usedBytes"` // Size of the clips, snapshots and metadata below Path
+	Measured   time.Time `json:"measured,omitempty"`
+}
+
+// Path returns the snapshot file of camera below hiResPath
+func Path(hiResPath, camera string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, camera)
+	if name == "" || name == "." || name == ".." {
+		name = "camera"
+	}
+	return filepath.Join(hiResPath, Dir, name+".json")
+}
+
+// Write replaces the snapshot file at path, readers never see a partly written file
+func Write(path string, s Snapshot) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".status-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Read reads the snapshot file at path
+func Read(path string) (Snapshot, error) {
+	var s Snapshot
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(data, &s)
+	return s, err
+}
+
+// ReadAll reads the snapshots of every camera below hiResPath, sorted by camera. Running snapshots that were not
+// updated within staleAfter of now are marked stale. Unreadable files are skipped.
+func ReadAll(hiResPath string, staleAfter time.Duration, now time.Time) ([]Snapshot, error) {
+	entries, err := os.ReadDir(filepath.Join(hiResPath, Dir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []Snapshot{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		s, err := Read(filepath.Join(hiResPath, Dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		s.Stale = s.Running && now.Sub(s.Updated) > staleAfter
+		snapshots = append(snapshots, s)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Camera < snapshots[j].Camera })
+	return snapshots, nil
+}
+
+// secretParams are query parameters that carry credentials in camera URLs
+var secretParams = []string{"password", "pass", "pwd", "token", "key", "secret", "auth"}
+
+// RedactURL hides the password of a stream URL and query parameters that look like credentials, the user name is
+// kept so the URL can still be told apart. A URL that does not parse is hidden entirely.
+func RedactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "redacted"
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for name := range query {
+			for _, secret := range secretParams {
+				if strings.EqualFold(name, secret) {
+					query.Set(name, "xxxxx")
+				}
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// URLSecrets returns the parts of a stream URL that RedactURL hides: the password and the values of query parameters
+// that look like credentials, also in their escaped form
+func URLSecrets(raw string) []string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil
+	}
+	var secrets []string
+	add := func(secret string) {
+		secrets = append(secrets, secret)
+		if escaped := url.QueryEscape(secret); escaped != secret {
+			secrets = append(secrets, escaped)
+		}
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			add(password)
+		}
+	}
+	for name, values := range u.Query() {
+		for _, secret := range secretParams {
+			if strings.EqualFold(name, secret) {
+				for _, value := range values {
+					add(value)
+				}
+			}
+		}
+	}
+	return secrets
+}
+
+// DirSize returns the bytes of the regular files below path, errors on single entries are skipped
+func DirSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, entry os.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
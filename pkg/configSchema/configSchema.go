@@ -0,0 +1,306 @@
+// Package configSchema checks a JSON config file against the Go struct it is decoded into. encoding/json stops at
+// the first type error, silently ignores unknown keys and matches keys case-insensitively; Check instead reports every
+// unknown key, every key that only matches with a different case and every value of the wrong type, each with the
+// JSON path of the offending value, so a config can be fixed in one go.
+//
+// YAML and TOML configs are converted to JSON with ToJSON first, and Resolve applies secret files and environment
+// variables, so every config is checked the same way whatever its source. Migrate moves the keys of older configs to
+// their new names.
+package configSchema
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Error is a problem with the value at Path, e.g. motion.lookForClasses[2]. Path is empty for the file as a whole.
+type Error struct {
+	Path    string
+	Message string
+}
+
+func (e Error) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Errors collects the problems of a config, in the order they were found
+type Errors []Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Add records a problem with the value at path
+func (e *Errors) Add(path, format string, args ...any) {
+	*e = append(*e, Error{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Field returns the path of the field name of the object at path
+func Field(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// Index returns the path of element i of the array at path
+func Index(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+// Renamed maps the path of a field that was renamed to its new name, see Check
+type Renamed map[string]string
+
+// Check reports the problems of the JSON document data as a value of v, which must be a pointer to the type the
+// document is decoded into. Keys are matched against the json tags, or the names of untagged fields, exactly. A key
+// listed in renamed is reported with its new name. A document without problems decodes into v without errors.
+func Check(data []byte, v any, renamed Renamed) Errors {
+	var errs Errors
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		errs.Add("", "%s", syntaxError(data, err))
+		return errs
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		errs.Add("", "unexpected data after the top level value")
+		return errs
+	}
+
+	c := checker{renamed: renamed}
+	c.check("", document, reflect.TypeOf(v).Elem())
+	return c.errs
+}
+
+// syntaxError adds the line and column to the errors of a document that is not valid JSON
+func syntaxError(data []byte, err error) string {
+	var offset int64 = -1
+	var syntax *json.SyntaxError
+	if errors.As(err, &syntax) {
+		offset = syntax.Offset - 1 // Offset is past the offending byte
+	} else if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		offset = int64(len(data))
+		err = errors.New("unexpected end of file")
+	}
+	if offset < 0 {
+		return err.Error()
+	}
+	before := data[:min(int(offset), len(data))]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Sprintf("line %d column %d: %v", line, column, err)
+}
+
+type checker struct {
+	renamed Renamed
+	errs    Errors
+}
+
+var (
+	jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func (c *checker) check(path string, value any, t reflect.Type) {
+	if value == nil {
+		return // null leaves the field alone
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	// Types that decode themselves, like json.RawMessage, accept whatever they accept
+	if reflect.PointerTo(t).Implements(jsonUnmarshaler) {
+		return
+	}
+	if reflect.PointerTo(t).Implements(textUnmarshaler) {
+		c.expect(path, value, "a string", isString)
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+	case reflect.Struct:
+		object, ok := value.(map[string]any)
+		if !ok {
+			c.mismatch(path, "an object", value)
+			return
+		}
+		fields := fieldsOf(t)
+		for _, key := range sortedKeys(object) {
+			keyPath := Field(path, key)
+			if field, ok := fields[key]; ok {
+				c.check(keyPath, object[key], field)
+				continue
+			}
+			if name, ok := c.renamed[keyPath]; ok {
+				c.errs.Add(keyPath, "unknown field, it was renamed to %s", name)
+				continue
+			}
+			if name, ok := foldMatch(fields, key); ok {
+				c.errs.Add(keyPath, "unknown field, did you mean %s?", name)
+				continue
+			}
+			c.errs.Add(keyPath, "unknown field")
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]any)
+		if !ok {
+			c.mismatch(path, "an object", value)
+			return
+		}
+		for _, key := range sortedKeys(object) {
+			c.check(Field(path, key), object[key], t.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			c.expect(path, value, "a base64 string", isString)
+			return
+		}
+		list, ok := value.([]any)
+		if !ok {
+			c.mismatch(path, "an array", value)
+			return
+		}
+		if t.Kind() == reflect.Array && len(list) != t.Len() {
+			c.errs.Add(path, "expected %d values, got %d", t.Len(), len(list))
+		}
+		for i, item := range list {
+			c.check(Index(path, i), item, t.Elem())
+		}
+	case reflect.String:
+		c.expect(path, value, "a string", isString)
+	case reflect.Bool:
+		c.expect(path, value, "true or false", func(v any) bool { _, ok := v.(bool); return ok })
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, ok := value.(json.Number)
+		if !ok {
+			c.mismatch(path, "an integer", value)
+			return
+		}
+		if n, err := strconv.ParseInt(string(number), 10, 64); err != nil || reflect.Zero(t).OverflowInt(n) {
+			c.errs.Add(path, "expected an integer, got %s", number)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number, ok := value.(json.Number)
+		if !ok {
+			c.mismatch(path, "a positive integer", value)
+			return
+		}
+		if n, err := strconv.ParseUint(string(number), 10, 64); err != nil || reflect.Zero(t).OverflowUint(n) {
+			c.errs.Add(path, "expected a positive integer, got %s", number)
+		}
+	case reflect.Float32, reflect.Float64:
+		number, ok := value.(json.Number)
+		if !ok {
+			c.mismatch(path, "a number", value)
+			return
+		}
+		if n, err := number.Float64(); err != nil || (t.Kind() == reflect.Float32 && math.Abs(n) > math.MaxFloat32) {
+			c.errs.Add(path, "number %s is out of range", number)
+		}
+	default:
+		c.errs.Add(path, "cannot be set in a config file")
+	}
+}
+
+func (c *checker) expect(path string, value any, expected string, ok func(any) bool) {
+	if !ok(value) {
+		c.mismatch(path, expected, value)
+	}
+}
+
+func (c *checker) mismatch(path, expected string, value any) {
+	c.errs.Add(path, "expected %s, got %s", expected, describe(value))
+}
+
+func isString(v any) bool {
+	_, ok := v.(string)
+	return ok
+}
+
+// describe names the JSON type of value for error messages
+func describe(value any) string {
+	switch v := value.(type) {
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	case string:
+		return strconv.Quote(v)
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// fieldsOf returns the types of the fields of struct t by their JSON key, the way encoding/json names them
+func fieldsOf(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for key, fieldType := range fieldsOf(embedded) {
+					if _, ok := fields[key]; !ok {
+						fields[key] = fieldType
+					}
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func foldMatch(fields map[string]reflect.Type, key string) (string, bool) {
+	for name := range fields {
+		if strings.EqualFold(name, key) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func sortedKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
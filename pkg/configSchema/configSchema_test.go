@@ -0,0 +1,207 @@
+package configSchema
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type Inner struct {
+	Name   string     `json:"name"`
+	Mean   [3]float32 `json:"mean"`
+	hidden int
+}
+
+type Embedded struct {
+	Extra bool `json:"extra"`
+}
+
+type config struct {
+	Embedded
+	Port    int               `json:"port"`
+	Ratio   float64           `json:"ratio"`
+	Tags    []string          `json:"tags"`
+	Levels  map[string]string `json:"levels"`
+	Inners  []Inner           `json:"inners"`
+	Raw     json.RawMessage   `json:"raw"`
+	Width   int               // Untagged fields keep their Go name
+	Ignored string            `json:"-"`
+	Mqtt    struct {
+		Password string `json:"password"`
+	} `json:"mqtt"`
+}
+
+func TestCheckReportsEveryProblem(t *testing.T) {
+	data := []byte(`{
+		"port": 1.5,
+		"ratio": "high",
+		"tags": ["a", 2],
+		"levels": {"serve": true},
+		"inners": [{"name": "x", "mean": [1, 2]}, {"Name": "y", "hidden": 1}],
+		"raw": {"anything": [1, "two"]},
+		"Width": 10,
+		"Ignored": "x",
+		"extra": true,
+		"mqtt": {"pass": "secret"},
+		"unknown": null
+	}`)
+	errs := Check(data, &config{}, Renamed{"mqtt.pass": "password"})
+
+	expected := Errors{
+		{"Ignored", "unknown field"},
+		{"inners[0].mean", "expected 3 values, got 2"},
+		{"inners[1].Name", "unknown field, did you mean name?"},
+		{"inners[1].hidden", "unknown field"},
+		{"levels.serve", "expected a string, got true"},
+		{"mqtt.pass", "unknown field, it was renamed to password"},
+		{"port", "expected an integer, got 1.5"},
+		{"ratio", `expected a number, got "high"`},
+		{"tags[1]", "expected a string, got 2"},
+		{"unknown", "unknown field"},
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("expected\n%v\ngot\n%v", expected, errs)
+	}
+}
+
+func TestCheckValidDocumentDecodes(t *testing.T) {
+	data := []byte(`{"port": 8080, "ratio": 0.5, "tags": null, "inners": [{"name": "x", "mean": [0.5, 0.5, 0.5]}], "Width": 3, "extra": false}`)
+	if errs := Check(data, &config{}, nil); len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	var c config
+	if err := json.Unmarshal(data, &c); err != nil || c.Port != 8080 || c.Inners[0].Mean[2] != 0.5 {
+		t.Errorf("expected the document to decode, got %+v %v", c, err)
+	}
+}
+
+func TestCheckSyntaxError(t *testing.T) {
+	errs := Check([]byte("{\n  \"port\": 1,\n  \"ratio\": ,\n}"), &config{}, nil)
+	if len(errs) != 1 || errs[0].Error() != "line 3 column 12: invalid character ',' looking for beginning of value" {
+		t.Errorf("expected the position of the syntax error, got %v", errs)
+	}
+	errs = Check([]byte(`{"port": 1`), &config{}, nil)
+	if len(errs) != 1 || errs[0].Error() != "line 1 column 11: unexpected end of file" {
+		t.Errorf("expected an unexpected end, got %v", errs)
+	}
+	errs = Check([]byte(`{} {}`), &config{}, nil)
+	if len(errs) != 1 {
+		t.Errorf("expected trailing data to be reported, got %v", errs)
+	}
+	errs = Check([]byte(`[]`), &config{}, nil)
+	if len(errs) != 1 || errs[0].Error() != "expected an object, got an array" {
+		t.Errorf("expected a top level type error, got %v", errs)
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	yamlDoc := []byte("port: 8080\ntags: [a, b]\nlevels:\n  serve: debug\ninners:\n  - name: x\n    mean: [0.5, 0.5, 0.5]\n")
+	tomlDoc := []byte("port = 8080\ntags = [\"a\", \"b\"]\n[levels]\nserve = \"debug\"\n[[inners]]\nname = \"x\"\nmean = [0.5, 0.5, 0.5]\n")
+	for name, data := range map[string][]byte{"config.yaml": yamlDoc, "config.TOML": tomlDoc} {
+		converted, err := ToJSON(name, data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if errs := Check(converted, &config{}, nil); len(errs) != 0 {
+			t.Fatalf("%s: expected no errors, got %v", name, errs)
+		}
+		var c config
+		if err := json.Unmarshal(converted, &c); err != nil || c.Port != 8080 || c.Levels["serve"] != "debug" || c.Inners[0].Mean[1] != 0.5 || len(c.Tags) != 2 {
+			t.Errorf("%s: expected the document to decode, got %+v %v", name, c, err)
+		}
+	}
+
+	if _, err := ToJSON("config.yml", []byte("port: [1\n")); err == nil {
+		t.Errorf("expected a YAML syntax error")
+	}
+	if data, _ := ToJSON("config.json", []byte(`{"port": 1}`)); string(data) != `{"port": 1}` {
+		t.Errorf("expected JSON to be returned as it is, got %s", data)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "password")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(`{"port": 1, "mqtt": {"password_file": "` + secret + `"}, "inners": [{"name_file": "` + secret + `"}]}`)
+	environ := []string{
+		"PATH=/bin",
+		"APP_PORT=8080",
+		"APP_TAGS=a, b",
+		"APP_LEVELS={\"serve\": \"debug\"}",
+		"APP_EMBEDDED_EXTRA=true",
+		"APP_RATIO_FILE=" + secret,
+		"APP_WIDTH=x",
+		"APP_TYPO=1",
+	}
+	resolved, secrets, errs := Resolve(data, &config{}, "APP_", environ)
+
+	expected := Errors{
+		{"APP_EMBEDDED_EXTRA", "unknown environment variable"}, // Embedded fields have no key of their own
+		{"ratio", "APP_RATIO_FILE is not valid JSON: invalid character 's' looking for beginning of value"},
+		{"APP_TYPO", "unknown environment variable"},
+		{"Width", "APP_WIDTH is not valid JSON: invalid character 'x' looking for beginning of value"},
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("expected\n%v\ngot\n%v", expected, errs)
+	}
+	if len(secrets) != 3 || secrets[0] != "s3cret" {
+		t.Errorf("expected the content of every file read, got %q", secrets)
+	}
+
+	var c config
+	if err := json.Unmarshal(resolved, &c); err != nil {
+		t.Fatalf("expected JSON, got %s: %v", resolved, err)
+	}
+	if c.Port != 8080 || c.Mqtt.Password != "s3cret" || c.Inners[0].Name != "s3cret" || !reflect.DeepEqual(c.Tags, []string{"a", "b"}) || c.Levels["serve"] != "debug" {
+		t.Errorf("expected the files and the environment applied, got %+v", c)
+	}
+	_, _, errs = Resolve([]byte(`{"mqtt": {"password": "a", "password_file": "/nonexistent"}}`), &config{}, "APP_", nil)
+	if len(errs) != 1 || errs[0].Error() != "mqtt.password_file: set together with password" {
+		t.Errorf("expected a value set twice to be reported, got %v", errs)
+	}
+}
+
+func TestUpperSnake(t *testing.T) {
+	for key, expected := range map[string]string{"onnxModel": "ONNX_MODEL", "onnxCudaDeviceID": "ONNX_CUDA_DEVICE_ID", "generateGIF": "GENERATE_GIF", "maxSizeMB": "MAX_SIZE_MB", "fps": "FPS", "Width": "WIDTH"} {
+		if name := upperSnake(key); name != expected {
+			t.Errorf("expected %s for %s, got %s", expected, key, name)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	renamed := Renamed{"mqtt.pass": "password"}
+	migrated, warnings, errs := Migrate([]byte(`{"port": 1, "mqtt": {"pass": "s3cret"}}`), renamed)
+	if len(errs) != 0 || len(warnings) != 1 || warnings[0] != "mqtt.pass is deprecated, it was renamed to password" {
+		t.Fatalf("expected a deprecation warning, got %v %v", warnings, errs)
+	}
+	if errs := Check(migrated, &config{}, renamed); len(errs) != 0 {
+		t.Errorf("expected the migrated document to check, got %v", errs)
+	}
+	var c config
+	if err := json.Unmarshal(migrated, &c); err != nil || c.Mqtt.Password != "s3cret" || c.Port != 1 {
+		t.Errorf("expected pass moved to password, got %s", migrated)
+	}
+
+	migrated, warnings, _ = Migrate([]byte(`{"mqtt": {"pass_file": "/run/secrets/mqtt"}}`), renamed)
+	if len(warnings) != 1 || string(migrated) != `{"mqtt":{"password_file":"/run/secrets/mqtt"}}` {
+		t.Errorf("expected the file form to be moved too, got %s %v", migrated, warnings)
+	}
+
+	data := []byte(`{"mqtt": {"pass": "a", "password": "b"}}`)
+	migrated, _, errs = Migrate(data, renamed)
+	if len(errs) != 1 || errs[0].Error() != "mqtt.pass: set together with password" || string(migrated) != `{"mqtt":{"password":"b"}}` {
+		t.Errorf("expected both names to be an error, got %v", errs)
+	}
+
+	data = []byte(`{"port": 1}`)
+	if migrated, warnings, errs = Migrate(data, renamed); string(migrated) != string(data) || warnings != nil || errs != nil {
+		t.Errorf("expected a current document to be returned as it is, got %s %v %v", migrated, warnings, errs)
+	}
+}
@@ -0,0 +1,223 @@
+package configSchema
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// FileSuffix marks a key whose value is the path of a file holding the value of the key without it, e.g.
+// "password_file": "/run/secrets/mqtt" sets password. Environment variables use it in upper case.
+const FileSuffix = "_file"
+
+// Resolve applies secret files and environment variables to the JSON document data of v, which must be a pointer to
+// the type the document is decoded into:
+//
+//   - Keys ending in FileSuffix, at any depth, are replaced by the key without it set to the content of the file.
+//   - Every field that is not an object can be set by an environment variable named prefix and the path of the field in
+//     upper snake case, e.g. FIRESCREW_MOTION_ONNX_MODEL for motion.onnxModel. Text fields take the value as it is,
+//     lists of text also take comma separated values, all others take JSON. The variable with the _FILE suffix
+//     reads the value from a file. Variables beat the document.
+//
+// environ holds KEY=value entries like os.Environ, entries without prefix are ignored and unknown ones are errors.
+// The content of every file read is returned in secrets. A document that is not a JSON object is returned unchanged
+// for Check to report.
+func Resolve(data []byte, v any, prefix string, environ []string) (resolved []byte, secrets []string, errs Errors) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document map[string]any
+	if err := decoder.Decode(&document); err != nil || document == nil {
+		return data, nil, nil
+	}
+
+	r := resolver{}
+	r.files("", document)
+
+	fields := envFields(reflect.TypeOf(v).Elem(), prefix)
+	values := map[string]string{}
+	for _, entry := range environ {
+		name, value, _ := strings.Cut(entry, "=")
+		if strings.HasPrefix(name, prefix) {
+			values[name] = value
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := values[name]
+		field, ok := fields[name]
+		if !ok {
+			base := strings.TrimSuffix(name, strings.ToUpper(FileSuffix))
+			if field, ok = fields[base]; !ok || base == name {
+				r.errs.Add(name, "unknown environment variable")
+				continue
+			}
+			if _, ok := values[base]; ok {
+				r.errs.Add(name, "set together with %s", base)
+				continue
+			}
+			if value, ok = r.readFile(name, value); !ok {
+				continue
+			}
+		}
+		if field.path == nil {
+			r.errs.Add(name, "matches more than one field, set it in the config file")
+			continue
+		}
+		r.set(name, document, field, value)
+	}
+
+	if !r.changed {
+		return data, r.secrets, r.errs
+	}
+	resolved, err := json.Marshal(document)
+	if err != nil {
+		r.errs.Add("", "%v", err)
+		return data, r.secrets, r.errs
+	}
+	return resolved, r.secrets, r.errs
+}
+
+type resolver struct {
+	secrets []string
+	errs    Errors
+	changed bool
+}
+
+// files replaces the keys with FileSuffix below value
+func (r *resolver) files(path string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			keyPath := Field(path, key)
+			base, ok := strings.CutSuffix(key, FileSuffix)
+			filePath, isString := v[key].(string)
+			if !ok || base == "" || !isString {
+				r.files(keyPath, v[key])
+				continue
+			}
+			r.changed = true
+			delete(v, key)
+			if _, ok := v[base]; ok {
+				r.errs.Add(keyPath, "set together with %s", base)
+				continue
+			}
+			if content, ok := r.readFile(keyPath, filePath); ok {
+				v[base] = content
+			}
+		}
+	case []any:
+		for i, item := range v {
+			r.files(Index(path, i), item)
+		}
+	}
+}
+
+// readFile reads a secret file, without the line break editors and echo leave at the end
+func (r *resolver) readFile(path, name string) (string, bool) {
+	content, err := os.ReadFile(name)
+	if err != nil {
+		r.errs.Add(path, "%v", err)
+		return "", false
+	}
+	secret := strings.TrimRight(string(content), "\r\n")
+	r.secrets = append(r.secrets, secret)
+	return secret, true
+}
+
+// set sets the field of the environment variable name to value
+func (r *resolver) set(name string, document map[string]any, field envField, value string) {
+	path := strings.Join(field.path, ".")
+	var converted any
+	switch {
+	case field.kind.Kind() == reflect.String:
+		converted = value
+	case field.kind.Kind() == reflect.Slice && field.kind.Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "["):
+		list := []any{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		converted = list
+	default:
+		decoder := json.NewDecoder(strings.NewReader(value))
+		decoder.UseNumber()
+		if err := decoder.Decode(&converted); err != nil {
+			r.errs.Add(path, "%s is not valid JSON: %v", name, err)
+			return
+		}
+	}
+
+	object := document
+	for _, key := range field.path[:len(field.path)-1] {
+		next, ok := object[key].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			object[key] = next
+		}
+		object = next
+	}
+	object[field.path[len(field.path)-1]] = converted
+	r.changed = true
+}
+
+// envField is a field that can be set by an environment variable, path is nil when several fields have its name
+type envField struct {
+	path []string
+	kind reflect.Type
+}
+
+// envFields returns the fields of struct t that are not objects by the name of their environment variable
+func envFields(t reflect.Type, prefix string) map[string]envField {
+	fields := map[string]envField{}
+	var walk func(t reflect.Type, path []string)
+	walk = func(t reflect.Type, path []string) {
+		for key, fieldType := range fieldsOf(t) {
+			fieldPath := append(append([]string{}, path...), key)
+			for fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct && !reflect.PointerTo(fieldType).Implements(jsonUnmarshaler) {
+				walk(fieldType, fieldPath)
+				continue
+			}
+			words := make([]string, len(fieldPath))
+			for i, key := range fieldPath {
+				words[i] = upperSnake(key)
+			}
+			name := prefix + strings.Join(words, "_")
+			if _, ok := fields[name]; ok {
+				fields[name] = envField{}
+				continue
+			}
+			fields[name] = envField{path: fieldPath, kind: fieldType}
+		}
+	}
+	walk(t, nil)
+	return fields
+}
+
+// upperSnake converts a key like onnxCudaDeviceID to ONNX_CUDA_DEVICE_ID
+func upperSnake(key string) string {
+	runes := []rune(key)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			previous := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
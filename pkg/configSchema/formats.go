@@ -0,0 +1,57 @@
+package configSchema
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ToJSON converts a YAML (.yaml, .yml) or TOML (.toml) document to JSON by the extension of name, so every format is
+// checked and decoded the same way. Other documents are returned as they are.
+func ToJSON(name string, data []byte) ([]byte, error) {
+	var document any
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, err
+		}
+		if document == nil {
+			document = map[string]any{} // An empty file
+		}
+	case ".toml":
+		var table map[string]any
+		if err := toml.Unmarshal(data, &table); err != nil {
+			return nil, err
+		}
+		document = table
+	default:
+		return data, nil
+	}
+
+	return json.Marshal(stringKeys(document))
+}
+
+// stringKeys converts the maps YAML decodes when a key is not a string, such as a number, JSON only has string keys
+func stringKeys(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = stringKeys(item)
+		}
+	case map[any]any:
+		object := make(map[string]any, len(v))
+		for key, item := range v {
+			object[fmt.Sprint(key)] = stringKeys(item)
+		}
+		return object
+	case []any:
+		for i, item := range v {
+			v[i] = stringKeys(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,79 @@
+package configSchema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Migrate moves the keys of data listed in renamed to their new name, also in their FileSuffix form, and returns a
+// deprecation warning for each key it moved. A key set under both its old and its new name is an error, as it is
+// unclear which one is meant, and only the new one is kept. A document that is not a JSON object is returned unchanged for Check to report.
+func Migrate(data []byte, renamed Renamed) (migrated []byte, warnings []string, errs Errors) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document map[string]any
+	if err := decoder.Decode(&document); err != nil || document == nil {
+		return data, nil, nil
+	}
+
+	paths := make([]string, 0, len(renamed))
+	for path := range renamed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	changed := false
+	for _, path := range paths {
+		parent, oldKey := "", path
+		if i := strings.LastIndexByte(path, '.'); i >= 0 {
+			parent, oldKey = path[:i], path[i+1:]
+		}
+		object := lookupObject(document, parent)
+		if object == nil {
+			continue
+		}
+		for _, suffix := range []string{"", FileSuffix} {
+			from, to := oldKey+suffix, renamed[path]+suffix
+			value, ok := object[from]
+			if !ok {
+				continue
+			}
+			if _, ok := object[to]; ok {
+				errs.Add(Field(parent, from), "set together with %s", to)
+			} else {
+				object[to] = value
+				warnings = append(warnings, fmt.Sprintf("%s is deprecated, it was renamed to %s", Field(parent, from), to))
+			}
+			delete(object, from)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return data, warnings, errs
+	}
+	migrated, err := json.Marshal(document)
+	if err != nil {
+		errs.Add("", "%v", err)
+		return data, nil, errs
+	}
+	return migrated, warnings, errs
+}
+
+// lookupObject returns the object at the dotted path below document, nil if there is none
+func lookupObject(document map[string]any, path string) map[string]any {
+	if path == "" {
+		return document
+	}
+	object := document
+	for _, key := range strings.Split(path, ".") {
+		next, ok := object[key].(map[string]any)
+		if !ok {
+			return nil
+		}
+		object = next
+	}
+	return object
+}
@@ -0,0 +1,236 @@
+// Package eventBus passes the events of the cameras to the web server of a firescrew daemon. Subscribers get every
+// event published after they subscribed over a channel and a new subscriber can catch up with the recent history. A
+// slow subscriber loses events instead of holding up the cameras.
+//
+// Camera processes started by the daemon publish with a Client, which sends the events as JSON lines over a local
+// TCP connection to Listen.
+package eventBus
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Event is one event of a camera, the payload is the JSON the event handlers get
+type Event struct {
+	Type    string          `json:"type"`
+	Camera  string          `json:"camera"`
+	Time    time.Time       `json:"time"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Bus delivers published events to its subscribers, it is safe for concurrent use
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	recent      []Event // Oldest first
+	history     int
+}
+
+// New returns a bus that keeps the last history events for Recent
+func New(history int) *Bus {
+	return &Bus{subscribers: map[chan Event]struct{}{}, history: history}
+}
+
+// Publish sends e to every subscriber, subscribers with a full channel miss it
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.history > 0 {
+		if len(b.recent) == b.history {
+			b.recent = append(b.recent[:0], b.recent[1:]...)
+		}
+		b.recent = append(b.recent, e)
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of the events published from now on, buffering up to buffer events. Call cancel once
+// done, it closes the channel.
+func (b *Bus) Subscribe(buffer int) (events <-chan Event, cancel func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Recent returns the last published events, oldest first
+func (b *Bus) Recent() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Event(nil), b.recent...)
+}
+
+// maxLine is the largest event a client can send, motion events carry the objects of the event
+const maxLine = 4 << 20
+
+// NewToken returns a random token for Listen and Dial
+func NewToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Listen accepts clients on l and publishes their events until ctx is done. A client first sends token on a line of
+// its own, connections with a wrong token are closed.
+func (b *Bus) Listen(ctx context.Context, l net.Listener, token string) error {
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go b.serve(ctx, conn, token)
+	}
+}
+
+func (b *Bus) serve(ctx context.Context, conn net.Conn, token string) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64<<10), maxLine)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if !scanner.Scan() || subtle.ConstantTimeCompare(scanner.Bytes(), []byte(token)) != 1 {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		b.Publish(e)
+	}
+}
+
+// Client publishes events to the Listen of a daemon. Events are queued and sent in the background, the connection is
+// made again after errors. Events that do not fit the queue or were being sent when the connection broke are lost.
+type Client struct {
+	addr, token string
+	queue       chan Event
+	done        chan struct{}
+	closed      chan struct{}
+	closeOnce   sync.Once
+}
+
+// Dial returns a client that sends to addr, it connects in the background
+func Dial(addr, token string) *Client {
+	c := &Client{addr: addr, token: token, queue: make(chan Event, 256), done: make(chan struct{}), closed: make(chan struct{})}
+	go c.run()
+	return c
+}
+
+// Publish queues e without waiting, false when the queue is full or the client was closed
+func (c *Client) Publish(e Event) bool {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	select {
+	case <-c.closed:
+		return false
+	default:
+	}
+	select {
+	case c.queue <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close sends the queued events, waiting at most timeout, and closes the connection
+func (c *Client) Close(timeout time.Duration) error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	select {
+	case <-c.done:
+		return nil
+	case <-time.After(timeout):
+		return errors.New("events still queued")
+	}
+}
+
+func (c *Client) run() {
+	defer close(c.done)
+	var conn net.Conn
+	var out *bufio.Writer
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		var e Event
+		select {
+		case e = <-c.queue:
+		case <-c.closed:
+			select {
+			case e = <-c.queue: // Drain the queue before leaving
+			default:
+				return
+			}
+		}
+
+		for conn == nil {
+			var err error
+			if conn, err = net.DialTimeout("tcp", c.addr, 2*time.Second); err == nil {
+				out = bufio.NewWriter(conn)
+				out.WriteString(c.token + "\n")
+				break
+			}
+			select {
+			case <-time.After(time.Second):
+			case <-c.closed:
+				return // The daemon is gone, nothing will be sent
+			}
+		}
+
+		data, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		out.Write(append(data, '\n'))
+		if len(c.queue) == 0 {
+			if err := out.Flush(); err != nil {
+				conn.Close()
+				conn = nil
+			}
+		}
+	}
+}
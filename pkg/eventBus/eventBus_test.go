@@ -0,0 +1,76 @@
+package eventBus
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSubscribeAndRecent(t *testing.T) {
+	b := New(2)
+	b.Publish(Event{Type: "motion_start", Camera: "front"})
+	events, cancel := b.Subscribe(1)
+	b.Publish(Event{Type: "motion_update", Camera: "front"})
+	b.Publish(Event{Type: "motion_end", Camera: "front"}) // The subscriber is full and misses it
+
+	if e := <-events; e.Type != "motion_update" || e.Time.IsZero() {
+		t.Errorf("expected the first event after subscribing with a time, got %+v", e)
+	}
+	recent := b.Recent()
+	if len(recent) != 2 || recent[0].Type != "motion_update" || recent[1].Type != "motion_end" {
+		t.Errorf("expected the last 2 events oldest first, got %+v", recent)
+	}
+
+	cancel()
+	cancel()
+	if _, ok := <-events; ok {
+		t.Errorf("expected cancel to close the channel")
+	}
+	b.Publish(Event{Type: "motion_start"}) // No send on the closed channel
+}
+
+func TestClientOverTCP(t *testing.T) {
+	b := New(10)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go b.Listen(ctx, l, "secret")
+
+	events, cancel := b.Subscribe(10)
+	defer cancel()
+
+	intruder := Dial(l.Addr().String(), "wrong")
+	intruder.Publish(Event{Type: "motion_start", Camera: "fake"})
+	client := Dial(l.Addr().String(), "secret")
+	for i := 0; i < 3; i++ {
+		client.Publish(Event{Type: "motion_update", Camera: "front", Payload: json.RawMessage(`{"id":"abc"}`)})
+	}
+	if err := client.Close(5 * time.Second); err != nil {
+		t.Fatalf("expected the queue to be sent, got %v", err)
+	}
+	intruder.Close(time.Second)
+
+	for i := 0; i < 3; i++ {
+		select {
+		case e := <-events:
+			if e.Camera != "front" || string(e.Payload) != `{"id":"abc"}` {
+				t.Errorf("unexpected event %+v", e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 3 events, got %d", i)
+		}
+	}
+	select {
+	case e := <-events:
+		t.Errorf("expected the events of a wrong token to be dropped, got %+v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if client.Publish(Event{Type: "late"}) {
+		t.Errorf("expected a closed client to refuse events")
+	}
+}
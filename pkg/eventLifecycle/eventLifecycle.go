@@ -0,0 +1,171 @@
+// Package eventLifecycle decides when motion events start, end and are split into clips. A track has to persist
+// before it can start an event, an event ends a gap after its last object (on a timer, not on the next frame), the
+// clip keeps a post-roll of video after the last object, long events are split into clips of a maximum length and
+// classes cool down after an event before they can start the next one.
+package eventLifecycle
+
+import (
+	"sync"
+	"time"
+)
+
+// Action is what is due on an open event
+type Action int
+
+const (
+	None  Action = iota
+	Close        // The event ended
+	Split        // The clip reached the maximum length, the event continues in a new clip
+)
+
+// Config sets the lifecycle rules, zero values disable a rule
+type Config struct {
+	MinPersistence time.Duration            // A track has to be seen this long before it counts towards an event
+	Gap            time.Duration            // An event ends this long after its last object
+	PostRoll       time.Duration            // Video kept after the last object, defaults to Gap
+	MaxDuration    time.Duration            // Clips longer than this are split, the event continues in the next clip
+	Cooldown       map[string]time.Duration // Per class, "*" for all others. A class that was part of an event does not start a new one for this long after it ended
+}
+
+// Lifecycle keeps the state of the events of one camera, it is safe for concurrent use
+type Lifecycle struct {
+	Config Config
+
+	mu       sync.Mutex
+	open     bool
+	start    time.Time // Start of the current clip
+	last     time.Time // Last object of the event
+	classes  map[string]bool
+	tracks   map[string]*track
+	cooldown map[string]time.Time // Class can't start an event before
+}
+
+type track struct {
+	first, last time.Time
+	admitted    bool
+}
+
+func New(cfg Config) *Lifecycle {
+	if cfg.PostRoll == 0 {
+		cfg.PostRoll = cfg.Gap
+	}
+	return &Lifecycle{
+		Config:   cfg,
+		classes:  map[string]bool{},
+		tracks:   map[string]*track{},
+		cooldown: map[string]time.Time{},
+	}
+}
+
+// Admit reports whether the detection of track id at now counts towards an event. It is true once per track, as
+// soon as the track was seen for MinPersistence and, unless an event is open, its class is not cooling down.
+func (l *Lifecycle) Admit(id, class string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for trackID, t := range l.tracks {
+		if now.Sub(t.last) > 30*time.Second { // Same expiry as the tracker
+			delete(l.tracks, trackID)
+		}
+	}
+
+	t, ok := l.tracks[id]
+	if !ok {
+		t = &track{first: now}
+		l.tracks[id] = t
+	}
+	t.last = now
+
+	if t.admitted || now.Sub(t.first) < l.Config.MinPersistence {
+		return false
+	}
+	if !l.open && now.Before(l.cooldown[class]) {
+		return false
+	}
+	t.admitted = true
+	return true
+}
+
+// Trigger adds an admitted object of class to the event, it returns true when this started a new event
+func (l *Lifecycle) Trigger(class string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	started := !l.open
+	if started {
+		l.open = true
+		l.start = now
+		clear(l.classes)
+	}
+	l.last = now
+	l.classes[class] = true
+	return started
+}
+
+// Open reports whether an event is open
+func (l *Lifecycle) Open() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.open
+}
+
+// RecordUntil is the end of the clip as far as known: the last object plus the post-roll
+func (l *Lifecycle) RecordUntil() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.last.Add(l.Config.PostRoll)
+}
+
+// Deadline is when Check has to be called next, zero when no event is open
+func (l *Lifecycle) Deadline() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.open {
+		return time.Time{}
+	}
+	deadline := l.closeAt()
+	if l.Config.MaxDuration > 0 {
+		if split := l.start.Add(l.Config.MaxDuration); split.Before(deadline) {
+			deadline = split
+		}
+	}
+	return deadline
+}
+
+// closeAt is when the event ends, once both the gap and the post-roll passed
+func (l *Lifecycle) closeAt() time.Time {
+	return l.last.Add(max(l.Config.Gap, l.Config.PostRoll))
+}
+
+// Check returns what is due at now and applies it. Close ends the event and starts the cooldown of its classes,
+// Split starts the next clip at now.
+func (l *Lifecycle) Check(now time.Time) Action {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.open {
+		return None
+	}
+	if !now.Before(l.closeAt()) {
+		l.open = false
+		for class := range l.classes {
+			if cooldown := l.cooldownOf(class); cooldown > 0 {
+				l.cooldown[class] = now.Add(cooldown)
+			}
+		}
+		return Close
+	}
+	if l.Config.MaxDuration > 0 && now.Sub(l.start) >= l.Config.MaxDuration {
+		l.start = now
+		return Split
+	}
+	return None
+}
+
+func (l *Lifecycle) cooldownOf(class string) time.Duration {
+	if cooldown, ok := l.Config.Cooldown[class]; ok {
+		return cooldown
+	}
+	return l.Config.Cooldown["*"]
+}
@@ -0,0 +1,96 @@
+package eventLifecycle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdmitMinPersistence(t *testing.T) {
+	l := New(Config{MinPersistence: 2 * time.Second})
+	start := time.Unix(0, 0)
+
+	if l.Admit("a", "person", start) {
+		t.Fatalf("expected a new track not to be admitted")
+	}
+	if l.Admit("a", "person", start.Add(time.Second)) {
+		t.Fatalf("expected the track not to be admitted before it persisted")
+	}
+	if !l.Admit("a", "person", start.Add(2*time.Second)) {
+		t.Fatalf("expected the track to be admitted once it persisted")
+	}
+	if l.Admit("a", "person", start.Add(3*time.Second)) {
+		t.Errorf("expected a track to be admitted only once")
+	}
+}
+
+func TestGapAndPostRoll(t *testing.T) {
+	l := New(Config{Gap: 10 * time.Second, PostRoll: 15 * time.Second})
+	start := time.Unix(0, 0)
+
+	if !l.Trigger("person", start) {
+		t.Fatalf("expected the first object to start an event")
+	}
+	if l.Trigger("car", start.Add(5*time.Second)) {
+		t.Fatalf("expected an object of an open event not to start a new one")
+	}
+	if until := l.RecordUntil(); !until.Equal(start.Add(20 * time.Second)) {
+		t.Errorf("expected the clip to end 15s after the last object, got %v", until.Sub(start))
+	}
+	if deadline := l.Deadline(); !deadline.Equal(start.Add(20 * time.Second)) {
+		t.Errorf("expected the event to close after the post-roll, got %v", deadline.Sub(start))
+	}
+
+	if action := l.Check(start.Add(19 * time.Second)); action != None {
+		t.Errorf("expected nothing due before the deadline, got %v", action)
+	}
+	if action := l.Check(start.Add(20 * time.Second)); action != Close || l.Open() {
+		t.Errorf("expected the event to close at the deadline, got %v", action)
+	}
+	if !l.Deadline().IsZero() {
+		t.Errorf("expected no deadline without an open event")
+	}
+}
+
+func TestMaxDurationSplits(t *testing.T) {
+	l := New(Config{Gap: 10 * time.Second, MaxDuration: time.Minute})
+	start := time.Unix(0, 0)
+
+	l.Trigger("person", start)
+	for s := 5; s < 60; s += 5 {
+		l.Trigger("person", start.Add(time.Duration(s)*time.Second))
+	}
+	if deadline := l.Deadline(); !deadline.Equal(start.Add(time.Minute)) {
+		t.Fatalf("expected the split to be due after a minute, got %v", deadline.Sub(start))
+	}
+	if action := l.Check(start.Add(time.Minute)); action != Split || !l.Open() {
+		t.Fatalf("expected the clip to be split, got %v", action)
+	}
+	if deadline := l.Deadline(); !deadline.Equal(start.Add(65 * time.Second)) {
+		t.Errorf("expected the event to close 10s after the last object, got %v", deadline.Sub(start))
+	}
+}
+
+func TestCooldown(t *testing.T) {
+	l := New(Config{Gap: 10 * time.Second, Cooldown: map[string]time.Duration{"car": time.Minute}})
+	start := time.Unix(0, 0)
+
+	if !l.Admit("a", "car", start) {
+		t.Fatalf("expected the first car to be admitted")
+	}
+	l.Trigger("car", start)
+	l.Check(start.Add(10 * time.Second))
+
+	if l.Admit("b", "car", start.Add(20*time.Second)) {
+		t.Errorf("expected a car not to start an event during the cooldown")
+	}
+	if !l.Admit("c", "person", start.Add(20*time.Second)) {
+		t.Errorf("expected other classes not to cool down")
+	}
+	l.Trigger("person", start.Add(20*time.Second))
+	if !l.Admit("d", "car", start.Add(25*time.Second)) {
+		t.Errorf("expected a car to join an open event during the cooldown")
+	}
+	if !l.Admit("e", "car", start.Add(80*time.Second)) {
+		t.Errorf("expected a car to be admitted after the cooldown")
+	}
+}
@@ -0,0 +1,319 @@
+// Package faceGallery stores the people enrolled for face recognition. The web server manages people and photos,
+// the detector computes an embedding per photo and matches faces against them. Both share the gallery on disk:
+//
+//	<dir>/people.json        people and the file names of their photos
+//	<dir>/<person id>/*.jpg  enrolled photos
+//	<dir>/embeddings.json    photo embeddings, written by the detector
+package faceGallery
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	peopleFile     = "people.json"
+	embeddingsFile = "embeddings.json"
+)
+
+type Person struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Photos  []string  `json:"photos"` // File names inside the person dir
+	Created time.Time `json:"created"`
+}
+
+// Gallery is safe for concurrent use within a process, writes across processes are atomic renames
+type Gallery struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+func Open(dir string) (*Gallery, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating face gallery dir: %w", err)
+	}
+	return &Gallery{Dir: dir}, nil
+}
+
+// People returns every enrolled person sorted by name
+func (g *Gallery) People() ([]Person, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	people, err := g.readPeople()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(people, func(i, j int) bool { return strings.ToLower(people[i].Name) < strings.ToLower(people[j].Name) })
+	return people, nil
+}
+
+// AddPerson enrolls a new person without photos
+func (g *Gallery) AddPerson(name string) (Person, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Person{}, fmt.Errorf("name must be set")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	people, err := g.readPeople()
+	if err != nil {
+		return Person{}, err
+	}
+
+	person := Person{ID: newID(), Name: name, Photos: []string{}, Created: time.Now()}
+	if err := os.MkdirAll(filepath.Join(g.Dir, person.ID), 0755); err != nil {
+		return Person{}, err
+	}
+	return person, g.writePeople(append(people, person))
+}
+
+// RenamePerson changes the name of person id
+func (g *Gallery) RenamePerson(id, name string) (Person, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Person{}, fmt.Errorf("name must be set")
+	}
+
+	var renamed Person
+	err := g.update(id, func(person *Person) error {
+		person.Name = name
+		renamed = *person
+		return nil
+	})
+	return renamed, err
+}
+
+// DeletePerson removes person id and all their photos
+func (g *Gallery) DeletePerson(id string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	people, err := g.readPeople()
+	if err != nil {
+		return err
+	}
+
+	for i, person := range people {
+		if person.ID == id {
+			if err := g.writePeople(append(people[:i], people[i+1:]...)); err != nil {
+				return err
+			}
+			return os.RemoveAll(filepath.Join(g.Dir, id))
+		}
+	}
+	return fmt.Errorf("person %s not found", id)
+}
+
+// AddPhoto stores a jpeg/png photo of person id and returns its file name
+func (g *Gallery) AddPhoto(id string, data []byte, ext string) (string, error) {
+	ext = strings.ToLower(ext)
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+		return "", fmt.Errorf("unsupported photo type %s", ext)
+	}
+	// The detector decodes every photo, one that does not decode would only fail there
+	if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		return "", fmt.Errorf("photo is not a JPEG or PNG image: %w", err)
+	}
+
+	photo := newID() + ext
+	err := g.update(id, func(person *Person) error {
+		if err := os.WriteFile(filepath.Join(g.Dir, id, photo), data, 0644); err != nil {
+			return err
+		}
+		person.Photos = append(person.Photos, photo)
+		return nil
+	})
+	return photo, err
+}
+
+// DeletePhoto removes a photo of person id
+func (g *Gallery) DeletePhoto(id, photo string) error {
+	return g.update(id, func(person *Person) error {
+		for i, p := range person.Photos {
+			if p == photo {
+				person.Photos = append(person.Photos[:i], person.Photos[i+1:]...)
+				return os.Remove(filepath.Join(g.Dir, id, photo))
+			}
+		}
+		return fmt.Errorf("photo %s not found", photo)
+	})
+}
+
+// PhotoPath returns the path of a photo, checking it belongs to person id
+func (g *Gallery) PhotoPath(id, photo string) (string, error) {
+	people, err := g.People()
+	if err != nil {
+		return "", err
+	}
+	for _, person := range people {
+		if person.ID == id {
+			for _, p := range person.Photos {
+				if p == photo {
+					return filepath.Join(g.Dir, id, photo), nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("photo %s not found", photo)
+}
+
+// Modified returns the modification time of people.json, used to notice changes made by the web server
+func (g *Gallery) Modified() time.Time {
+	info, err := os.Stat(filepath.Join(g.Dir, peopleFile))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// Embeddings returns the cached photo embeddings keyed by "<person id>/<photo>"
+func (g *Gallery) Embeddings() (map[string][]float32, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	embeddings := map[string][]float32{}
+	if err := readJSON(filepath.Join(g.Dir, embeddingsFile), &embeddings); err != nil {
+		return nil, err
+	}
+	return embeddings, nil
+}
+
+// SaveEmbeddings replaces the cached photo embeddings
+func (g *Gallery) SaveEmbeddings(embeddings map[string][]float32) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return writeJSON(filepath.Join(g.Dir, embeddingsFile), embeddings)
+}
+
+func (g *Gallery) update(id string, fn func(person *Person) error) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	people, err := g.readPeople()
+	if err != nil {
+		return err
+	}
+	for i := range people {
+		if people[i].ID == id {
+			if err := fn(&people[i]); err != nil {
+				return err
+			}
+			return g.writePeople(people)
+		}
+	}
+	return fmt.Errorf("person %s not found", id)
+}
+
+func (g *Gallery) readPeople() ([]Person, error) {
+	people := []Person{}
+	if err := readJSON(filepath.Join(g.Dir, peopleFile), &people); err != nil {
+		return nil, err
+	}
+	return people, nil
+}
+
+func (g *Gallery) writePeople(people []Person) error {
+	return writeJSON(filepath.Join(g.Dir, peopleFile), people)
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSON writes to a temp file and renames it so the other process never reads a half written file
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Entry is one enrolled photo embedding used for matching
+type Entry struct {
+	PersonID  string
+	Name      string
+	Embedding []float32 // L2 normalized
+}
+
+// Match is the best gallery entry for a face
+type Match struct {
+	PersonID   string
+	Name       string
+	Similarity float32
+}
+
+// BestMatch returns the entry with the highest cosine similarity to embedding, ok is false below threshold
+func BestMatch(entries []Entry, embedding []float32, threshold float32) (Match, bool) {
+	embedding = Normalize(embedding)
+
+	best := Match{Similarity: -1}
+	for _, entry := range entries {
+		similarity := Dot(entry.Embedding, embedding)
+		if similarity > best.Similarity {
+			best = Match{PersonID: entry.PersonID, Name: entry.Name, Similarity: similarity}
+		}
+	}
+	return best, best.PersonID != "" && best.Similarity >= threshold
+}
+
+// Normalize returns embedding scaled to unit length, so the dot product of two normalized embeddings is their cosine similarity
+func Normalize(embedding []float32) []float32 {
+	var sum float64
+	for _, v := range embedding {
+		sum += float64(v) * float64(v)
+	}
+	norm := float32(math.Sqrt(sum))
+	if norm == 0 {
+		return embedding
+	}
+
+	out := make([]float32, len(embedding))
+	for i, v := range embedding {
+		out[i] = v / norm
+	}
+	return out
+}
+
+func Dot(a, b []float32) float32 {
+	var sum float32
+	for i := 0; i < len(a) && i < len(b); i++ {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
@@ -0,0 +1,98 @@
+package faceGallery
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"testing"
+)
+
+func pngPhoto(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGalleryPeopleAndPhotos(t *testing.T) {
+	gallery, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := gallery.AddPerson("Alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gallery.AddPerson(" "); err == nil {
+		t.Error("expected an error for an empty name")
+	}
+
+	photo, err := gallery.AddPhoto(alice.ID, pngPhoto(t), ".png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gallery.AddPhoto(alice.ID, []byte("jpeg"), ".jpg"); err == nil {
+		t.Error("expected an error for a photo that is not an image")
+	}
+	if _, err := gallery.AddPhoto(alice.ID, []byte("gif"), ".gif"); err == nil {
+		t.Error("expected an error for an unsupported photo type")
+	}
+
+	path, err := gallery.PhotoPath(alice.ID, photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected photo at %s: %v", path, err)
+	}
+	if _, err := gallery.PhotoPath(alice.ID, "../people.json"); err == nil {
+		t.Error("expected an error for a photo that is not enrolled")
+	}
+
+	if _, err := gallery.RenamePerson(alice.ID, "Alice B"); err != nil {
+		t.Fatal(err)
+	}
+	people, err := gallery.People()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(people) != 1 || people[0].Name != "Alice B" || len(people[0].Photos) != 1 {
+		t.Fatalf("unexpected people %+v", people)
+	}
+
+	if err := gallery.DeletePhoto(alice.ID, photo); err != nil {
+		t.Fatal(err)
+	}
+	if err := gallery.DeletePerson(alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if people, _ := gallery.People(); len(people) != 0 {
+		t.Errorf("expected no people, got %+v", people)
+	}
+}
+
+func TestBestMatch(t *testing.T) {
+	entries := []Entry{
+		{PersonID: "a", Name: "Alice", Embedding: Normalize([]float32{1, 0, 0})},
+		{PersonID: "b", Name: "Bob", Embedding: Normalize([]float32{0, 1, 0})},
+	}
+
+	match, ok := BestMatch(entries, []float32{0.9, 0.1, 0}, 0.8)
+	if !ok || match.Name != "Alice" {
+		t.Errorf("expected Alice, got %+v %v", match, ok)
+	}
+
+	// Halfway between both is below the threshold
+	match, ok = BestMatch(entries, []float32{1, 1, 0}, 0.8)
+	if ok {
+		t.Errorf("expected no match, got %+v", match)
+	}
+
+	if _, ok := BestMatch(nil, []float32{1, 0, 0}, 0); ok {
+		t.Error("expected no match on an empty gallery")
+	}
+}
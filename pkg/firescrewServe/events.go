@@ -0,0 +1,209 @@
+package firescrewServe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/catsimple/firescrew/pkg/eventBus"
+)
+
+// Bus carries the events of the cameras. The daemon sets its own bus, on its own the server makes one that is fed
+// by cameras whose webhookUrl points at /api/events.
+var Bus *eventBus.Bus
+
+// Max size of an event posted by a camera webhook
+const maxEventSize = 4 << 20
+
+// Event types of the payloads cameras post, the handler types are used on the bus
+var webhookTypes = map[string]string{
+	"motion_started": "motion_start",
+	"motion_ended":   "motion_end",
+}
+
+// liveTypes are the events pushed by /api/events/stream
+var liveTypes = []string{"motion_start", "motion_update", "motion_end"}
+
+// LiveEvent is a motion event pushed to the web UI, Event has the shape of the metadata of /api
+type LiveEvent struct {
+	Type         string   `json:"type"` // motion_start, motion_update or motion_end
+	Event        FileData `json:"event"`
+	SnapshotURLs []string `json:"snapshotUrls"`
+	VideoURL     string   `json:"videoUrl"`
+}
+
+// eventsHandler lists and receives the events of the cameras:
+//
+//	GET  /api/events  recent events, newest last. Optional camera, type and limit (defaults to 50)
+//	POST /api/events  publishes an event, the body is the payload of a camera webhook
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 50
+		}
+
+		events := []eventBus.Event{}
+		for _, e := range Bus.Recent() {
+			if (query.Get("camera") == "" || e.Camera == query.Get("camera")) && (query.Get("type") == "" || e.Type == query.Get("type")) {
+				events = append(events, e)
+			}
+		}
+		if len(events) > limit {
+			events = events[len(events)-limit:]
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSONResponse(w, http.StatusOK, events, nil)
+	case http.MethodPost:
+		payload, err := io.ReadAll(io.LimitReader(r.Body, maxEventSize))
+		if err != nil {
+			writeJSONResponse(w, http.StatusBadRequest, nil, err)
+			return
+		}
+		var header struct {
+			Type       string `json:"type"`
+			CameraName string `json:"camera_name"`
+		}
+		if err := json.Unmarshal(payload, &header); err != nil || header.Type == "" {
+			writeJSONResponse(w, http.StatusBadRequest, nil, fmt.Errorf("expected an event with a type"))
+			return
+		}
+		if eventType, ok := webhookTypes[header.Type]; ok {
+			header.Type = eventType
+		}
+		Bus.Publish(eventBus.Event{Type: header.Type, Camera: header.CameraName, Payload: payload})
+		writeJSONResponse(w, http.StatusOK, nil, nil)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// eventStreamHandler pushes motion events as server-sent events, one LiveEvent per message with the event type as
+// the SSE event name:
+//
+//	GET /api/events/stream  optional camera and class, comma separated lists
+func eventStreamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	cameras := splitList(r.URL.Query().Get("camera"))
+	classes := splitList(strings.ToLower(r.URL.Query().Get("class")))
+
+	events, cancel := Bus.Subscribe(64)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no") // Keeps nginx from buffering the stream
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			live, ok := liveEvent(e)
+			if !ok || !matchesLive(live, cameras, classes) {
+				continue
+			}
+			data, err := json.Marshal(live)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", live.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// liveEvent converts a motion event of the bus, false for other events
+func liveEvent(e eventBus.Event) (LiveEvent, bool) {
+	if !slices.Contains(liveTypes, e.Type) {
+		return LiveEvent{}, false
+	}
+	var payload struct {
+		ID          string     `json:"id"`
+		MotionStart time.Time  `json:"motion_start"`
+		MotionEnd   *time.Time `json:"motion_end"`
+		Objects     []Objects  `json:"Objects"`
+		CameraName  string     `json:"camera_name"`
+		Attributes  []string   `json:"attributes"`
+		Snapshots   []string   `json:"snapshots"`
+		VideoFile   string     `json:"video_file"`
+	}
+	if err := json.Unmarshal(e.Payload, &payload); err != nil || payload.ID == "" {
+		return LiveEvent{}, false
+	}
+
+	live := LiveEvent{
+		Type: e.Type,
+		Event: FileData{
+			ID:          payload.ID,
+			MotionStart: payload.MotionStart.Format(time.RFC3339Nano),
+			Objects:     payload.Objects,
+			Snapshots:   payload.Snapshots,
+			VideoFile:   filepath.ToSlash(payload.VideoFile),
+			CameraName:  payload.CameraName,
+			Attributes:  payload.Attributes,
+		},
+		SnapshotURLs: []string{},
+		VideoURL:     path.Join("/rec", filepath.ToSlash(payload.VideoFile)),
+	}
+	live.Event = withoutEmbeddings(live.Event)
+	if live.Event.CameraName == "" {
+		live.Event.CameraName = e.Camera
+	}
+	if payload.MotionEnd != nil {
+		live.Event.MotionEnd = payload.MotionEnd.Format(time.RFC3339Nano)
+	}
+	for _, snapshot := range payload.Snapshots {
+		live.SnapshotURLs = append(live.SnapshotURLs, path.Join("/images", filepath.ToSlash(snapshot)))
+	}
+	return live, true
+}
+
+// matchesLive reports whether live is from one of cameras and has an object of one of classes, empty lists match all
+func matchesLive(live LiveEvent, cameras, classes []string) bool {
+	if len(cameras) > 0 && !slices.Contains(cameras, live.Event.CameraName) {
+		return false
+	}
+	if len(classes) == 0 {
+		return true
+	}
+	for _, object := range live.Event.Objects {
+		if slices.Contains(classes, strings.ToLower(object.Class)) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,109 @@
+package firescrewServe
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/catsimple/firescrew/pkg/eventBus"
+)
+
+func TestEventsHandler(t *testing.T) {
+	Bus = eventBus.New(10)
+	defer func() { Bus = nil }()
+
+	for _, payload := range []string{
+		`{"type": "motion_started", "camera_name": "front", "id": "a"}`,
+		`{"type": "stream_down", "camera_name": "front"}`,
+		`{"type": "motion_ended", "camera_name": "back", "id": "b"}`,
+	} {
+		w := httptest.NewRecorder()
+		eventsHandler(w, httptest.NewRequest(http.MethodPost, "/api/events", strings.NewReader(payload)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected %s to be published, got %d %s", payload, w.Code, w.Body)
+		}
+	}
+	w := httptest.NewRecorder()
+	eventsHandler(w, httptest.NewRequest(http.MethodPost, "/api/events", strings.NewReader(`{"camera_name": "front"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected an event without a type to be rejected, got %d", w.Code)
+	}
+
+	for query, expected := range map[string][]string{
+		"":                              {"motion_start", "stream_down", "motion_end"},
+		"?camera=front":                 {"motion_start", "stream_down"},
+		"?type=motion_end":              {"motion_end"},
+		"?limit=1":                      {"motion_end"},
+		"?camera=front&type=motion_end": {},
+	} {
+		w := httptest.NewRecorder()
+		eventsHandler(w, httptest.NewRequest(http.MethodGet, "/api/events"+query, nil))
+		var resp struct {
+			Data []eventBus.Event `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: expected JSON, got %v", query, err)
+		}
+		types := []string{}
+		for _, e := range resp.Data {
+			types = append(types, e.Type)
+		}
+		if strings.Join(types, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s: expected %v, got %v", query, expected, types)
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	Bus = eventBus.New(10)
+	defer func() { Bus = nil }()
+	server := httptest.NewServer(http.HandlerFunc(eventStreamHandler))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?camera=front&class=Person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %s", resp.Header.Get("Content-Type"))
+	}
+	lines := bufio.NewScanner(resp.Body)
+	lines.Scan() // retry: 3000, the subscription is in place once it arrived
+	lines.Scan()
+
+	Bus.Publish(eventBus.Event{Type: "motion_start", Camera: "back", Payload: json.RawMessage(`{"id": "back", "Objects": [{"Class": "person"}]}`)})
+	Bus.Publish(eventBus.Event{Type: "motion_start", Camera: "front", Payload: json.RawMessage(`{"id": "car", "Objects": [{"Class": "car"}]}`)})
+	Bus.Publish(eventBus.Event{Type: "stream_down", Camera: "front", Payload: json.RawMessage(`{"id": "down"}`)})
+	Bus.Publish(eventBus.Event{Type: "motion_end", Camera: "front", Payload: json.RawMessage(`{
+		"id": "match", "motion_start": "2024-05-01T10:00:00Z", "motion_end": "2024-05-01T10:00:30Z",
+		"Objects": [{"Class": "person", "Embedding": [1, 0]}], "snapshots": ["2024-05-01/a.jpg"], "video_file": "2024-05-01/a.mp4"
+	}`)})
+
+	var name, data string
+	for lines.Scan() {
+		line := lines.Text()
+		if value, ok := strings.CutPrefix(line, "event: "); ok {
+			name = value
+		} else if value, ok := strings.CutPrefix(line, "data: "); ok {
+			data = value
+			break
+		}
+	}
+	if name != "motion_end" {
+		t.Fatalf("expected only the matching motion_end event, got %q %s", name, data)
+	}
+	var live LiveEvent
+	if err := json.Unmarshal([]byte(data), &live); err != nil {
+		t.Fatal(err)
+	}
+	if live.Event.ID != "match" || live.Event.CameraName != "front" || live.Event.MotionEnd != "2024-05-01T10:00:30Z" || live.Event.Objects[0].Embedding != nil {
+		t.Errorf("unexpected event %+v", live.Event)
+	}
+	if live.VideoURL != "/rec/2024-05-01/a.mp4" || len(live.SnapshotURLs) != 1 || live.SnapshotURLs[0] != "/images/2024-05-01/a.jpg" {
+		t.Errorf("unexpected urls %s %v", live.VideoURL, live.SnapshotURLs)
+	}
+}
@@ -0,0 +1,114 @@
+package firescrewServe
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/catsimple/firescrew/pkg/faceGallery"
+)
+
+// Max size of an uploaded gallery photo
+const maxPhotoSize = 10 << 20
+
+// GalleryPath is the face recognition gallery the server manages, it has to be the galleryPath of the cameras. Serve
+// defaults it to the faces directory below the media path, which is also the default of the cameras.
+var GalleryPath string
+
+var gallery *faceGallery.Gallery
+
+// facesHandler manages the face recognition gallery, the detector picks up changes on its own:
+//
+//	GET    /api/faces                      list people
+//	POST   /api/faces                      add a person, form field name
+//	PUT    /api/faces/{id}                 rename a person, form field name
+//	DELETE /api/faces/{id}                 delete a person and their photos
+//	POST   /api/faces/{id}/photos          add a photo, multipart field photo
+//	GET    /api/faces/{id}/photos/{photo}  get a photo
+//	DELETE /api/faces/{id}/photos/{photo}  delete a photo
+func facesHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/faces"), "/"), "/")
+	if parts[0] == "" {
+		parts = nil
+	}
+
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		people, err := gallery.People()
+		if err != nil {
+			writeJSONResponse(w, http.StatusInternalServerError, nil, err)
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, people, nil)
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		person, err := gallery.AddPerson(r.FormValue("name"))
+		if err != nil {
+			writeJSONResponse(w, http.StatusBadRequest, nil, err)
+			return
+		}
+		Log("info", fmt.Sprintf("Face gallery: added %s (%s)", person.Name, person.ID))
+		writeJSONResponse(w, http.StatusCreated, person, nil)
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		person, err := gallery.RenamePerson(parts[0], r.FormValue("name"))
+		if err != nil {
+			writeJSONResponse(w, http.StatusBadRequest, nil, err)
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, person, nil)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if err := gallery.DeletePerson(parts[0]); err != nil {
+			writeJSONResponse(w, http.StatusNotFound, nil, err)
+			return
+		}
+		Log("info", fmt.Sprintf("Face gallery: deleted %s", parts[0]))
+		writeJSONResponse(w, http.StatusOK, nil, nil)
+	case len(parts) == 2 && parts[1] == "photos" && r.Method == http.MethodPost:
+		uploadPhoto(w, r, parts[0])
+	case len(parts) == 3 && parts[1] == "photos" && r.Method == http.MethodGet:
+		path, err := gallery.PhotoPath(parts[0], parts[2])
+		if err != nil {
+			http.Error(w, "Photo not found", http.StatusNotFound)
+			return
+		}
+		http.ServeFile(w, r, path)
+	case len(parts) == 3 && parts[1] == "photos" && r.Method == http.MethodDelete:
+		if err := gallery.DeletePhoto(parts[0], parts[2]); err != nil {
+			writeJSONResponse(w, http.StatusNotFound, nil, err)
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, nil, nil)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+func uploadPhoto(w http.ResponseWriter, r *http.Request, id string) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPhotoSize)
+	file, header, err := r.FormFile("photo")
+	if err != nil {
+		writeJSONResponse(w, http.StatusBadRequest, nil, fmt.Errorf("photo is required: %w", err))
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeJSONResponse(w, http.StatusBadRequest, nil, err)
+		return
+	}
+
+	photo, err := gallery.AddPhoto(id, data, filepath.Ext(header.Filename))
+	if err != nil {
+		status := http.StatusBadRequest
+		if os.IsNotExist(err) {
+			status = http.StatusNotFound
+		}
+		writeJSONResponse(w, status, nil, err)
+		return
+	}
+	Log("info", fmt.Sprintf("Face gallery: added photo %s to %s", photo, id))
+	writeJSONResponse(w, http.StatusCreated, map[string]string{"photo": photo}, nil)
+}
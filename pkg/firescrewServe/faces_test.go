@@ -0,0 +1,130 @@
+package firescrewServe
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/catsimple/firescrew/pkg/faceGallery"
+)
+
+func TestFacesHandler(t *testing.T) {
+	var err error
+	gallery, err = faceGallery.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { gallery = nil }()
+
+	do := func(method, target string, body *bytes.Buffer, contentType string) *httptest.ResponseRecorder {
+		if body == nil {
+			body = &bytes.Buffer{}
+		}
+		r := httptest.NewRequest(method, target, body)
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		facesHandler(w, r)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder, v any) {
+		t.Helper()
+		resp := struct {
+			Data any `json:"data"`
+		}{Data: v}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("expected JSON, got %v", err)
+		}
+	}
+
+	w := do(http.MethodPost, "/api/faces", bytes.NewBufferString(url.Values{"name": {"Alice"}}.Encode()), "application/x-www-form-urlencoded")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected the person to be added, got %d %s", w.Code, w.Body)
+	}
+	var person faceGallery.Person
+	decode(w, &person)
+
+	upload := func(data []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("photo", "alice.JPG")
+		part.Write(data)
+		form.Close()
+		return do(http.MethodPost, "/api/faces/"+person.ID+"/photos", &body, form.FormDataContentType())
+	}
+	if w = upload([]byte("jpeg data")); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a photo that is not an image to be refused, got %d %s", w.Code, w.Body)
+	}
+	var photoData bytes.Buffer
+	jpeg.Encode(&photoData, image.NewGray(image.Rect(0, 0, 2, 2)), nil)
+	w = upload(photoData.Bytes())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected the photo to be added, got %d %s", w.Code, w.Body)
+	}
+	var photo map[string]string
+	decode(w, &photo)
+
+	w = do(http.MethodGet, "/api/faces/"+person.ID+"/photos/"+photo["photo"], nil, "")
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), photoData.Bytes()) {
+		t.Errorf("expected the photo, got %d %s", w.Code, w.Body)
+	}
+	if w = do(http.MethodGet, "/api/faces/"+person.ID+"/photos/..%2Fpeople.json", nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected a path outside the person to be refused, got %d", w.Code)
+	}
+
+	var people []faceGallery.Person
+	decode(do(http.MethodGet, "/api/faces", nil, ""), &people)
+	if len(people) != 1 || people[0].Name != "Alice" || len(people[0].Photos) != 1 {
+		t.Errorf("expected Alice with one photo, got %+v", people)
+	}
+
+	if w = do(http.MethodDelete, "/api/faces/"+person.ID, nil, ""); w.Code != http.StatusOK {
+		t.Errorf("expected the person to be deleted, got %d %s", w.Code, w.Body)
+	}
+	if w = do(http.MethodDelete, "/api/faces/"+person.ID, nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected a deleted person to be gone, got %d", w.Code)
+	}
+	if w = do(http.MethodPatch, "/api/faces", nil, ""); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "Not found") {
+		t.Errorf("expected an unknown route to be refused, got %d", w.Code)
+	}
+}
+
+func TestServeImagesHidesGallery(t *testing.T) {
+	mediaPath = t.TempDir()
+	defer func() { mediaPath = "" }()
+	var err error
+	gallery, err = faceGallery.Open(filepath.Join(mediaPath, "faces"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { gallery = nil }()
+	if _, err := gallery.AddPerson("Alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mediaPath, "snapshot.jpg"), []byte("snapshot"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for target, expected := range map[string]int{
+		"/images/snapshot.jpg":          http.StatusOK,
+		"/images/faces/people.json":     http.StatusNotFound,
+		"/images/faces":                 http.StatusNotFound,
+		"/images/faces/../snapshot.jpg": http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		serveImages(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != expected {
+			t.Errorf("%s: expected %d, got %d", target, expected, w.Code)
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package firescrewServe
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -12,6 +14,11 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+
+	"github.com/catsimple/firescrew/pkg/eventBus"
+	"github.com/catsimple/firescrew/pkg/faceGallery"
+	"github.com/catsimple/firescrew/pkg/logging"
 )
 
 //go:embed static/*
@@ -26,14 +33,29 @@ type FileData struct {
 	Snapshots   []string  `json:"Snapshots"`
 	VideoFile   string    `json:"VideoFile"`
 	CameraName  string    `json:"CameraName"`
+	Attributes  []string  `json:"Attributes,omitempty"`
 }
 
 type Objects struct {
-	BBox       BBox    `json:"BBox"`
-	Center     Center  `json:"Center"`
-	Area       int     `json:"Area"`
-	LastMoved  string  `json:"LastMoved"`
-	Class      string  `json:"Class"`
+	BBox       BBox      `json:"BBox"`
+	Center     Center    `json:"Center"`
+	Area       int       `json:"Area"`
+	LastMoved  string    `json:"LastMoved"`
+	Class      string    `json:"Class"`
+	Confidence float64   `json:"Confidence"`
+	Labels     []Label   `json:"Labels,omitempty"`
+	ID         string    `json:"ID,omitempty"`
+	Plate      string    `json:"Plate,omitempty"`
+	PlateConf  float64   `json:"PlateConf,omitempty"`
+	Identity   string    `json:"Identity,omitempty"`
+	Person     string    `json:"Person,omitempty"`
+	Embedding  []float32 `json:"Embedding,omitempty"`
+}
+
+// Label is the result of a secondary classifier on an object, e.g. vehicle color
+type Label struct {
+	Classifier string  `json:"Classifier"`
+	Label      string  `json:"Label"`
 	Confidence float64 `json:"Confidence"`
 }
 
@@ -52,19 +74,29 @@ type Center struct {
 	Y int `json:"Y"`
 }
 
+var logger = logging.For("serve")
+
+// Log logs msg at level: debug, info, warning or error
 func Log(level, msg string) {
-	color := "\x1b[0m"
-	switch level {
-	case "info":
-		color = "\x1b[32m" // Green
-	case "error":
-		color = "\x1b[31m" // Red
-	case "warning":
-		color = "\x1b[33m" // Yellow
-	case "debug":
-		color = "\x1b[36m" // Cyan
-	}
-	fmt.Printf("%s%s [%s] %s\x1b[0m\n", color, time.Now().Format("15:04:05"), strings.ToUpper(level), msg)
+	slogLevel, _ := logging.ParseLevel(level, slog.LevelInfo)
+	logger.Log(context.Background(), slogLevel, msg)
+}
+
+// apiResponse 是 JSON 接口的通用返回格式
+type apiResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+func writeJSONResponse(w http.ResponseWriter, status int, data interface{}, err error) {
+	resp := apiResponse{Success: err == nil, Data: data}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
 }
 
 // loadData 优化：使用 os.ReadDir 替代 Walk，使用 json.Decoder 替代 ReadAll
@@ -100,7 +132,7 @@ func loadData(baseFolder string, tStart, tEnd time.Time) ([]FileData, error) {
 			if err != nil {
 				continue
 			}
-			
+
 			// 优化：使用 Decoder 流式解析，减少内存分配
 			var fileData FileData
 			if err := json.NewDecoder(file).Decode(&fileData); err != nil {
@@ -114,7 +146,7 @@ func loadData(baseFolder string, tStart, tEnd time.Time) ([]FileData, error) {
 			// 假设 VideoFile 是相对路径 "2025-01-01/clip.ts"
 			fullVideoPath := filepath.Join(baseFolder, fileData.VideoFile)
 			mp4FilePath := strings.TrimSuffix(fullVideoPath, filepath.Ext(fullVideoPath)) + ".mp4"
-			
+
 			if _, err := os.Stat(mp4FilePath); err == nil {
 				// 更新为 .mp4 扩展名
 				fileData.VideoFile = strings.TrimSuffix(fileData.VideoFile, filepath.Ext(fileData.VideoFile)) + ".mp4"
@@ -140,6 +172,7 @@ func promptHandler(w http.ResponseWriter, r *http.Request) {
 	startStr := query.Get("start")
 	endStr := query.Get("end")
 	keywordStr := query.Get("q")
+	plateStr := normalizePlate(query.Get("plate"))
 
 	layout := "2006-01-02 15:04"
 	var tStart, tEnd time.Time
@@ -165,6 +198,14 @@ func promptHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Without explicit bounds a range in the prompt, e.g. "people yesterday 5pm", narrows the search
+	if startStr == "" && endStr == "" {
+		if start, end, rest, err := parseDateRange(keywordStr, now); err == nil {
+			tStart, tEnd = start, end
+			keywordStr = strings.Join(rest, " ")
+		}
+	}
+
 	Log("info", fmt.Sprintf("Query: %s -> %s | Q: %s", tStart.Format(layout), tEnd.Format(layout), keywordStr))
 
 	rawData, err := loadData(mediaPath, tStart, tEnd)
@@ -205,6 +246,21 @@ func promptHandler(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 
+			// 匹配事件属性 (known_person / unknown_person)
+			if !matched {
+				for _, attr := range item.Attributes {
+					for _, k := range keywords {
+						if strings.Contains(attr, k) {
+							matched = true
+							break
+						}
+					}
+					if matched {
+						break
+					}
+				}
+			}
+
 			// 2. 匹配物体
 			if !matched {
 				for _, obj := range item.Objects {
@@ -215,6 +271,26 @@ func promptHandler(w http.ResponseWriter, r *http.Request) {
 							matched = true
 							break
 						}
+						// 匹配车牌
+						if plateKey := normalizePlate(k); obj.Plate != "" && plateKey != "" && strings.Contains(normalizePlate(obj.Plate), plateKey) {
+							matched = true
+							break
+						}
+						// 匹配人脸识别结果 (人名 / known_person / unknown_person)
+						if (obj.Person != "" && strings.Contains(strings.ToLower(obj.Person), k)) || (obj.Identity != "" && strings.Contains(obj.Identity, k)) {
+							matched = true
+							break
+						}
+						// 匹配二级分类标签 (e.g. "red", "delivery")
+						for _, label := range obj.Labels {
+							if strings.Contains(strings.ToLower(label.Label), k) {
+								matched = true
+								break
+							}
+						}
+						if matched {
+							break
+						}
 					}
 					if matched {
 						break
@@ -226,7 +302,21 @@ func promptHandler(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		filteredData = append(filteredData, item)
+		// 车牌过滤
+		if plateStr != "" {
+			matched := false
+			for _, obj := range item.Objects {
+				if strings.Contains(normalizePlate(obj.Plate), plateStr) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		filteredData = append(filteredData, withoutEmbeddings(item))
 	}
 
 	// 排序：最新的在前
@@ -242,6 +332,110 @@ func promptHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(retObj{Success: true, Data: filteredData})
 }
 
+var monthNames = map[string]time.Month{
+	"january": time.January, "february": time.February, "march": time.March, "april": time.April,
+	"may": time.May, "june": time.June, "july": time.July, "august": time.August,
+	"september": time.September, "october": time.October, "november": time.November, "december": time.December,
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April, "jun": time.June,
+	"jul": time.July, "aug": time.August, "sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// rangeWords only join the dates and times of a prompt
+var rangeWords = map[string]bool{"from": true, "to": true, "between": true, "and": true, "at": true, "on": true}
+
+// ParseDateRangePrompt reads the time range of a prompt such as "people today from 9am to 1pm" or "july 4th 9am".
+// A single time covers the hour after it, a day without a time covers the whole day.
+func ParseDateRangePrompt(prompt string) (time.Time, time.Time, error) {
+	start, end, _, err := parseDateRange(prompt, time.Now())
+	return start, end, err
+}
+
+// parseDateRange also returns the words of the prompt that are not part of the range
+func parseDateRange(prompt string, now time.Time) (start, end time.Time, rest []string, err error) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	dated := false
+	var points []time.Time
+	words := strings.Fields(strings.ToLower(prompt))
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		switch {
+		case word == "today":
+			day, dated = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local), true
+		case word == "yesterday":
+			day, dated = time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, time.Local), true
+		case monthNames[word] != 0 && i+1 < len(words) && parseMonthDay(words[i+1]) > 0:
+			day, dated = time.Date(now.Year(), monthNames[word], parseMonthDay(words[i+1]), 0, 0, 0, 0, time.Local), true
+			i++
+		case parseClock(word) >= 0:
+			points = append(points, day.Add(parseClock(word)))
+		case rangeWords[word]:
+		default:
+			rest = append(rest, word)
+		}
+	}
+
+	switch {
+	case len(points) >= 2:
+		return points[0], points[1], rest, nil
+	case len(points) == 1:
+		return points[0], points[0].Add(time.Hour), rest, nil
+	case dated:
+		return day, day.Add(24*time.Hour - time.Second), rest, nil
+	}
+	return time.Time{}, time.Time{}, nil, fmt.Errorf("no date or time in %q", prompt)
+}
+
+// parseMonthDay reads a day of the month such as 7 or 7th, 0 if it is none
+func parseMonthDay(word string) int {
+	for _, suffix := range []string{"st", "nd", "rd", "th"} {
+		word = strings.TrimSuffix(word, suffix)
+	}
+	day, err := strconv.Atoi(word)
+	if err != nil || day < 1 || day > 31 {
+		return 0
+	}
+	return day
+}
+
+// parseClock reads a time of day such as 9am or 5:30pm as the offset from midnight, -1 if it is none
+func parseClock(word string) time.Duration {
+	var pm bool
+	if clock, ok := strings.CutSuffix(word, "pm"); ok {
+		word, pm = clock, true
+	} else if clock, ok := strings.CutSuffix(word, "am"); ok {
+		word = clock
+	} else {
+		return -1
+	}
+	hourStr, minuteStr, _ := strings.Cut(word, ":")
+	hour, err := strconv.Atoi(hourStr)
+	if err != nil || hour < 1 || hour > 12 {
+		return -1
+	}
+	minute := 0
+	if minuteStr != "" {
+		if minute, err = strconv.Atoi(minuteStr); err != nil || minute < 0 || minute > 59 {
+			return -1
+		}
+	}
+	hour %= 12
+	if pm {
+		hour += 12
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+}
+
+// normalizePlate uppercases a plate and strips everything but letters and digits, same as objectPredict.NormalizePlate
+func normalizePlate(plate string) string {
+	var out strings.Builder
+	for _, r := range strings.ToUpper(plate) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
 // singular 增强版
 func singular(word string) string {
 	word = strings.ToLower(word)
@@ -306,17 +500,21 @@ func rangeVideo(w http.ResponseWriter, req *http.Request) {
 		ranges := strings.Split(rangeHeader, "=")[1]
 		rangesSplit := strings.Split(ranges, "-")
 		start, _ := strconv.ParseInt(rangesSplit[0], 10, 64)
-		
+
 		var end int64
 		if len(rangesSplit) > 1 && rangesSplit[1] != "" {
 			end, _ = strconv.ParseInt(rangesSplit[1], 10, 64)
 		} else {
 			end = size - 1
 		}
-		
-		if start < 0 { start = 0 }
-		if end >= size { end = size - 1 }
-		
+
+		if start < 0 {
+			start = 0
+		}
+		if end >= size {
+			end = size - 1
+		}
+
 		ra.start = start
 		ra.length = end - start + 1
 	}
@@ -344,7 +542,12 @@ func rangeVideo(w http.ResponseWriter, req *http.Request) {
 func serveImages(w http.ResponseWriter, r *http.Request) {
 	requestFile := strings.TrimPrefix(r.URL.Path, "/images/")
 	img := filepath.Join(mediaPath, requestFile)
-	
+
+	// The gallery has its own API, its people and embeddings are not snapshots
+	if gallery != nil && insideDir(gallery.Dir, img) {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
 	file, err := os.Open(img)
 	if err != nil {
 		http.Error(w, "Image not found", http.StatusNotFound)
@@ -357,10 +560,43 @@ func serveImages(w http.ResponseWriter, r *http.Request) {
 	io.Copy(w, file)
 }
 
+// insideDir tells whether path is dir or below it
+func insideDir(dir, path string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func Serve(path string, addr string) error {
 	mediaPath = filepath.Clean(path)
+	if Bus == nil {
+		Bus = eventBus.New(500)
+	}
+
+	var err error
+	if GalleryPath == "" {
+		GalleryPath = filepath.Join(mediaPath, "faces")
+	}
+	gallery, err = faceGallery.Open(GalleryPath)
+	if err != nil {
+		return err
+	}
 
 	http.HandleFunc("/api", promptHandler)
+	http.HandleFunc("/api/similar", similarHandler)
+	http.HandleFunc("/api/faces", facesHandler)
+	http.HandleFunc("/api/faces/", facesHandler)
+	http.HandleFunc("/api/status", statusHandler)
+	http.HandleFunc("/api/events", eventsHandler)
+	http.HandleFunc("/api/events/stream", eventStreamHandler)
+	http.HandleFunc("/status", statusPage)
 	http.Handle("/static/", http.FileServer(http.FS(staticFiles)))
 	http.HandleFunc("/images/", serveImages)
 	http.HandleFunc("/rec/", rangeVideo)
@@ -374,6 +610,6 @@ func Serve(path string, addr string) error {
 		io.Copy(w, f)
 	})
 
-	Log("info", fmt.Sprintf("Server started. Media Root: %s | Address: %s", mediaPath, addr))
+	Log("info", fmt.Sprintf("Server started. Media Root: %s | Face Gallery: %s | Address: %s", mediaPath, GalleryPath, addr))
 	return http.ListenAndServe(addr, nil)
 }
@@ -0,0 +1,239 @@
+package firescrewServe
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/catsimple/firescrew/pkg/faceGallery"
+)
+
+// ImageEmbedder 计算上传图片的外观向量，仅当服务端带配置文件启动且开启 appearanceEmbedding 时设置
+var ImageEmbedder func(img image.Image) ([]float32, error)
+
+// Max size of an uploaded example image
+const maxExampleSize = 10 << 20
+
+// SimilarEvent 是以图搜图的一条结果，Similarity 是事件中最相似物体的余弦相似度
+type SimilarEvent struct {
+	Similarity float32  `json:"similarity"`
+	ObjectID   string   `json:"objectId"`
+	Event      FileData `json:"event"`
+}
+
+// similarHandler 以图搜图，返回出现过相似物体的事件，按余弦相似度排序:
+//
+//	GET  /api/similar?event={id}&object={track id}  以事件中的物体为例
+//	GET  /api/similar?event={id}&box=x1,y1,x2,y2    以事件中与该框重叠最多的物体为例
+//	POST /api/similar                               以上传的截图为例, multipart field image
+//
+// 可选参数: start/end (同 /api, 默认最近 30 天), class, min (最低相似度, 默认 0.5), limit (默认 20)
+func similarHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var example []float32
+	var exampleEvent string
+	class := query.Get("class")
+
+	switch r.Method {
+	case http.MethodGet:
+		object, err := findExampleObject(query.Get("event"), query.Get("object"), query.Get("box"))
+		if err != nil {
+			writeJSONResponse(w, http.StatusNotFound, nil, err)
+			return
+		}
+		if len(object.Embedding) == 0 {
+			writeJSONResponse(w, http.StatusBadRequest, nil, fmt.Errorf("object has no appearance embedding"))
+			return
+		}
+		example, exampleEvent = object.Embedding, query.Get("event")
+		if class == "" {
+			class = object.Class
+		}
+	case http.MethodPost:
+		if ImageEmbedder == nil {
+			writeJSONResponse(w, http.StatusNotImplemented, nil, fmt.Errorf("searching by image needs the server started with a config that enables appearanceEmbedding"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxExampleSize)
+		file, _, err := r.FormFile("image")
+		if err != nil {
+			writeJSONResponse(w, http.StatusBadRequest, nil, fmt.Errorf("image is required: %w", err))
+			return
+		}
+		defer file.Close()
+
+		img, _, err := image.Decode(file)
+		if err != nil {
+			writeJSONResponse(w, http.StatusBadRequest, nil, fmt.Errorf("error decoding image: %w", err))
+			return
+		}
+		example, err = ImageEmbedder(img)
+		if err != nil {
+			writeJSONResponse(w, http.StatusInternalServerError, nil, err)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now()
+	tStart := parseQueryTime(query.Get("start"), now.AddDate(0, 0, -30))
+	tEnd := parseQueryTime(query.Get("end"), now)
+	minSimilarity := float32(0.5)
+	if v, err := strconv.ParseFloat(query.Get("min"), 32); err == nil {
+		minSimilarity = float32(v)
+	}
+	limit := 20
+	if v, err := strconv.Atoi(query.Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+
+	events, err := loadData(mediaPath, tStart, tEnd)
+	if err != nil {
+		writeJSONResponse(w, http.StatusInternalServerError, nil, err)
+		return
+	}
+
+	results := rankSimilar(events, example, exampleEvent, class, minSimilarity, limit)
+	Log("info", fmt.Sprintf("Similar: %s -> %s | Class: %s | %d of %d events", tStart.Format("2006-01-02 15:04"), tEnd.Format("2006-01-02 15:04"), class, len(results), len(events)))
+	writeJSONResponse(w, http.StatusOK, results, nil)
+}
+
+// rankSimilar 线性扫描所有物体的外观向量，每个事件取最相似的物体，跳过示例所在的事件
+func rankSimilar(events []FileData, example []float32, skipEvent, class string, minSimilarity float32, limit int) []SimilarEvent {
+	example = faceGallery.Normalize(example)
+
+	results := []SimilarEvent{}
+	for _, event := range events {
+		if event.ID == skipEvent {
+			continue
+		}
+
+		best := SimilarEvent{Similarity: -1}
+		for _, obj := range event.Objects {
+			if len(obj.Embedding) != len(example) || (class != "" && obj.Class != class) {
+				continue
+			}
+			// 存储的向量已归一化，点积即余弦相似度
+			if similarity := faceGallery.Dot(obj.Embedding, example); similarity > best.Similarity {
+				best.Similarity, best.ObjectID = similarity, obj.ID
+			}
+		}
+		if best.Similarity < minSimilarity {
+			continue
+		}
+
+		best.Event = withoutEmbeddings(event)
+		results = append(results, best)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Similarity > results[j].Similarity })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// findExampleObject 在事件中按 track id 或重叠最多的框查找示例物体
+func findExampleObject(eventID, objectID, box string) (Objects, error) {
+	event, err := loadEvent(eventID)
+	if err != nil {
+		return Objects{}, err
+	}
+
+	if objectID != "" {
+		for _, obj := range event.Objects {
+			if obj.ID == objectID {
+				return obj, nil
+			}
+		}
+		return Objects{}, fmt.Errorf("object %s not found in event %s", objectID, eventID)
+	}
+
+	rect, err := parseBox(box)
+	if err != nil {
+		return Objects{}, err
+	}
+	best, bestOverlap := -1, 0
+	for i, obj := range event.Objects {
+		objRect := image.Rect(obj.BBox.Min.X, obj.BBox.Min.Y, obj.BBox.Max.X, obj.BBox.Max.Y)
+		overlap := rect.Intersect(objRect)
+		if area := overlap.Dx() * overlap.Dy(); area > bestOverlap {
+			best, bestOverlap = i, area
+		}
+	}
+	if best < 0 {
+		return Objects{}, fmt.Errorf("no object of event %s overlaps box %s", eventID, box)
+	}
+	return event.Objects[best], nil
+}
+
+// loadEvent 读取单个事件，事件 ID 以 20060102_150405 开头，据此确定日期文件夹
+func loadEvent(id string) (FileData, error) {
+	if len(id) < 8 {
+		return FileData{}, fmt.Errorf("invalid event id %q", id)
+	}
+	day, err := time.ParseInLocation("20060102", id[:8], time.Local)
+	if err != nil {
+		return FileData{}, fmt.Errorf("invalid event id %q", id)
+	}
+
+	events, err := loadData(mediaPath, day, day)
+	if err != nil {
+		return FileData{}, err
+	}
+	for _, event := range events {
+		if event.ID == id {
+			return event, nil
+		}
+	}
+	return FileData{}, fmt.Errorf("event %s not found in %s", id, filepath.Join(mediaPath, day.Format("2006-01-02")))
+}
+
+// parseBox 解析 "x1,y1,x2,y2"
+func parseBox(box string) (image.Rectangle, error) {
+	parts := strings.Split(box, ",")
+	if len(parts) != 4 {
+		return image.Rectangle{}, fmt.Errorf("object or box=x1,y1,x2,y2 must be set")
+	}
+	var coords [4]int
+	for i, part := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return image.Rectangle{}, fmt.Errorf("invalid box %q", box)
+		}
+		coords[i] = v
+	}
+	return image.Rect(coords[0], coords[1], coords[2], coords[3]), nil
+}
+
+func parseQueryTime(value string, fallback time.Time) time.Time {
+	if value == "" {
+		return fallback
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+	if err != nil {
+		return fallback
+	}
+	return t
+}
+
+// withoutEmbeddings 返回不含外观向量的事件，向量只用于检索，不需要发给前端
+func withoutEmbeddings(event FileData) FileData {
+	objects := make([]Objects, len(event.Objects))
+	copy(objects, event.Objects)
+	for i := range objects {
+		objects[i].Embedding = nil
+	}
+	event.Objects = objects
+	return event
+}
@@ -0,0 +1,51 @@
+package firescrewServe
+
+import (
+	"testing"
+)
+
+func TestRankSimilar(t *testing.T) {
+	events := []FileData{
+		{ID: "example", Objects: []Objects{{ID: "a", Class: "truck", Embedding: []float32{1, 0}}}},
+		{ID: "same", Objects: []Objects{
+			{ID: "b", Class: "person", Embedding: []float32{1, 0}},
+			{ID: "c", Class: "truck", Embedding: []float32{0.96, 0.28}},
+		}},
+		{ID: "close", Objects: []Objects{{ID: "d", Class: "truck", Embedding: []float32{0.8, 0.6}}}},
+		{ID: "different", Objects: []Objects{{ID: "e", Class: "truck", Embedding: []float32{0, 1}}}},
+		{ID: "none", Objects: []Objects{{ID: "f", Class: "truck"}}},
+	}
+
+	results := rankSimilar(events, []float32{2, 0}, "example", "truck", 0.5, 10)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].Event.ID != "same" || results[0].ObjectID != "c" || results[1].Event.ID != "close" {
+		t.Errorf("unexpected ranking %+v", results)
+	}
+	if results[0].Similarity < 0.95 || results[0].Similarity > 0.97 {
+		t.Errorf("expected similarity 0.96, got %f", results[0].Similarity)
+	}
+	if results[0].Event.Objects[1].Embedding != nil {
+		t.Errorf("expected embeddings to be stripped from results")
+	}
+	if events[1].Objects[1].Embedding == nil {
+		t.Errorf("expected the loaded events to keep their embeddings")
+	}
+
+	if results := rankSimilar(events, []float32{1, 0}, "", "", 0.5, 1); len(results) != 1 || results[0].Similarity < 0.99 {
+		t.Errorf("expected the single best match, got %+v", results)
+	}
+}
+
+func TestParseBox(t *testing.T) {
+	rect, err := parseBox("10, 20,30,40")
+	if err != nil || rect.Min.X != 10 || rect.Min.Y != 20 || rect.Max.X != 30 || rect.Max.Y != 40 {
+		t.Errorf("unexpected box %v %v", rect, err)
+	}
+	for _, box := range []string{"", "1,2,3", "a,b,c,d"} {
+		if _, err := parseBox(box); err == nil {
+			t.Errorf("expected error for %q", box)
+		}
+	}
+}
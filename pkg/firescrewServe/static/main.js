@@ -11,6 +11,11 @@ let eventInfo = document.getElementById('eventInfo');
 let promptInput = document.getElementById('promptInput');
 let startDateInput = document.getElementById('startDate');
 let endDateInput = document.getElementById('endDate');
+let cameraFilter = document.getElementById('cameraFilter');
+let classFilter = document.getElementById('classFilter');
+let liveIndicator = document.getElementById('liveIndicator');
+let toastContainer = document.getElementById('toastContainer');
+let liveSource = null;
 
 // 颜色组配置
 const colorGroups = [
@@ -39,6 +44,8 @@ window.onload = function () {
 
     promptInput.focus();
     queryData();
+    loadCameras();
+    connectLive();
 }
 
 // --- 核心查询逻辑 ---
@@ -62,49 +69,10 @@ function queryData() {
             }
 
             json.data.forEach(item => {
-                if (!item.Snapshots || item.Snapshots.length === 0) return;
-
-                let midIndex = Math.floor(item.Snapshots.length / 2);
-                let coverSnapshot = item.Snapshots[midIndex];
-
-                let imgDiv = document.createElement('div');
-                imgDiv.classList.add("image-wrapper");
-
-                let img = document.createElement('img');
-                img.src = baseImageUrl + coverSnapshot;
-                img.loading = "lazy";
-                
-                let color = getEventColor(item.ID);
-                img.style.boxShadow = `0 0 8px 1px ${color}`;
-
-                imgDiv.appendChild(img);
-
-                let iconsDiv = document.createElement('div');
-                iconsDiv.classList.add('icons');
-                
-                if (item.Objects && item.Objects.length > 0) {
-                    let uniqueClasses = [...new Set(item.Objects.map(o => o.Class))];
-                    uniqueClasses.forEach(cls => {
-                        let icon = document.createElement('i');
-                        icon.className = getObjectIcon(cls);
-                        icon.classList.add("objectIcon");
-                        iconsDiv.appendChild(icon);
-                    });
-                }
-                imgDiv.appendChild(iconsDiv);
-
-                let timeDiv = document.createElement('div');
-                timeDiv.classList.add('time-label');
-                timeDiv.innerText = formatDisplayTime(item.MotionStart);
-                imgDiv.appendChild(timeDiv);
-
-                img.addEventListener('click', function () {
-                    playVideo(item.VideoFile, baseImageUrl + coverSnapshot);
-                    showEventDetails(item);
-                });
-
-                imageGrid.appendChild(imgDiv);
+                let card = createCard(item);
+                if (card) imageGrid.appendChild(card);
             });
+            applyFilters();
         })
         .catch(err => {
             console.error(err);
@@ -112,6 +80,151 @@ function queryData() {
         });
 }
 
+// --- 事件卡片 ---
+function createCard(item) {
+    if (!item.Snapshots || item.Snapshots.length === 0) return null;
+
+    let imgDiv = document.createElement('div');
+    imgDiv.classList.add("image-wrapper");
+    imgDiv.dataset.id = item.ID;
+
+    let img = document.createElement('img');
+    img.loading = "lazy";
+    img.style.boxShadow = `0 0 8px 1px ${getEventColor(item.ID)}`;
+    imgDiv.appendChild(img);
+
+    let iconsDiv = document.createElement('div');
+    iconsDiv.classList.add('icons');
+    imgDiv.appendChild(iconsDiv);
+
+    let timeDiv = document.createElement('div');
+    timeDiv.classList.add('time-label');
+    timeDiv.innerText = formatDisplayTime(item.MotionStart);
+    imgDiv.appendChild(timeDiv);
+
+    updateCard(imgDiv, item);
+    return imgDiv;
+}
+
+// updateCard 用事件的最新数据刷新卡片：封面、物体图标和点击播放
+function updateCard(imgDiv, item) {
+    let midIndex = Math.floor(item.Snapshots.length / 2);
+    let coverSnapshot = item.Snapshots[midIndex];
+    let img = imgDiv.querySelector('img');
+    if (img.dataset.snapshot !== coverSnapshot) {
+        img.dataset.snapshot = coverSnapshot;
+        img.dataset.retried = "";
+        img.src = baseImageUrl + coverSnapshot;
+    }
+    // 实时事件到达时截图可能还没写完，重试一次
+    img.onerror = function () {
+        if (img.dataset.retried) return;
+        img.dataset.retried = "1";
+        setTimeout(() => { img.src = baseImageUrl + img.dataset.snapshot + '?retry=1'; }, 1000);
+    };
+
+    let iconsDiv = imgDiv.querySelector('.icons');
+    iconsDiv.innerHTML = '';
+    let uniqueClasses = [...new Set((item.Objects || []).map(o => o.Class))];
+    uniqueClasses.forEach(cls => {
+        let icon = document.createElement('i');
+        icon.className = getObjectIcon(cls);
+        icon.classList.add("objectIcon");
+        iconsDiv.appendChild(icon);
+    });
+
+    imgDiv.dataset.camera = item.CameraName || '';
+    imgDiv.dataset.classes = uniqueClasses.map(c => c.toLowerCase()).join(',');
+    rememberFilterOptions(item.CameraName, uniqueClasses);
+
+    img.onclick = function () {
+        playVideo(item.VideoFile, baseImageUrl + coverSnapshot);
+        showEventDetails(item);
+    };
+}
+
+// --- 实时事件 (SSE) ---
+function connectLive() {
+    if (liveSource) liveSource.close();
+    let params = new URLSearchParams();
+    if (cameraFilter.value) params.set('camera', cameraFilter.value);
+    if (classFilter.value) params.set('class', classFilter.value);
+
+    // EventSource 断线后会自动重连
+    liveSource = new EventSource('/api/events/stream?' + params.toString());
+    liveSource.onopen = () => liveIndicator.classList.add('live-on');
+    liveSource.onerror = () => liveIndicator.classList.remove('live-on');
+    ['motion_start', 'motion_update', 'motion_end'].forEach(type => {
+        liveSource.addEventListener(type, e => handleLiveEvent(JSON.parse(e.data)));
+    });
+}
+
+function handleLiveEvent(live) {
+    let item = live.event;
+    if (live.type === 'motion_start') showToast(item);
+
+    let existing = [...imageGrid.querySelectorAll('.image-wrapper')].find(card => card.dataset.id === item.ID);
+    if (existing) {
+        updateCard(existing, item);
+    } else if (showsNow() && promptInput.value.trim() === '') {
+        // 只有当前时间段包含现在、且没有关键词过滤时才插入新卡片
+        let card = createCard(item);
+        if (!card) return;
+        let placeholder = imageGrid.querySelector('p');
+        if (placeholder) placeholder.remove();
+        card.classList.add('card-new');
+        imageGrid.prepend(card);
+    }
+    applyFilters();
+}
+
+function showsNow() {
+    return new Date(endDateInput.value) >= new Date();
+}
+
+function showToast(item) {
+    let classes = [...new Set((item.Objects || []).map(o => o.Class))];
+    let toast = document.createElement('div');
+    toast.className = 'toast';
+    let icon = document.createElement('i');
+    icon.className = getObjectIcon(classes[0]);
+    toast.appendChild(icon);
+    toast.appendChild(document.createTextNode(` ${item.CameraName}: ${classes.join(', ') || 'motion'}`));
+    toast.onclick = () => toast.remove();
+    toastContainer.appendChild(toast);
+    setTimeout(() => toast.remove(), 6000);
+}
+
+// --- 摄像头 / 类别过滤 ---
+function loadCameras() {
+    fetch('/api/status')
+        .then(response => response.json())
+        .then(json => (json.data || []).forEach(c => addFilterOption(cameraFilter, c.camera)))
+        .catch(() => {});
+}
+
+function rememberFilterOptions(camera, classes) {
+    addFilterOption(cameraFilter, camera);
+    classes.forEach(c => addFilterOption(classFilter, (c || '').toLowerCase()));
+}
+
+function addFilterOption(select, value) {
+    if (!value || [...select.options].some(o => o.value === value)) return;
+    let option = document.createElement('option');
+    option.value = value;
+    option.innerText = value;
+    select.appendChild(option);
+}
+
+function applyFilters() {
+    let camera = cameraFilter.value;
+    let cls = classFilter.value;
+    imageGrid.querySelectorAll('.image-wrapper').forEach(card => {
+        let visible = (!camera || card.dataset.camera === camera) && (!cls || card.dataset.classes.split(',').includes(cls));
+        card.style.display = visible ? '' : 'none';
+    });
+}
+
 // --- 详情弹窗逻辑 (已优化) ---
 function showEventDetails(item) {
     eventInfo.innerHTML = '';
@@ -212,3 +325,4 @@ function addInfoLabel(name, val, cls) {
 span.onclick = closeModal;
 window.onclick = e => { if(e.target == modal) closeModal(); };
 promptInput.addEventListener('keydown', e => { if(e.key==="Enter") queryData(); });
+cameraFilter.onchange = classFilter.onchange = () => { applyFilters(); connectLive(); };
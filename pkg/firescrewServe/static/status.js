@@ -0,0 +1,154 @@
+// 状态页：每 5 秒轮询 /api/status
+let statusGrid = document.getElementById('statusGrid');
+let statusUpdated = document.getElementById('statusUpdated');
+
+window.onload = function () {
+    loadStatus();
+    setInterval(loadStatus, 5000);
+}
+
+function loadStatus() {
+    // 事件总线只在 daemon 模式下有内容
+    Promise.all([
+        fetch('/api/status').then(response => response.json()),
+        fetch('/api/events?limit=200').then(response => response.json()).catch(() => ({})),
+    ])
+        .then(([json, events]) => {
+            statusGrid.innerHTML = '';
+            statusUpdated.innerText = 'Updated ' + new Date().toLocaleTimeString();
+
+            if (!json.data || json.data.length === 0) {
+                statusGrid.innerHTML = '<p style="color:#aaa; text-align:center; grid-column:1/-1; padding: 50px;">No camera has written a status yet.</p>';
+                return;
+            }
+            json.data.forEach(camera => {
+                let recent = (events.data || []).filter(e => e.camera === camera.camera);
+                statusGrid.appendChild(cameraCard(camera, recent.slice(-5).reverse()));
+            });
+        })
+        .catch(err => {
+            statusUpdated.innerText = 'Cannot load status: ' + err;
+        });
+}
+
+function cameraCard(c, recent) {
+    let card = document.createElement('div');
+    card.className = 'status-card';
+
+    let state = 'running', cls = 'status-ok';
+    if (!c.running) { state = 'stopped'; cls = 'status-off'; }
+    else if (c.stale) { state = 'not responding'; cls = 'status-bad'; }
+
+    let title = document.createElement('h3');
+    title.innerText = c.camera;
+    let badge = document.createElement('span');
+    badge.className = 'status-badge ' + cls;
+    badge.innerText = state;
+    title.appendChild(badge);
+    card.appendChild(title);
+
+    addSection(card, 'Streams', [
+        streamRow('LO', c.lo),
+        streamRow('HI', c.hi),
+    ]);
+
+    let motion = c.motion ? `moving (${(c.motionRatio * 100).toFixed(1)}%)` : 'idle';
+    let event = c.activeEvent ? `${c.activeEvent} since ${formatTime(c.eventStart)}` : 'none';
+    addSection(card, 'Motion', [
+        ['Last frame', formatAge(c.lastFrame)],
+        ['Motion', motion],
+        ['Active event', event],
+    ]);
+
+    let d = c.detector || {};
+    addSection(card, 'Detector', [
+        ['Backend', `${d.backend || '-'} ${upLabel(d.up)}`],
+        ['Model', d.model || '-'],
+        ['Inference', d.inferences ? `avg ${d.avgMs.toFixed(1)}ms, min ${d.minMs.toFixed(1)}ms, max ${d.maxMs.toFixed(1)}ms` : 'no runs yet'],
+        ['Runs', `${d.inferences || 0}, last ${formatAge(d.lastRun)}`],
+        ['Restarts', d.restarts || 0],
+    ]);
+
+    let sinks = Object.entries(c.sinks || {}).sort().map(([name, s]) => {
+        let text = `${s.success} ok, ${s.failure} failed`;
+        if (s.lastError) text += ` (last: ${s.lastError}, ${formatAge(s.lastFail)})`;
+        return [name, text];
+    });
+    addSection(card, 'Event handlers', sinks.length ? sinks : [['-', 'nothing delivered yet']]);
+
+    let st = c.storage || {};
+    let used = st.totalBytes ? `${formatBytes(st.totalBytes - st.freeBytes)} of ${formatBytes(st.totalBytes)} used, ${formatBytes(st.freeBytes)} free` : '-';
+    addSection(card, 'Storage', [
+        ['Path', st.path || '-'],
+        ['Disk', used],
+        ['Clips', `${formatBytes(st.usedBytes || 0)} (measured ${formatAge(st.measured)})`],
+    ]);
+
+    if (recent.length) {
+        addSection(card, 'Recent events', recent.map(e => [e.type, formatAge(e.time)]));
+    }
+
+    let footer = document.createElement('div');
+    footer.className = 'time-label';
+    footer.innerText = `pid ${c.pid} · version ${c.version || 'dev'} · started ${formatTime(c.started)} · written ${formatAge(c.updated)}`;
+    card.appendChild(footer);
+    return card;
+}
+
+function streamRow(name, s) {
+    s = s || {};
+    let text = `${upLabel(s.up)} ${s.width}x${s.height} @ ${(s.fps || 0).toFixed(2)} fps`;
+    if (s.codec) text += ` ${s.codec}`;
+    if (s.restarts) text += `, ${s.restarts} restarts`;
+    return [name, text + '\n' + (s.url || '')];
+}
+
+function addSection(card, name, rows) {
+    let section = document.createElement('div');
+    section.className = 'status-section';
+    let head = document.createElement('div');
+    head.className = 'date-label';
+    head.innerText = name.toUpperCase();
+    section.appendChild(head);
+    rows.forEach(([key, value]) => {
+        let row = document.createElement('div');
+        row.className = 'status-row';
+        let k = document.createElement('span');
+        k.innerText = key;
+        let v = document.createElement('span');
+        v.innerText = value;
+        row.appendChild(k);
+        row.appendChild(v);
+        section.appendChild(row);
+    });
+    card.appendChild(section);
+}
+
+// --- 辅助函数 ---
+
+function upLabel(up) {
+    return up ? '▲ up' : '▼ down';
+}
+
+function isZeroTime(t) {
+    return !t || t.startsWith('0001-');
+}
+
+function formatTime(t) {
+    return isZeroTime(t) ? '-' : new Date(t).toLocaleString();
+}
+
+function formatAge(t) {
+    if (isZeroTime(t)) return 'never';
+    let seconds = Math.max(0, Math.round((Date.now() - new Date(t).getTime()) / 1000));
+    if (seconds < 60) return `${seconds}s ago`;
+    if (seconds < 3600) return `${Math.floor(seconds / 60)}m ago`;
+    return `${Math.floor(seconds / 3600)}h ago`;
+}
+
+function formatBytes(b) {
+    const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+    let i = 0;
+    while (b >= 1024 && i < units.length - 1) { b /= 1024; i++; }
+    return `${b.toFixed(i ? 1 : 0)} ${units[i]}`;
+}
@@ -0,0 +1,44 @@
+package firescrewServe
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/catsimple/firescrew/pkg/cameraStatus"
+)
+
+// Camera processes write their status every 5s, a snapshot that missed a few writes is stale
+const statusStaleAfter = 30 * time.Second
+
+// statusHandler returns the status of every camera that writes below the media path:
+//
+//	GET /api/status  streams, motion, active event, detector, event handlers and storage per camera
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	snapshots, err := cameraStatus.ReadAll(mediaPath, statusStaleAfter, time.Now())
+	if err != nil {
+		writeJSONResponse(w, http.StatusInternalServerError, nil, err)
+		return
+	}
+	if snapshots == nil {
+		snapshots = []cameraStatus.Snapshot{}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSONResponse(w, http.StatusOK, snapshots, nil)
+}
+
+// statusPage serves the status page, it polls /api/status
+func statusPage(w http.ResponseWriter, r *http.Request) {
+	f, err := staticFiles.Open("static/status.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.Copy(w, f)
+}
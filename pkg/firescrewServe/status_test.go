@@ -0,0 +1,52 @@
+package firescrewServe
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/catsimple/firescrew/pkg/cameraStatus"
+)
+
+func TestStatusHandler(t *testing.T) {
+	mediaPath = t.TempDir()
+	defer func() { mediaPath = "" }()
+
+	get := func() []cameraStatus.Snapshot {
+		t.Helper()
+		w := httptest.NewRecorder()
+		statusHandler(w, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+		var resp struct {
+			Data []cameraStatus.Snapshot `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("expected a list of snapshots, got %d %v", w.Code, err)
+		}
+		return resp.Data
+	}
+	if snapshots := get(); snapshots == nil || len(snapshots) != 0 {
+		t.Errorf("expected an empty list without status files, got %v", snapshots)
+	}
+
+	now := time.Now()
+	for _, s := range []cameraStatus.Snapshot{
+		{Camera: "front", Running: true, Updated: now},
+		{Camera: "back", Running: true, Updated: now.Add(-time.Minute)},
+	} {
+		if err := cameraStatus.Write(cameraStatus.Path(mediaPath, s.Camera), s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshots := get()
+	if len(snapshots) != 2 || snapshots[0].Camera != "back" || !snapshots[0].Stale || snapshots[1].Stale {
+		t.Errorf("expected back to be stale and front to be up, got %+v", snapshots)
+	}
+
+	w := httptest.NewRecorder()
+	statusHandler(w, httptest.NewRequest(http.MethodPost, "/api/status", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected only GET, got %d", w.Code)
+	}
+}
@@ -0,0 +1,171 @@
+// Package inferenceScheduler decides which frames of which camera are sent to the detector. Every camera asks
+// for a detection rate that depends on what is going on (fast while objects are tracked, slow while idle), the
+// scheduler measures how many inferences per second the detector can actually do and splits that budget across
+// cameras with max-min fairness: cameras asking for less than an even share get all of it, the rest is split
+// evenly between the others.
+package inferenceScheduler
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Scheduler is shared by every camera using the same detector, it is safe for concurrent use
+type Scheduler struct {
+	Workers int // Inferences that can run concurrently, e.g. the onnx session pool size
+
+	mu      sync.Mutex
+	latency time.Duration // Moving average of the inference latency
+	cameras map[*Camera]struct{}
+}
+
+// Camera is the schedule of a single camera
+type Camera struct {
+	Name string
+
+	scheduler *Scheduler
+	demand    float64 // Detection rate asked for on the last Due call
+	next      time.Time
+}
+
+func New(workers int) *Scheduler {
+	return &Scheduler{Workers: max(workers, 1), cameras: map[*Camera]struct{}{}}
+}
+
+// Camera registers a camera, Close removes it from the budget again
+func (s *Scheduler) Camera(name string) *Camera {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	camera := &Camera{Name: name, scheduler: s}
+	s.cameras[camera] = struct{}{}
+	return camera
+}
+
+// Observe feeds the latency of one inference into the capacity estimate
+func (s *Scheduler) Observe(took time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.latency == 0 {
+		s.latency = took
+		return
+	}
+	s.latency += (took - s.latency) / 10
+}
+
+// Capacity is the estimated number of inferences per second, +Inf until a latency was observed
+func (s *Scheduler) Capacity() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.capacity()
+}
+
+func (s *Scheduler) capacity() float64 {
+	if s.latency <= 0 {
+		return math.Inf(1)
+	}
+	return float64(s.Workers) / s.latency.Seconds()
+}
+
+// shares splits the capacity across the demands of all cameras with max-min fairness
+func (s *Scheduler) shares() map[*Camera]float64 {
+	cameras := make([]*Camera, 0, len(s.cameras))
+	for camera := range s.cameras {
+		if camera.demand > 0 {
+			cameras = append(cameras, camera)
+		}
+	}
+	sort.Slice(cameras, func(i, j int) bool { return cameras[i].demand < cameras[j].demand })
+
+	shares := make(map[*Camera]float64, len(cameras))
+	remaining := s.capacity()
+	for i, camera := range cameras {
+		share := min(camera.demand, remaining/float64(len(cameras)-i))
+		shares[camera] = share
+		remaining -= share
+	}
+	return shares
+}
+
+// Due reports whether the frame at now should be inferred, for a camera that wants fps detections per second.
+// Frames that are not due are skipped, never queued, so the detector always works on fresh frames.
+func (c *Camera) Due(now time.Time, fps float64) bool {
+	s := c.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c.demand = fps
+	rate := s.shares()[c]
+	if rate <= 0 || now.Before(c.next) {
+		return false
+	}
+
+	interval := time.Duration(float64(time.Second) / rate)
+	// Keep a steady pace, but don't catch up on frames missed while the camera was idle or starved
+	if c.next.IsZero() || now.Sub(c.next) > interval {
+		c.next = now
+	}
+	c.next = c.next.Add(interval)
+	return true
+}
+
+// Rate is the detection rate the camera currently gets
+func (c *Camera) Rate() float64 {
+	s := c.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shares()[c]
+}
+
+func (c *Camera) Close() {
+	s := c.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cameras, c)
+}
+
+// Latest is a mailbox that only keeps the newest value. A slow consumer gets the most recent frame
+// instead of a growing backlog, older values are dropped and counted. Put must be called from a single producer.
+type Latest[T any] struct {
+	ch      chan T
+	dropped atomic.Int64
+}
+
+func NewLatest[T any]() *Latest[T] {
+	return &Latest[T]{ch: make(chan T, 1)}
+}
+
+// Put stores v, replacing a value the consumer did not take yet
+func (l *Latest[T]) Put(v T) {
+	select {
+	case l.ch <- v:
+		return
+	default:
+	}
+
+	select {
+	case <-l.ch:
+		l.dropped.Add(1)
+	default: // Taken by the consumer in the meantime
+	}
+	l.ch <- v
+}
+
+// Close tells the consumer no more values follow, after it received the last one. Like Put it is only called by the producer.
+func (l *Latest[T]) Close() {
+	close(l.ch)
+}
+
+// C is the channel to receive from
+func (l *Latest[T]) C() <-chan T {
+	return l.ch
+}
+
+// Dropped is the number of values replaced before they were received
+func (l *Latest[T]) Dropped() int64 {
+	return l.dropped.Load()
+}
@@ -0,0 +1,115 @@
+package inferenceScheduler
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// count returns how many of the frames arriving at frameFps over d are due
+func count(c *Camera, start time.Time, frameFps, fps float64, d time.Duration) int {
+	due := 0
+	step := time.Duration(float64(time.Second) / frameFps)
+	for t := start; t.Before(start.Add(d)); t = t.Add(step) {
+		if c.Due(t, fps) {
+			due++
+		}
+	}
+	return due
+}
+
+func TestDueFollowsTargetRate(t *testing.T) {
+	s := New(1)
+	camera := s.Camera("front")
+	start := time.Unix(0, 0)
+
+	if due := count(camera, start, 25, 5, 10*time.Second); due < 49 || due > 51 {
+		t.Errorf("expected ~50 frames at 5 fps, got %d", due)
+	}
+	if due := count(camera, start.Add(10*time.Second), 25, 0.5, 10*time.Second); due < 4 || due > 6 {
+		t.Errorf("expected ~5 frames at 0.5 fps, got %d", due)
+	}
+	if due := count(camera, start.Add(20*time.Second), 25, 0, 10*time.Second); due != 0 {
+		t.Errorf("expected no frames at 0 fps, got %d", due)
+	}
+}
+
+func TestDueDoesNotCatchUp(t *testing.T) {
+	s := New(1)
+	camera := s.Camera("front")
+	start := time.Unix(0, 0)
+
+	camera.Due(start, 5)
+	// A long gap, e.g. the stream stalled, must not be followed by a burst
+	due := 0
+	for i := 0; i < 10; i++ {
+		if camera.Due(start.Add(time.Minute+time.Duration(i)*time.Millisecond), 5) {
+			due++
+		}
+	}
+	if due != 1 {
+		t.Errorf("expected a single due frame after a gap, got %d", due)
+	}
+}
+
+func TestFairShares(t *testing.T) {
+	s := New(2)
+	for i := 0; i < 10; i++ {
+		s.Observe(200 * time.Millisecond) // 2 workers at 200ms, 10 inferences per second
+	}
+	if capacity := s.Capacity(); math.Abs(capacity-10) > 0.01 {
+		t.Fatalf("expected capacity 10, got %f", capacity)
+	}
+
+	busy1, busy2, idle := s.Camera("busy1"), s.Camera("busy2"), s.Camera("idle")
+	now := time.Unix(0, 0)
+	busy1.Due(now, 10)
+	busy2.Due(now, 10)
+	idle.Due(now, 1)
+
+	// The idle camera gets all it asks for, the busy ones split the rest
+	if rate := idle.Rate(); math.Abs(rate-1) > 0.01 {
+		t.Errorf("expected idle camera to get 1 fps, got %f", rate)
+	}
+	if rate := busy1.Rate(); math.Abs(rate-4.5) > 0.01 {
+		t.Errorf("expected busy camera to get 4.5 fps, got %f", rate)
+	}
+
+	idle.Close()
+	if rate := busy2.Rate(); math.Abs(rate-5) > 0.01 {
+		t.Errorf("expected busy camera to get 5 fps after the idle one left, got %f", rate)
+	}
+}
+
+func TestLatestKeepsNewest(t *testing.T) {
+	l := NewLatest[int]()
+	for i := 1; i <= 5; i++ {
+		l.Put(i)
+	}
+	if v := <-l.C(); v != 5 {
+		t.Errorf("expected the newest value 5, got %d", v)
+	}
+	if dropped := l.Dropped(); dropped != 4 {
+		t.Errorf("expected 4 dropped values, got %d", dropped)
+	}
+
+	select {
+	case v := <-l.C():
+		t.Errorf("expected an empty mailbox, got %d", v)
+	default:
+	}
+}
+
+func TestLatestClose(t *testing.T) {
+	l := NewLatest[int]()
+	l.Put(1)
+	l.Close()
+
+	var received []int
+	for v := range l.C() {
+		received = append(received, v)
+	}
+	if len(received) != 1 || received[0] != 1 {
+		t.Errorf("expected the last value before the close, got %v", received)
+	}
+}
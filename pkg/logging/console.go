@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// consoleHandler writes the colored "15:04:05 [INFO] message key=value" lines firescrew always printed, the log file
+// gets them without colors. The component is left out, it is in the text and JSON formats.
+type consoleHandler struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	file   io.Writer // Optional
+	attrs  string    // Formatted attrs of WithAttrs
+	prefix string    // Group of WithGroup, with a trailing dot
+}
+
+func newConsoleHandler(out io.Writer, file io.Writer) *consoleHandler {
+	return &consoleHandler{mu: &sync.Mutex{}, out: out, file: file}
+}
+
+func levelStyle(level slog.Level) (string, string) {
+	switch {
+	case level >= slog.LevelError:
+		return "ERROR", "\x1b[31m"
+	case level >= slog.LevelWarn:
+		return "WARNING", "\x1b[33m"
+	case level >= LevelNotice:
+		return "NOTICE", "\x1b[35m"
+	case level >= LevelEvent:
+		return "EVENT", "\x1b[34m"
+	case level >= slog.LevelInfo:
+		return "INFO", "\x1b[32m"
+	default:
+		return "DEBUG", "\x1b[36m"
+	}
+}
+
+func (h *consoleHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return true
+}
+
+func (h *consoleHandler) Handle(ctx context.Context, record slog.Record) error {
+	label, color := levelStyle(record.Level)
+	var line bytes.Buffer
+	fmt.Fprintf(&line, "%s [%s] %s", record.Time.Format("15:04:05"), label, record.Message)
+	line.WriteString(h.attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		writeAttr(&line, h.prefix, attr)
+		return true
+	})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := fmt.Fprintf(h.out, "%s%s\x1b[0m\n", color, line.String())
+	if h.file != nil {
+		line.WriteByte('\n')
+		h.file.Write(line.Bytes()) // Stdout still works when the file does not
+	}
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	var line bytes.Buffer
+	for _, attr := range attrs {
+		writeAttr(&line, h.prefix, attr)
+	}
+	next.attrs += line.String()
+	return &next
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	next := *h
+	next.prefix += name + "."
+	return &next
+}
+
+func writeAttr(line *bytes.Buffer, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Key == "component" && prefix == "" {
+		return
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		for _, member := range attr.Value.Group() {
+			writeAttr(line, prefix+attr.Key+".", member)
+		}
+		return
+	}
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	fmt.Fprintf(line, " %s%s=%v", prefix, attr.Key, attr.Value)
+}
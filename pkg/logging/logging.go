@@ -0,0 +1,163 @@
+// Package logging is the log of firescrew, built on log/slog. Records go to stdout as colored console lines (the
+// default), logfmt text or JSON lines, and optionally also to a log file that is rotated by size. Every component
+// logs through its own logger with its own level, and records carry fields such as the camera name or event id.
+//
+// Loggers returned by For follow Setup, so package level loggers can be created before the config is read.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Levels between slog.LevelInfo and slog.LevelWarn for the notice and event records of the console
+const (
+	LevelEvent  = slog.Level(1)
+	LevelNotice = slog.Level(2)
+)
+
+// Config of the log, zero values use the defaults
+type Config struct {
+	Format     string            // console (default), text or json
+	Level      string            // debug, info (default), event, notice, warning or error
+	Levels     map[string]string // Level per component, overrides Level
+	File       string            // Also write the log to this file, empty for stdout only
+	MaxSizeMB  int               // The file is rotated at this size, defaults to 10
+	MaxBackups int               // Rotated files kept as File.1 to File.N, defaults to 3
+}
+
+type state struct {
+	handler slog.Handler
+	level   slog.Level
+	levels  map[string]slog.Level
+	closer  io.Closer
+}
+
+var current atomic.Pointer[state]
+
+func init() {
+	current.Store(&state{handler: newConsoleHandler(os.Stdout, nil), level: slog.LevelInfo})
+}
+
+// Setup applies cfg to every logger, it returns an error for an invalid config and keeps the previous one then
+func Setup(cfg Config) error {
+	level, err := ParseLevel(cfg.Level, slog.LevelInfo)
+	if err != nil {
+		return err
+	}
+	levels := map[string]slog.Level{}
+	for component, name := range cfg.Levels {
+		if levels[component], err = ParseLevel(name, level); err != nil {
+			return fmt.Errorf("level of %s: %w", component, err)
+		}
+	}
+
+	var out, file io.Writer = os.Stdout, nil
+	var closer io.Closer
+	if cfg.File != "" {
+		rotating, err := openRotatingFile(cfg.File, int64(max(cfg.MaxSizeMB, 0))<<20, cfg.MaxBackups)
+		if err != nil {
+			return err
+		}
+		file, closer = rotating, rotating
+	}
+
+	var handler slog.Handler
+	options := &slog.HandlerOptions{Level: slog.LevelDebug - 4} // Levels are checked by the component handler
+	switch cfg.Format {
+	case "", "console":
+		handler = newConsoleHandler(out, file)
+	case "text", "json":
+		if file != nil {
+			out = io.MultiWriter(out, file)
+		}
+		if cfg.Format == "text" {
+			handler = slog.NewTextHandler(out, options)
+		} else {
+			handler = slog.NewJSONHandler(out, options)
+		}
+	default:
+		if closer != nil {
+			closer.Close()
+		}
+		return fmt.Errorf("unknown log format %q, use console, text or json", cfg.Format)
+	}
+
+	next := &state{handler: handler, level: level, levels: levels, closer: closer}
+	if previous := current.Swap(next); previous.closer != nil {
+		previous.closer.Close()
+	}
+	return nil
+}
+
+// Close closes the log file, records after that only go to stdout
+func Close() {
+	if closer := current.Load().closer; closer != nil {
+		closer.Close()
+	}
+}
+
+// ParseLevel parses a level name, empty returns fallback
+func ParseLevel(name string, fallback slog.Level) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return fallback, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "event":
+		return LevelEvent, nil
+	case "notice":
+		return LevelNotice, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return fallback, fmt.Errorf("unknown log level %q", name)
+}
+
+// For returns the logger of component, records have a component field
+func For(component string) *slog.Logger {
+	return slog.New(&componentHandler{component: component})
+}
+
+// componentHandler forwards records to the handler of the current Setup, at the level of its component
+type componentHandler struct {
+	component string
+	wrap      []func(slog.Handler) slog.Handler // WithAttrs and WithGroup calls, applied in order
+}
+
+func (h *componentHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	s := current.Load()
+	if componentLevel, ok := s.levels[h.component]; ok {
+		return level >= componentLevel
+	}
+	return level >= s.level
+}
+
+func (h *componentHandler) Handle(ctx context.Context, record slog.Record) error {
+	handler := current.Load().handler.WithAttrs([]slog.Attr{slog.String("component", h.component)})
+	for _, wrap := range h.wrap {
+		handler = wrap(handler)
+	}
+	return handler.Handle(ctx, redactRecord(record))
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(redactAttrs(attrs)) })
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *componentHandler) with(wrap func(slog.Handler) slog.Handler) slog.Handler {
+	return &componentHandler{component: h.component, wrap: append(append([]func(slog.Handler) slog.Handler{}, h.wrap...), wrap)}
+}
@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Redacted replaces the secrets passed to Redact
+const Redacted = "xxxxx"
+
+// Secrets shorter than this are not redacted, replacing them would garble ordinary words
+const minSecretLength = 4
+
+var (
+	secretsMu sync.Mutex
+	secrets   = map[string]bool{}
+	replacer  atomic.Pointer[strings.Replacer]
+)
+
+// Redact adds values, such as the passwords and tokens of a config, that are replaced by Redacted in every record
+// from now on, in the message and in the fields. Empty and very short values are ignored.
+func Redact(values ...string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	added := false
+	for _, value := range values {
+		if len(value) >= minSecretLength && !secrets[value] {
+			secrets[value] = true
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	// Longer secrets first, so a secret that contains another one is replaced as a whole
+	sorted := make([]string, 0, len(secrets))
+	for secret := range secrets {
+		sorted = append(sorted, secret)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i]) != len(sorted[j]) {
+			return len(sorted[i]) > len(sorted[j])
+		}
+		return sorted[i] < sorted[j]
+	})
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, secret := range sorted {
+		pairs = append(pairs, secret, Redacted)
+	}
+	replacer.Store(strings.NewReplacer(pairs...))
+}
+
+// RedactString returns s with the secrets passed to Redact replaced, for text that leaves the process other than
+// through the log, like status files and events
+func RedactString(s string) string {
+	if r := replacer.Load(); r != nil {
+		return r.Replace(s)
+	}
+	return s
+}
+
+func redactRecord(record slog.Record) slog.Record {
+	if replacer.Load() == nil {
+		return record
+	}
+	redacted := slog.NewRecord(record.Time, record.Level, RedactString(record.Message), record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return redacted
+}
+
+func redactAttrs(attrs []slog.Attr) []slog.Attr {
+	if replacer.Load() == nil {
+		return attrs
+	}
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return redacted
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	value := a.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, RedactString(value.String()))
+	case slog.KindGroup:
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redactAttrs(value.Group())...)}
+	case slog.KindAny:
+		// Errors and other values are only turned into text when they contain a secret
+		text := fmt.Sprint(value.Any())
+		if redacted := RedactString(text); redacted != text {
+			return slog.String(a.Key, redacted)
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: value}
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package metrics
+
+import "errors"
+
+// DiskSpace is not supported on this platform
+func DiskSpace(path string) (free, total uint64, err error) {
+	return 0, 0, errors.New("disk space is not supported on this platform")
+}
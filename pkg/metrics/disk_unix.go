@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package metrics
+
+import "syscall"
+
+// DiskSpace returns the bytes available to unprivileged users and the size of the file system of path
+func DiskSpace(path string) (free, total uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), uint64(stat.Blocks) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,313 @@
+// Package metrics keeps counters, gauges and histograms and writes them in the Prometheus text exposition format,
+// so /metrics can be scraped without the Prometheus client library. Every metric is a family of series told apart by
+// label values; a series can also be a function that is read on every scrape.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	counter   = "counter"
+	gauge     = "gauge"
+	histogram = "histogram"
+)
+
+// DefaultBuckets suit latencies in seconds, from 5ms to 10s
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds metric families, it is safe for concurrent use
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	bits   atomic.Uint64 // Counter or gauge value
+
+	mu     sync.Mutex
+	fn     func() float64 // Read on scrape instead of bits
+	counts []uint64       // Histogram count per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// CounterVec is a counter family, its series only go up
+type CounterVec struct{ f *family }
+
+// GaugeVec is a gauge family
+type GaugeVec struct{ f *family }
+
+// HistogramVec is a histogram family
+type HistogramVec struct{ f *family }
+
+// Counter is one series of a CounterVec
+type Counter struct{ s *series }
+
+// Gauge is one series of a GaugeVec
+type Gauge struct{ s *series }
+
+// Histogram is one series of a HistogramVec
+type Histogram struct {
+	s       *series
+	buckets []float64
+}
+
+// Counter registers a counter family with the label names, a name that is already registered returns that family
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.family(name, help, counter, labels, nil)}
+}
+
+// Gauge registers a gauge family with the label names
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{r.family(name, help, gauge, labels, nil)}
+}
+
+// Histogram registers a histogram family with the bucket upper bounds, nil uses DefaultBuckets
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = slices.Clone(buckets)
+	sort.Float64s(buckets)
+	return &HistogramVec{r.family(name, help, histogram, labels, buckets)}
+}
+
+func (r *Registry) family(name, help, kind string, labels []string, buckets []float64) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, f := range r.families {
+		if f.name == name {
+			if f.kind != kind || !slices.Equal(f.labels, labels) {
+				panic(fmt.Sprintf("metrics: %s registered twice with different kinds or labels", name))
+			}
+			return f
+		}
+	}
+	f := &family{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: map[string]*series{}}
+	r.families = append(r.families, f)
+	return f
+}
+
+// get returns the series with the label values, creating it
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: slices.Clone(values)}
+		if f.kind == histogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (s *series) setFunc(fn func() float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fn = fn
+}
+
+// With returns the series with the label values
+func (v *CounterVec) With(values ...string) *Counter {
+	return &Counter{v.f.get(values)}
+}
+
+// Func makes the series with the label values read fn on every scrape, fn must never go down
+func (v *CounterVec) Func(fn func() float64, values ...string) {
+	v.f.get(values).setFunc(fn)
+}
+
+// With returns the series with the label values
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return &Gauge{v.f.get(values)}
+}
+
+// Func makes the series with the label values read fn on every scrape
+func (v *GaugeVec) Func(fn func() float64, values ...string) {
+	v.f.get(values).setFunc(fn)
+}
+
+// With returns the series with the label values
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return &Histogram{v.f.get(values), v.f.buckets}
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds delta, negative values are ignored
+func (c *Counter) Add(delta float64) {
+	if delta > 0 {
+		add(&c.s.bits, delta)
+	}
+}
+
+func (g *Gauge) Set(value float64) {
+	g.s.bits.Store(math.Float64bits(value))
+}
+
+func (g *Gauge) Add(delta float64) {
+	add(&g.s.bits, delta)
+}
+
+func add(bits *atomic.Uint64, delta float64) {
+	for {
+		old := bits.Load()
+		if bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Observe adds a value to the histogram
+func (h *Histogram) Observe(value float64) {
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		h.s.counts[i]++
+	}
+	h.s.sum += value
+	h.s.count++
+}
+
+// WriteText writes every family in the Prometheus text exposition format, series sorted by their label values
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+
+	out := bufio.NewWriter(w)
+	for _, f := range families {
+		f.mu.Lock()
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		all := make([]*series, len(keys))
+		for i, key := range keys {
+			all[i] = f.series[key]
+		}
+		f.mu.Unlock()
+
+		fmt.Fprintf(out, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(out, "# TYPE %s %s\n", f.name, f.kind)
+		for _, s := range all {
+			if f.kind == histogram {
+				f.writeHistogram(out, s)
+				continue
+			}
+			s.mu.Lock()
+			fn := s.fn
+			s.mu.Unlock()
+			value := math.Float64frombits(s.bits.Load())
+			if fn != nil {
+				value = fn()
+			}
+			fmt.Fprintf(out, "%s%s %s\n", f.name, labelString(f.labels, s.values, "", ""), formatFloat(value))
+		}
+	}
+	return out.Flush()
+}
+
+func (f *family) writeHistogram(out io.Writer, s *series) {
+	s.mu.Lock()
+	counts, sum, count := slices.Clone(s.counts), s.sum, s.count
+	s.mu.Unlock()
+
+	cumulative := uint64(0)
+	for i, bound := range f.buckets {
+		cumulative += counts[i]
+		fmt.Fprintf(out, "%s_bucket%s %d\n", f.name, labelString(f.labels, s.values, "le", formatFloat(bound)), cumulative)
+	}
+	fmt.Fprintf(out, "%s_bucket%s %d\n", f.name, labelString(f.labels, s.values, "le", "+Inf"), count)
+	fmt.Fprintf(out, "%s_sum%s %s\n", f.name, labelString(f.labels, s.values, "", ""), formatFloat(sum))
+	fmt.Fprintf(out, "%s_count%s %d\n", f.name, labelString(f.labels, s.values, "", ""), count)
+}
+
+// Handler serves the registry to Prometheus
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// labelString formats {name="value",...}, with an extra label when extraName is set
+func labelString(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", name, escapeValue(values[i]))
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extraName, extraValue)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeValue(s string) string { return valueEscaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTextFormat(t *testing.T) {
+	r := NewRegistry()
+	frames := r.Counter("frames_total", "Frames received", "camera")
+	frames.With("front").Add(3)
+	frames.With("back").Inc()
+	frames.With("back").Add(-5) // Ignored, counters only go up
+	r.Gauge("disk_free_bytes", "Free bytes\nof the disk", "path").Func(func() float64 { return 1024 }, `C:\clips "hi"`)
+	latency := r.Histogram("latency_seconds", "Inference latency", []float64{0.1, 0.5}, "backend")
+	latency.With("onnx").Observe(0.05)
+	latency.With("onnx").Observe(0.1)
+	latency.With("onnx").Observe(2)
+
+	var out strings.Builder
+	if err := r.WriteText(&out); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	want := `# HELP frames_total Frames received
+# TYPE frames_total counter
+frames_total{camera="back"} 1
+frames_total{camera="front"} 3
+# HELP disk_free_bytes Free bytes\nof the disk
+# TYPE disk_free_bytes gauge
+disk_free_bytes{path="C:\\clips \"hi\""} 1024
+# HELP latency_seconds Inference latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{backend="onnx",le="0.1"} 2
+latency_seconds_bucket{backend="onnx",le="0.5"} 2
+latency_seconds_bucket{backend="onnx",le="+Inf"} 3
+latency_seconds_sum{backend="onnx"} 2.15
+latency_seconds_count{backend="onnx"} 3
+`
+	if out.String() != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRegisterTwiceReturnsFamily(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("events_total", "Events", "class").With("car").Inc()
+	r.Counter("events_total", "Events", "class").With("car").Inc()
+
+	var out strings.Builder
+	r.WriteText(&out)
+	if !strings.Contains(out.String(), `events_total{class="car"} 2`) {
+		t.Errorf("expected both registrations to share the series, got:\n%s", out.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a different kind under the same name to panic")
+		}
+	}()
+	r.Gauge("events_total", "Events", "class")
+}
+
+func TestConcurrentUpdatesAndHandler(t *testing.T) {
+	r := NewRegistry()
+	counter := r.Counter("ops_total", "Operations")
+	gauge := r.Gauge("level", "Level")
+	histogram := r.Histogram("took_seconds", "Took", nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				counter.With().Inc()
+				gauge.With().Add(1)
+				histogram.With().Observe(0.01)
+			}
+		}()
+	}
+	wg.Wait()
+
+	recorder := httptest.NewRecorder()
+	r.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", recorder.Header().Get("Content-Type"))
+	}
+	for _, line := range []string{"ops_total 8000", "level 8000", "took_seconds_count 8000"} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected %q in:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+// Package motionDetect finds moving areas of a video frame. Frames are converted to gray, downscaled and blurred,
+// then compared to a per pixel running average background with a variance estimate (a single gaussian per pixel,
+// the simplest form of MOG). Pixels that keep flickering, like leaves or rain, build up variance and stop
+// triggering. Changed pixels are grouped into blobs so tiny specks can be dropped and the remaining blobs can be
+// used to crop inference.
+package motionDetect
+
+import (
+	"image"
+	"sort"
+)
+
+// Config tunes the detector, zero values use the defaults
+type Config struct {
+	Downscale       int               // Frame pixels per side of a background cell, defaults to 4
+	BlurRadius      int               // Box blur radius in cells, defaults to 1, -1 disables the blur
+	Threshold       float32           // Minimum gray level difference to the background, defaults to 25
+	VarianceFactor  float32           // Difference must also exceed this many standard deviations of the cell, defaults to 2.5, -1 disables
+	LearningRate    float32           // Background adaptation per frame, defaults to 0.02. Changed cells adapt 10x slower
+	MinBlobArea     int               // Blobs smaller than this many frame pixels are dropped
+	MaxChangedRatio float64           // A change of more than this fraction of the unmasked frame (IR switchover, exposure jump) resets the background instead of reporting motion, defaults to 0.6, 1 disables
+	Masks           []image.Rectangle // Areas in frame pixels that never report motion
+}
+
+// Result is the motion found in a frame, all boxes are in frame pixels
+type Result struct {
+	ChangedPixels int               // Frame pixels covered by the kept blobs
+	Blobs         []image.Rectangle // Boxes of the blobs of at least MinBlobArea, largest first
+	Box           image.Rectangle   // Union of Blobs
+	Reset         bool              // The background was (re)initialized by this frame, no motion is reported
+}
+
+// Detector keeps the background model of one camera. It is not safe for concurrent use.
+type Detector struct {
+	Config Config
+
+	bounds         image.Rectangle // Bounds of the frames the model was built for
+	w, h           int             // Cells
+	mean, variance []float32
+	masked         []bool
+	gray, scratch  []float32
+	foreground     []bool
+	stack          []int
+}
+
+func New(cfg Config) *Detector {
+	if cfg.Downscale <= 0 {
+		cfg.Downscale = 4
+	}
+	if cfg.BlurRadius == 0 {
+		cfg.BlurRadius = 1
+	}
+	if cfg.Threshold == 0 {
+		cfg.Threshold = 25
+	}
+	if cfg.VarianceFactor == 0 {
+		cfg.VarianceFactor = 2.5
+	}
+	if cfg.LearningRate == 0 {
+		cfg.LearningRate = 0.02
+	}
+	if cfg.MaxChangedRatio == 0 {
+		cfg.MaxChangedRatio = 0.6
+	}
+	return &Detector{Config: cfg}
+}
+
+// Reset drops the background, the next frame starts a new one
+func (d *Detector) Reset() {
+	d.bounds = image.Rectangle{}
+}
+
+// Detect compares frame to the background, updates the background and returns the moving blobs
+func (d *Detector) Detect(frame *image.RGBA) Result {
+	if frame.Bounds() != d.bounds {
+		d.init(frame.Bounds())
+		d.sample(frame)
+		copy(d.mean, d.gray)
+		d.resetVariance()
+		return Result{Reset: true}
+	}
+
+	d.sample(frame)
+
+	cfg := d.Config
+	varianceFactor2 := cfg.VarianceFactor * cfg.VarianceFactor
+	changed, unmasked := 0, 0
+	for i, g := range d.gray {
+		d.foreground[i] = false
+		if d.masked[i] {
+			continue
+		}
+		unmasked++
+
+		diff := g - d.mean[i]
+		diff2 := diff * diff
+		if diff2 > cfg.Threshold*cfg.Threshold && (cfg.VarianceFactor < 0 || diff2 > varianceFactor2*d.variance[i]) {
+			d.foreground[i] = true
+			changed++
+		}
+
+		// Changed cells adapt slowly, so objects that stopped fade into the background and cells that keep
+		// flickering build up enough variance to stop triggering
+		rate := cfg.LearningRate
+		if d.foreground[i] {
+			rate /= 10
+		}
+		d.mean[i] += rate * diff
+		d.variance[i] += rate * (diff2 - d.variance[i])
+	}
+
+	if unmasked > 0 && float64(changed)/float64(unmasked) > cfg.MaxChangedRatio {
+		copy(d.mean, d.gray)
+		d.resetVariance()
+		return Result{Reset: true}
+	}
+
+	return d.blobs()
+}
+
+func (d *Detector) init(bounds image.Rectangle) {
+	ds := d.Config.Downscale
+	d.bounds = bounds
+	d.w = (bounds.Dx() + ds - 1) / ds
+	d.h = (bounds.Dy() + ds - 1) / ds
+	n := d.w * d.h
+	d.mean = make([]float32, n)
+	d.variance = make([]float32, n)
+	d.gray = make([]float32, n)
+	d.scratch = make([]float32, n)
+	d.foreground = make([]bool, n)
+	d.masked = make([]bool, n)
+	d.SetMasks(d.Config.Masks)
+}
+
+// SetMasks replaces the masked areas, a cell is masked when its center is inside a mask
+func (d *Detector) SetMasks(masks []image.Rectangle) {
+	d.Config.Masks = masks
+	if d.masked == nil {
+		return
+	}
+
+	ds := d.Config.Downscale
+	for y := 0; y < d.h; y++ {
+		for x := 0; x < d.w; x++ {
+			center := image.Pt(x*ds+ds/2, y*ds+ds/2).Add(d.bounds.Min)
+			masked := false
+			for _, mask := range masks {
+				if center.In(mask) {
+					masked = true
+					break
+				}
+			}
+			d.masked[y*d.w+x] = masked
+		}
+	}
+}
+
+func (d *Detector) resetVariance() {
+	// Start every cell where the variance test matches the threshold, so the first frames are judged by the threshold alone
+	initial := d.Config.Threshold * d.Config.Threshold
+	if d.Config.VarianceFactor > 0 {
+		initial /= d.Config.VarianceFactor * d.Config.VarianceFactor
+	}
+	for i := range d.variance {
+		d.variance[i] = initial
+	}
+}
+
+// sample fills gray with the mean luma of every cell, then blurs it
+func (d *Detector) sample(frame *image.RGBA) {
+	ds := d.Config.Downscale
+	width, height := frame.Bounds().Dx(), frame.Bounds().Dy()
+
+	for i := range d.gray {
+		d.gray[i] = 0
+	}
+	counts := d.scratch
+	for i := range counts {
+		counts[i] = 0
+	}
+	for y := 0; y < height; y++ {
+		row := frame.Pix[y*frame.Stride:]
+		cellRow := (y / ds) * d.w
+		for x := 0; x < width; x++ {
+			p := row[x*4 : x*4+3]
+			d.gray[cellRow+x/ds] += float32(299*int(p[0])+587*int(p[1])+114*int(p[2])) / 1000
+			counts[cellRow+x/ds]++
+		}
+	}
+	for i := range d.gray {
+		d.gray[i] /= counts[i]
+	}
+
+	if d.Config.BlurRadius > 0 {
+		boxBlur(d.gray, d.scratch, d.w, d.h, d.Config.BlurRadius)
+	}
+}
+
+// boxBlur blurs values of a w x h grid in place, horizontally into tmp then vertically back
+func boxBlur(values, tmp []float32, w, h, radius int) {
+	for y := 0; y < h; y++ {
+		row := values[y*w : (y+1)*w]
+		for x := 0; x < w; x++ {
+			var sum float32
+			n := 0
+			for k := max(0, x-radius); k <= min(w-1, x+radius); k++ {
+				sum += row[k]
+				n++
+			}
+			tmp[y*w+x] = sum / float32(n)
+		}
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum float32
+			n := 0
+			for k := max(0, y-radius); k <= min(h-1, y+radius); k++ {
+				sum += tmp[k*w+x]
+				n++
+			}
+			values[y*w+x] = sum / float32(n)
+		}
+	}
+}
+
+// blobs groups the foreground cells into 8-connected blobs
+func (d *Detector) blobs() Result {
+	ds := d.Config.Downscale
+	type blob struct {
+		cells int
+		rect  image.Rectangle
+	}
+	var found []blob
+
+	visited := d.foreground // Cleared while flooding, foreground is rebuilt on the next frame
+	for start := range visited {
+		if !visited[start] {
+			continue
+		}
+		visited[start] = false
+
+		b := blob{rect: image.Rect(start%d.w, start/d.w, start%d.w+1, start/d.w+1)}
+		d.stack = append(d.stack[:0], start)
+		for len(d.stack) > 0 {
+			i := d.stack[len(d.stack)-1]
+			d.stack = d.stack[:len(d.stack)-1]
+			x, y := i%d.w, i/d.w
+			b.cells++
+			b.rect = b.rect.Union(image.Rect(x, y, x+1, y+1))
+
+			for ny := max(0, y-1); ny <= min(d.h-1, y+1); ny++ {
+				for nx := max(0, x-1); nx <= min(d.w-1, x+1); nx++ {
+					if j := ny*d.w + nx; visited[j] {
+						visited[j] = false
+						d.stack = append(d.stack, j)
+					}
+				}
+			}
+		}
+
+		if b.cells*ds*ds >= d.Config.MinBlobArea {
+			found = append(found, b)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].cells > found[j].cells })
+
+	var result Result
+	for _, b := range found {
+		rect := image.Rect(b.rect.Min.X*ds, b.rect.Min.Y*ds, b.rect.Max.X*ds, b.rect.Max.Y*ds).Add(d.bounds.Min).Intersect(d.bounds)
+		result.Blobs = append(result.Blobs, rect)
+		result.Box = result.Box.Union(rect)
+		result.ChangedPixels += b.cells * ds * ds
+	}
+	return result
+}
+
+// MergeOverlapping merges rectangles that overlap until none do, e.g. blobs after they were grown to the model size
+func MergeOverlapping(rects []image.Rectangle) []image.Rectangle {
+	merged := append([]image.Rectangle(nil), rects...)
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < len(merged) && !changed; i++ {
+			for j := i + 1; j < len(merged); j++ {
+				if merged[i].Overlaps(merged[j]) {
+					merged[i] = merged[i].Union(merged[j])
+					merged = append(merged[:j], merged[j+1:]...)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,113 @@
+package motionDetect
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func newFrame(w, h int, gray uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{gray, gray, gray, 255}}, image.Point{}, draw.Src)
+	return img
+}
+
+func fillRect(img *image.RGBA, r image.Rectangle, gray uint8) {
+	draw.Draw(img, r, &image.Uniform{color.RGBA{gray, gray, gray, 255}}, image.Point{}, draw.Src)
+}
+
+func TestDetectBlobs(t *testing.T) {
+	d := New(Config{MinBlobArea: 100})
+
+	if result := d.Detect(newFrame(160, 120, 50)); !result.Reset {
+		t.Fatalf("expected the first frame to initialize the background")
+	}
+	if result := d.Detect(newFrame(160, 120, 50)); len(result.Blobs) != 0 {
+		t.Fatalf("expected no motion on a static frame, got %v", result.Blobs)
+	}
+
+	frame := newFrame(160, 120, 50)
+	fillRect(frame, image.Rect(20, 20, 60, 60), 200)     // Large object
+	fillRect(frame, image.Rect(120, 100, 124, 104), 200) // Speck below MinBlobArea
+	result := d.Detect(frame)
+
+	if len(result.Blobs) != 1 {
+		t.Fatalf("expected 1 blob, got %v", result.Blobs)
+	}
+	blob := result.Blobs[0]
+	if !image.Rect(24, 24, 56, 56).In(blob) || !blob.In(image.Rect(12, 12, 68, 68)) {
+		t.Errorf("blob %v does not cover the object", blob)
+	}
+	if result.Box != blob || result.ChangedPixels < 30*30 {
+		t.Errorf("unexpected box %v or changed pixels %d", result.Box, result.ChangedPixels)
+	}
+}
+
+func TestDetectMasks(t *testing.T) {
+	d := New(Config{Masks: []image.Rectangle{image.Rect(0, 0, 80, 120)}})
+	d.Detect(newFrame(160, 120, 50))
+
+	frame := newFrame(160, 120, 50)
+	fillRect(frame, image.Rect(20, 20, 60, 60), 200)
+	if result := d.Detect(frame); len(result.Blobs) != 0 {
+		t.Errorf("expected motion inside the mask to be ignored, got %v", result.Blobs)
+	}
+
+	fillRect(frame, image.Rect(100, 20, 140, 60), 200)
+	if result := d.Detect(frame); len(result.Blobs) != 1 || result.Blobs[0].Min.X < 80 {
+		t.Errorf("expected only the unmasked blob, got %v", result.Blobs)
+	}
+}
+
+func TestDetectGlobalChangeResets(t *testing.T) {
+	d := New(Config{})
+	d.Detect(newFrame(64, 64, 30))
+
+	// IR switchover, every pixel changes at once
+	if result := d.Detect(newFrame(64, 64, 180)); !result.Reset || len(result.Blobs) != 0 {
+		t.Fatalf("expected a background reset without motion, got %+v", result)
+	}
+	if result := d.Detect(newFrame(64, 64, 180)); result.Reset || len(result.Blobs) != 0 {
+		t.Errorf("expected the new background to be used, got %+v", result)
+	}
+}
+
+func TestDetectFlickerBuildsVariance(t *testing.T) {
+	d := New(Config{})
+	d.Detect(newFrame(64, 64, 100))
+
+	// A patch alternating around the background, like leaves in the wind
+	flicker := func(i int) *image.RGBA {
+		frame := newFrame(64, 64, 100)
+		gray := uint8(70)
+		if i%2 == 0 {
+			gray = 130
+		}
+		fillRect(frame, image.Rect(16, 16, 48, 48), gray)
+		return frame
+	}
+
+	first := d.Detect(flicker(0))
+	if len(first.Blobs) == 0 {
+		t.Fatalf("expected the first flicker to be detected")
+	}
+	for i := 1; i < 300; i++ {
+		d.Detect(flicker(i))
+	}
+	if result := d.Detect(flicker(300)); len(result.Blobs) != 0 {
+		t.Errorf("expected constant flicker to stop triggering, got %v", result.Blobs)
+	}
+}
+
+func TestMergeOverlapping(t *testing.T) {
+	merged := MergeOverlapping([]image.Rectangle{
+		image.Rect(0, 0, 10, 10),
+		image.Rect(50, 50, 60, 60),
+		image.Rect(5, 5, 20, 20),
+		image.Rect(18, 18, 30, 30),
+	})
+	if len(merged) != 2 || merged[0] != image.Rect(0, 0, 30, 30) || merged[1] != image.Rect(50, 50, 60, 60) {
+		t.Errorf("unexpected merge %v", merged)
+	}
+}
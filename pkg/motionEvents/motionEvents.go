@@ -0,0 +1,299 @@
+// Package motionEvents owns the motion events of one camera. A single goroutine holds the open event and its
+// lifecycle: detections, object updates and the close/split timer reach it as messages and it alone talks to the
+// recorder, so the event state needs no locks and events can't overlap. Callers get copies of the event.
+package motionEvents
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/catsimple/firescrew/pkg/eventLifecycle"
+)
+
+// Recorder is the clip recorder, its methods must not block
+type Recorder interface {
+	Record(videoFile string, until time.Time) // Start or extend a clip, a different file continues the recording in it
+	Stop()
+}
+
+// Event is a copy of one clip of an event
+type Event[O any] struct {
+	ID            string
+	CameraName    string
+	Start         time.Time
+	End           time.Time
+	LastTriggered time.Time
+	Objects       []O
+	Attributes    []string
+	Snapshots     []string
+	VideoFile     string
+	ContinuedFrom string // Previous clip of the same event when it was split
+	Notified      bool   // A motion notification was sent for this event
+}
+
+// Config wires the manager to the rest of the app, only TrackID and Class are required
+type Config[O any] struct {
+	CameraName   string
+	Lifecycle    eventLifecycle.Config
+	Recorder     Recorder
+	TrackID      func(O) string
+	Class        func(O) string
+	Attributes   func([]O) []string                      // Event wide attributes of the objects
+	Notify       func(attributes []string) bool          // Whether an event with these attributes is notified, nil never notifies
+	NewID        func(now time.Time) string              // Defaults to the time and a counter
+	VideoFile    func(id string, start time.Time) string // Defaults to clip_<id>.ts
+	SnapshotFile func(id string, now time.Time) string   // File name for the snapshot of a new object, nil takes none
+
+	// Hooks run on the owner goroutine in event order. They must not call the manager and should return quickly.
+	Started func(Event[O])
+	Updated func(Event[O])
+	Ended   func(Event[O])
+}
+
+// Trigger is the outcome of a new object
+type Trigger[O any] struct {
+	Event    Event[O] // The event after the object was added
+	Started  bool     // The object started the event
+	Notify   bool     // The caller should send the motion notification, it is only reported once per event
+	Snapshot string   // Where the caller should store the snapshot of the object, empty for none
+}
+
+// Manager is safe for concurrent use
+type Manager[O any] struct {
+	config    Config[O]
+	lifecycle *eventLifecycle.Lifecycle
+	ops       chan func()
+	done      chan struct{}
+	closeOnce sync.Once
+	active    atomic.Bool
+
+	// Owned by the run goroutine
+	event  *Event[O]
+	timer  *time.Timer
+	timerC <-chan time.Time
+	ids    int
+}
+
+func New[O any](cfg Config[O]) *Manager[O] {
+	m := &Manager[O]{
+		config:    cfg,
+		lifecycle: eventLifecycle.New(cfg.Lifecycle),
+		ops:       make(chan func()),
+		done:      make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+func (m *Manager[O]) run() {
+	for {
+		select {
+		case op := <-m.ops:
+			op()
+		case now := <-m.timerC:
+			m.check(now)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// do runs op on the owner goroutine and waits for it, false once the manager is closed
+func (m *Manager[O]) do(op func()) bool {
+	finished := make(chan struct{})
+	select {
+	case m.ops <- func() { op(); close(finished) }:
+		<-finished
+		return true
+	case <-m.done:
+		return false
+	}
+}
+
+// Active reports whether an event is open, without waiting for the owner goroutine
+func (m *Manager[O]) Active() bool {
+	return m.active.Load()
+}
+
+// Admit reports whether the detection of a track counts towards an event, see eventLifecycle.Lifecycle.Admit
+func (m *Manager[O]) Admit(object O, now time.Time) bool {
+	admitted := false
+	m.do(func() {
+		admitted = m.lifecycle.Admit(m.config.TrackID(object), m.config.Class(object), now)
+	})
+	return admitted
+}
+
+// Trigger adds an admitted object at now, starting an event if none is open
+func (m *Manager[O]) Trigger(object O, now time.Time) Trigger[O] {
+	var result Trigger[O]
+	m.do(func() {
+		result.Started = m.lifecycle.Trigger(m.config.Class(object), now)
+		if result.Started {
+			m.start(now)
+		}
+		m.event.LastTriggered = now
+		m.event.Objects = append(m.event.Objects, object)
+		m.updateAttributes()
+		if m.config.SnapshotFile != nil {
+			result.Snapshot = m.config.SnapshotFile(m.event.ID, now)
+			m.event.Snapshots = append(m.event.Snapshots, result.Snapshot)
+		}
+		result.Notify = m.notify()
+
+		if m.config.Recorder != nil {
+			m.config.Recorder.Record(m.event.VideoFile, m.lifecycle.RecordUntil())
+		}
+		result.Event = m.snapshot()
+		if result.Started {
+			m.hook(m.config.Started)
+		} else {
+			m.hook(m.config.Updated)
+		}
+		m.schedule()
+	})
+	return result
+}
+
+// UpdateObject applies update to the objects of the open event with the track id. It returns the event id, empty
+// when no event is open, and whether the caller should send the motion notification the update made due.
+func (m *Manager[O]) UpdateObject(trackID string, update func(object *O)) (string, bool) {
+	id, notify := "", false
+	m.do(func() {
+		if m.event == nil {
+			return
+		}
+		for i := range m.event.Objects {
+			if m.config.TrackID(m.event.Objects[i]) == trackID {
+				update(&m.event.Objects[i])
+			}
+		}
+		m.updateAttributes()
+		id, notify = m.event.ID, m.notify()
+	})
+	return id, notify
+}
+
+// Current returns a copy of the open event
+func (m *Manager[O]) Current() (Event[O], bool) {
+	var event Event[O]
+	ok := false
+	m.do(func() {
+		if m.event != nil {
+			event, ok = m.snapshot(), true
+		}
+	})
+	return event, ok
+}
+
+// Close ends the open event at now and stops the manager, later calls do nothing
+func (m *Manager[O]) Close(now time.Time) {
+	m.closeOnce.Do(func() {
+		m.do(func() {
+			if m.event != nil {
+				m.end(now, true)
+			}
+			if m.timer != nil {
+				m.timer.Stop()
+			}
+		})
+		close(m.done)
+	})
+}
+
+// check applies what the lifecycle says is due at now
+func (m *Manager[O]) check(now time.Time) {
+	switch m.lifecycle.Check(now) {
+	case eventLifecycle.Close:
+		m.end(now, true)
+	case eventLifecycle.Split:
+		previous := m.event
+		m.start(now)
+		next := m.event
+		// The recorder switches to the next clip before the previous one is reported as ended
+		if m.config.Recorder != nil {
+			m.config.Recorder.Record(next.VideoFile, m.lifecycle.RecordUntil())
+		}
+		m.event = previous
+		m.end(now, false)
+
+		next.ContinuedFrom = previous.ID
+		next.Objects = slices.Clone(previous.Objects)
+		next.Attributes = slices.Clone(previous.Attributes)
+		next.Notified = previous.Notified
+		next.LastTriggered = previous.LastTriggered
+		m.event = next
+		m.active.Store(true)
+		m.hook(m.config.Started)
+	}
+	m.schedule()
+}
+
+func (m *Manager[O]) start(now time.Time) {
+	m.ids++
+	id := fmt.Sprintf("%s_%d", now.Format("20060102_150405"), m.ids)
+	if m.config.NewID != nil {
+		id = m.config.NewID(now)
+	}
+	videoFile := fmt.Sprintf("clip_%s.ts", id)
+	if m.config.VideoFile != nil {
+		videoFile = m.config.VideoFile(id, now)
+	}
+	m.event = &Event[O]{ID: id, CameraName: m.config.CameraName, Start: now, VideoFile: videoFile}
+	m.active.Store(true)
+}
+
+func (m *Manager[O]) end(now time.Time, stopRecording bool) {
+	if stopRecording && m.config.Recorder != nil {
+		m.config.Recorder.Stop()
+	}
+	m.event.End = now
+	m.hook(m.config.Ended)
+	m.event = nil
+	m.active.Store(false)
+}
+
+// schedule arms the timer for the next close or split
+func (m *Manager[O]) schedule() {
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	m.timer, m.timerC = nil, nil
+	if deadline := m.lifecycle.Deadline(); !deadline.IsZero() {
+		m.timer = time.NewTimer(time.Until(deadline))
+		m.timerC = m.timer.C
+	}
+}
+
+func (m *Manager[O]) updateAttributes() {
+	if m.config.Attributes != nil {
+		m.event.Attributes = m.config.Attributes(m.event.Objects)
+	}
+}
+
+// notify marks the event notified when its attributes allow a notification that was not sent yet
+func (m *Manager[O]) notify() bool {
+	if m.event.Notified || m.config.Notify == nil || !m.config.Notify(m.event.Attributes) {
+		return false
+	}
+	m.event.Notified = true
+	return true
+}
+
+func (m *Manager[O]) hook(hook func(Event[O])) {
+	if hook != nil {
+		hook(m.snapshot())
+	}
+}
+
+// snapshot copies the open event, so callers never share its slices
+func (m *Manager[O]) snapshot() Event[O] {
+	event := *m.event
+	event.Objects = slices.Clone(event.Objects)
+	event.Attributes = slices.Clone(event.Attributes)
+	event.Snapshots = slices.Clone(event.Snapshots)
+	return event
+}
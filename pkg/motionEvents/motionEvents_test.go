@@ -0,0 +1,230 @@
+package motionEvents
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/catsimple/firescrew/pkg/eventLifecycle"
+	"github.com/catsimple/firescrew/pkg/motionDetect"
+)
+
+type object struct {
+	ID    string
+	Class string
+	Label string
+}
+
+// recorder records the calls of the manager
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) Record(videoFile string, until time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.calls) == 0 || r.calls[len(r.calls)-1] != "record "+videoFile {
+		r.calls = append(r.calls, "record "+videoFile)
+	}
+}
+
+func (r *recorder) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, "stop")
+}
+
+// hooks collects the events reported by the manager and checks that they never overlap
+type hooks struct {
+	t       *testing.T
+	mu      sync.Mutex
+	open    string
+	started []Event[object]
+	ended   chan Event[object]
+}
+
+func newHooks(t *testing.T) *hooks {
+	return &hooks{t: t, ended: make(chan Event[object], 100)}
+}
+
+func (h *hooks) config(cfg Config[object]) Config[object] {
+	cfg.TrackID = func(o object) string { return o.ID }
+	cfg.Class = func(o object) string { return o.Class }
+	cfg.Started = func(event Event[object]) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.open != "" {
+			h.t.Errorf("event %s started while %s is open", event.ID, h.open)
+		}
+		h.open = event.ID
+		h.started = append(h.started, event)
+	}
+	cfg.Ended = func(event Event[object]) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.open != event.ID {
+			h.t.Errorf("event %s ended while %s is open", event.ID, h.open)
+		}
+		h.open = ""
+		h.ended <- event
+	}
+	return cfg
+}
+
+func (h *hooks) waitEnded(t *testing.T) Event[object] {
+	t.Helper()
+	select {
+	case event := <-h.ended:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the event to end")
+		return Event[object]{}
+	}
+}
+
+// frames is a synthetic sequence with a square crossing the picture in frames [from, to)
+func frames(n, from, to int) []*image.RGBA {
+	var sequence []*image.RGBA
+	for i := 0; i < n; i++ {
+		frame := image.NewRGBA(image.Rect(0, 0, 160, 120))
+		draw.Draw(frame, frame.Bounds(), &image.Uniform{color.RGBA{40, 40, 40, 255}}, image.Point{}, draw.Src)
+		if i >= from && i < to {
+			x := (i - from) * 8
+			draw.Draw(frame, image.Rect(x, 40, x+30, 80), &image.Uniform{color.RGBA{220, 220, 220, 255}}, image.Point{}, draw.Src)
+		}
+		sequence = append(sequence, frame)
+	}
+	return sequence
+}
+
+func TestFrameSequence(t *testing.T) {
+	h := newHooks(t)
+	rec := &recorder{}
+	m := New(h.config(Config[object]{
+		Lifecycle:    eventLifecycle.Config{MinPersistence: 150 * time.Millisecond, Gap: 300 * time.Millisecond},
+		Recorder:     rec,
+		SnapshotFile: func(id string, now time.Time) string { return "snap_" + id + ".jpg" },
+	}))
+	defer m.Close(time.Now())
+
+	detector := motionDetect.New(motionDetect.Config{MinBlobArea: 100})
+	start := time.Now()
+	var last time.Time
+	for i, frame := range frames(15, 3, 12) {
+		now := start.Add(time.Duration(i) * 50 * time.Millisecond)
+		motion := detector.Detect(frame)
+		if len(motion.Blobs) == 0 {
+			continue
+		}
+		// The tracker would keep the id of the square while it moves
+		o := object{ID: "square", Class: "person"}
+		if m.Admit(o, now) {
+			result := m.Trigger(o, now)
+			if !result.Started || result.Snapshot == "" {
+				t.Errorf("expected the square to start an event with a snapshot, got %+v", result)
+			}
+		}
+		last = now
+	}
+	if last.IsZero() {
+		t.Fatalf("expected the square to be detected")
+	}
+	if !m.Active() {
+		t.Fatalf("expected an open event after the square persisted")
+	}
+
+	event := h.waitEnded(t)
+	if len(event.Objects) != 1 || len(event.Snapshots) != 1 {
+		t.Errorf("expected one object and snapshot, got %+v", event)
+	}
+	if event.End.Before(event.LastTriggered.Add(300 * time.Millisecond)) {
+		t.Errorf("expected the event to end a gap after the last object, got %v", event.End.Sub(event.LastTriggered))
+	}
+	if m.Active() {
+		t.Errorf("expected no open event after it ended")
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.calls) != 2 || rec.calls[0] != "record "+event.VideoFile || rec.calls[1] != "stop" {
+		t.Errorf("unexpected recorder calls %v", rec.calls)
+	}
+}
+
+func TestSplitContinuesEvent(t *testing.T) {
+	h := newHooks(t)
+	rec := &recorder{}
+	m := New(h.config(Config[object]{
+		Lifecycle: eventLifecycle.Config{Gap: 200 * time.Millisecond, MaxDuration: 150 * time.Millisecond},
+		Recorder:  rec,
+	}))
+	defer m.Close(time.Now())
+
+	for i := 0; i < 10; i++ {
+		m.Trigger(object{ID: fmt.Sprint(i), Class: "person"}, time.Now())
+		time.Sleep(30 * time.Millisecond)
+	}
+
+	first := h.waitEnded(t)
+	second := h.waitEnded(t)
+	if second.ContinuedFrom != first.ID {
+		t.Errorf("expected the second clip to continue %s, got %q", first.ID, second.ContinuedFrom)
+	}
+	if len(second.Objects) < len(first.Objects) {
+		t.Errorf("expected the objects to carry over, got %d after %d", len(second.Objects), len(first.Objects))
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.calls) < 3 || rec.calls[0] != "record "+first.VideoFile || rec.calls[1] != "record "+second.VideoFile {
+		t.Errorf("expected the recorder to switch clips, got %v", rec.calls)
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	h := newHooks(t)
+	m := New(h.config(Config[object]{
+		Lifecycle:  eventLifecycle.Config{Gap: 20 * time.Millisecond, MaxDuration: 50 * time.Millisecond},
+		Recorder:   &recorder{},
+		Attributes: func(objects []object) []string { return []string{fmt.Sprint(len(objects))} },
+		Notify:     func(attributes []string) bool { return true },
+	}))
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				o := object{ID: fmt.Sprintf("%d-%d", worker, i), Class: "person"}
+				if m.Admit(o, time.Now()) {
+					m.Trigger(o, time.Now())
+				}
+				m.UpdateObject(o.ID, func(tracked *object) { tracked.Label = "updated" })
+				m.Current()
+				m.Active()
+				time.Sleep(time.Millisecond * time.Duration(worker))
+			}
+		}(worker)
+	}
+	wg.Wait()
+	m.Close(time.Now())
+	m.Close(time.Now()) // Closing twice is fine
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.open != "" {
+		t.Errorf("expected Close to end the open event %s", h.open)
+	}
+	if len(h.ended) != len(h.started) {
+		t.Errorf("expected every started clip to end, %d started %d ended", len(h.started), len(h.ended))
+	}
+	if id, _ := m.UpdateObject("x", func(*object) {}); id != "" {
+		t.Errorf("expected a closed manager to ignore updates")
+	}
+}
@@ -0,0 +1,219 @@
+package objectPredict
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sync"
+
+	onnx "github.com/8ff/onnxruntime_go"
+)
+
+// CropModelConfig configures a model that runs on crops of detections, e.g. a classifier or an embedder.
+// The model has to take a single [1,3,H,W] float input and produce a single flat float output.
+type CropModelConfig struct {
+	Model       string     // Path, cached or embedded model name, resolved like the detector model
+	ModelWidth  int        // Defaults to 224
+	ModelHeight int        // Defaults to 224
+	InputName   string     // Defaults to "input"
+	OutputName  string     // Defaults to "output"
+	OutputSize  int        // Number of floats the model outputs per image
+	Mean        [3]float32 // Subtracted per channel from the 0-1 pixels, e.g. 0.485,0.456,0.406 for ImageNet models
+	Std         [3]float32 // Divides per channel after Mean, zero means 1
+}
+
+// CropModel is a single session running a CropModelConfig model on the same environment and
+// execution provider as the detector. It is safe for concurrent use, calls are serialized.
+type CropModel struct {
+	Config    CropModelConfig
+	ModelPath string
+
+	mu           sync.Mutex
+	session      *onnx.DynamicAdvancedSession
+	input        *onnx.Tensor[float32]
+	output       *onnx.Tensor[float32]
+	preprocessor *Preprocessor
+}
+
+// NewCropModel loads cfg.Model on the execution provider the detector sessions are running on
+func (c *Client) NewCropModel(cfg CropModelConfig) (*CropModel, error) {
+	if cfg.ModelWidth == 0 {
+		cfg.ModelWidth = 224
+	}
+	if cfg.ModelHeight == 0 {
+		cfg.ModelHeight = 224
+	}
+	if cfg.InputName == "" {
+		cfg.InputName = "input"
+	}
+	if cfg.OutputName == "" {
+		cfg.OutputName = "output"
+	}
+	if cfg.OutputSize <= 0 {
+		return nil, fmt.Errorf("crop model %s: outputSize must be set", cfg.Model)
+	}
+	for i := range cfg.Std {
+		if cfg.Std[i] == 0 {
+			cfg.Std[i] = 1
+		}
+	}
+
+	modelPath, err := c.Models.Resolve(cfg.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := c.newSessionOptions(c.Provider)
+	if err != nil {
+		return nil, err
+	}
+	defer options.Destroy()
+
+	session, err := onnx.NewDynamicAdvancedSession(modelPath, []string{cfg.InputName}, []string{cfg.OutputName}, options)
+	if err != nil {
+		return nil, fmt.Errorf("error loading crop model %s: %w", cfg.Model, err)
+	}
+
+	input, err := onnx.NewEmptyTensor[float32](onnx.NewShape(1, 3, int64(cfg.ModelHeight), int64(cfg.ModelWidth)))
+	if err != nil {
+		session.Destroy()
+		return nil, fmt.Errorf("error creating input tensor: %w", err)
+	}
+	output, err := onnx.NewEmptyTensor[float32](onnx.NewShape(1, int64(cfg.OutputSize)))
+	if err != nil {
+		session.Destroy()
+		input.Destroy()
+		return nil, fmt.Errorf("error creating output tensor: %w", err)
+	}
+
+	return &CropModel{
+		Config:       cfg,
+		ModelPath:    modelPath,
+		session:      session,
+		input:        input,
+		output:       output,
+		preprocessor: NewPreprocessor(cfg.ModelWidth, cfg.ModelHeight),
+	}, nil
+}
+
+// Run letterboxes img into the model input and returns a copy of the raw output
+func (m *CropModel) Run(img image.Image) ([]float32, error) {
+	output, _, err := m.run(img)
+	return output, err
+}
+
+// run is Run that also returns the letterbox used, to map boxes of detection models back to img
+func (m *CropModel) run(img image.Image) ([]float32, Letterbox, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.session == nil {
+		return nil, Letterbox{}, fmt.Errorf("crop model %s is closed", m.Config.Model)
+	}
+
+	data := m.input.GetData()
+	lb := m.preprocessor.Letterbox(img, data)
+	normalizePlanes(data, m.Config.ModelWidth*m.Config.ModelHeight, m.Config.Mean, m.Config.Std)
+
+	err := m.session.Run([]onnx.ArbitraryTensor{m.input}, []onnx.ArbitraryTensor{m.output})
+	if err != nil {
+		return nil, Letterbox{}, fmt.Errorf("error running crop model %s: %w", m.Config.Model, err)
+	}
+
+	return append([]float32(nil), m.output.GetData()...), lb, nil
+}
+
+func (m *CropModel) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.session == nil {
+		return
+	}
+	m.session.Destroy()
+	m.input.Destroy()
+	m.output.Destroy()
+	m.session = nil
+}
+
+// normalizePlanes applies (v-mean)/std to each of the 3 planes of size plane
+func normalizePlanes(data []float32, plane int, mean, std [3]float32) {
+	for ch := 0; ch < 3; ch++ {
+		if mean[ch] == 0 && std[ch] == 1 {
+			continue
+		}
+		values := data[ch*plane : (ch+1)*plane]
+		for i := range values {
+			values[i] = (values[i] - mean[ch]) / std[ch]
+		}
+	}
+}
+
+// Label is the top class of a Classifier
+type Label struct {
+	Name       string
+	Confidence float32
+}
+
+// Classifier maps the output of a CropModel to Labels, one output per label
+type Classifier struct {
+	*CropModel
+	Labels  []string
+	Softmax bool // Apply softmax, for models that output raw logits
+}
+
+// NewClassifier loads a classification model with len(labels) outputs
+func (c *Client) NewClassifier(cfg CropModelConfig, labels []string, softmax bool) (*Classifier, error) {
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("classifier %s: labels must be set", cfg.Model)
+	}
+	cfg.OutputSize = len(labels)
+
+	model, err := c.NewCropModel(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Classifier{CropModel: model, Labels: labels, Softmax: softmax}, nil
+}
+
+// Classify returns the most likely label of img
+func (cl *Classifier) Classify(img image.Image) (Label, error) {
+	output, err := cl.Run(img)
+	if err != nil {
+		return Label{}, err
+	}
+	return topLabel(output, cl.Labels, cl.Softmax), nil
+}
+
+func topLabel(output []float32, labels []string, softmax bool) Label {
+	if softmax {
+		output = softmaxOf(output)
+	}
+
+	best := 0
+	for i := range output {
+		if output[i] > output[best] {
+			best = i
+		}
+	}
+	return Label{Name: labels[best], Confidence: output[best]}
+}
+
+func softmaxOf(values []float32) []float32 {
+	maxValue := values[0]
+	for _, v := range values {
+		maxValue = max(maxValue, v)
+	}
+
+	out := make([]float32, len(values))
+	var sum float64
+	for i, v := range values {
+		e := math.Exp(float64(v - maxValue))
+		out[i] = float32(e)
+		sum += e
+	}
+	for i := range out {
+		out[i] = float32(float64(out[i]) / sum)
+	}
+	return out
+}
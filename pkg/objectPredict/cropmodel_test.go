@@ -0,0 +1,32 @@
+package objectPredict
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTopLabel(t *testing.T) {
+	labels := []string{"red", "blue", "white"}
+
+	label := topLabel([]float32{0.1, 0.7, 0.2}, labels, false)
+	if label.Name != "blue" || label.Confidence != 0.7 {
+		t.Errorf("expected blue 0.7, got %+v", label)
+	}
+
+	// Logits, softmax of 2,1,0 is 0.665,0.245,0.090
+	label = topLabel([]float32{2, 1, 0}, labels, true)
+	if label.Name != "red" || math.Abs(float64(label.Confidence)-0.665) > 1e-3 {
+		t.Errorf("expected red 0.665, got %+v", label)
+	}
+}
+
+func TestNormalizePlanes(t *testing.T) {
+	data := []float32{0.5, 0.5, 0.5, 0.5, 0.5, 0.5}
+	normalizePlanes(data, 2, [3]float32{0.5, 0, 0.25}, [3]float32{1, 1, 0.5})
+	want := []float32{0, 0, 0.5, 0.5, 0.5, 0.5}
+	for i := range want {
+		if math.Abs(float64(data[i]-want[i])) > 1e-6 {
+			t.Fatalf("expected %v, got %v", want, data)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package objectPredict
+
+import (
+	"fmt"
+	"image"
+)
+
+// FaceRecognizerConfig configures face detection and embedding extraction
+type FaceRecognizerConfig struct {
+	Detector           CropModelConfig // YOLOv8 style single class face detector, OutputSize is derived
+	DetectorConfidence float32         // Minimum face box confidence, defaults to 0.5
+	DetectorRows       int             // Rows per anchor of the detector output, 5 for box+score, 20 for models with 5 keypoints. Defaults to 5
+	Embedder           CropModelConfig // Face embedding model (e.g. ArcFace/MobileFaceNet), OutputSize is the embedding size
+	MinFaceSize        int             // Faces smaller than this many pixels on either side are skipped, defaults to 20
+}
+
+// Face is a face found by a FaceRecognizer
+type Face struct {
+	Box        image.Rectangle // Face box in the coordinates of the image passed to Detect
+	Confidence float32
+	Embedding  []float32
+}
+
+// FaceRecognizer finds faces, typically in person crops, and computes an embedding per face
+type FaceRecognizer struct {
+	Config   FaceRecognizerConfig
+	detector *CropModel
+	embedder *CropModel
+}
+
+// NewFaceRecognizer loads the face detector and embedder on the detector environment and provider
+func (c *Client) NewFaceRecognizer(cfg FaceRecognizerConfig) (*FaceRecognizer, error) {
+	if cfg.Embedder.OutputSize <= 0 {
+		return nil, fmt.Errorf("face recognizer: embedding size must be set")
+	}
+	if cfg.DetectorConfidence == 0 {
+		cfg.DetectorConfidence = 0.5
+	}
+	if cfg.DetectorRows < 5 {
+		cfg.DetectorRows = 5
+	}
+	if cfg.MinFaceSize == 0 {
+		cfg.MinFaceSize = 20
+	}
+
+	if cfg.Detector.ModelWidth == 0 {
+		cfg.Detector.ModelWidth = 640
+	}
+	if cfg.Detector.ModelHeight == 0 {
+		cfg.Detector.ModelHeight = 640
+	}
+	if cfg.Detector.InputName == "" {
+		cfg.Detector.InputName = "images"
+	}
+	if cfg.Detector.OutputName == "" {
+		cfg.Detector.OutputName = "output0"
+	}
+	cfg.Detector.OutputSize = cfg.DetectorRows * numAnchors(cfg.Detector.ModelWidth, cfg.Detector.ModelHeight)
+
+	// Most face embedders take 112x112
+	if cfg.Embedder.ModelWidth == 0 {
+		cfg.Embedder.ModelWidth = 112
+	}
+	if cfg.Embedder.ModelHeight == 0 {
+		cfg.Embedder.ModelHeight = 112
+	}
+
+	detector, err := c.NewCropModel(cfg.Detector)
+	if err != nil {
+		return nil, err
+	}
+	embedder, err := c.NewCropModel(cfg.Embedder)
+	if err != nil {
+		detector.Close()
+		return nil, err
+	}
+	return &FaceRecognizer{Config: cfg, detector: detector, embedder: embedder}, nil
+}
+
+// Detect finds the faces in img and computes their embeddings, largest face first
+func (f *FaceRecognizer) Detect(img image.Image) ([]Face, error) {
+	output, lb, err := f.detector.run(img)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := f.Config.Detector
+	boxes := decodeYolo(output, []string{"face"}, f.Config.DetectorConfidence, lb, cfg.ModelWidth, cfg.ModelHeight)
+	boxes = NonMaxSuppression(boxes, 0.5, false)
+
+	bounds := img.Bounds()
+	var faces []Face
+	for _, box := range boxes {
+		rect := image.Rect(int(box.X1), int(box.Y1), int(box.X2), int(box.Y2)).Add(bounds.Min).Intersect(bounds)
+		if rect.Dx() < f.Config.MinFaceSize || rect.Dy() < f.Config.MinFaceSize {
+			continue
+		}
+
+		embedding, err := f.Embed(cropImage(img, rect))
+		if err != nil {
+			return nil, err
+		}
+		faces = append(faces, Face{Box: rect, Confidence: box.Confidence, Embedding: embedding})
+	}
+
+	// Largest first, that is usually the face the crop was taken for
+	for i := 1; i < len(faces); i++ {
+		for j := i; j > 0 && area(faces[j].Box) > area(faces[j-1].Box); j-- {
+			faces[j], faces[j-1] = faces[j-1], faces[j]
+		}
+	}
+	return faces, nil
+}
+
+// Embed runs the embedder on an already cropped face
+func (f *FaceRecognizer) Embed(face image.Image) ([]float32, error) {
+	return f.embedder.Run(face)
+}
+
+func (f *FaceRecognizer) Close() {
+	f.detector.Close()
+	f.embedder.Close()
+}
+
+func area(r image.Rectangle) int {
+	return r.Dx() * r.Dy()
+}
@@ -0,0 +1,293 @@
+package objectPredict
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const manifestName = "manifest.json"
+
+// ModelInfo describes a model known to the ModelManager
+type ModelInfo struct {
+	Name     string    `json:"name"`
+	File     string    `json:"file"`   // File name inside the cache dir
+	SHA256   string    `json:"sha256"` // Hex encoded hash of the file
+	Size     int64     `json:"size"`
+	Source   string    `json:"source"` // URL or path the model was added from, "embedded" for models shipped in the binary
+	Added    time.Time `json:"added"`
+	Embedded bool      `json:"embedded"`
+}
+
+// ModelManager keeps onnx models in a local cache dir next to a manifest with their SHA-256 hashes.
+// Embedded models are extracted into the cache on first use instead of on every start.
+type ModelManager struct {
+	CacheDir string
+
+	mu sync.Mutex
+}
+
+// DefaultModelCacheDir returns the per user cache dir for models, falling back to /tmp when there is none
+func DefaultModelCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "firescrew", "models")
+}
+
+// NewModelManager creates cacheDir if needed, an empty cacheDir uses DefaultModelCacheDir
+func NewModelManager(cacheDir string) (*ModelManager, error) {
+	if cacheDir == "" {
+		cacheDir = DefaultModelCacheDir()
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating model cache dir: %w", err)
+	}
+	return &ModelManager{CacheDir: cacheDir}, nil
+}
+
+// List returns the cached models followed by the embedded ones that are not cached yet, sorted by name
+func (m *ModelManager) List() ([]ModelInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	manifest, err := m.readManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	embedded, err := embeddedModels()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range embedded {
+		if _, ok := manifest[name]; !ok {
+			manifest[name] = ModelInfo{Name: name, Source: "embedded", Embedded: true}
+		}
+	}
+
+	list := make([]ModelInfo, 0, len(manifest))
+	for _, info := range manifest {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Add copies the model at source (http(s) URL or local path) into the cache as name.
+// When expectedSHA256 is set the download is rejected if the hash does not match.
+func (m *ModelManager) Add(name, source, expectedSHA256 string) (ModelInfo, error) {
+	if err := validModelName(name); err != nil {
+		return ModelInfo{}, err
+	}
+
+	var reader io.ReadCloser
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		resp, err := http.Get(source)
+		if err != nil {
+			return ModelInfo{}, fmt.Errorf("error downloading model: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return ModelInfo{}, fmt.Errorf("error downloading model: %s", resp.Status)
+		}
+		reader = resp.Body
+	} else {
+		file, err := os.Open(source)
+		if err != nil {
+			return ModelInfo{}, fmt.Errorf("error opening model: %w", err)
+		}
+		reader = file
+	}
+	defer reader.Close()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, err := m.store(name, reader, expectedSHA256)
+	if err != nil {
+		return ModelInfo{}, err
+	}
+	info.Source = source
+	return info, m.updateManifest(info)
+}
+
+// Verify hashes the cached file of name and compares it with the manifest
+func (m *ModelManager) Verify(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	manifest, err := m.readManifest()
+	if err != nil {
+		return err
+	}
+	info, ok := manifest[name]
+	if !ok {
+		return fmt.Errorf("model %s is not in the cache", name)
+	}
+	return m.verify(info)
+}
+
+// Resolve returns a verified local path for model. Model can be a path to an onnx file, a cached model
+// or an embedded model, the latter is extracted into the cache the first time it is used.
+func (m *ModelManager) Resolve(model string) (string, error) {
+	if _, err := os.Stat(model); err == nil {
+		return model, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	manifest, err := m.readManifest()
+	if err != nil {
+		return "", err
+	}
+
+	info, cached := manifest[model]
+	if cached {
+		err = m.verify(info)
+		if err == nil {
+			return filepath.Join(m.CacheDir, info.File), nil
+		}
+		if !info.Embedded {
+			return "", err
+		}
+		logger.Warn("Extracting embedded model again", "error", err)
+	}
+
+	// Embedded models can always be restored from the binary
+	data, err := models.Open(path.Join("models", model+".onnx"))
+	if err != nil {
+		return "", fmt.Errorf("model %s not found: not a file, not cached and not embedded", model)
+	}
+	defer data.Close()
+
+	info, err = m.store(model, data, "")
+	if err != nil {
+		return "", err
+	}
+	info.Source = "embedded"
+	info.Embedded = true
+	if err := m.updateManifest(info); err != nil {
+		return "", err
+	}
+	return filepath.Join(m.CacheDir, info.File), nil
+}
+
+// store writes reader into the cache as name.onnx, hashing it on the way. The file is written
+// to a temp file first and renamed so a failed download never replaces a good model.
+func (m *ModelManager) store(name string, reader io.Reader, expectedSHA256 string) (ModelInfo, error) {
+	tmp, err := os.CreateTemp(m.CacheDir, name+".*.tmp")
+	if err != nil {
+		return ModelInfo{}, fmt.Errorf("error creating model file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after the rename
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return ModelInfo{}, fmt.Errorf("error writing model file: %w", err)
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if expectedSHA256 != "" && !strings.EqualFold(sum, expectedSHA256) {
+		return ModelInfo{}, fmt.Errorf("sha256 mismatch for %s: expected %s, got %s", name, expectedSHA256, sum)
+	}
+
+	file := name + ".onnx"
+	if err := os.Rename(tmp.Name(), filepath.Join(m.CacheDir, file)); err != nil {
+		return ModelInfo{}, fmt.Errorf("error moving model into cache: %w", err)
+	}
+
+	return ModelInfo{Name: name, File: file, SHA256: sum, Size: size, Added: time.Now()}, nil
+}
+
+func (m *ModelManager) verify(info ModelInfo) error {
+	file, err := os.Open(filepath.Join(m.CacheDir, info.File))
+	if err != nil {
+		return fmt.Errorf("model %s: %w", info.Name, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return fmt.Errorf("model %s: %w", info.Name, err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != info.SHA256 {
+		return fmt.Errorf("model %s: sha256 mismatch, expected %s, got %s", info.Name, info.SHA256, sum)
+	}
+	return nil
+}
+
+func (m *ModelManager) readManifest() (map[string]ModelInfo, error) {
+	manifest := map[string]ModelInfo{}
+	data, err := os.ReadFile(filepath.Join(m.CacheDir, manifestName))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading model manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("error parsing model manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+func (m *ModelManager) updateManifest(info ModelInfo) error {
+	manifest, err := m.readManifest()
+	if err != nil {
+		return err
+	}
+	manifest[info.Name] = info
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write and rename so readers never see a half written manifest
+	tmp := filepath.Join(m.CacheDir, manifestName+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing model manifest: %w", err)
+	}
+	return os.Rename(tmp, filepath.Join(m.CacheDir, manifestName))
+}
+
+// embeddedModels returns the names of the models compiled into the binary
+func embeddedModels() ([]string, error) {
+	entries, err := fs.ReadDir(models, "models")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".onnx") {
+			names = append(names, strings.TrimSuffix(entry.Name(), ".onnx"))
+		}
+	}
+	return names, nil
+}
+
+func validModelName(name string) error {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid model name: %q", name)
+	}
+	return nil
+}
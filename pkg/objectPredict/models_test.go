@@ -0,0 +1,80 @@
+package objectPredict
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestModelManagerAddVerifyResolve(t *testing.T) {
+	dir := t.TempDir()
+	manager, err := NewModelManager(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("not really an onnx model")
+	source := filepath.Join(dir, "custom.onnx")
+	if err := os.WriteFile(source, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+
+	if _, err := manager.Add("custom", source, "deadbeef"); err == nil {
+		t.Fatal("expected a sha256 mismatch error")
+	}
+
+	info, err := manager.Add("custom", source, hex.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(data)) || info.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected model info: %+v", info)
+	}
+
+	if err := manager.Verify("custom"); err != nil {
+		t.Errorf("expected model to verify: %v", err)
+	}
+
+	path, err := manager.Resolve("custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(manager.CacheDir, "custom.onnx") {
+		t.Errorf("unexpected resolved path %s", path)
+	}
+
+	// A path is used as is
+	if path, err := manager.Resolve(source); err != nil || path != source {
+		t.Errorf("expected %s to resolve to itself, got %s, %v", source, path, err)
+	}
+
+	// Corrupt the cached file, it must no longer verify or resolve
+	if err := os.WriteFile(path, []byte("corrupted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Verify("custom"); err == nil {
+		t.Error("expected verify to fail on a corrupted model")
+	}
+	if _, err := manager.Resolve("custom"); err == nil {
+		t.Error("expected resolve to fail on a corrupted model")
+	}
+
+	list, err := manager.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, model := range list {
+		found = found || model.Name == "custom"
+	}
+	if !found {
+		t.Errorf("expected custom in %+v", list)
+	}
+
+	if _, err := manager.Add("../escape", source, ""); err == nil {
+		t.Error("expected an invalid model name error")
+	}
+}
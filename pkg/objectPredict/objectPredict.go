@@ -12,16 +12,16 @@ import (
 	"image/jpeg"
 	"image/png"
 	"io"
-	"io/fs"
-	"log"
 	"math"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sort"
 	"sync"
+	"time"
 
 	onnx "github.com/8ff/onnxruntime_go"
+	"github.com/catsimple/firescrew/pkg/logging"
 	"github.com/goki/freetype"
 	"golang.org/x/image/draw"
 	"golang.org/x/image/math/fixed"
@@ -36,35 +36,85 @@ var fonts embed.FS
 //go:embed lib.tgz
 var lib []byte
 
+var logger = logging.For("objectPredict")
+
 type Config struct {
 	// ModelPath    string
-	Model        string
-	ModelWidth   int
-	ModelHeight  int
-	EnableCuda   bool
-	CudaDeviceID int
-	EnableCoreMl bool
+	Model           string
+	ModelWidth      int
+	ModelHeight     int
+	EnableCuda      bool
+	CudaDeviceID    int
+	EnableCoreMl    bool
+	SessionPoolSize int    // Number of sessions that can run concurrently, defaults to 1
+	MaxBatchSize    int    // Max images per session run, only set above 1 for models exported with a dynamic batch axis
+	KeepImages      bool   // Render the letterboxed model input into Result.Image, costs an allocation per image
+	NormalizedBoxes bool   // Return boxes as 0-1 fractions of the original image instead of pixels
+	ModelCacheDir   string // Where models are cached and verified, defaults to DefaultModelCacheDir
+
+	// Execution providers tried in order (tensorrt, cuda, openvino, coreml, cpu), the first one that
+	// initializes wins and cpu is always the last resort. Empty falls back to EnableCuda/EnableCoreMl.
+	Providers       []string
+	ProviderOptions map[string]map[string]string // Per provider settings passed to onnxruntime, e.g. "cuda": {"gpu_mem_limit": "2147483648"}
+	LibraryPath     string                       // Load this onnxruntime library instead of the embedded one
+	IntraOpThreads  int                          // Threads used inside an operator, 0 lets onnxruntime decide
+	InterOpThreads  int                          // Threads used to run operators in parallel, 0 lets onnxruntime decide
+
+	// Only load the library and pick the provider for crop models, for a client whose detector runs elsewhere. The
+	// provider is the first of Providers that onnxruntime accepts, Model is not loaded and Predict fails.
+	CropModelsOnly bool
 }
 
 type Client struct {
-	ModelPath      string
-	ModelBasePath  string
-	ModelWidth     int
-	ModelHeight    int
-	LibPath        string
-	LibExtractPath string
-	RuntimeSession ModelSession
-	EnableCuda     bool
-	CudaDeviceID   int
-	EnableCoreMl   bool
+	ModelPath       string
+	ModelWidth      int
+	ModelHeight     int
+	LibPath         string
+	LibExtractPath  string
+	Sessions        []*ModelSession
+	Models          *ModelManager
+	EnableCuda      bool
+	CudaDeviceID    int
+	EnableCoreMl    bool
+	SessionPoolSize int
+	MaxBatchSize    int
+	KeepImages      bool
+	NormalizedBoxes bool
+	Providers       []string
+	ProviderOptions map[string]map[string]string
+	Provider        string // Execution provider the sessions ended up running on
+	IntraOpThreads  int
+	InterOpThreads  int
+
+	mu   sync.RWMutex       // Guards the model fields and pool against SwapModel
+	pool chan *ModelSession // Idle sessions, callers block here until one is free
 }
 
+// ModelSession wraps a single onnx session. A session is used by one caller at a time,
+// the tensors are cached per batch size so repeated calls dont allocate them again.
 type ModelSession struct {
-	Session *onnx.AdvancedSession
-	Input   *onnx.Tensor[float32]
-	Output  *onnx.Tensor[float32]
+	ModelWidth   int
+	ModelHeight  int
+	Session      *onnx.DynamicAdvancedSession
+	Tensors      map[int]*ModelTensors
+	Preprocessor *Preprocessor
+}
+
+type ModelTensors struct {
+	Input  *onnx.Tensor[float32]
+	Output *onnx.Tensor[float32]
+}
+
+// Result holds the outcome of a single image passed to PredictBatch
+type Result struct {
+	Objects   []Object
+	Image     *image.RGBA   // Letterboxed image that was fed to the model, only set with KeepImages
+	Letterbox Letterbox     // Scale and padding applied to the image
+	Took      time.Duration // Latency of the session run this image was part of
 }
 
+// Object is a single detection. Coordinates are in the original image passed to Predict,
+// either in pixels or as 0-1 fractions when NormalizedBoxes is set.
 type Object struct {
 	ClassName  string
 	ClassID    int
@@ -76,83 +126,55 @@ type Object struct {
 }
 
 func Init(opt Config) (*Client, error) {
-	fmt.Println(">>> [DEBUG] Init start") // 调试日志
+	logger.Debug("Init start")
 	client := Client{}
 
-	// Determine OS and architecture and set libPath
-	hostOs := runtime.GOOS
-	hostArch := runtime.GOARCH
-	switch {
-	case hostOs == "darwin" && hostArch == "arm64":
-		if opt.EnableCuda {
-			return &Client{}, fmt.Errorf("cuda not supported on darwin/arm64")
+	// Providers are tried in order, the embedded gpu build is only needed for cuda/tensorrt
+	client.Providers = resolveProviders(opt)
+	client.ProviderOptions = opt.ProviderOptions
+
+	var err error
+	if opt.LibraryPath != "" {
+		// Use a system wide onnxruntime (e.g. one built with OpenVINO or a newer TensorRT) instead of the embedded one
+		if _, err := os.Stat(opt.LibraryPath); err != nil {
+			return &Client{}, fmt.Errorf("libraryPath does not exist: %s", opt.LibraryPath)
 		}
-		client.LibPath = "lib/osx_arm64/libonnxruntime.dylib"
-	case hostOs == "linux" && hostArch == "amd64":
-		if opt.EnableCoreMl {
-			return &Client{}, fmt.Errorf("coreml not supported on linux/amd64")
+		client.LibPath = opt.LibraryPath
+	} else {
+		// Determine OS and architecture and set libPath
+		client.LibPath, err = embeddedLibPath(runtime.GOOS, runtime.GOARCH, needsGpuLib(client.Providers))
+		if err != nil {
+			return &Client{}, err
 		}
-		if opt.EnableCuda {
-			client.LibPath = "lib/linux_amd64_gpu/libonnxruntime.so"
-		} else {
-			client.LibPath = "lib/linux_amd64_cpu/libonnxruntime.so"
+
+		// Store libPath in temp file
+		logger.Debug("Extracting libraries")
+		client.LibExtractPath, err = extractLibs(lib, "/tmp")
+		if err != nil {
+			return &Client{}, err
 		}
-	case hostOs == "linux" && hostArch == "arm64":
-		if opt.EnableCuda || opt.EnableCoreMl {
-			return &Client{}, fmt.Errorf("cuda and coreml not supported on linux/arm64")
+		logger.Debug("Libraries extracted", "path", client.LibExtractPath)
+		// Check if library file exists
+		if _, err := os.Stat(client.LibExtractPath + "/" + client.LibPath); err != nil {
+			return &Client{}, fmt.Errorf("libPath does not exist: %s", client.LibPath)
 		}
-		client.LibPath = "lib/linux_arm64_cpu/libonnxruntime.so"
-	default:
-		return &Client{}, fmt.Errorf("unsupported OS or architecture: %s/%s", hostOs, hostArch)
 	}
 
-	// Store libPath in temp file
-	fmt.Println(">>> [DEBUG] Extracting Libraries...") // 调试日志
-	var err error
-	client.LibExtractPath, err = extractLibs(lib, "/tmp")
+	// Models are resolved through the cache, embedded ones are only extracted the first time they are used
+	client.Models, err = NewModelManager(opt.ModelCacheDir)
 	if err != nil {
 		return &Client{}, err
 	}
-	fmt.Println(">>> [DEBUG] Libs extracted to:", client.LibExtractPath) // 调试日志
-	// Check if library file exists
-	if _, err := os.Stat(client.LibExtractPath + "/" + client.LibPath); err != nil {
-		return &Client{}, fmt.Errorf("libPath does not exist: %s", client.LibPath)
-	}
-
-	// Prepare models (Extract embedded ones anyway just in case)
-	fmt.Println(">>> [DEBUG] Extracting Models...") // 调试日志
-	modelTempPath, err := extractModels(models, "/tmp")
-	if err != nil {
-		return &Client{}, err
-	}
-	client.ModelBasePath = modelTempPath // Set base path for extracted models so it can be cleaned up later
-	
-	// === MODIFIED: Logic to support external model files ===
-	// Check if opt.Model is a valid local file
-	if _, err := os.Stat(opt.Model); err == nil {
-		client.ModelPath = opt.Model
-		// log.Printf("Loading external model from: %s", client.ModelPath)
-	} else {
-		// Fallback to embedded models
-		switch opt.Model {
-		case "yolo11n":
-			client.ModelPath = modelTempPath + "/models/yolo11n.onnx"
-		case "yolov8n":
-			client.ModelPath = modelTempPath + "/models/yolov8n.onnx"
-		case "yolov8s":
-			client.ModelPath = modelTempPath + "/models/yolov8s.onnx"
-		case "yolov8m":
-			client.ModelPath = modelTempPath + "/models/yolov8m.onnx"
-		default:
-			// log.Printf("Model %s not found locally, using embedded yolov8n", opt.Model)
-			client.ModelPath = modelTempPath + "/models/yolov8n.onnx"
+	if !opt.CropModelsOnly {
+		client.ModelPath, err = client.Models.Resolve(opt.Model)
+		if err != nil {
+			logger.Warn("Using embedded yolov8n", "error", err)
+			client.ModelPath, err = client.Models.Resolve("yolov8n")
+			if err != nil {
+				return &Client{}, err
+			}
 		}
-	fmt.Printf(">>> [DEBUG] Selected Model Path: %s\n", client.ModelPath) // 调试日志
-	}
-
-	// Check if model file exists
-	if _, err := os.Stat(client.ModelPath); err != nil {
-		return &Client{}, fmt.Errorf("modelPath does not exist: %s", client.ModelPath)
+		logger.Debug("Selected model", "path", client.ModelPath)
 	}
 
 	// Copy cudaDeviceID
@@ -175,225 +197,359 @@ func Init(opt Config) (*Client, error) {
 	client.EnableCuda = opt.EnableCuda
 	client.EnableCoreMl = opt.EnableCoreMl
 
-	// Create session
-	fmt.Println(">>> [DEBUG] Calling initSession...") // 调试日志
-	ses, err := client.initSession()
-	if err != nil {
+	// Pool and batch sizes, default to a single session running one image at a time
+	client.SessionPoolSize = opt.SessionPoolSize
+	if client.SessionPoolSize < 1 {
+		client.SessionPoolSize = 1
+	}
+	client.MaxBatchSize = opt.MaxBatchSize
+	if client.MaxBatchSize < 1 {
+		client.MaxBatchSize = 1
+	}
+	client.KeepImages = opt.KeepImages
+	client.NormalizedBoxes = opt.NormalizedBoxes
+	client.IntraOpThreads = opt.IntraOpThreads
+	client.InterOpThreads = opt.InterOpThreads
+
+	// Load the shared library once, all sessions share the same environment
+	logger.Debug("Calling initEnvironment")
+	if err := client.initEnvironment(); err != nil {
+		return &Client{}, err
+	}
+
+	if opt.CropModelsOnly {
+		if client.Provider, err = client.firstProvider(); err != nil {
+			return &Client{}, err
+		}
+		return &client, nil
+	}
+
+	// Create session pool on the first provider that works
+	if err := client.initSessions(); err != nil {
 		return &Client{}, err
 	}
-	fmt.Println(">>> [DEBUG] Session initialized successfully!") // 调试日志
-	client.RuntimeSession = ses
 	return &client, nil
 }
 
+// Predict runs the model on a single image and returns boxes in the coordinates of imgRaw. It is safe to call from multiple goroutines,
+// concurrent calls are spread over the session pool.
 func (c *Client) Predict(imgRaw image.Image) ([]Object, *image.RGBA, error) {
-	input, img_width, img_height, resizedImage := c.prepareInput(imgRaw)
-	inputTensor := c.RuntimeSession.Input.GetData()
-
-	// inTensor := modelSes.Input.GetData()
-	copy(inputTensor, input)
-	err := c.RuntimeSession.Session.Run()
+	results, err := c.PredictBatch([]image.Image{imgRaw})
 	if err != nil {
-		return nil, nil, fmt.Errorf("error running session: %w", err)
+		return nil, nil, err
 	}
-
-	// === MODIFIED: Pass model dimensions to processOutput ===
-	objects := processOutput(c.RuntimeSession.Output.GetData(), img_width, img_height, c.ModelWidth, c.ModelHeight)
-	return objects, resizedImage, nil
+	return results[0].Objects, results[0].Image, nil
 }
 
-func (c *Client) initSession() (ModelSession, error) {
-	fmt.Println(">>> [DEBUG] inside initSession") // 调试日志
-	// Change dir to libExtractPath and then change back
-	cwd, err := os.Getwd()
+// PredictBatch runs the model on a slice of images and returns one Result per image in the same order.
+// Images are split into chunks of MaxBatchSize, chunks run in parallel on the free sessions of the pool.
+func (c *Client) PredictBatch(imgs []image.Image) ([]Result, error) {
+	results, err := c.predictBatch(imgs)
 	if err != nil {
-		return ModelSession{}, err
+		return nil, err
 	}
-	fmt.Println(">>> [DEBUG] Changing dir to lib path...")
-	err = os.Chdir(c.LibExtractPath) // Change dir to libExtractPath
-	if err != nil {
-		return ModelSession{}, err
+
+	if c.NormalizedBoxes {
+		for i := range results {
+			normalizeObjects(results[i].Objects, imgs[i].Bounds().Dx(), imgs[i].Bounds().Dy())
+		}
 	}
-	fmt.Printf(">>> [DEBUG] Loading Shared Library: %s\n", c.LibPath)
-	onnx.SetSharedLibraryPath(c.LibPath) // Set libPath
-	fmt.Println(">>> [DEBUG] Initializing ONNX Environment...")
-	err = onnx.InitializeEnvironment()
-	if err != nil {
-		return ModelSession{}, err
+	return results, nil
+}
+
+// predictBatch is PredictBatch with boxes always in pixels of each image
+func (c *Client) predictBatch(imgs []image.Image) ([]Result, error) {
+	results := make([]Result, len(imgs))
+	if len(imgs) == 0 {
+		return results, nil
 	}
-	fmt.Println(">>> [DEBUG] Environment Initialized.")
-	err = os.Chdir(cwd) // Change back to cwd
-	if err != nil {
-		return ModelSession{}, err
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var runErr error
+
+	for start := 0; start < len(imgs); start += c.MaxBatchSize {
+		end := start + c.MaxBatchSize
+		if end > len(imgs) {
+			end = len(imgs)
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+
+			ses, pool, err := c.acquire() // Wait for a free session
+			if err != nil {
+				errOnce.Do(func() { runErr = err })
+				return
+			}
+			defer func() { pool <- ses }()
+
+			err = c.runBatch(ses, imgs[start:end], results[start:end])
+			if err != nil {
+				errOnce.Do(func() { runErr = err })
+			}
+		}(start, end)
 	}
 
-	options, e := onnx.NewSessionOptions()
-	if e != nil {
-		return ModelSession{}, fmt.Errorf("error creating session options: %w", e)
+	wg.Wait()
+	if runErr != nil {
+		return nil, runErr
 	}
-	defer options.Destroy()
+	return results, nil
+}
 
-	switch {
-	case c.EnableCoreMl: // If CoreML is enabled, append the CoreML execution provider
-		e = options.AppendExecutionProviderCoreML(0)
-		if e != nil {
-			options.Destroy()
-			return ModelSession{}, err
-		}
-		defer options.Destroy()
-	case c.EnableCuda: // If CUDA is enabled, append the CUDA execution provider
-		cudaOptions, err := onnx.NewCUDAProviderOptions()
-		if err != nil {
-			return ModelSession{}, fmt.Errorf("error creating CUDA provider options: %w", err)
-		}
-		defer cudaOptions.Destroy()
+// runBatch feeds imgs through ses as one batch and writes the outcome into results
+func (c *Client) runBatch(ses *ModelSession, imgs []image.Image, results []Result) error {
+	timer := time.Now()
 
-		// This is a clunky API, but it reflects how the underlying C API sets CUDA options.
-		err = cudaOptions.Update(map[string]string{"device_id": fmt.Sprintf("%d", c.CudaDeviceID)})
-		if err != nil {
-			return ModelSession{}, fmt.Errorf("error updating CUDA provider options: %w", err)
+	modelWidth, modelHeight := ses.ModelWidth, ses.ModelHeight
+	tensors, err := ses.tensors(len(imgs), modelWidth, modelHeight)
+	if err != nil {
+		return err
+	}
+
+	// Letterbox every image straight into its slot of the input tensor
+	inputTensor := tensors.Input.GetData()
+	inputSize := 3 * modelWidth * modelHeight
+	for i, img := range imgs {
+		input := inputTensor[i*inputSize : (i+1)*inputSize]
+		results[i].Letterbox = ses.Preprocessor.Letterbox(img, input)
+		if c.KeepImages {
+			results[i].Image = TensorToRGBA(input, modelWidth, modelHeight)
 		}
+	}
 
-		options.AppendExecutionProviderCUDA(cudaOptions) // Append the CUDA execution provider
+	err = ses.Session.Run([]onnx.ArbitraryTensor{tensors.Input}, []onnx.ArbitraryTensor{tensors.Output})
+	if err != nil {
+		return fmt.Errorf("error running session: %w", err)
+	}
 
+	output := tensors.Output.GetData()
+	outputSize := 84 * numAnchors(modelWidth, modelHeight)
+	took := time.Since(timer)
+	for i := range imgs {
+		// === MODIFIED: Pass model dimensions to processOutput ===
+		results[i].Objects = processOutput(output[i*outputSize:(i+1)*outputSize], results[i].Letterbox, modelWidth, modelHeight)
+		results[i].Took = took
 	}
 
-	// Create and prepare a blank image
-	blankImage := CreateBlankImage(c.ModelWidth, c.ModelHeight)
-	input, _, _, _ := c.prepareInput(blankImage)
+	return nil
+}
+
+// tensors returns the input/output tensors for batchSize, creating them on first use
+func (s *ModelSession) tensors(batchSize, modelWidth, modelHeight int) (*ModelTensors, error) {
+	if t, ok := s.Tensors[batchSize]; ok {
+		return t, nil
+	}
 
 	// === MODIFIED: Dynamic Input Shape ===
-	inputShape := onnx.NewShape(1, 3, int64(c.ModelWidth), int64(c.ModelHeight))
-	inputTensor, err := onnx.NewTensor(inputShape, input)
+	inputShape := onnx.NewShape(int64(batchSize), 3, int64(modelWidth), int64(modelHeight))
+	inputTensor, err := onnx.NewEmptyTensor[float32](inputShape)
 	if err != nil {
-		return ModelSession{}, fmt.Errorf("error creating input tensor: %w", err)
+		return nil, fmt.Errorf("error creating input tensor: %w", err)
 	}
 
-	// === MODIFIED: Dynamic Anchor Calculation ===
-	// Calculate number of anchors based on resolution (Stride 8, 16, 32)
-	// For 640x640: 6400 + 1600 + 400 = 8400
-	// For 320x320: 1600 + 400 + 100 = 2100
-	w, h := c.ModelWidth, c.ModelHeight
-	numAnchors := (w/8)*(h/8) + (w/16)*(h/16) + (w/32)*(h/32)
-
-	// Output shape: [1, 84, numAnchors]
-	outputShape := onnx.NewShape(1, 84, int64(numAnchors))
+	// Output shape: [batch, 84, numAnchors]
+	outputShape := onnx.NewShape(int64(batchSize), 84, int64(numAnchors(modelWidth, modelHeight)))
 	outputTensor, err := onnx.NewEmptyTensor[float32](outputShape)
 	if err != nil {
-		return ModelSession{}, fmt.Errorf("error creating output tensor: %w", err)
-	}
-	fmt.Println(">>> [DEBUG] Creating Advanced Session (Loading Model)...")
-	session, err := onnx.NewAdvancedSession(c.ModelPath,
-		[]string{"images"}, []string{"output0"},
-		[]onnx.ArbitraryTensor{inputTensor}, []onnx.ArbitraryTensor{outputTensor}, options)
-    if err != nil {
-         fmt.Println(">>> [DEBUG] Session Creation FAILED")
-         return ModelSession{}, err
-    }
-	fmt.Println(">>> [DEBUG] Advanced Session Created.")
-	return ModelSession{
-		Session: session,
-		Input:   inputTensor,
-		Output:  outputTensor,
-	}, nil
-}
-
-func (c *Client) prepareInput(imageObj image.Image) ([]float32, int64, int64, *image.RGBA) {
-	// Get the original image size
-	imageSize := imageObj.Bounds().Size()
-	imageWidth, imageHeight := int64(imageSize.X), int64(imageSize.Y)
-
-	// Calculate new dimensions to preserve aspect ratio
-	ratio := math.Min(float64(c.ModelWidth)/float64(imageWidth), float64(c.ModelHeight)/float64(imageHeight))
-	newWidth := int(float64(imageWidth) * ratio)
-	newHeight := int(float64(imageHeight) * ratio)
-
-	// Create a new image with the model dimensions and fill it with a black background
-	paddedImage := image.NewRGBA(image.Rect(0, 0, c.ModelWidth, c.ModelHeight))
-	black := color.RGBA{0, 0, 0, 255}
-	draw.Draw(paddedImage, paddedImage.Bounds(), &image.Uniform{black}, image.Point{}, draw.Src)
-
-	// Resize the original image
-	resizedImage := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
-	draw.CatmullRom.Scale(resizedImage, resizedImage.Bounds(), imageObj, imageObj.Bounds(), draw.Over, nil)
-
-	// Calculate where to paste the resized image onto the black background
-	dx := (c.ModelWidth - newWidth) / 2
-	dy := (c.ModelHeight - newHeight) / 2
+		inputTensor.Destroy()
+		return nil, fmt.Errorf("error creating output tensor: %w", err)
+	}
 
-	rect := image.Rect(dx, dy, newWidth+dx, newHeight+dy)
-	draw.Draw(paddedImage, rect, resizedImage, image.Point{0, 0}, draw.Over)
+	t := &ModelTensors{Input: inputTensor, Output: outputTensor}
+	s.Tensors[batchSize] = t
+	return t, nil
+}
 
-	// Initialize slice to store the final input, pre-allocate memory
-	totalPixels := c.ModelWidth * c.ModelHeight
-	inputArray := make([]float32, totalPixels*3)
+// Destroy releases the session and all of its cached tensors
+func (s *ModelSession) Destroy() {
+	s.Session.Destroy()
+	for _, t := range s.Tensors {
+		t.Input.Destroy()
+		t.Output.Destroy()
+	}
+	s.Tensors = nil
+}
 
-	// Initialize a WaitGroup to track the completion of goroutines
-	var wg sync.WaitGroup
+// === MODIFIED: Dynamic Anchor Calculation ===
+// Calculate number of anchors based on resolution (Stride 8, 16, 32)
+// For 640x640: 6400 + 1600 + 400 = 8400
+// For 320x320: 1600 + 400 + 100 = 2100
+func numAnchors(w, h int) int {
+	return (w/8)*(h/8) + (w/16)*(h/16) + (w/32)*(h/32)
+}
 
-	// Define number of goroutines to use
-	numGoroutines := runtime.NumCPU()
+func (c *Client) initEnvironment() error {
+	logger.Debug("Inside initEnvironment")
+	if onnx.IsInitialized() {
+		// The library is loaded once per process, later clients (the detectors of a daemon) run on the first one
+		logger.Debug("Environment already initialized")
+		return nil
+	}
+	// Change dir to libExtractPath and then change back
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	logger.Debug("Changing dir to lib path")
+	if c.LibExtractPath != "" {
+		err = os.Chdir(c.LibExtractPath) // Change dir to libExtractPath
+		if err != nil {
+			return err
+		}
+	}
+	logger.Debug("Loading shared library", "path", c.LibPath)
+	onnx.SetSharedLibraryPath(c.LibPath) // Set libPath
+	logger.Debug("Initializing ONNX environment")
+	err = onnx.InitializeEnvironment()
+	if err != nil {
+		return err
+	}
+	logger.Debug("Environment initialized")
+	return os.Chdir(cwd) // Change back to cwd
+}
 
-	// Calculate rows per goroutine
-	rowsPerGoroutine := c.ModelHeight / numGoroutines
+func (c *Client) initSession(provider, modelPath string, modelWidth, modelHeight int) (*ModelSession, error) {
+	options, err := c.newSessionOptions(provider)
+	if err != nil {
+		return nil, err
+	}
+	defer options.Destroy()
 
-	for i := 0; i < numGoroutines; i++ {
-		// Calculate the start and end rows for this goroutine
-		startY := i * rowsPerGoroutine
-		endY := (i + 1) * rowsPerGoroutine
-		if i == numGoroutines-1 {
-			endY = c.ModelHeight
+	logger.Debug("Creating dynamic session (loading model)")
+	session, err := onnx.NewDynamicAdvancedSession(modelPath,
+		[]string{"images"}, []string{"output0"}, options)
+	if err != nil {
+		logger.Debug("Session creation failed")
+		return nil, err
+	}
+
+	ses := &ModelSession{
+		ModelWidth:   modelWidth,
+		ModelHeight:  modelHeight,
+		Session:      session,
+		Tensors:      map[int]*ModelTensors{},
+		Preprocessor: NewPreprocessor(modelWidth, modelHeight),
+	}
+
+	// Pre-create batch 1 tensors and warm up the session with a blank image
+	err = c.runWarmup(ses)
+	if err != nil {
+		ses.Destroy()
+		return nil, err
+	}
+	logger.Debug("Dynamic session created")
+	return ses, nil
+}
+
+// runWarmup runs a blank image through ses so the first real frame doesnt pay for provider setup
+func (c *Client) runWarmup(ses *ModelSession) error {
+	blankImage := CreateBlankImage(ses.ModelWidth, ses.ModelHeight)
+	return c.runBatch(ses, []image.Image{blankImage}, make([]Result, 1))
+}
+
+func destroySessions(sessions []*ModelSession) {
+	for _, ses := range sessions {
+		ses.Destroy()
+	}
+}
+
+// acquire waits for a free session. The pool it was taken from is returned as well, the session has to go back
+// there even if SwapModel replaced the pool in the meantime.
+func (c *Client) acquire() (*ModelSession, chan *ModelSession, error) {
+	for {
+		c.mu.RLock()
+		pool := c.pool
+		c.mu.RUnlock()
+		if pool == nil {
+			return nil, nil, fmt.Errorf("client is closed")
 		}
 
-		wg.Add(1)
+		// A closed pool was drained by SwapModel, retry on the new one
+		if ses, ok := <-pool; ok {
+			return ses, pool, nil
+		}
+	}
+}
 
-		go func(startY, endY int) {
-			defer wg.Done()
+// drainPool waits for every session to be returned to pool, closes it and destroys the sessions
+func drainPool(sessions []*ModelSession, pool chan *ModelSession) {
+	for range sessions {
+		<-pool
+	}
+	close(pool)
+	destroySessions(sessions)
+}
 
-			var pixelColor color.Color
-			var r, g, b uint32
+// SwapModel loads model (a path, cached or embedded name) on the active provider and replaces the running one.
+// Predictions keep running on the old sessions until the new ones are ready, the old sessions are destroyed
+// once every in-flight call has returned them. On error the current model stays active.
+func (c *Client) SwapModel(model string, modelWidth, modelHeight int) error {
+	if modelWidth == 0 {
+		modelWidth = 640
+	}
+	if modelHeight == 0 {
+		modelHeight = 640
+	}
 
-			for y := startY; y < endY; y++ {
-				for x := 0; x < c.ModelWidth; x++ {
-					pixelColor = paddedImage.At(x, y)
-					r, g, b, _ = pixelColor.RGBA()
+	modelPath, err := c.Models.Resolve(model)
+	if err != nil {
+		return err
+	}
 
-					redIdx := y*c.ModelWidth + x
-					greenIdx := redIdx + c.ModelWidth*c.ModelHeight
-					blueIdx := greenIdx + c.ModelWidth*c.ModelHeight
+	sessions, pool, err := c.newPool(c.Provider, modelPath, modelWidth, modelHeight)
+	if err != nil {
+		return fmt.Errorf("error loading model %s, keeping the current one: %w", model, err)
+	}
 
-					inputArray[redIdx] = float32(r/257) / 255.0
-					inputArray[greenIdx] = float32(g/257) / 255.0
-					inputArray[blueIdx] = float32(b/257) / 255.0
-				}
-			}
-		}(startY, endY)
+	c.mu.Lock()
+	if c.pool == nil {
+		c.mu.Unlock()
+		destroySessions(sessions)
+		return fmt.Errorf("client is closed")
 	}
+	oldSessions, oldPool := c.Sessions, c.pool
+	c.ModelPath, c.ModelWidth, c.ModelHeight = modelPath, modelWidth, modelHeight
+	c.Sessions, c.pool = sessions, pool
+	c.mu.Unlock()
 
-	// Wait for all goroutines to complete
-	wg.Wait()
+	drainPool(oldSessions, oldPool)
+	return nil
+}
 
-	return inputArray, int64(c.ModelWidth), int64(c.ModelHeight), paddedImage
+// ModelSize returns the input size of the active model, it changes with SwapModel
+func (c *Client) ModelSize() (int, int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ModelWidth, c.ModelHeight
 }
 
 // === MODIFIED: Dynamic Process Output logic ===
-func processOutput(output []float32, imgWidth, imgHeight int64, modelWidth, modelHeight int) []Object {
+// Boxes are mapped from model space back to the original image through lb, undoing the letterbox.
+func processOutput(output []float32, lb Letterbox, modelWidth, modelHeight int) []Object {
+	return NonMaxSuppression(decodeYolo(output, Yolo_classes, 0.5, lb, modelWidth, modelHeight), 0.7, false)
+}
+
+// decodeYolo reads the boxes of a YOLOv8 style [4+len(classNames), anchors] output above minConfidence
+func decodeYolo(output []float32, classNames []string, minConfidence float32, lb Letterbox, modelWidth, modelHeight int) []Object {
 	objects := []Object{}
 
 	// Calculate dynamic anchor count
-	w, h := modelWidth, modelHeight
-	numAnchors := (w/8)*(h/8) + (w/16)*(h/16) + (w/32)*(h/32)
+	numAnchors := numAnchors(modelWidth, modelHeight)
+	numClasses := len(classNames)
 
 	// Safety check
-	expectedLen := 84 * numAnchors
+	expectedLen := (4 + numClasses) * numAnchors
 	if len(output) < expectedLen {
-		fmt.Printf("Warning: Output tensor size mismatch. Expected >= %d, got %d. Check Model Resolution setting.\n", expectedLen, len(output))
+		logger.Warn("Output tensor size mismatch, check the model resolution setting", "expected", expectedLen, "got", len(output))
 		return objects
 	}
 
 	for idx := 0; idx < numAnchors; idx++ {
 		classID, probability := 0, float32(0.0)
-		for col := 0; col < 80; col++ {
+		for col := 0; col < numClasses; col++ {
 			// Using numAnchors as stride
 			currentProb := output[numAnchors*(col+4)+idx]
 			if currentProb > probability {
@@ -402,11 +558,11 @@ func processOutput(output []float32, imgWidth, imgHeight int64, modelWidth, mode
 			}
 		}
 
-		if probability < 0.5 {
+		if probability < minConfidence {
 			continue
 		}
 
-		label := Yolo_classes[classID]
+		label := classNames[classID]
 
 		// Using numAnchors as stride
 		xc := output[idx]
@@ -414,18 +570,22 @@ func processOutput(output []float32, imgWidth, imgHeight int64, modelWidth, mode
 		w := output[2*numAnchors+idx]
 		h := output[3*numAnchors+idx]
 
-		// Normalize using model dimensions, not hardcoded 640
-		x1 := (xc - w/2) / float32(modelWidth) * float32(imgWidth)
-		y1 := (yc - h/2) / float32(modelHeight) * float32(imgHeight)
-		x2 := (xc + w/2) / float32(modelWidth) * float32(imgWidth)
-		y2 := (yc + h/2) / float32(modelHeight) * float32(imgHeight)
+		// Undo the letterbox so boxes line up with the original image
+		x1, y1 := lb.ToSource(xc-w/2, yc-h/2)
+		x2, y2 := lb.ToSource(xc+w/2, yc+h/2)
 
 		objects = append(objects, Object{ClassName: label, ClassID: classID, Confidence: probability, X1: x1, Y1: y1, X2: x2, Y2: y2})
 	}
 
-	// Sort the objects by confidence
-	sort.Slice(objects, func(i, j int) bool {
-		return objects[i].Confidence < objects[j].Confidence
+	return objects
+}
+
+// NonMaxSuppression keeps the most confident box out of every group of boxes overlapping by more than iouThreshold.
+// With classAware only boxes of the same class suppress each other.
+func NonMaxSuppression(objects []Object, iouThreshold float64, classAware bool) []Object {
+	// Sort the objects by confidence, most confident first
+	sort.SliceStable(objects, func(i, j int) bool {
+		return objects[i].Confidence > objects[j].Confidence
 	})
 
 	// Define a slice to hold the final result
@@ -437,7 +597,7 @@ func processOutput(output []float32, imgWidth, imgHeight int64, modelWidth, mode
 		result = append(result, firstObject)
 		tmp := []Object{}
 		for _, object := range objects[1:] { // Skip the first object
-			if iou(firstObject, object) < 0.7 {
+			if (classAware && object.ClassID != firstObject.ClassID) || iou(firstObject, object) < iouThreshold {
 				tmp = append(tmp, object)
 			}
 		}
@@ -447,6 +607,16 @@ func processOutput(output []float32, imgWidth, imgHeight int64, modelWidth, mode
 	return result
 }
 
+// normalizeObjects converts pixel boxes to 0-1 fractions of a width x height image in place
+func normalizeObjects(objects []Object, width, height int) {
+	for i := range objects {
+		objects[i].X1 /= float32(width)
+		objects[i].X2 /= float32(width)
+		objects[i].Y1 /= float32(height)
+		objects[i].Y2 /= float32(height)
+	}
+}
+
 func iou(box1, box2 Object) float64 {
 	// Calculate the area of intersection between the two bounding boxes using the intersection function
 	intersectArea := intersection(box1, box2)
@@ -587,82 +757,22 @@ func extractLibs(data []byte, tempBasePath string) (string, error) {
 	return tempDir, nil
 }
 
-func extractModels(embedFS embed.FS, tempBasePath string) (string, error) {
-	// Remove if exists and recreate a dir named objectPredictLibs.f4fc215193baa83 in tempBasePath
-	tempDir := filepath.Join(tempBasePath, "objectPredictModels.a30da82de8eae8")
-	if err := os.RemoveAll(tempDir); err != nil {
-		return "", err
-	}
-	if err := os.MkdirAll(tempDir, os.ModePerm); err != nil {
-		return "", err
-	}
-
-	// Recursive function to extract files and directories
-	var walkDir func(fs.FS, string, string) error
-	walkDir = func(fsys fs.FS, path string, currentTempDir string) error {
-		dir, err := fs.ReadDir(fsys, path)
-		if err != nil {
-			return err
-		}
-
-		for _, entry := range dir {
-			entryName := entry.Name()
-			sourcePath := filepath.Join(path, entryName)
-			destPath := filepath.Join(currentTempDir, entryName)
-
-			if entry.IsDir() {
-				if err := os.MkdirAll(destPath, os.ModePerm); err != nil {
-					return err
-				}
-				if err := walkDir(fsys, sourcePath, destPath); err != nil {
-					return err
-				}
-			} else {
-				srcFile, err := fsys.Open(sourcePath)
-				if err != nil {
-					return err
-				}
-				defer srcFile.Close()
-
-				destFile, err := os.Create(destPath)
-				if err != nil {
-					return err
-				}
-				defer destFile.Close()
-
-				if _, err := io.Copy(destFile, srcFile); err != nil {
-					return err
-				}
-			}
-		}
-		return nil
-	}
-
-	if err := walkDir(embedFS, ".", tempDir); err != nil {
-		return "", err
-	}
-
-	return tempDir, nil
-}
-
 func (c *Client) Close() {
 	// Cleanup temp dir
 	if c.LibExtractPath != "" {
 		if err := os.RemoveAll(c.LibExtractPath); err != nil {
-			fmt.Println("Warning: error removing LibExtractPath:", err)
+			logger.Warn("Error removing LibExtractPath", "error", err)
 		}
 	}
 
-	// Cleanup temp dir for model
-	if c.ModelBasePath != "" {
-		if err := os.RemoveAll(c.ModelBasePath); err != nil {
-			fmt.Println("Warning: error removing ModelBasePath:", err)
-		}
+	// Wait for in-flight predictions to return their sessions before destroying them
+	c.mu.Lock()
+	sessions, pool := c.Sessions, c.pool
+	c.Sessions, c.pool = nil, nil
+	c.mu.Unlock()
+	if pool != nil {
+		drainPool(sessions, pool) // Cleanup sessions and tensors
 	}
-
-	c.RuntimeSession.Session.Destroy() // Cleanup session
-	c.RuntimeSession.Input.Destroy()   // Cleanup input
-	c.RuntimeSession.Output.Destroy()  // Cleanup output
 }
 
 func CreateBlankImage(width, height int) image.Image {
@@ -740,7 +850,7 @@ func AddLabelWithTTF(img draw.Image, text string, pt image.Point, textColor colo
 		Y: fixed.I(pt.Y),
 	})
 	if err != nil {
-		log.Printf("Error drawing string: %v", err)
+		logger.Error("Error drawing string", "error", err)
 	}
 }
 
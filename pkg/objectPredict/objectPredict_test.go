@@ -0,0 +1,73 @@
+package objectPredict
+
+import (
+	"math"
+	"testing"
+)
+
+// fakeOutput builds a model output with a single confident anchor at the given model space box
+func fakeOutput(modelWidth, modelHeight, classID int, xc, yc, w, h float32) []float32 {
+	anchors := numAnchors(modelWidth, modelHeight)
+	output := make([]float32, 84*anchors)
+	output[0] = xc
+	output[anchors] = yc
+	output[2*anchors] = w
+	output[3*anchors] = h
+	output[(4+classID)*anchors] = 0.9
+	return output
+}
+
+func TestProcessOutputUndoesLetterbox(t *testing.T) {
+	// 1920x1080 in 640x640: scaled to 640x360, 140px padding on top
+	lb := NewLetterbox(1920, 1080, 640, 640)
+
+	// Box covering the middle quarter of the scaled frame
+	output := fakeOutput(640, 640, 0, 320, 320, 320, 180)
+	objects := processOutput(output, lb, 640, 640)
+	if len(objects) != 1 {
+		t.Fatalf("expected 1 object, got %d", len(objects))
+	}
+
+	want := Object{ClassName: "person", X1: 480, Y1: 270, X2: 1440, Y2: 810}
+	got := objects[0]
+	if got.ClassName != want.ClassName {
+		t.Errorf("expected class %s, got %s", want.ClassName, got.ClassName)
+	}
+	for _, pair := range [][2]float32{{got.X1, want.X1}, {got.Y1, want.Y1}, {got.X2, want.X2}, {got.Y2, want.Y2}} {
+		if math.Abs(float64(pair[0]-pair[1])) > 0.5 {
+			t.Errorf("expected box %v,%v,%v,%v got %v,%v,%v,%v", want.X1, want.Y1, want.X2, want.Y2, got.X1, got.Y1, got.X2, got.Y2)
+			break
+		}
+	}
+
+	// Same box normalized
+	objects = processOutput(output, lb, 640, 640)
+	normalizeObjects(objects, 1920, 1080)
+	got = objects[0]
+	if math.Abs(float64(got.X1-0.25)) > 1e-3 || math.Abs(float64(got.Y1-0.25)) > 1e-3 || math.Abs(float64(got.X2-0.75)) > 1e-3 || math.Abs(float64(got.Y2-0.75)) > 1e-3 {
+		t.Errorf("expected normalized box 0.25,0.25,0.75,0.75 got %v,%v,%v,%v", got.X1, got.Y1, got.X2, got.Y2)
+	}
+}
+
+func TestNonMaxSuppressionKeepsMostConfident(t *testing.T) {
+	objects := []Object{
+		{ClassID: 0, Confidence: 0.6, X1: 0, Y1: 0, X2: 100, Y2: 100},
+		{ClassID: 0, Confidence: 0.9, X1: 5, Y1: 5, X2: 105, Y2: 105},
+		{ClassID: 2, Confidence: 0.8, X1: 0, Y1: 0, X2: 100, Y2: 100},
+		{ClassID: 0, Confidence: 0.7, X1: 300, Y1: 300, X2: 400, Y2: 400},
+	}
+
+	result := NonMaxSuppression(append([]Object{}, objects...), 0.5, true)
+	if len(result) != 3 {
+		t.Fatalf("expected 3 objects, got %d: %v", len(result), result)
+	}
+	if result[0].Confidence != 0.9 {
+		t.Errorf("expected the most confident box first, got %v", result[0])
+	}
+
+	// Class agnostic, the car box is suppressed by the person box too
+	result = NonMaxSuppression(append([]Object{}, objects...), 0.5, false)
+	if len(result) != 2 {
+		t.Fatalf("expected 2 objects, got %d: %v", len(result), result)
+	}
+}
@@ -0,0 +1,235 @@
+package objectPredict
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"unicode"
+)
+
+// PlateReaderConfig configures the licence plate pipeline: a plate detector on vehicle crops followed by OCR on every plate
+type PlateReaderConfig struct {
+	Detector           CropModelConfig // YOLOv8 style single class plate detector, OutputSize is derived from the model size
+	DetectorConfidence float32         // Minimum plate box confidence, defaults to 0.4
+	OCR                CropModelConfig // OCR model run on each plate crop, OutputSize is derived from Alphabet and Length
+	Alphabet           string          // Characters of the OCR output in model order
+	Length             int             // Character slots of a fixed length model, or time steps of a CTC model
+	CTC                bool            // Output is [Length, 1+len(Alphabet)] with the CTC blank at index 0 instead of [Length, len(Alphabet)] slots
+	PadChar            rune            // Alphabet character used for empty slots, defaults to '_'
+	Softmax            bool            // Apply softmax per slot/step, for models that output raw logits
+}
+
+// PlateRead is a single plate found by a PlateReader
+type PlateRead struct {
+	Text       string
+	Confidence float32         // Lowest character confidence, a single bad character makes the read unreliable
+	Box        image.Rectangle // Plate box in the coordinates of the image passed to Read
+}
+
+// PlateReader finds and reads licence plates
+type PlateReader struct {
+	Config   PlateReaderConfig
+	detector *CropModel
+	ocr      *CropModel
+}
+
+// NewPlateReader loads the plate detector and OCR models on the detector environment and provider
+func (c *Client) NewPlateReader(cfg PlateReaderConfig) (*PlateReader, error) {
+	if cfg.Alphabet == "" || cfg.Length <= 0 {
+		return nil, fmt.Errorf("plate reader: alphabet and length must be set")
+	}
+	if cfg.DetectorConfidence == 0 {
+		cfg.DetectorConfidence = 0.4
+	}
+	if cfg.PadChar == 0 {
+		cfg.PadChar = '_'
+	}
+
+	// Detector defaults match a YOLOv8 export, like the main model
+	if cfg.Detector.ModelWidth == 0 {
+		cfg.Detector.ModelWidth = 640
+	}
+	if cfg.Detector.ModelHeight == 0 {
+		cfg.Detector.ModelHeight = 640
+	}
+	if cfg.Detector.InputName == "" {
+		cfg.Detector.InputName = "images"
+	}
+	if cfg.Detector.OutputName == "" {
+		cfg.Detector.OutputName = "output0"
+	}
+	cfg.Detector.OutputSize = 5 * numAnchors(cfg.Detector.ModelWidth, cfg.Detector.ModelHeight)
+	cfg.OCR.OutputSize = cfg.Length * ocrClasses(cfg)
+
+	detector, err := c.NewCropModel(cfg.Detector)
+	if err != nil {
+		return nil, err
+	}
+	ocr, err := c.NewCropModel(cfg.OCR)
+	if err != nil {
+		detector.Close()
+		return nil, err
+	}
+	return &PlateReader{Config: cfg, detector: detector, ocr: ocr}, nil
+}
+
+// Read finds the plates in img, typically the crop of a vehicle, and reads them
+func (p *PlateReader) Read(img image.Image) ([]PlateRead, error) {
+	output, lb, err := p.detector.run(img)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := p.Config.Detector
+	boxes := decodeYolo(output, []string{"plate"}, p.Config.DetectorConfidence, lb, cfg.ModelWidth, cfg.ModelHeight)
+	boxes = NonMaxSuppression(boxes, 0.5, false)
+
+	bounds := img.Bounds()
+	var reads []PlateRead
+	for _, box := range boxes {
+		rect := image.Rect(int(box.X1), int(box.Y1), int(box.X2), int(box.Y2)).Add(bounds.Min).Intersect(bounds)
+		if rect.Empty() {
+			continue
+		}
+
+		output, err := p.ocr.Run(cropImage(img, rect))
+		if err != nil {
+			return nil, err
+		}
+
+		text, confidence := decodePlate(output, p.Config)
+		if text == "" {
+			continue
+		}
+		reads = append(reads, PlateRead{Text: text, Confidence: confidence, Box: rect})
+	}
+	return reads, nil
+}
+
+func (p *PlateReader) Close() {
+	p.detector.Close()
+	p.ocr.Close()
+}
+
+func ocrClasses(cfg PlateReaderConfig) int {
+	classes := len([]rune(cfg.Alphabet))
+	if cfg.CTC {
+		classes++ // Blank
+	}
+	return classes
+}
+
+// decodePlate turns the OCR output into text, taking the best class of every slot/step
+func decodePlate(output []float32, cfg PlateReaderConfig) (string, float32) {
+	alphabet := []rune(cfg.Alphabet)
+	classes := ocrClasses(cfg)
+
+	var text strings.Builder
+	confidence := float32(1)
+	previous := -1
+	for step := 0; step < cfg.Length && (step+1)*classes <= len(output); step++ {
+		scores := output[step*classes : (step+1)*classes]
+		if cfg.Softmax {
+			scores = softmaxOf(scores)
+		}
+
+		best := 0
+		for i := range scores {
+			if scores[i] > scores[best] {
+				best = i
+			}
+		}
+
+		if cfg.CTC {
+			// Collapse repeats, then drop blanks
+			repeated := best == previous
+			previous = best
+			if best == 0 || repeated {
+				continue
+			}
+			text.WriteRune(alphabet[best-1])
+		} else {
+			if alphabet[best] == cfg.PadChar {
+				continue
+			}
+			text.WriteRune(alphabet[best])
+		}
+		confidence = min(confidence, scores[best])
+	}
+
+	if text.Len() == 0 {
+		return "", 0
+	}
+	return text.String(), confidence
+}
+
+// NormalizePlate uppercases a plate and strips everything but letters and digits, so "ab-123 c" matches "AB123C"
+func NormalizePlate(plate string) string {
+	var out strings.Builder
+	for _, r := range strings.ToUpper(plate) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+// PlateDistance is the edit distance between two normalized plates, used to tolerate a misread character
+func PlateDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// PlateVotes accumulates reads of the same vehicle across frames. Every read votes for its normalized text
+// with its confidence, so a single misread frame is outvoted by the consistent ones.
+type PlateVotes struct {
+	Scores map[string]float32
+	Counts map[string]int
+	Reads  int
+}
+
+func NewPlateVotes() *PlateVotes {
+	return &PlateVotes{Scores: map[string]float32{}, Counts: map[string]int{}}
+}
+
+// Add counts a read, reads that normalize to nothing are ignored
+func (v *PlateVotes) Add(text string, confidence float32) {
+	text = NormalizePlate(text)
+	if text == "" {
+		return
+	}
+	v.Scores[text] += confidence
+	v.Counts[text]++
+	v.Reads++
+}
+
+// Best returns the text with the highest summed confidence, its mean confidence and how many reads voted for it
+func (v *PlateVotes) Best() (string, float32, int) {
+	best := ""
+	for text, score := range v.Scores {
+		if best == "" || score > v.Scores[best] || (score == v.Scores[best] && text < best) {
+			best = text
+		}
+	}
+	if best == "" {
+		return "", 0, 0
+	}
+	return best, v.Scores[best] / float32(v.Counts[best]), v.Counts[best]
+}
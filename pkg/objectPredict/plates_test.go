@@ -0,0 +1,65 @@
+package objectPredict
+
+import (
+	"testing"
+)
+
+// oneHot builds an OCR output picking the given class per step
+func oneHot(classes int, picks ...int) []float32 {
+	output := make([]float32, classes*len(picks))
+	for step, pick := range picks {
+		output[step*classes+pick] = 0.9
+	}
+	return output
+}
+
+func TestDecodePlateSlots(t *testing.T) {
+	cfg := PlateReaderConfig{Alphabet: "AB12_", Length: 5, PadChar: '_'}
+	// A 1 B 2 _
+	text, confidence := decodePlate(oneHot(5, 0, 2, 1, 3, 4), cfg)
+	if text != "A1B2" || confidence != 0.9 {
+		t.Errorf("expected A1B2 0.9, got %s %v", text, confidence)
+	}
+}
+
+func TestDecodePlateCTC(t *testing.T) {
+	cfg := PlateReaderConfig{Alphabet: "AB12", Length: 7, CTC: true}
+	// A A blank A 1 1 blank -> AA1
+	text, _ := decodePlate(oneHot(5, 1, 1, 0, 1, 3, 3, 0), cfg)
+	if text != "AA1" {
+		t.Errorf("expected AA1, got %s", text)
+	}
+}
+
+func TestPlateVotes(t *testing.T) {
+	votes := NewPlateVotes()
+	votes.Add("ab-123", 0.8)
+	votes.Add("AB 123", 0.7)
+	votes.Add("A8123", 0.95) // Single misread
+	votes.Add("--", 0.9)     // Normalizes to nothing
+
+	text, confidence, count := votes.Best()
+	if text != "AB123" || count != 2 || votes.Reads != 3 {
+		t.Errorf("expected AB123 with 2 of 3 votes, got %s %d of %d", text, count, votes.Reads)
+	}
+	if confidence < 0.74 || confidence > 0.76 {
+		t.Errorf("expected mean confidence 0.75, got %v", confidence)
+	}
+}
+
+func TestPlateDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"AB123", "AB123", 0},
+		{"AB123", "A8123", 1},
+		{"AB123", "AB1234", 1},
+		{"", "ABC", 3},
+	}
+	for _, test := range tests {
+		if got := PlateDistance(test.a, test.b); got != test.want {
+			t.Errorf("PlateDistance(%s, %s) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
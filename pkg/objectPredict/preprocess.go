@@ -0,0 +1,284 @@
+package objectPredict
+
+import (
+	"image"
+)
+
+// Letterbox describes how a source frame was scaled and padded to fit the model input.
+// Boxes predicted in model space can be mapped back to the source frame with ToSource.
+type Letterbox struct {
+	SrcWidth  int
+	SrcHeight int
+	Width     int     // Width of the scaled frame inside the model input
+	Height    int     // Height of the scaled frame inside the model input
+	OffsetX   int     // Left padding
+	OffsetY   int     // Top padding
+	ScaleX    float64 // Model pixels per source pixel, horizontally
+	ScaleY    float64 // Model pixels per source pixel, vertically
+}
+
+// NewLetterbox calculates the letterbox of a srcWidth x srcHeight frame in a modelWidth x modelHeight input.
+// The math matches RemovePadding so both agree on where the frame sits.
+func NewLetterbox(srcWidth, srcHeight, modelWidth, modelHeight int) Letterbox {
+	ratio := min(float64(modelWidth)/float64(srcWidth), float64(modelHeight)/float64(srcHeight))
+	newWidth := int(float64(srcWidth) * ratio)
+	newHeight := int(float64(srcHeight) * ratio)
+
+	return Letterbox{
+		SrcWidth:  srcWidth,
+		SrcHeight: srcHeight,
+		Width:     newWidth,
+		Height:    newHeight,
+		OffsetX:   (modelWidth - newWidth) / 2,
+		OffsetY:   (modelHeight - newHeight) / 2,
+		ScaleX:    float64(newWidth) / float64(srcWidth),
+		ScaleY:    float64(newHeight) / float64(srcHeight),
+	}
+}
+
+// ToSource maps a point from model space back to the source frame, clamped to the frame
+func (l Letterbox) ToSource(x, y float32) (float32, float32) {
+	sx := (float64(x) - float64(l.OffsetX)) / l.ScaleX
+	sy := (float64(y) - float64(l.OffsetY)) / l.ScaleY
+	sx = max(0, min(sx, float64(l.SrcWidth)))
+	sy = max(0, min(sy, float64(l.SrcHeight)))
+	return float32(sx), float32(sy)
+}
+
+// bilinearTap holds the two source indexes and the weight of the second one for a destination pixel
+type bilinearTap struct {
+	i0, i1 int
+	w      float32
+}
+
+// letterboxTables caches the sampling taps for one source size
+type letterboxTables struct {
+	lb Letterbox
+	xs []bilinearTap
+	ys []bilinearTap
+}
+
+// Preprocessor letterboxes frames straight into a model input tensor (planar RGB, 0-1 floats).
+// *image.RGBA and *image.YCbCr are read directly from Pix, other image types fall back to At().
+// Sampling tables are cached per source size so repeated frames dont allocate.
+// A Preprocessor is not safe for concurrent use, each session owns one.
+type Preprocessor struct {
+	ModelWidth  int
+	ModelHeight int
+	tables      map[image.Point]*letterboxTables
+}
+
+func NewPreprocessor(modelWidth, modelHeight int) *Preprocessor {
+	return &Preprocessor{
+		ModelWidth:  modelWidth,
+		ModelHeight: modelHeight,
+		tables:      map[image.Point]*letterboxTables{},
+	}
+}
+
+// Letterbox scales img into dst which must hold 3*ModelWidth*ModelHeight floats and returns the letterbox used
+func (p *Preprocessor) Letterbox(img image.Image, dst []float32) Letterbox {
+	size := img.Bounds().Size()
+	t := p.tablesFor(size)
+
+	plane := p.ModelWidth * p.ModelHeight
+	r, g, b := dst[:plane], dst[plane:2*plane], dst[2*plane:3*plane]
+	p.clearPadding(t.lb, r, g, b)
+
+	switch src := img.(type) {
+	case *image.RGBA:
+		p.fromRGBA(src, t, r, g, b)
+	case *image.YCbCr:
+		p.fromYCbCr(src, t, r, g, b)
+	default:
+		p.fromImage(src, t, r, g, b)
+	}
+
+	return t.lb
+}
+
+func (p *Preprocessor) tablesFor(size image.Point) *letterboxTables {
+	if t, ok := p.tables[size]; ok {
+		return t
+	}
+
+	lb := NewLetterbox(size.X, size.Y, p.ModelWidth, p.ModelHeight)
+	t := &letterboxTables{
+		lb: lb,
+		xs: bilinearTaps(lb.Width, size.X, lb.ScaleX),
+		ys: bilinearTaps(lb.Height, size.Y, lb.ScaleY),
+	}
+	p.tables[size] = t
+	return t
+}
+
+// bilinearTaps calculates the source taps for n destination pixels sampling a src sized axis at scale
+func bilinearTaps(n, src int, scale float64) []bilinearTap {
+	taps := make([]bilinearTap, n)
+	for i := range taps {
+		// Sample at the pixel center
+		pos := (float64(i)+0.5)/scale - 0.5
+		if pos < 0 {
+			pos = 0
+		}
+		i0 := int(pos)
+		if i0 > src-1 {
+			i0 = src - 1
+		}
+		i1 := i0 + 1
+		if i1 > src-1 {
+			i1 = src - 1
+		}
+		taps[i] = bilinearTap{i0: i0, i1: i1, w: float32(pos - float64(i0))}
+	}
+	return taps
+}
+
+// clearPadding zeroes (black) the area around the scaled frame
+func (p *Preprocessor) clearPadding(lb Letterbox, planes ...[]float32) {
+	w := p.ModelWidth
+	for _, plane := range planes {
+		clear(plane[:lb.OffsetY*w])
+		clear(plane[(lb.OffsetY+lb.Height)*w:])
+		for y := lb.OffsetY; y < lb.OffsetY+lb.Height; y++ {
+			row := plane[y*w : (y+1)*w]
+			clear(row[:lb.OffsetX])
+			clear(row[lb.OffsetX+lb.Width:])
+		}
+	}
+}
+
+func lerp(a, b, w float32) float32 {
+	return a + (b-a)*w
+}
+
+func (p *Preprocessor) fromRGBA(src *image.RGBA, t *letterboxTables, r, g, b []float32) {
+	const norm = 1.0 / 255.0
+	lb := t.lb
+	pix := src.Pix // Pix[0] is Rect.Min, taps are relative to it
+
+	for dy, ty := range t.ys {
+		row0 := ty.i0 * src.Stride
+		row1 := ty.i1 * src.Stride
+		out := (lb.OffsetY+dy)*p.ModelWidth + lb.OffsetX
+
+		for dx, tx := range t.xs {
+			c0 := tx.i0 * 4
+			c1 := tx.i1 * 4
+			p00, p01 := pix[row0+c0:row0+c0+3], pix[row0+c1:row0+c1+3]
+			p10, p11 := pix[row1+c0:row1+c0+3], pix[row1+c1:row1+c1+3]
+
+			i := out + dx
+			r[i] = lerp(lerp(float32(p00[0]), float32(p01[0]), tx.w), lerp(float32(p10[0]), float32(p11[0]), tx.w), ty.w) * norm
+			g[i] = lerp(lerp(float32(p00[1]), float32(p01[1]), tx.w), lerp(float32(p10[1]), float32(p11[1]), tx.w), ty.w) * norm
+			b[i] = lerp(lerp(float32(p00[2]), float32(p01[2]), tx.w), lerp(float32(p10[2]), float32(p11[2]), tx.w), ty.w) * norm
+		}
+	}
+}
+
+// ycbcrToRGB converts with the same constants as image/color, in float32 to skip the rounding
+func ycbcrToRGB(y, cb, cr uint8) (float32, float32, float32) {
+	fy := float32(y)
+	fcb := float32(cb) - 128
+	fcr := float32(cr) - 128
+	return clamp255(fy + 1.40200*fcr), clamp255(fy - 0.34414*fcb - 0.71414*fcr), clamp255(fy + 1.77200*fcb)
+}
+
+func clamp255(v float32) float32 {
+	return max(0, min(v, 255))
+}
+
+// ycbcrShifts returns how many bits x and y are shifted to address the chroma planes
+func ycbcrShifts(ratio image.YCbCrSubsampleRatio) (uint, uint) {
+	switch ratio {
+	case image.YCbCrSubsampleRatio422:
+		return 1, 0
+	case image.YCbCrSubsampleRatio420:
+		return 1, 1
+	case image.YCbCrSubsampleRatio440:
+		return 0, 1
+	case image.YCbCrSubsampleRatio411:
+		return 2, 0
+	case image.YCbCrSubsampleRatio410:
+		return 2, 1
+	default:
+		return 0, 0
+	}
+}
+
+func (p *Preprocessor) fromYCbCr(src *image.YCbCr, t *letterboxTables, r, g, b []float32) {
+	const norm = 1.0 / 255.0
+	lb := t.lb
+	minX, minY := src.Rect.Min.X, src.Rect.Min.Y
+	sx, sy := ycbcrShifts(src.SubsampleRatio)
+
+	// Same addressing as YCbCr.YOffset/COffset, inlined
+	yRow := func(y int) int { return (y - minY) * src.YStride }
+	cRow := func(y int) int { return ((y >> sy) - (minY >> sy)) * src.CStride }
+	cCol := func(x int) int { return (x >> sx) - (minX >> sx) }
+
+	for dy, ty := range t.ys {
+		y0, y1 := ty.i0+minY, ty.i1+minY
+		yr0, yr1 := yRow(y0), yRow(y1)
+		cr0, cr1 := cRow(y0), cRow(y1)
+		out := (lb.OffsetY+dy)*p.ModelWidth + lb.OffsetX
+
+		for dx, tx := range t.xs {
+			x0, x1 := tx.i0+minX, tx.i1+minX
+			cc0, cc1 := cCol(x0), cCol(x1)
+
+			r00, g00, b00 := ycbcrToRGB(src.Y[yr0+tx.i0], src.Cb[cr0+cc0], src.Cr[cr0+cc0])
+			r01, g01, b01 := ycbcrToRGB(src.Y[yr0+tx.i1], src.Cb[cr0+cc1], src.Cr[cr0+cc1])
+			r10, g10, b10 := ycbcrToRGB(src.Y[yr1+tx.i0], src.Cb[cr1+cc0], src.Cr[cr1+cc0])
+			r11, g11, b11 := ycbcrToRGB(src.Y[yr1+tx.i1], src.Cb[cr1+cc1], src.Cr[cr1+cc1])
+
+			i := out + dx
+			r[i] = lerp(lerp(r00, r01, tx.w), lerp(r10, r11, tx.w), ty.w) * norm
+			g[i] = lerp(lerp(g00, g01, tx.w), lerp(g10, g11, tx.w), ty.w) * norm
+			b[i] = lerp(lerp(b00, b01, tx.w), lerp(b10, b11, tx.w), ty.w) * norm
+		}
+	}
+}
+
+// fromImage is the slow path for image types without direct Pix access
+func (p *Preprocessor) fromImage(src image.Image, t *letterboxTables, r, g, b []float32) {
+	const norm = 1.0 / 65535.0
+	lb := t.lb
+	minX, minY := src.Bounds().Min.X, src.Bounds().Min.Y
+
+	sample := func(x, y int) (float32, float32, float32) {
+		cr, cg, cb, _ := src.At(x, y).RGBA()
+		return float32(cr), float32(cg), float32(cb)
+	}
+
+	for dy, ty := range t.ys {
+		y0, y1 := ty.i0+minY, ty.i1+minY
+		out := (lb.OffsetY+dy)*p.ModelWidth + lb.OffsetX
+
+		for dx, tx := range t.xs {
+			x0, x1 := tx.i0+minX, tx.i1+minX
+			r00, g00, b00 := sample(x0, y0)
+			r01, g01, b01 := sample(x1, y0)
+			r10, g10, b10 := sample(x0, y1)
+			r11, g11, b11 := sample(x1, y1)
+
+			i := out + dx
+			r[i] = lerp(lerp(r00, r01, tx.w), lerp(r10, r11, tx.w), ty.w) * norm
+			g[i] = lerp(lerp(g00, g01, tx.w), lerp(g10, g11, tx.w), ty.w) * norm
+			b[i] = lerp(lerp(b00, b01, tx.w), lerp(b10, b11, tx.w), ty.w) * norm
+		}
+	}
+}
+
+// TensorToRGBA renders a planar RGB model input back into an image, mostly useful for debugging and drawing
+func TensorToRGBA(data []float32, width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	plane := width * height
+	for i := 0; i < plane; i++ {
+		img.Pix[i*4] = uint8(clamp255(data[i]*255 + 0.5))
+		img.Pix[i*4+1] = uint8(clamp255(data[plane+i]*255 + 0.5))
+		img.Pix[i*4+2] = uint8(clamp255(data[2*plane+i]*255 + 0.5))
+		img.Pix[i*4+3] = 255
+	}
+	return img
+}
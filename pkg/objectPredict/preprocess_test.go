@@ -0,0 +1,217 @@
+package objectPredict
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"runtime"
+	"sync"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	testModelWidth  = 640
+	testModelHeight = 640
+)
+
+// prepareInputReference is the previous preprocessing path, kept to benchmark against
+func prepareInputReference(imageObj image.Image, modelWidth, modelHeight int) []float32 {
+	imageSize := imageObj.Bounds().Size()
+	ratio := math.Min(float64(modelWidth)/float64(imageSize.X), float64(modelHeight)/float64(imageSize.Y))
+	newWidth := int(float64(imageSize.X) * ratio)
+	newHeight := int(float64(imageSize.Y) * ratio)
+
+	paddedImage := image.NewRGBA(image.Rect(0, 0, modelWidth, modelHeight))
+	draw.Draw(paddedImage, paddedImage.Bounds(), &image.Uniform{color.RGBA{0, 0, 0, 255}}, image.Point{}, draw.Src)
+
+	resizedImage := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	draw.CatmullRom.Scale(resizedImage, resizedImage.Bounds(), imageObj, imageObj.Bounds(), draw.Over, nil)
+
+	dx := (modelWidth - newWidth) / 2
+	dy := (modelHeight - newHeight) / 2
+	draw.Draw(paddedImage, image.Rect(dx, dy, newWidth+dx, newHeight+dy), resizedImage, image.Point{0, 0}, draw.Over)
+
+	inputArray := make([]float32, modelWidth*modelHeight*3)
+	var wg sync.WaitGroup
+	numGoroutines := runtime.NumCPU()
+	rowsPerGoroutine := modelHeight / numGoroutines
+	for i := 0; i < numGoroutines; i++ {
+		startY, endY := i*rowsPerGoroutine, (i+1)*rowsPerGoroutine
+		if i == numGoroutines-1 {
+			endY = modelHeight
+		}
+		wg.Add(1)
+		go func(startY, endY int) {
+			defer wg.Done()
+			for y := startY; y < endY; y++ {
+				for x := 0; x < modelWidth; x++ {
+					r, g, b, _ := paddedImage.At(x, y).RGBA()
+					redIdx := y*modelWidth + x
+					inputArray[redIdx] = float32(r/257) / 255.0
+					inputArray[redIdx+modelWidth*modelHeight] = float32(g/257) / 255.0
+					inputArray[redIdx+2*modelWidth*modelHeight] = float32(b/257) / 255.0
+				}
+			}
+		}(startY, endY)
+	}
+	wg.Wait()
+	return inputArray
+}
+
+func testFrameRGBA(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), uint8(x + y), 255})
+		}
+	}
+	return img
+}
+
+func testFrameYCbCr(width, height int) *image.YCbCr {
+	img := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Y[img.YOffset(x, y)] = uint8(x + y)
+			ci := img.COffset(x, y)
+			img.Cb[ci] = uint8(x)
+			img.Cr[ci] = uint8(y)
+		}
+	}
+	return img
+}
+
+func TestLetterboxToSource(t *testing.T) {
+	tests := []struct {
+		srcWidth, srcHeight int
+	}{
+		{1920, 1080},
+		{640, 360},
+		{1080, 1920},
+		{3840, 2160},
+		{640, 640},
+	}
+
+	for _, test := range tests {
+		lb := NewLetterbox(test.srcWidth, test.srcHeight, testModelWidth, testModelHeight)
+
+		// Corners of the scaled frame must map onto the corners of the source frame
+		x, y := lb.ToSource(float32(lb.OffsetX), float32(lb.OffsetY))
+		if x != 0 || y != 0 {
+			t.Errorf("%dx%d: top left mapped to %f,%f", test.srcWidth, test.srcHeight, x, y)
+		}
+		x, y = lb.ToSource(float32(lb.OffsetX+lb.Width), float32(lb.OffsetY+lb.Height))
+		if math.Abs(float64(x)-float64(test.srcWidth)) > 1e-3 || math.Abs(float64(y)-float64(test.srcHeight)) > 1e-3 {
+			t.Errorf("%dx%d: bottom right mapped to %f,%f", test.srcWidth, test.srcHeight, x, y)
+		}
+
+		// Points in the padding clamp to the frame
+		x, y = lb.ToSource(0, 0)
+		if x != 0 || y != 0 {
+			t.Errorf("%dx%d: padding mapped outside the frame: %f,%f", test.srcWidth, test.srcHeight, x, y)
+		}
+	}
+}
+
+func TestPreprocessorMatchesReference(t *testing.T) {
+	// Smooth gradient, the two paths use different resampling kernels which only agree away from hard edges
+	img := image.NewRGBA(image.Rect(0, 0, 1280, 720))
+	for y := 0; y < 720; y++ {
+		for x := 0; x < 1280; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 255 / 1280), uint8(y * 255 / 720), 128, 255})
+		}
+	}
+	want := prepareInputReference(img, testModelWidth, testModelHeight)
+
+	p := NewPreprocessor(testModelWidth, testModelHeight)
+	got := make([]float32, len(want))
+	p.Letterbox(img, got)
+
+	var worst float64
+	for i := range want {
+		worst = math.Max(worst, math.Abs(float64(got[i]-want[i])))
+	}
+	if worst > 2.0/255 {
+		t.Errorf("max difference to reference: %f", worst)
+	}
+}
+
+func TestPreprocessorFastPathsMatchGeneric(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"rgba", testFrameRGBA(800, 450)},
+		{"ycbcr", testFrameYCbCr(800, 450)},
+		{"ycbcr_subimage", testFrameYCbCr(1000, 600).SubImage(image.Rect(101, 51, 901, 501))},
+		{"rgba_subimage", testFrameRGBA(1000, 600).SubImage(image.Rect(100, 50, 900, 500))},
+	}
+
+	for _, test := range tests {
+		p := NewPreprocessor(testModelWidth, testModelHeight)
+		fast := make([]float32, 3*testModelWidth*testModelHeight)
+		generic := make([]float32, len(fast))
+		p.Letterbox(test.img, fast)
+
+		// Hide the concrete type so the At() path runs
+		p.Letterbox(struct{ image.Image }{test.img}, generic)
+
+		for i := range fast {
+			if math.Abs(float64(fast[i]-generic[i])) > 2.0/255 {
+				t.Fatalf("%s: index %d fast %f generic %f", test.name, i, fast[i], generic[i])
+			}
+		}
+	}
+}
+
+func TestPreprocessorZeroAlloc(t *testing.T) {
+	p := NewPreprocessor(testModelWidth, testModelHeight)
+	dst := make([]float32, 3*testModelWidth*testModelHeight)
+	rgba := testFrameRGBA(1920, 1080)
+	ycbcr := testFrameYCbCr(1920, 1080)
+
+	// Warm up the tables
+	p.Letterbox(rgba, dst)
+
+	if allocs := testing.AllocsPerRun(10, func() { p.Letterbox(rgba, dst) }); allocs != 0 {
+		t.Errorf("rgba: %f allocations per frame", allocs)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { p.Letterbox(ycbcr, dst) }); allocs != 0 {
+		t.Errorf("ycbcr: %f allocations per frame", allocs)
+	}
+}
+
+func BenchmarkPrepareInputReference(b *testing.B) {
+	img := testFrameRGBA(1920, 1080)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		prepareInputReference(img, testModelWidth, testModelHeight)
+	}
+}
+
+func BenchmarkPreprocessorRGBA(b *testing.B) {
+	img := testFrameRGBA(1920, 1080)
+	p := NewPreprocessor(testModelWidth, testModelHeight)
+	dst := make([]float32, 3*testModelWidth*testModelHeight)
+	p.Letterbox(img, dst) // Build the sampling tables outside the timer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Letterbox(img, dst)
+	}
+}
+
+func BenchmarkPreprocessorYCbCr(b *testing.B) {
+	img := testFrameYCbCr(1920, 1080)
+	p := NewPreprocessor(testModelWidth, testModelHeight)
+	dst := make([]float32, 3*testModelWidth*testModelHeight)
+	p.Letterbox(img, dst) // Build the sampling tables outside the timer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Letterbox(img, dst)
+	}
+}
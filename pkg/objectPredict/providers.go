@@ -0,0 +1,234 @@
+package objectPredict
+
+import (
+	"fmt"
+	"strconv"
+
+	onnx "github.com/8ff/onnxruntime_go"
+)
+
+// Execution provider names accepted in Config.Providers
+const (
+	ProviderTensorRT = "tensorrt"
+	ProviderCUDA     = "cuda"
+	ProviderOpenVINO = "openvino"
+	ProviderCoreML   = "coreml"
+	ProviderCPU      = "cpu"
+)
+
+// resolveProviders returns the provider list to try in order. An empty list falls back to the
+// EnableCuda/EnableCoreMl flags, cpu is always appended as the last resort.
+func resolveProviders(opt Config) []string {
+	providers := opt.Providers
+	if len(providers) == 0 {
+		switch {
+		case opt.EnableCoreMl:
+			providers = []string{ProviderCoreML}
+		case opt.EnableCuda:
+			providers = []string{ProviderCUDA}
+		}
+	}
+
+	var resolved []string
+	seen := map[string]bool{}
+	for _, provider := range append(providers, ProviderCPU) {
+		if !seen[provider] {
+			seen[provider] = true
+			resolved = append(resolved, provider)
+		}
+	}
+	return resolved
+}
+
+// needsGpuLib reports whether any of the providers only ships in the gpu build of onnxruntime
+func needsGpuLib(providers []string) bool {
+	for _, provider := range providers {
+		if provider == ProviderCUDA || provider == ProviderTensorRT {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddedLibPath returns the path of the onnxruntime library inside the embedded lib.tgz
+func embeddedLibPath(hostOs, hostArch string, gpu bool) (string, error) {
+	switch {
+	case hostOs == "darwin" && hostArch == "arm64":
+		return "lib/osx_arm64/libonnxruntime.dylib", nil
+	case hostOs == "linux" && hostArch == "amd64":
+		if gpu {
+			return "lib/linux_amd64_gpu/libonnxruntime.so", nil
+		}
+		return "lib/linux_amd64_cpu/libonnxruntime.so", nil
+	case hostOs == "linux" && hostArch == "arm64":
+		return "lib/linux_arm64_cpu/libonnxruntime.so", nil
+	default:
+		return "", fmt.Errorf("unsupported OS or architecture: %s/%s", hostOs, hostArch)
+	}
+}
+
+// appendProvider configures options to run on provider
+func (c *Client) appendProvider(options *onnx.SessionOptions, provider string) error {
+	providerOptions := c.ProviderOptions[provider]
+
+	switch provider {
+	case ProviderCPU:
+		return nil
+	case ProviderCoreML:
+		var flags uint64
+		if value, ok := providerOptions["flags"]; ok {
+			var err error
+			flags, err = strconv.ParseUint(value, 0, 32)
+			if err != nil {
+				return fmt.Errorf("invalid coreml flags %q: %w", value, err)
+			}
+		}
+		return options.AppendExecutionProviderCoreML(uint32(flags))
+	case ProviderCUDA:
+		cudaOptions, err := onnx.NewCUDAProviderOptions()
+		if err != nil {
+			return fmt.Errorf("error creating CUDA provider options: %w", err)
+		}
+		defer cudaOptions.Destroy()
+
+		// This is a clunky API, but it reflects how the underlying C API sets CUDA options.
+		settings := map[string]string{"device_id": strconv.Itoa(c.CudaDeviceID)}
+		for key, value := range providerOptions {
+			settings[key] = value
+		}
+		if err := cudaOptions.Update(settings); err != nil {
+			return fmt.Errorf("error updating CUDA provider options: %w", err)
+		}
+		return options.AppendExecutionProviderCUDA(cudaOptions)
+	case ProviderTensorRT:
+		trtOptions, err := onnx.NewTensorRTProviderOptions()
+		if err != nil {
+			return fmt.Errorf("error creating TensorRT provider options: %w", err)
+		}
+		defer trtOptions.Destroy()
+
+		settings := map[string]string{"device_id": strconv.Itoa(c.CudaDeviceID)}
+		for key, value := range providerOptions {
+			settings[key] = value
+		}
+		if err := trtOptions.Update(settings); err != nil {
+			return fmt.Errorf("error updating TensorRT provider options: %w", err)
+		}
+		return options.AppendExecutionProviderTensorRT(trtOptions)
+	case ProviderOpenVINO:
+		// Only onnxruntime builds with OpenVINO have it, see Config.LibraryPath
+		openvinoOptions, err := parseOpenVINOOptions(providerOptions)
+		if err != nil {
+			return err
+		}
+		return options.AppendExecutionProviderOpenVINO(openvinoOptions)
+	default:
+		return fmt.Errorf("unknown execution provider: %s", provider)
+	}
+}
+
+// parseOpenVINOOptions reads the OpenVINO settings from the string options of the config, with the keys onnxruntime
+// uses for them
+func parseOpenVINOOptions(providerOptions map[string]string) (onnx.OpenVINOProviderOptions, error) {
+	var options onnx.OpenVINOProviderOptions
+	for key, value := range providerOptions {
+		var err error
+		switch key {
+		case "device_type":
+			options.DeviceType = value
+		case "device_id":
+			options.DeviceID = value
+		case "cache_dir":
+			options.CacheDir = value
+		case "num_of_threads":
+			options.NumOfThreads, err = strconv.Atoi(value)
+			if err == nil && options.NumOfThreads < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		case "enable_vpu_fast_compile":
+			options.EnableVPUFastCompile, err = strconv.ParseBool(value)
+		case "enable_opencl_throttling":
+			options.EnableOpenCLThrottling, err = strconv.ParseBool(value)
+		case "enable_dynamic_shapes":
+			options.EnableDynamicShapes, err = strconv.ParseBool(value)
+		default:
+			return options, fmt.Errorf("unknown openvino option %s", key)
+		}
+		if err != nil {
+			return options, fmt.Errorf("invalid openvino %s %q: %w", key, value, err)
+		}
+	}
+	return options, nil
+}
+
+// newSessionOptions creates session options for provider including the thread settings
+func (c *Client) newSessionOptions(provider string) (*onnx.SessionOptions, error) {
+	options, err := onnx.NewSessionOptions()
+	if err != nil {
+		return nil, fmt.Errorf("error creating session options: %w", err)
+	}
+
+	if err := options.SetIntraOpNumThreads(c.IntraOpThreads); err != nil {
+		options.Destroy()
+		return nil, fmt.Errorf("error setting intra op threads: %w", err)
+	}
+	if err := options.SetInterOpNumThreads(c.InterOpThreads); err != nil {
+		options.Destroy()
+		return nil, fmt.Errorf("error setting inter op threads: %w", err)
+	}
+
+	if err := c.appendProvider(options, provider); err != nil {
+		options.Destroy()
+		return nil, err
+	}
+	return options, nil
+}
+
+// initSessions creates the session pool on the first provider that works, trying them in order
+func (c *Client) initSessions() error {
+	var errs []error
+	for _, provider := range c.Providers {
+		sessions, pool, err := c.newPool(provider, c.ModelPath, c.ModelWidth, c.ModelHeight)
+		if err == nil {
+			c.Sessions, c.pool = sessions, pool
+			c.Provider = provider
+			logger.Debug("Sessions initialized", "sessions", c.SessionPoolSize, "provider", provider)
+			return nil
+		}
+
+		logger.Warn("Execution provider failed, trying next", "provider", provider, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", provider, err))
+	}
+	return fmt.Errorf("no execution provider could be initialized: %v", errs)
+}
+
+// firstProvider returns the first provider whose session options onnxruntime accepts, for clients without sessions
+func (c *Client) firstProvider() (string, error) {
+	var errs []error
+	for _, provider := range c.Providers {
+		options, err := c.newSessionOptions(provider)
+		if err == nil {
+			options.Destroy()
+			return provider, nil
+		}
+		logger.Warn("Execution provider failed, trying next", "provider", provider, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", provider, err))
+	}
+	return "", fmt.Errorf("no execution provider could be initialized: %v", errs)
+}
+
+// newPool creates SessionPoolSize sessions of modelPath running on provider
+func (c *Client) newPool(provider, modelPath string, modelWidth, modelHeight int) ([]*ModelSession, chan *ModelSession, error) {
+	pool := make(chan *ModelSession, c.SessionPoolSize)
+	var sessions []*ModelSession
+	for i := 0; i < c.SessionPoolSize; i++ {
+		ses, err := c.initSession(provider, modelPath, modelWidth, modelHeight)
+		if err != nil {
+			destroySessions(sessions)
+			return nil, nil, err
+		}
+		sessions = append(sessions, ses)
+		pool <- ses
+	}
+	return sessions, pool, nil
+}
@@ -0,0 +1,59 @@
+package objectPredict
+
+import (
+	"reflect"
+	"testing"
+
+	onnx "github.com/8ff/onnxruntime_go"
+)
+
+func TestResolveProviders(t *testing.T) {
+	tests := []struct {
+		opt  Config
+		want []string
+	}{
+		{Config{}, []string{"cpu"}},
+		{Config{EnableCuda: true}, []string{"cuda", "cpu"}},
+		{Config{EnableCoreMl: true}, []string{"coreml", "cpu"}},
+		{Config{Providers: []string{"tensorrt", "cuda"}, EnableCoreMl: true}, []string{"tensorrt", "cuda", "cpu"}},
+		{Config{Providers: []string{"openvino", "cpu", "cuda", "cpu"}}, []string{"openvino", "cpu", "cuda"}},
+	}
+
+	for _, test := range tests {
+		if got := resolveProviders(test.opt); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("resolveProviders(%+v) = %v, want %v", test.opt, got, test.want)
+		}
+	}
+
+	if !needsGpuLib([]string{"tensorrt", "cpu"}) || needsGpuLib([]string{"openvino", "coreml", "cpu"}) {
+		t.Error("only cuda and tensorrt need the gpu build")
+	}
+}
+
+func TestParseOpenVINOOptions(t *testing.T) {
+	options, err := parseOpenVINOOptions(map[string]string{
+		"device_type":           "GPU_FP16",
+		"device_id":             "GPU.1",
+		"num_of_threads":        "4",
+		"cache_dir":             "/tmp/ov",
+		"enable_dynamic_shapes": "1",
+	})
+	want := onnx.OpenVINOProviderOptions{DeviceType: "GPU_FP16", DeviceID: "GPU.1", NumOfThreads: 4, CacheDir: "/tmp/ov", EnableDynamicShapes: true}
+	if err != nil || options != want {
+		t.Errorf("parseOpenVINOOptions = %+v %v, want %+v", options, err, want)
+	}
+	if options, err := parseOpenVINOOptions(nil); err != nil || options != (onnx.OpenVINOProviderOptions{}) {
+		t.Errorf("expected no options to leave the defaults, got %+v %v", options, err)
+	}
+
+	for _, bad := range []map[string]string{
+		{"num_of_threads": "four"},
+		{"num_of_threads": "-1"},
+		{"enable_opencl_throttling": "sometimes"},
+		{"precision": "FP16"},
+	} {
+		if _, err := parseOpenVINOOptions(bad); err == nil {
+			t.Errorf("expected %v to be an error", bad)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package objectPredict
+
+import (
+	"image"
+	"time"
+)
+
+// TileOptions configures SAHI style sliced inference
+type TileOptions struct {
+	TileWidth        int     // Tile size in source pixels, defaults to the model width
+	TileHeight       int     // Tile size in source pixels, defaults to the model height
+	Overlap          float64 // Fraction of a tile shared with its neighbour, 0-0.9
+	IncludeFullFrame bool    // Also run the whole frame so large objects spanning tiles are still found
+	MergeIoU         float64 // IoU above which boxes of the same class from different regions are merged, defaults to 0.5
+}
+
+type subImager interface {
+	SubImage(r image.Rectangle) image.Image
+}
+
+// PredictRegions runs the model on each region of img as its own crop and merges the detections.
+// Boxes are returned in the coordinates of img. Crops share the pixel buffer of img when it supports SubImage,
+// regions are batched/parallelized like PredictBatch. Took is the latency of the whole call.
+func (c *Client) PredictRegions(img image.Image, regions []image.Rectangle, mergeIoU float64) ([]Object, time.Duration, error) {
+	timer := time.Now()
+	bounds := img.Bounds()
+
+	crops := make([]image.Image, 0, len(regions))
+	offsets := make([]image.Point, 0, len(regions))
+	for _, region := range regions {
+		region = region.Intersect(bounds)
+		if region.Empty() {
+			continue
+		}
+		crops = append(crops, cropImage(img, region))
+		offsets = append(offsets, region.Min.Sub(bounds.Min))
+	}
+
+	results, err := c.predictBatch(crops)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Move every box from crop to frame coordinates
+	var objects []Object
+	for i, result := range results {
+		for _, object := range result.Objects {
+			object.X1 += float32(offsets[i].X)
+			object.X2 += float32(offsets[i].X)
+			object.Y1 += float32(offsets[i].Y)
+			object.Y2 += float32(offsets[i].Y)
+			objects = append(objects, object)
+		}
+	}
+
+	if len(crops) > 1 {
+		if mergeIoU <= 0 {
+			mergeIoU = 0.5
+		}
+		objects = NonMaxSuppression(objects, mergeIoU, true)
+	}
+
+	if c.NormalizedBoxes {
+		normalizeObjects(objects, bounds.Dx(), bounds.Dy())
+	}
+	return objects, time.Since(timer), nil
+}
+
+// PredictTiled slices img into overlapping tiles, runs them through the model and merges the results
+func (c *Client) PredictTiled(img image.Image, opt TileOptions) ([]Object, time.Duration, error) {
+	modelWidth, modelHeight := c.ModelSize()
+	if opt.TileWidth <= 0 {
+		opt.TileWidth = modelWidth
+	}
+	if opt.TileHeight <= 0 {
+		opt.TileHeight = modelHeight
+	}
+
+	regions := TileRegions(img.Bounds(), opt.TileWidth, opt.TileHeight, opt.Overlap)
+	if opt.IncludeFullFrame && len(regions) > 1 {
+		regions = append(regions, img.Bounds())
+	}
+	return c.PredictRegions(img, regions, opt.MergeIoU)
+}
+
+// TileRegions covers bounds with tileWidth x tileHeight tiles overlapping by overlap (fraction of a tile).
+// The last tile of every row/column is aligned with the edge so no tile reaches outside bounds.
+func TileRegions(bounds image.Rectangle, tileWidth, tileHeight int, overlap float64) []image.Rectangle {
+	overlap = max(0, min(overlap, 0.9))
+	xs := tileStarts(bounds.Min.X, bounds.Dx(), tileWidth, overlap)
+	ys := tileStarts(bounds.Min.Y, bounds.Dy(), tileHeight, overlap)
+
+	tiles := make([]image.Rectangle, 0, len(xs)*len(ys))
+	for _, y := range ys {
+		for _, x := range xs {
+			tiles = append(tiles, image.Rect(x, y, x+min(tileWidth, bounds.Dx()), y+min(tileHeight, bounds.Dy())))
+		}
+	}
+	return tiles
+}
+
+// tileStarts returns the start positions of tiles of size along an axis of length starting at origin
+func tileStarts(origin, length, size int, overlap float64) []int {
+	if size >= length {
+		return []int{origin}
+	}
+
+	step := max(1, int(float64(size)*(1-overlap)))
+	var starts []int
+	for pos := 0; ; pos += step {
+		if pos+size >= length {
+			starts = append(starts, origin+length-size)
+			break
+		}
+		starts = append(starts, origin+pos)
+	}
+	return starts
+}
+
+// ExpandRegion grows r around its center to at least minWidth x minHeight plus a margin fraction on every side,
+// shifted and clamped to stay inside bounds. Useful to give tight motion boxes some context.
+func ExpandRegion(r, bounds image.Rectangle, minWidth, minHeight int, margin float64) image.Rectangle {
+	width := max(int(float64(r.Dx())*(1+2*margin)), minWidth)
+	height := max(int(float64(r.Dy())*(1+2*margin)), minHeight)
+	width, height = min(width, bounds.Dx()), min(height, bounds.Dy())
+
+	center := image.Pt((r.Min.X+r.Max.X)/2, (r.Min.Y+r.Max.Y)/2)
+	x := max(bounds.Min.X, min(center.X-width/2, bounds.Max.X-width))
+	y := max(bounds.Min.Y, min(center.Y-height/2, bounds.Max.Y-height))
+	return image.Rect(x, y, x+width, y+height)
+}
+
+// cropImage returns the region of img, sharing pixels when the image type allows it
+func cropImage(img image.Image, region image.Rectangle) image.Image {
+	if sub, ok := img.(subImager); ok {
+		return sub.SubImage(region)
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, region.Dx(), region.Dy()))
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for x := region.Min.X; x < region.Max.X; x++ {
+			rgba.Set(x-region.Min.X, y-region.Min.Y, img.At(x, y))
+		}
+	}
+	return rgba
+}
@@ -0,0 +1,56 @@
+package objectPredict
+
+import (
+	"image"
+	"testing"
+)
+
+func TestTileRegionsCoverFrame(t *testing.T) {
+	bounds := image.Rect(0, 0, 3840, 2160)
+	tiles := TileRegions(bounds, 640, 640, 0.2)
+
+	for _, tile := range tiles {
+		if !tile.In(bounds) {
+			t.Errorf("tile %v outside of %v", tile, bounds)
+		}
+		if tile.Dx() != 640 || tile.Dy() != 640 {
+			t.Errorf("tile %v is not 640x640", tile)
+		}
+	}
+
+	// Every pixel must be covered by at least one tile
+	for _, pt := range []image.Point{{0, 0}, {3839, 2159}, {1919, 1079}, {3839, 0}, {0, 2159}} {
+		covered := false
+		for _, tile := range tiles {
+			if pt.In(tile) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			t.Errorf("point %v not covered", pt)
+		}
+	}
+
+	// Frame smaller than a tile is a single tile of the frame
+	tiles = TileRegions(image.Rect(0, 0, 320, 240), 640, 640, 0.2)
+	if len(tiles) != 1 || tiles[0] != image.Rect(0, 0, 320, 240) {
+		t.Errorf("expected a single frame sized tile, got %v", tiles)
+	}
+}
+
+func TestExpandRegion(t *testing.T) {
+	bounds := image.Rect(0, 0, 1920, 1080)
+
+	// Tiny box in the corner grows to the minimum size without leaving the frame
+	r := ExpandRegion(image.Rect(10, 10, 30, 30), bounds, 640, 640, 0.1)
+	if r != image.Rect(0, 0, 640, 640) {
+		t.Errorf("unexpected region %v", r)
+	}
+
+	// Large box only gets the margin
+	r = ExpandRegion(image.Rect(500, 300, 1500, 900), bounds, 640, 640, 0.1)
+	if r.Dx() != 1200 || r.Dy() != 720 {
+		t.Errorf("unexpected region size %v", r)
+	}
+}
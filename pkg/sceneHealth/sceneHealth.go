@@ -0,0 +1,304 @@
+// Package sceneHealth watches the whole picture of a camera rather than what moves in it. It notices global
+// lighting jumps and day/night (IR) switchovers, so they don't count as motion, and camera tampering: a covered
+// lens (uniform frame), a moved camera (the scene no longer matches the learned reference) and lost focus.
+package sceneHealth
+
+import (
+	"image"
+	"math"
+	"slices"
+	"time"
+)
+
+// Thumbnail size used for every scene comparison
+const (
+	thumbWidth  = 64
+	thumbHeight = 48
+)
+
+const (
+	Covered   = "covered"
+	Moved     = "moved"
+	Defocused = "defocused"
+
+	Day   = "day"
+	Night = "night"
+)
+
+// Config tunes the monitor, zero values use the defaults
+type Config struct {
+	BrightnessJump   float64       // Change of the mean gray level between frames that counts as a lighting change, defaults to 40
+	SuppressFor      time.Duration // Motion is suppressed this long after a lighting change, defaults to 2s
+	UniformStdDev    float64       // Frames with a lower gray level standard deviation are considered covered, defaults to 6
+	MovedCorrelation float64       // Correlation with the reference below which the camera is considered moved, defaults to 0.5
+	DefocusRatio     float64       // Sharpness below this fraction of the reference is considered defocused, defaults to 0.4
+	TamperAfter      time.Duration // A tamper condition has to hold this long before it is reported, defaults to 5s
+	RelearnAfter     time.Duration // A moved camera becomes the new reference after this long, defaults to 5m
+	NightChroma      float64       // Mean color saturation below which the picture is considered IR night mode, defaults to 4
+	ModeAfter        time.Duration // A day/night mode has to hold this long before it is reported, defaults to 10s
+}
+
+// Event is a change of the scene health
+type Event struct {
+	Type   string // camera_tamper or camera_day_night
+	Reason string // covered, moved or defocused for camera_tamper
+	Active bool   // camera_tamper started (true) or cleared (false)
+	Mode   string // day or night for camera_day_night
+}
+
+// Status is the result of a frame
+type Status struct {
+	Suppress bool // Changes of this frame are lighting or a covered lens, not motion
+	Events   []Event
+	Mode     string // Current day/night mode, empty until known
+	Tampered []string
+}
+
+// Monitor keeps the scene reference of one camera. It is not safe for concurrent use.
+type Monitor struct {
+	Config Config
+
+	thumb          []float32
+	reference      []float32 // Slowly learned thumbnail of the healthy scene
+	sharpness      float64   // Slowly learned sharpness of the healthy scene
+	references     int       // Frames learned into the reference
+	lastBrightness float64
+	suppressUntil  time.Time
+
+	conditions map[string]time.Time // Since when a tamper condition holds
+	active     map[string]bool      // Reported tamper conditions
+
+	mode          string
+	candidate     string
+	candidateFrom time.Time
+}
+
+func New(cfg Config) *Monitor {
+	if cfg.BrightnessJump == 0 {
+		cfg.BrightnessJump = 40
+	}
+	if cfg.SuppressFor == 0 {
+		cfg.SuppressFor = 2 * time.Second
+	}
+	if cfg.UniformStdDev == 0 {
+		cfg.UniformStdDev = 6
+	}
+	if cfg.MovedCorrelation == 0 {
+		cfg.MovedCorrelation = 0.5
+	}
+	if cfg.DefocusRatio == 0 {
+		cfg.DefocusRatio = 0.4
+	}
+	if cfg.TamperAfter == 0 {
+		cfg.TamperAfter = 5 * time.Second
+	}
+	if cfg.RelearnAfter == 0 {
+		cfg.RelearnAfter = 5 * time.Minute
+	}
+	if cfg.NightChroma == 0 {
+		cfg.NightChroma = 4
+	}
+	if cfg.ModeAfter == 0 {
+		cfg.ModeAfter = 10 * time.Second
+	}
+	return &Monitor{
+		Config:     cfg,
+		thumb:      make([]float32, thumbWidth*thumbHeight),
+		conditions: map[string]time.Time{},
+		active:     map[string]bool{},
+	}
+}
+
+// Update checks frame, taken at now, and returns the scene status
+func (m *Monitor) Update(frame *image.RGBA, now time.Time) Status {
+	var status Status
+	chroma := m.sample(frame)
+	sharpness := sharpnessOf(frame)
+	brightness, stdDev := meanStdDev(m.thumb)
+
+	// Lighting jumps, the reference is relearned for the new lighting
+	first := m.references == 0
+	if !first && math.Abs(brightness-m.lastBrightness) > m.Config.BrightnessJump {
+		m.suppressUntil = now.Add(m.Config.SuppressFor)
+		m.references = 0
+	}
+	m.lastBrightness = brightness
+
+	if mode := m.updateMode(chroma, now); mode != "" {
+		status.Events = append(status.Events, Event{Type: "camera_day_night", Mode: mode})
+		m.suppressUntil = now.Add(m.Config.SuppressFor)
+		m.references = 0
+	}
+	status.Mode = m.mode
+
+	covered := stdDev < m.Config.UniformStdDev
+	moved, defocused := false, false
+	if !covered && m.references >= 10 {
+		moved = correlation(m.thumb, m.reference) < m.Config.MovedCorrelation
+		defocused = !moved && sharpness < m.sharpness*m.Config.DefocusRatio
+	}
+
+	for _, check := range []struct {
+		reason string
+		holds  bool
+	}{{Covered, covered}, {Moved, moved}, {Defocused, defocused}} {
+		if event, ok := m.updateCondition(check.reason, check.holds, now); ok {
+			status.Events = append(status.Events, event)
+		}
+		if m.active[check.reason] {
+			status.Tampered = append(status.Tampered, check.reason)
+		}
+	}
+
+	// A camera that was moved for good becomes the new reference
+	if since, ok := m.conditions[Moved]; ok && moved && now.Sub(since) >= m.Config.RelearnAfter {
+		m.references = 0
+		moved = false
+		if event, ok := m.updateCondition(Moved, false, now); ok {
+			status.Events = append(status.Events, event)
+		}
+		status.Tampered = slices.DeleteFunc(status.Tampered, func(reason string) bool { return reason == Moved })
+	}
+
+	// Learn the healthy scene, fast at first and then slowly so gradual changes like the sun are followed
+	if (!covered && !moved && !defocused && now.After(m.suppressUntil)) || (m.references == 0 && !covered) {
+		m.learn(sharpness)
+	}
+
+	status.Suppress = covered || now.Before(m.suppressUntil)
+	return status
+}
+
+// updateCondition tracks how long a tamper condition holds and returns an event when it becomes active or clears
+func (m *Monitor) updateCondition(reason string, holds bool, now time.Time) (Event, bool) {
+	if !holds {
+		delete(m.conditions, reason)
+		if m.active[reason] {
+			delete(m.active, reason)
+			return Event{Type: "camera_tamper", Reason: reason, Active: false}, true
+		}
+		return Event{}, false
+	}
+
+	since, ok := m.conditions[reason]
+	if !ok {
+		m.conditions[reason] = now
+		since = now
+	}
+	if !m.active[reason] && now.Sub(since) >= m.Config.TamperAfter {
+		m.active[reason] = true
+		return Event{Type: "camera_tamper", Reason: reason, Active: true}, true
+	}
+	return Event{}, false
+}
+
+// updateMode returns the new mode once the picture was colored (day) or monochrome (night) for ModeAfter
+func (m *Monitor) updateMode(chroma float64, now time.Time) string {
+	mode := Day
+	if chroma < m.Config.NightChroma {
+		mode = Night
+	}
+
+	if mode != m.candidate {
+		m.candidate, m.candidateFrom = mode, now
+	}
+	if mode == m.mode {
+		return ""
+	}
+	if m.mode == "" {
+		m.mode = mode // Initial mode is not a switch
+		return ""
+	}
+	if now.Sub(m.candidateFrom) < m.Config.ModeAfter {
+		return ""
+	}
+	m.mode = mode
+	return mode
+}
+
+func (m *Monitor) learn(sharpness float64) {
+	if m.references == 0 {
+		m.reference = append(m.reference[:0], m.thumb...)
+		m.sharpness = sharpness
+		m.references = 1
+		return
+	}
+
+	rate := float32(max(1/float64(m.references+1), 0.01))
+	for i, v := range m.thumb {
+		m.reference[i] += rate * (v - m.reference[i])
+	}
+	m.sharpness += float64(rate) * (sharpness - m.sharpness)
+	m.references++
+}
+
+// sample fills the gray thumbnail and returns the mean saturation of the sampled pixels
+func (m *Monitor) sample(frame *image.RGBA) float64 {
+	bounds := frame.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	var chroma float64
+	for ty := 0; ty < thumbHeight; ty++ {
+		y := (ty*height + height/2) / thumbHeight
+		row := frame.Pix[y*frame.Stride:]
+		for tx := 0; tx < thumbWidth; tx++ {
+			x := (tx*width + width/2) / thumbWidth
+			r, g, b := int(row[x*4]), int(row[x*4+1]), int(row[x*4+2])
+			m.thumb[ty*thumbWidth+tx] = float32(299*r+587*g+114*b) / 1000
+			chroma += float64(max(r, g, b) - min(r, g, b))
+		}
+	}
+	return chroma / float64(thumbWidth*thumbHeight)
+}
+
+// sharpnessOf is the mean squared gradient between neighbouring pixels on a sparse grid of the frame. Squared,
+// because blur spreads an edge over more pixels without changing the sum of the plain gradients.
+func sharpnessOf(frame *image.RGBA) float64 {
+	bounds := frame.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	gray := func(x, y int) int {
+		p := frame.Pix[y*frame.Stride+x*4:]
+		return (299*int(p[0]) + 587*int(p[1]) + 114*int(p[2])) / 1000
+	}
+
+	var sum float64
+	n := 0
+	for y := 0; y < height-1; y += 4 {
+		for x := (y / 4) % 4; x < width-1; x += 4 { // Staggered so edges on a multiple of the step are not missed
+			v := gray(x, y)
+			dx, dy := gray(x+1, y)-v, gray(x, y+1)-v
+			sum += float64(dx*dx + dy*dy)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+func meanStdDev(values []float32) (float64, float64) {
+	var sum, sum2 float64
+	for _, v := range values {
+		sum += float64(v)
+		sum2 += float64(v) * float64(v)
+	}
+	n := float64(len(values))
+	mean := sum / n
+	return mean, math.Sqrt(max(sum2/n-mean*mean, 0))
+}
+
+// correlation is the normalized cross correlation of a and b, 1 for the same scene regardless of brightness and contrast
+func correlation(a, b []float32) float64 {
+	meanA, stdA := meanStdDev(a)
+	meanB, stdB := meanStdDev(b)
+	if stdA == 0 || stdB == 0 {
+		return 0
+	}
+
+	var sum float64
+	for i := range a {
+		sum += (float64(a[i]) - meanA) * (float64(b[i]) - meanB)
+	}
+	return sum / float64(len(a)) / (stdA * stdB)
+}
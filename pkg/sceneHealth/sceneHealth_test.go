@@ -0,0 +1,138 @@
+package sceneHealth
+
+import (
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+// scene draws a textured frame, shift moves the texture and tint adds color
+func scene(shift int, offset int, tint uint8, blur bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	for y := 0; y < 240; y++ {
+		for x := 0; x < 320; x++ {
+			v := 60
+			if ((x+shift)/20+y/20)%2 == 0 {
+				v = 180
+			}
+			if ((x+shift)/7+y/5)%3 == 0 {
+				v += 30 // Fine detail for the sharpness check
+			}
+			v += offset
+			img.SetRGBA(x, y, color.RGBA{clamp(v + int(tint)), clamp(v), clamp(v - int(tint)), 255})
+		}
+	}
+	if blur {
+		return boxBlur(img, 4)
+	}
+	return img
+}
+
+func clamp(v int) uint8 {
+	return uint8(min(max(v, 0), 255))
+}
+
+func boxBlur(src *image.RGBA, radius int) *image.RGBA {
+	dst := image.NewRGBA(src.Bounds())
+	b := src.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var r, g, bl, n int
+			for dy := -radius; dy <= radius; dy++ {
+				for dx := -radius; dx <= radius; dx++ {
+					if p := image.Pt(x+dx, y+dy); p.In(b) {
+						c := src.RGBAAt(p.X, p.Y)
+						r, g, bl, n = r+int(c.R), g+int(c.G), bl+int(c.B), n+1
+					}
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255})
+		}
+	}
+	return dst
+}
+
+func uniform(gray uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = gray, gray, gray, 255
+	}
+	return img
+}
+
+// run feeds frame for d at 1 frame per second and returns the collected events and the last status
+func run(m *Monitor, frame *image.RGBA, now *time.Time, d time.Duration) ([]Event, Status) {
+	var events []Event
+	var status Status
+	for end := now.Add(d); now.Before(end); *now = now.Add(time.Second) {
+		status = m.Update(frame, *now)
+		events = append(events, status.Events...)
+	}
+	return events, status
+}
+
+func TestCovered(t *testing.T) {
+	m := New(Config{})
+	now := time.Unix(0, 0)
+	run(m, scene(0, 0, 20, false), &now, 20*time.Second)
+
+	events, status := run(m, uniform(10), &now, 10*time.Second)
+	if !status.Suppress || len(events) != 1 || events[0] != (Event{Type: "camera_tamper", Reason: Covered, Active: true}) {
+		t.Fatalf("expected a covered tamper event, got %+v %+v", events, status)
+	}
+
+	events, status = run(m, scene(0, 0, 20, false), &now, 5*time.Second)
+	if status.Suppress || len(events) != 1 || events[0] != (Event{Type: "camera_tamper", Reason: Covered, Active: false}) {
+		t.Errorf("expected the covered tamper to clear, got %+v %+v", events, status)
+	}
+}
+
+func TestMovedAndRelearn(t *testing.T) {
+	m := New(Config{RelearnAfter: time.Minute})
+	now := time.Unix(0, 0)
+	run(m, scene(0, 0, 20, false), &now, 20*time.Second)
+
+	events, status := run(m, scene(10, 0, 20, false), &now, 10*time.Second)
+	if len(events) != 1 || events[0].Reason != Moved || !events[0].Active || status.Suppress {
+		t.Fatalf("expected a moved tamper event without suppressing motion, got %+v %+v", events, status)
+	}
+
+	events, status = run(m, scene(10, 0, 20, false), &now, time.Minute)
+	if len(events) != 1 || events[0].Reason != Moved || events[0].Active || len(status.Tampered) != 0 {
+		t.Errorf("expected the new viewpoint to become the reference, got %+v %+v", events, status)
+	}
+}
+
+func TestDefocused(t *testing.T) {
+	m := New(Config{})
+	now := time.Unix(0, 0)
+	run(m, scene(0, 0, 20, false), &now, 20*time.Second)
+
+	events, _ := run(m, scene(0, 0, 20, true), &now, 10*time.Second)
+	if len(events) != 1 || events[0].Reason != Defocused || !events[0].Active {
+		t.Errorf("expected a defocused tamper event, got %+v", events)
+	}
+}
+
+func TestLightingJumpAndDayNight(t *testing.T) {
+	m := New(Config{})
+	now := time.Unix(0, 0)
+	if _, status := run(m, scene(0, 0, 20, false), &now, 20*time.Second); status.Mode != Day || status.Suppress {
+		t.Fatalf("expected day mode, got %+v", status)
+	}
+
+	// IR switchover: brighter and monochrome
+	status := m.Update(scene(0, 60, 0, false), now)
+	if !status.Suppress || len(status.Events) != 0 {
+		t.Fatalf("expected the lighting jump to be suppressed, got %+v", status)
+	}
+
+	events, status := run(m, scene(0, 60, 0, false), &now, 20*time.Second)
+	if len(events) != 1 || events[0] != (Event{Type: "camera_day_night", Mode: Night}) || status.Mode != Night {
+		t.Errorf("expected a switch to night mode, got %+v %+v", events, status)
+	}
+	if len(status.Tampered) != 0 || status.Suppress {
+		t.Errorf("expected no tamper after the switchover, got %+v", status)
+	}
+}
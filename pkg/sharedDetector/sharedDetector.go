@@ -0,0 +1,292 @@
+// Package sharedDetector runs one object detector for several cameras. A Server loads nothing itself, it wraps a
+// Detector, e.g. an objectPredict client, and registers every camera on one inferenceScheduler.Scheduler, so the
+// cameras split the inferences the detector manages with max-min fairness instead of each loading a model of its own.
+//
+// Cameras in the process of the Server use Server.Camera. The camera processes of a firescrew daemon use Dial, which
+// sends the frames over a local TCP connection to the Listen of the daemon and gets the boxes back.
+package sharedDetector
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"image"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/catsimple/firescrew/pkg/inferenceScheduler"
+	ob "github.com/catsimple/firescrew/pkg/objectPredict"
+)
+
+// Request is one detection on Frame, the boxes of the result are in Frame coordinates
+type Request struct {
+	Frame   *image.RGBA
+	Regions []image.Rectangle // Only detect in these parts of Frame, each as its own crop. Empty for the whole frame
+	Tiles   *ob.TileOptions   // Detect in overlapping tiles of Frame instead, Regions are ignored then
+}
+
+// Detector runs a model on a request and returns the boxes and the inference latency
+type Detector interface {
+	Detect(Request) ([]ob.Object, time.Duration, error)
+	ModelSize() (width, height int) // Input size of the model, motion crops are never smaller
+}
+
+// Camera is a camera registered on a Server. Due decides whether a frame is detected at all, within the share of the
+// detector the camera gets, Detect runs it. Close removes the camera from the schedule.
+type Camera interface {
+	Detector
+	Due(now time.Time, fps float64) bool
+	Close() error
+}
+
+// Client is a Detector running on an objectPredict client
+func Client(client *ob.Client) Detector {
+	return clientDetector{client}
+}
+
+type clientDetector struct {
+	client *ob.Client
+}
+
+func (d clientDetector) Detect(r Request) ([]ob.Object, time.Duration, error) {
+	switch {
+	case r.Tiles != nil:
+		return d.client.PredictTiled(r.Frame, *r.Tiles)
+	case len(r.Regions) > 0:
+		return d.client.PredictRegions(r.Frame, r.Regions, 0)
+	}
+	results, err := d.client.PredictBatch([]image.Image{r.Frame})
+	if err != nil {
+		return nil, 0, err
+	}
+	return results[0].Objects, results[0].Took, nil
+}
+
+func (d clientDetector) ModelSize() (int, int) {
+	return d.client.ModelSize()
+}
+
+// Server schedules the cameras of one detector, it is safe for concurrent use
+type Server struct {
+	Detector  Detector
+	Scheduler *inferenceScheduler.Scheduler
+	Provider  string // Execution provider of the detector, remote cameras load their crop models on it
+}
+
+// NewServer returns a server for detector, workers is the number of inferences it runs concurrently
+func NewServer(detector Detector, workers int) *Server {
+	return &Server{Detector: detector, Scheduler: inferenceScheduler.New(workers)}
+}
+
+// Camera registers a camera in this process
+func (s *Server) Camera(name string) Camera {
+	return &localCamera{server: s, schedule: s.Scheduler.Camera(name)}
+}
+
+type localCamera struct {
+	server   *Server
+	schedule *inferenceScheduler.Camera
+}
+
+func (c *localCamera) Due(now time.Time, fps float64) bool {
+	return c.schedule.Due(now, fps)
+}
+
+// Detect feeds the latency into the capacity estimate the shares are based on
+func (c *localCamera) Detect(r Request) ([]ob.Object, time.Duration, error) {
+	objects, took, err := c.server.Detector.Detect(r)
+	if err == nil {
+		c.server.Scheduler.Observe(took)
+	}
+	return objects, took, err
+}
+
+func (c *localCamera) ModelSize() (int, int) {
+	return c.server.Detector.ModelSize()
+}
+
+func (c *localCamera) Close() error {
+	c.schedule.Close()
+	return nil
+}
+
+// The connection starts with a hello and a welcome, then every call is answered by a reply
+type hello struct {
+	Token  string
+	Camera string
+}
+
+type welcome struct {
+	Provider      string
+	Width, Height int
+}
+
+type call struct {
+	Detect  bool // Due otherwise
+	Now     time.Time
+	Fps     float64
+	Request Request
+}
+
+type reply struct {
+	Err           string
+	Due           bool
+	Objects       []ob.Object
+	Took          time.Duration
+	Width, Height int // Model size, it changes when the model is swapped
+}
+
+// Listen accepts remote cameras on l until ctx is done. A camera first sends token, connections with a wrong token
+// are closed. The camera stays registered until its connection is closed.
+func (s *Server) Listen(ctx context.Context, l net.Listener, token string) error {
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.serve(ctx, conn, token)
+	}
+}
+
+func (s *Server) serve(ctx context.Context, conn net.Conn, token string) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	dec, enc := gob.NewDecoder(conn), gob.NewEncoder(conn)
+	var h hello
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := dec.Decode(&h); err != nil || subtle.ConstantTimeCompare([]byte(h.Token), []byte(token)) != 1 {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	camera := s.Camera(h.Camera)
+	defer camera.Close()
+	width, height := camera.ModelSize()
+	if err := enc.Encode(welcome{Provider: s.Provider, Width: width, Height: height}); err != nil {
+		return
+	}
+
+	for {
+		var c call
+		if err := dec.Decode(&c); err != nil {
+			return
+		}
+		var r reply
+		if c.Detect {
+			var err error
+			if r.Objects, r.Took, err = camera.Detect(c.Request); err != nil {
+				r.Err = err.Error()
+			}
+			r.Width, r.Height = camera.ModelSize()
+		} else {
+			r.Due = camera.Due(c.Now, c.Fps)
+		}
+		if err := enc.Encode(r); err != nil {
+			return
+		}
+	}
+}
+
+// Remote is a camera registered on the Listen of another process. Calls wait for each other, a camera detects one
+// frame at a time anyway. Once the connection broke every call fails and Due is always true, so the next Detect
+// reports the error.
+type Remote struct {
+	Provider string // Execution provider of the shared detector
+
+	mu            sync.Mutex
+	conn          net.Conn
+	enc           *gob.Encoder
+	dec           *gob.Decoder
+	width, height int
+	err           error
+}
+
+// Dial registers camera on the server listening at addr
+func Dial(addr, token, camera string) (*Remote, error) {
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	r := &Remote{conn: conn, enc: gob.NewEncoder(conn), dec: gob.NewDecoder(conn)}
+
+	var w welcome
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := r.enc.Encode(hello{Token: token, Camera: camera}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := r.dec.Decode(&w); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("shared detector refused %s: %w", camera, err)
+	}
+	conn.SetDeadline(time.Time{})
+	r.Provider, r.width, r.height = w.Provider, w.Width, w.Height
+	return r, nil
+}
+
+func (r *Remote) roundTrip(c call) (reply, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return reply{}, r.err
+	}
+	var resp reply
+	if err := r.enc.Encode(c); err != nil {
+		r.err = fmt.Errorf("shared detector: %w", err)
+		return reply{}, r.err
+	}
+	if err := r.dec.Decode(&resp); err != nil {
+		r.err = fmt.Errorf("shared detector: %w", err)
+		return reply{}, r.err
+	}
+	if c.Detect {
+		r.width, r.height = resp.Width, resp.Height
+	}
+	return resp, nil
+}
+
+func (r *Remote) Due(now time.Time, fps float64) bool {
+	resp, err := r.roundTrip(call{Now: now, Fps: fps})
+	return err != nil || resp.Due
+}
+
+func (r *Remote) Detect(req Request) ([]ob.Object, time.Duration, error) {
+	resp, err := r.roundTrip(call{Detect: true, Request: req})
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.Err != "" {
+		return nil, resp.Took, errors.New(resp.Err)
+	}
+	return resp.Objects, resp.Took, nil
+}
+
+func (r *Remote) ModelSize() (int, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.width, r.height
+}
+
+// Close unregisters the camera
+func (r *Remote) Close() error {
+	err := r.conn.Close() // Also ends a call that is waiting for its reply
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = errors.New("shared detector: camera is closed")
+	}
+	return err
+}
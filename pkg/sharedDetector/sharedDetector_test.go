@@ -0,0 +1,128 @@
+package sharedDetector
+
+import (
+	"context"
+	"image"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	ob "github.com/catsimple/firescrew/pkg/objectPredict"
+)
+
+// fakeDetector takes latency per inference and runs one at a time, like a single onnx session. It finds one object
+// covering the frame, or one per region.
+type fakeDetector struct {
+	latency time.Duration
+
+	mu   sync.Mutex
+	runs map[int]int // By frame width, every camera of the test has its own
+}
+
+func (d *fakeDetector) Detect(r Request) ([]ob.Object, time.Duration, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	time.Sleep(d.latency)
+	d.runs[r.Frame.Bounds().Dx()]++
+
+	regions := r.Regions
+	if len(regions) == 0 {
+		regions = []image.Rectangle{r.Frame.Bounds()}
+	}
+	var objects []ob.Object
+	for _, region := range regions {
+		objects = append(objects, ob.Object{ClassName: "person", X1: float32(region.Min.X), Y1: float32(region.Min.Y), X2: float32(region.Max.X), Y2: float32(region.Max.Y)})
+	}
+	return objects, d.latency, nil
+}
+
+func (d *fakeDetector) ModelSize() (int, int) {
+	return 320, 320
+}
+
+func TestCamerasShareOneDetector(t *testing.T) {
+	detector := &fakeDetector{latency: 10 * time.Millisecond, runs: map[int]int{}}
+	server := NewServer(detector, 1)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go server.Listen(ctx, l, "secret")
+
+	if _, err := Dial(l.Addr().String(), "wrong", "intruder"); err == nil {
+		t.Error("expected a wrong token to be refused")
+	}
+
+	// An idle camera in the process of the server and two busy remote ones, the detector manages ~100 inferences
+	// per second: the idle camera gets its 5 per second, the busy ones split the rest
+	local := server.Camera("local")
+	defer local.Close()
+	var remotes []*Remote
+	for _, name := range []string{"front", "back"} {
+		remote, err := Dial(l.Addr().String(), "secret", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer remote.Close()
+		if w, h := remote.ModelSize(); w != 320 || h != 320 || remote.Provider != server.Provider {
+			t.Errorf("expected the model size and provider of the detector, got %dx%d %q", w, h, remote.Provider)
+		}
+		remotes = append(remotes, remote)
+	}
+
+	cameras := []struct {
+		camera Camera
+		width  int
+		fps    float64
+	}{{local, 100, 5}, {remotes[0], 200, 200}, {remotes[1], 300, 200}}
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(2 * time.Second)
+	for _, c := range cameras {
+		wg.Add(1)
+		go func(camera Camera, frame *image.RGBA, fps float64) {
+			defer wg.Done()
+			for now := time.Now(); now.Before(deadline); now = time.Now() {
+				if !camera.Due(now, fps) {
+					time.Sleep(time.Millisecond)
+					continue
+				}
+				objects, took, err := camera.Detect(Request{Frame: frame})
+				if err != nil || len(objects) != 1 || objects[0].X2 != float32(frame.Bounds().Dx()) || took != 10*time.Millisecond {
+					t.Errorf("expected the box of the frame, got %v %v %v", objects, took, err)
+					return
+				}
+			}
+		}(c.camera, image.NewRGBA(image.Rect(0, 0, c.width, 10)), c.fps)
+	}
+	wg.Wait()
+
+	detector.mu.Lock()
+	idle, front, back := detector.runs[100], detector.runs[200], detector.runs[300]
+	detector.mu.Unlock()
+	if idle < 6 || idle > 12 {
+		t.Errorf("expected the idle camera to get its ~10 detections, got %d", idle)
+	}
+	if front < 50 || back < 50 || front > 2*back || back > 2*front {
+		t.Errorf("expected the busy cameras to split the rest evenly, got %d and %d", front, back)
+	}
+	if total := idle + front + back; total > 210 {
+		t.Errorf("expected no more than the detector manages in 2s, got %d", total)
+	}
+
+	objects, _, err := remotes[0].Detect(Request{Frame: image.NewRGBA(image.Rect(0, 0, 640, 480)), Regions: []image.Rectangle{image.Rect(10, 10, 50, 50), image.Rect(100, 100, 200, 200)}})
+	if err != nil || len(objects) != 2 || objects[1].X1 != 100 {
+		t.Errorf("expected a box per region, got %v %v", objects, err)
+	}
+
+	remotes[1].Close()
+	if _, _, err := remotes[1].Detect(Request{Frame: image.NewRGBA(image.Rect(0, 0, 1, 1))}); err == nil {
+		t.Error("expected a closed camera to fail")
+	}
+	stop()
+	if _, _, err := remotes[0].Detect(Request{Frame: image.NewRGBA(image.Rect(0, 0, 1, 1))}); err == nil || !remotes[0].Due(time.Now(), 1) {
+		t.Error("expected a camera of a stopped server to fail")
+	}
+}
@@ -0,0 +1,120 @@
+// Package streamWatchdog notices camera streams that stalled without ffmpeg exiting. An RTSP source that froze but
+// keeps the TCP connection open sends no more bytes, a decoder can stop producing frames while data still arrives,
+// and some cameras keep sending the same picture when their encoder hangs. The caller restarts the pipeline.
+package streamWatchdog
+
+import (
+	"fmt"
+	"hash/fnv"
+	"image"
+	"time"
+)
+
+const (
+	NoData   = "no_data"
+	NoFrames = "no_frames"
+	Frozen   = "frozen"
+)
+
+// Config sets the timeouts, zero values use the defaults and negative values disable a check
+type Config struct {
+	NoData   time.Duration // No bytes arrived for this long, defaults to 15s
+	NoFrames time.Duration // No frame was decoded for this long, defaults to 30s. Only checked once Frame was called.
+	Frozen   time.Duration // Every frame was identical for this long, defaults to 2m
+}
+
+// Stall is the error Check returns for a stalled stream
+type Stall struct {
+	Reason string // no_data, no_frames or frozen
+	For    time.Duration
+}
+
+func (s *Stall) Error() string {
+	switch s.Reason {
+	case NoData:
+		return fmt.Sprintf("no data for %s", s.For.Round(time.Second))
+	case NoFrames:
+		return fmt.Sprintf("no frames for %s", s.For.Round(time.Second))
+	default:
+		return fmt.Sprintf("identical frames for %s", s.For.Round(time.Second))
+	}
+}
+
+// Watchdog watches one run of a stream. It is not safe for concurrent use.
+type Watchdog struct {
+	Config Config
+
+	lastData    time.Time
+	lastFrame   time.Time
+	frames      bool // Frame was called, the stream is decoded
+	fingerprint uint64
+	changed     time.Time // Last frame that differed from the one before
+}
+
+// New starts watching at now, the timeouts also cover the start of the stream
+func New(cfg Config, now time.Time) *Watchdog {
+	if cfg.NoData == 0 {
+		cfg.NoData = 15 * time.Second
+	}
+	if cfg.NoFrames == 0 {
+		cfg.NoFrames = 30 * time.Second
+	}
+	if cfg.Frozen == 0 {
+		cfg.Frozen = 2 * time.Minute
+	}
+	return &Watchdog{Config: cfg, lastData: now, lastFrame: now, changed: now}
+}
+
+// Data records that bytes arrived at now
+func (w *Watchdog) Data(now time.Time) {
+	w.lastData = now
+}
+
+// Frame records a decoded frame at now
+func (w *Watchdog) Frame(img image.Image, now time.Time) {
+	fingerprint := Fingerprint(img)
+	if !w.frames || fingerprint != w.fingerprint {
+		w.changed = now
+	}
+	w.frames = true
+	w.fingerprint = fingerprint
+	w.lastFrame = now
+}
+
+// Check returns a *Stall when the stream stalled at now, nil otherwise
+func (w *Watchdog) Check(now time.Time) error {
+	if w.Config.NoData > 0 && now.Sub(w.lastData) >= w.Config.NoData {
+		return &Stall{Reason: NoData, For: now.Sub(w.lastData)}
+	}
+	if !w.frames {
+		return nil
+	}
+	if w.Config.NoFrames > 0 && now.Sub(w.lastFrame) >= w.Config.NoFrames {
+		return &Stall{Reason: NoFrames, For: now.Sub(w.lastFrame)}
+	}
+	if w.Config.Frozen > 0 && now.Sub(w.changed) >= w.Config.Frozen {
+		return &Stall{Reason: Frozen, For: now.Sub(w.changed)}
+	}
+	return nil
+}
+
+// Fingerprint hashes a grid of pixels of img. Sensor noise makes frames of a live camera differ even in a still
+// scene, so equal fingerprints in a row mean the picture itself stopped changing.
+func Fingerprint(img image.Image) uint64 {
+	const grid = 64
+	hash := fnv.New64a()
+	bounds := img.Bounds()
+	var pixel [8]byte
+	for gy := 0; gy < grid; gy++ {
+		y := bounds.Min.Y + gy*bounds.Dy()/grid
+		for gx := 0; gx < grid; gx++ {
+			x := bounds.Min.X + gx*bounds.Dx()/grid
+			r, g, b, _ := img.At(x, y).RGBA()
+			pixel[0], pixel[1] = byte(r>>8), byte(r)
+			pixel[2], pixel[3] = byte(g>>8), byte(g)
+			pixel[4], pixel[5] = byte(b>>8), byte(b)
+			hash.Write(pixel[:6])
+		}
+	}
+	return hash.Sum64()
+}
@@ -0,0 +1,82 @@
+package streamWatchdog
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+func frame(level uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 320, 240))
+	for i := range img.Pix {
+		img.Pix[i] = level + uint8(i%3)
+	}
+	return img
+}
+
+func reason(err error) string {
+	var stall *Stall
+	if errors.As(err, &stall) {
+		return stall.Reason
+	}
+	return ""
+}
+
+func TestNoData(t *testing.T) {
+	start := time.Unix(0, 0)
+	w := New(Config{NoData: 10 * time.Second}, start)
+
+	w.Data(start.Add(5 * time.Second))
+	if err := w.Check(start.Add(14 * time.Second)); err != nil {
+		t.Fatalf("expected no stall within the timeout, got %v", err)
+	}
+	if err := w.Check(start.Add(15 * time.Second)); reason(err) != NoData {
+		t.Errorf("expected no_data 10s after the last bytes, got %v", err)
+	}
+}
+
+func TestNoFramesOnlyOnceDecoding(t *testing.T) {
+	start := time.Unix(0, 0)
+	w := New(Config{NoData: -1, NoFrames: 10 * time.Second}, start)
+
+	if err := w.Check(start.Add(time.Minute)); err != nil {
+		t.Fatalf("expected a stream that is not decoded never to miss frames, got %v", err)
+	}
+	w.Frame(frame(10), start.Add(time.Minute))
+	if err := w.Check(start.Add(70 * time.Second)); reason(err) != NoFrames {
+		t.Errorf("expected no_frames 10s after the last frame, got %v", err)
+	}
+}
+
+func TestFrozen(t *testing.T) {
+	start := time.Unix(0, 0)
+	w := New(Config{NoData: -1, Frozen: 10 * time.Second}, start)
+
+	for s := 0; s <= 8; s++ {
+		w.Frame(frame(uint8(s)), start.Add(time.Duration(s)*time.Second))
+	}
+	for s := 9; s <= 17; s++ {
+		w.Frame(frame(8), start.Add(time.Duration(s)*time.Second))
+		if err := w.Check(start.Add(time.Duration(s) * time.Second)); err != nil {
+			t.Fatalf("expected identical frames to be fine for 10s, got %v at %ds", err, s)
+		}
+	}
+	w.Frame(frame(8), start.Add(18*time.Second))
+	err := w.Check(start.Add(18 * time.Second))
+	if reason(err) != Frozen || err.Error() != "identical frames for 10s" {
+		t.Errorf("expected frozen after 10s of identical frames, got %v", err)
+	}
+}
+
+func TestFingerprintSeesSmallChanges(t *testing.T) {
+	a, b := frame(50), frame(50)
+	if Fingerprint(a) != Fingerprint(b) {
+		t.Fatalf("expected equal frames to have equal fingerprints")
+	}
+	b.Set(0, 0, color.Gray{Y: 51})
+	if Fingerprint(a) == Fingerprint(b) {
+		t.Errorf("expected a changed sampled pixel to change the fingerprint")
+	}
+}
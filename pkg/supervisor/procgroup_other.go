@@ -0,0 +1,24 @@
+//go:build !unix
+
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Process groups are a unix thing, elsewhere only the child itself is killed
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killGroup(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
+
+// Terminate kills the process of cmd, there is no signal to ask it to shut down
+func Terminate(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
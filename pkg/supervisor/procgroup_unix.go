@@ -0,0 +1,22 @@
+//go:build unix
+
+package supervisor
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killGroup kills the process group led by pid
+func killGroup(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGKILL)
+}
+
+// Terminate asks the process of cmd to shut down
+func Terminate(cmd *exec.Cmd) error {
+	return cmd.Process.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,336 @@
+// Package supervisor runs the long lived child processes (the ffmpeg feeds, the embedded object detector) and
+// restarts them when they exit. Restarts back off exponentially with jitter, so a dead camera is not hammered and
+// several children that failed together don't restart in lockstep. The stderr of a run is kept in a ring buffer for
+// the exit report, every child runs in its own process group so the helpers it spawned are killed with it, and a
+// health probe restarts a child that still runs but stopped working.
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config of a supervisor, zero values take the defaults
+type Config struct {
+	MinBackoff    time.Duration                   // Delay of the first restart, defaults to 1s
+	MaxBackoff    time.Duration                   // The delay doubles per failed run up to this, defaults to 1m
+	Jitter        float64                         // Delays vary randomly by this fraction, defaults to 0.2
+	ResetAfter    time.Duration                   // A run that lasted this long resets the backoff, defaults to MaxBackoff
+	StderrLines   int                             // Lines of stderr kept per run, defaults to 50
+	PidFile       string                          // Process groups left behind by a previous instance are killed on Run, optional
+	Probe         func(ctx context.Context) error // Health probe, nil for none
+	ProbeInterval time.Duration                   // Defaults to 5s
+	ProbeFailures int                             // Consecutive probe failures that restart the child, defaults to 3
+	StartGrace    time.Duration                   // Probe failures don't count this long after a start, until the first success
+
+	// Up is called when the child became healthy, by Healthy or the probe, Down when a run ended after that or the
+	// first run failed. Either is called once per change, never while Run is stopping, and should return quickly.
+	Up   func()
+	Down func(Exit)
+}
+
+// Exit describes a run that ended
+type Exit struct {
+	Err     error         // Why the run ended, nil when it exited cleanly
+	Stderr  []string      // Last lines of stderr of the run
+	Uptime  time.Duration // How long the run lasted
+	Restart time.Duration // Delay until the next run
+}
+
+// Supervisor restarts a child until its context is cancelled, it is safe for concurrent use
+type Supervisor struct {
+	Config Config
+
+	mu       sync.Mutex
+	stderr   *ring
+	failures int  // Consecutive failed runs
+	healthy  bool // Up was reported, Down was not since
+	reported bool // Up or Down was reported at least once
+	pids     []int
+	restarts atomic.Int64
+}
+
+func New(cfg Config) *Supervisor {
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = time.Second
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(time.Minute, cfg.MinBackoff)
+	}
+	if cfg.Jitter <= 0 {
+		cfg.Jitter = 0.2
+	}
+	if cfg.ResetAfter <= 0 {
+		cfg.ResetAfter = cfg.MaxBackoff
+	}
+	if cfg.StderrLines <= 0 {
+		cfg.StderrLines = 50
+	}
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = 5 * time.Second
+	}
+	if cfg.ProbeFailures <= 0 {
+		cfg.ProbeFailures = 3
+	}
+	return &Supervisor{Config: cfg, stderr: newRing(cfg.StderrLines)}
+}
+
+// Command returns a command that runs in its own process group, is killed with its group once ctx is cancelled and
+// is not waited for longer than a few seconds after that. It is meant for one-shot children outside a supervisor.
+func Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		if err := killGroup(cmd.Process.Pid); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+	cmd.WaitDelay = 5 * time.Second
+	return cmd
+}
+
+// Command returns a command for the current run, pass the ctx given to the run function. Its stderr goes to the ring
+// buffer, set cmd.Stderr to something else to read it yourself.
+func (s *Supervisor) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := Command(ctx, name, args...)
+	cmd.Stderr = s.stderr
+	return cmd
+}
+
+// Started records the process group of a started command in the pid file
+func (s *Supervisor) Started(cmd *exec.Cmd) {
+	if s.Config.PidFile == "" || cmd.Process == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pids = append(s.pids, cmd.Process.Pid)
+	s.writePidFile()
+}
+
+// Healthy marks the child up, for children that tell it themselves (e.g. on the first frame) instead of a probe
+func (s *Supervisor) Healthy() {
+	s.mu.Lock()
+	report := !s.healthy
+	s.healthy, s.reported = true, true
+	s.mu.Unlock()
+
+	if report && s.Config.Up != nil {
+		s.Config.Up()
+	}
+}
+
+// Restarts is the number of runs that ended and were restarted
+func (s *Supervisor) Restarts() int64 {
+	return s.restarts.Load()
+}
+
+// Stderr returns the last lines of stderr of the current or last run
+func (s *Supervisor) Stderr() []string {
+	return s.stderr.Lines()
+}
+
+// Run calls run, which starts the processes of the child with Command and returns once they ended, until ctx is
+// cancelled. The ctx passed to run is cancelled when a run ends or the health probe fails, killing what is left.
+func (s *Supervisor) Run(ctx context.Context, run func(ctx context.Context) error) {
+	s.killStale()
+	defer s.removePidFile()
+
+	for ctx.Err() == nil {
+		runCtx, cancel := context.WithCancelCause(ctx)
+		s.stderr.Reset()
+		started := time.Now()
+
+		probeDone := make(chan struct{})
+		go func() {
+			defer close(probeDone)
+			s.probe(runCtx, cancel, started)
+		}()
+
+		err := run(runCtx)
+		if cause := context.Cause(runCtx); cause != nil && ctx.Err() == nil {
+			err = cause // The probe restarted the child
+		}
+		cancel(nil)
+		<-probeDone
+		if ctx.Err() != nil {
+			return
+		}
+
+		exit := Exit{Err: err, Stderr: s.stderr.Lines(), Uptime: time.Since(started)}
+		if exit.Uptime >= s.Config.ResetAfter {
+			s.failures = 0
+		}
+		exit.Restart = s.Backoff(s.failures)
+		s.failures++
+
+		s.mu.Lock()
+		report := s.healthy || !s.reported
+		s.healthy, s.reported = false, true
+		s.pids = nil
+		s.mu.Unlock()
+		if report && s.Config.Down != nil {
+			s.Config.Down(exit)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(exit.Restart):
+			s.restarts.Add(1)
+		}
+	}
+}
+
+// Backoff is the delay before the restart after failures consecutive failed runs
+func (s *Supervisor) Backoff(failures int) time.Duration {
+	delay := float64(s.Config.MinBackoff) * math.Pow(2, float64(failures))
+	delay = min(delay, float64(s.Config.MaxBackoff))
+	delay *= 1 + s.Config.Jitter*(2*rand.Float64()-1)
+	return time.Duration(delay)
+}
+
+// probe runs the health probe until ctx is done and cancels the run after too many failures in a row
+func (s *Supervisor) probe(ctx context.Context, cancel context.CancelCauseFunc, started time.Time) {
+	if s.Config.Probe == nil {
+		return
+	}
+	ticker := time.NewTicker(s.Config.ProbeInterval)
+	defer ticker.Stop()
+
+	failures, succeeded := 0, false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		probeCtx, cancelProbe := context.WithTimeout(ctx, s.Config.ProbeInterval)
+		err := s.Config.Probe(probeCtx)
+		cancelProbe()
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			failures, succeeded = 0, true
+			s.Healthy()
+			continue
+		}
+		if !succeeded && time.Since(started) < s.Config.StartGrace {
+			continue // Still starting up
+		}
+		if failures++; failures >= s.Config.ProbeFailures {
+			cancel(fmt.Errorf("health probe failed %d times: %w", failures, err))
+			return
+		}
+	}
+}
+
+// killStale kills the process groups recorded in the pid file by a previous instance that did not clean up
+func (s *Supervisor) killStale() {
+	if s.Config.PidFile == "" {
+		return
+	}
+	data, err := os.ReadFile(s.Config.PidFile)
+	if err != nil {
+		return
+	}
+	for _, field := range strings.Fields(string(data)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil || pid <= 1 {
+			continue
+		}
+		killGroup(pid)
+	}
+	os.Remove(s.Config.PidFile)
+}
+
+// writePidFile is called with mu held
+func (s *Supervisor) writePidFile() {
+	var pids []string
+	for _, pid := range s.pids {
+		pids = append(pids, strconv.Itoa(pid))
+	}
+	os.WriteFile(s.Config.PidFile, []byte(strings.Join(pids, "\n")), 0644)
+}
+
+func (s *Supervisor) removePidFile() {
+	if s.Config.PidFile != "" {
+		os.Remove(s.Config.PidFile)
+	}
+}
+
+// ring keeps the last lines written to it
+type ring struct {
+	mu      sync.Mutex
+	lines   []string
+	next    int
+	full    bool
+	partial []byte // Line without its newline yet
+}
+
+func newRing(size int) *ring {
+	return &ring{lines: make([]string, size)}
+}
+
+func (r *ring) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.partial = append(r.partial, p...)
+	for {
+		i := strings.IndexAny(string(r.partial), "\r\n") // ffmpeg ends progress lines with \r
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(r.partial[:i])); line != "" {
+			r.add(line)
+		}
+		r.partial = r.partial[i+1:]
+	}
+	if len(r.partial) > 4096 { // A line that never ends
+		r.add(string(r.partial))
+		r.partial = nil
+	}
+	return len(p), nil
+}
+
+func (r *ring) add(line string) {
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	r.full = r.full || r.next == 0
+}
+
+// Lines returns the kept lines oldest first, including an unterminated last line
+func (r *ring) Lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var lines []string
+	if r.full {
+		lines = append(lines, r.lines[r.next:]...)
+	}
+	lines = append(lines, r.lines[:r.next]...)
+	if line := strings.TrimSpace(string(r.partial)); line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (r *ring) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clear(r.lines)
+	r.next, r.full, r.partial = 0, false, nil
+}
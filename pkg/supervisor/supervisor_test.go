@@ -0,0 +1,173 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	s := New(Config{MinBackoff: time.Second, MaxBackoff: 10 * time.Second, Jitter: 0.1})
+
+	for failures, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		for i := 0; i < 20; i++ {
+			delay := s.Backoff(failures)
+			if delay < want*9/10 || delay > want*11/10 {
+				t.Fatalf("expected the delay after %d failures to be %v ±10%%, got %v", failures, want, delay)
+			}
+		}
+	}
+}
+
+func TestRingKeepsLastLines(t *testing.T) {
+	r := newRing(3)
+	fmt.Fprint(r, "one\ntwo\r\nthree\nfour\nfi")
+	fmt.Fprint(r, "ve")
+
+	got := strings.Join(r.Lines(), ",")
+	if got != "two,three,four,five" {
+		t.Errorf("expected the last 3 lines and the unterminated one, got %q", got)
+	}
+	r.Reset()
+	if len(r.Lines()) != 0 {
+		t.Errorf("expected no lines after a reset, got %v", r.Lines())
+	}
+}
+
+// events collects the hooks of a supervisor
+type events struct {
+	mu    sync.Mutex
+	calls []string
+	exits []Exit
+}
+
+func (e *events) config(cfg Config) Config {
+	cfg.Up = func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.calls = append(e.calls, "up")
+	}
+	cfg.Down = func(exit Exit) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.calls = append(e.calls, "down")
+		e.exits = append(e.exits, exit)
+	}
+	return cfg
+}
+
+func (e *events) get() ([]string, []Exit) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.calls...), append([]Exit(nil), e.exits...)
+}
+
+func TestRunRestartsAndReportsChanges(t *testing.T) {
+	e := &events{}
+	s := New(e.config(Config{MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := 0
+	s.Run(ctx, func(ctx context.Context) error {
+		runs++
+		switch runs {
+		case 1, 2: // Failing twice reports one down
+			return errors.New("failed")
+		case 3, 4: // Up, then down again
+			s.Healthy()
+			s.Healthy()
+			return errors.New("failed after coming up")
+		}
+		s.Healthy()
+		cancel()
+		return nil
+	})
+
+	calls, exits := e.get()
+	if got := strings.Join(calls, ","); got != "down,up,down,up,down,up" {
+		t.Errorf("expected one report per change, got %s", got)
+	}
+	if len(exits) == 0 || exits[0].Err == nil || exits[0].Err.Error() != "failed" {
+		t.Errorf("expected the exit to carry the error of the run, got %+v", exits)
+	}
+	if runs != 5 || s.Restarts() != 4 {
+		t.Errorf("expected the run to be restarted until cancelled, got %d runs and %d restarts", runs, s.Restarts())
+	}
+}
+
+func TestProbeRestartsHungChild(t *testing.T) {
+	e := &events{}
+	s := New(e.config(Config{
+		MinBackoff:    time.Millisecond,
+		ProbeInterval: 5 * time.Millisecond,
+		ProbeFailures: 2,
+		Probe:         func(ctx context.Context) error { return errors.New("not answering") },
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx, func(ctx context.Context) error {
+			<-ctx.Done() // Hangs until the probe gives up
+			cancel()
+			return ctx.Err()
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the probe to restart the hung child")
+	}
+}
+
+func TestProbeFailureReportsDown(t *testing.T) {
+	e := &events{}
+	healthy := true
+	var mu sync.Mutex
+	s := New(e.config(Config{
+		MinBackoff:    time.Hour,
+		ProbeInterval: 5 * time.Millisecond,
+		ProbeFailures: 2,
+		Probe: func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if !healthy {
+				return errors.New("not answering")
+			}
+			return nil
+		},
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx, func(ctx context.Context) error {
+		time.Sleep(30 * time.Millisecond)
+		mu.Lock()
+		healthy = false
+		mu.Unlock()
+		<-ctx.Done()
+		return nil
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if calls, exits := e.get(); len(calls) == 2 {
+			if calls[0] != "up" || calls[1] != "down" {
+				t.Fatalf("expected up then down, got %v", calls)
+			}
+			if exits[0].Err == nil || !strings.Contains(exits[0].Err.Error(), "health probe failed") {
+				t.Errorf("expected the probe failure as the reason, got %v", exits[0].Err)
+			}
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected the failing probe to report the child down")
+}
@@ -0,0 +1,63 @@
+//go:build unix
+
+package supervisor
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunKillsProcessGroup(t *testing.T) {
+	s := New(Config{StderrLines: 5})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var grandchild int
+	s.Run(ctx, func(runCtx context.Context) error {
+		defer cancel()
+		cmd := s.Command(runCtx, "sh", "-c", "sleep 30 & echo $!; echo starting >&2; wait")
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		line, err := bufio.NewReader(stdout).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		grandchild, _ = strconv.Atoi(strings.TrimSpace(line))
+		cancel() // Stopping the supervisor kills the shell and the sleep it started
+		return cmd.Wait()
+	})
+
+	if grandchild == 0 {
+		t.Fatalf("expected the shell to report its child")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for alive(grandchild) {
+		if time.Now().After(deadline) {
+			syscall.Kill(grandchild, syscall.SIGKILL)
+			t.Fatalf("expected the grandchild %d to be killed with the group", grandchild)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := strings.Join(s.Stderr(), ","); got != "starting" {
+		t.Errorf("expected stderr in the ring buffer, got %q", got)
+	}
+}
+
+// alive reports whether pid runs, a zombie waiting for init to reap it does not
+func alive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	return err != nil || !strings.Contains(string(stat), ") Z")
+}
@@ -0,0 +1,3 @@
+module github.com/8ff/onnxruntime_go
+
+go 1.21.0